@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Limits of the API response handling
+const (
+	defaultMaxResponseBytes = 32 << 20 // Default --max_response_bytes
+	errorBodyExcerpt        = 512      // Bytes of an error response kept in the error
+)
+
+// APIError is a failed GitHub API call, with the context needed to escalate it to GitHub support
+type APIError struct {
+	Method    string // HTTP method
+	Path      string // Request path relative to the API URL
+	Status    int    // Response status code
+	RequestID string // X-GitHub-Request-Id response header
+	Message   string // GitHub error message, or an excerpt of the response body
+	Err       error  // Underlying read or decoding error
+}
+
+func (e *APIError) Error() string {
+	var b strings.Builder
+	if e.Err != nil {
+		fmt.Fprintf(&b, "response API failed for %s %s", e.Method, e.Path)
+	} else {
+		fmt.Fprintf(&b, "response API status %d for %s %s", e.Status, e.Method, e.Path)
+	}
+	if e.RequestID != "" {
+		fmt.Fprintf(&b, " (request ID %s)", e.RequestID)
+	}
+	if e.Err != nil {
+		fmt.Fprintf(&b, ": %v", e.Err)
+	} else if e.Message != "" {
+		fmt.Fprintf(&b, ": %s", e.Message)
+	}
+	return b.String()
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// newAPIError describes a non-2xx response from its status, request ID and body
+func newAPIError(method, path string, resp *http.Response) *APIError {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, errorBodyExcerpt))
+	return &APIError{
+		Method:    method,
+		Path:      path,
+		Status:    resp.StatusCode,
+		RequestID: resp.Header.Get("X-GitHub-Request-Id"),
+		Message:   errorMessage(data),
+	}
+}
+
+// errorMessage extracts the message of a GitHub error payload, falling back to a body excerpt
+func errorMessage(data []byte) string {
+	var payload struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(data, &payload) == nil && payload.Message != "" {
+		return payload.Message
+	}
+	excerpt := strings.Join(strings.Fields(string(data)), " ")
+	if len(data) == errorBodyExcerpt {
+		excerpt += "..."
+	}
+	return excerpt
+}
+
+// decodeResponse stream-decodes a JSON response body of at most limit bytes into out
+func decodeResponse(method, path string, resp *http.Response, limit int64, out any) error {
+	body := http.MaxBytesReader(nil, resp.Body, limit)
+	err := json.NewDecoder(body).Decode(out)
+	if err == nil {
+		return nil
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		err = fmt.Errorf("response body exceeds %d bytes (see --max_response_bytes)", tooLarge.Limit)
+	} else {
+		err = fmt.Errorf("decoding failed: %w", err)
+	}
+	return &APIError{Method: method, Path: path, Status: resp.StatusCode, RequestID: resp.Header.Get("X-GitHub-Request-Id"), Err: err}
+}
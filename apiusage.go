@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// APIUsage accounts for the GitHub API calls of a run, so token budgets can be planned
+// across repositories sharing a rate limit
+type APIUsage struct {
+	mu            sync.Mutex
+	Calls         int            `json:"calls"`                    // Requests sent by the client
+	CacheHits     int            `json:"cache_hits"`               // GET requests answered from the ETag cache (304 responses)
+	Routes        map[string]int `json:"routes"`                   // Requests per "METHOD /route"
+	RateLimit     int            `json:"rate_limit,omitempty"`     // Hourly request quota of the token
+	RemainingFrom int            `json:"remaining_from,omitempty"` // Remaining quota reported by the first response
+	RemainingTo   int            `json:"remaining_to,omitempty"`   // Remaining quota reported by the last response
+	Enterprise    string         `json:"enterprise,omitempty"`     // Version of the GitHub Enterprise Server instance, empty on github.com
+	rateSeen      bool
+}
+
+// cacheHitRate is the share of GET requests answered from the ETag cache
+func (u *APIUsage) cacheHitRate() float64 {
+	gets := 0
+	for route, n := range u.Routes {
+		if strings.HasPrefix(route, "GET ") {
+			gets += n
+		}
+	}
+	if gets == 0 {
+		return 0
+	}
+	return float64(u.CacheHits) / float64(gets)
+}
+
+// routeNumber matches the numeric path segments collapsed in route names
+var routeNumber = regexp.MustCompile(`/\d+(/|$)`)
+
+// routeOf names a request by method and path, with IDs and query strings removed
+func routeOf(req *http.Request) string {
+	route := req.URL.Path
+	for routeNumber.MatchString(route) {
+		route = routeNumber.ReplaceAllString(route, "/{n}$1")
+	}
+	return req.Method + " " + route
+}
+
+// record accounts for a response. Rate limit headers are absent on fixtures and fakes,
+// and on GitHub Enterprise Server instances with rate limiting disabled.
+func (u *APIUsage) record(req *http.Request, resp *http.Response) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.Calls++
+	if u.Routes == nil {
+		u.Routes = make(map[string]int)
+	}
+	u.Routes[routeOf(req)]++
+	if resp == nil {
+		return
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		u.CacheHits++
+	}
+	if version := resp.Header.Get("X-GitHub-Enterprise-Version"); version != "" {
+		u.Enterprise = version
+	}
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	if !u.rateSeen {
+		u.RemainingFrom, u.rateSeen = remaining, true
+	}
+	u.RemainingTo = remaining
+	if limit, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit")); err == nil {
+		u.RateLimit = limit
+	}
+}
+
+// cachedResponse is a GET response body kept for conditional requests
+type cachedResponse struct {
+	etag   string
+	header http.Header
+	body   []byte
+}
+
+// meteredTransport counts API calls and serves repeated GET requests through ETag
+// conditional requests, which GitHub does not charge against the rate limit
+type meteredTransport struct {
+	next  http.RoundTripper
+	usage *APIUsage
+	limit int64 // Largest body kept in the cache
+
+	mu    sync.Mutex
+	cache map[string]cachedResponse
+}
+
+func newMeteredTransport(next http.RoundTripper, usage *APIUsage, limit int64) *meteredTransport {
+	return &meteredTransport{next: next, usage: usage, limit: limit, cache: make(map[string]cachedResponse)}
+}
+
+func (t *meteredTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := req.URL.String()
+	t.mu.Lock()
+	cached, ok := t.cache[key]
+	t.mu.Unlock()
+	if req.Method == http.MethodGet && ok {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	t.usage.record(req, resp)
+	if err != nil || req.Method != http.MethodGet {
+		return resp, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && ok {
+		resp.Body.Close()
+		return &http.Response{
+			Status:     "200 OK",
+			StatusCode: http.StatusOK,
+			Header:     cached.header,
+			Body:       io.NopCloser(bytes.NewReader(cached.body)),
+			Request:    req,
+		}, nil
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" && resp.StatusCode == http.StatusOK {
+		// A body over the limit is passed on truncated past it, so decoding reports the limit
+		body, err := io.ReadAll(io.LimitReader(resp.Body, t.limit+1))
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(body)) <= t.limit {
+			t.mu.Lock()
+			t.cache[key] = cachedResponse{etag: etag, header: resp.Header, body: body}
+			t.mu.Unlock()
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	return resp, nil
+}
+
+// usageReporter is implemented by clients accounting for their API calls
+type usageReporter interface {
+	Usage() *APIUsage
+}
+
+// apiUsageOf returns the API usage of a client, nil when it does not account for it
+func apiUsageOf(client GitHubClient) *APIUsage {
+	if r, ok := client.(usageReporter); ok {
+		return r.Usage()
+	}
+	return nil
+}
+
+// reportAPIUsage prints the API usage summary of the run and exposes it as outputs
+func reportAPIUsage(cfg Config, usage *APIUsage) {
+	if usage == nil {
+		return
+	}
+	usage.mu.Lock()
+	defer usage.mu.Unlock()
+
+	fmt.Printf("GitHub API: %d call(s), %d served from cache (%.0f%% of GETs)", usage.Calls, usage.CacheHits, 100*usage.cacheHitRate())
+	switch {
+	case usage.rateSeen:
+		fmt.Printf(", rate limit remaining %d -> %d of %d", usage.RemainingFrom, usage.RemainingTo, usage.RateLimit)
+	case usage.Enterprise != "":
+		fmt.Printf(", rate limiting disabled on GitHub Enterprise Server %s", usage.Enterprise)
+	}
+	fmt.Println()
+
+	routes := make([]string, 0, len(usage.Routes))
+	for route := range usage.Routes {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	for _, route := range routes {
+		fmt.Printf("  %4d  %s\n", usage.Routes[route], route)
+	}
+
+	setOutput(cfg, "api_calls", strconv.Itoa(usage.Calls))
+	setOutput(cfg, "api_cache_hits", strconv.Itoa(usage.CacheHits))
+	if usage.rateSeen {
+		setOutput(cfg, "api_rate_remaining", strconv.Itoa(usage.RemainingTo))
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenGrant describes the installation token minted for a run, recorded in its event log
+// so reviewers can check the bot never held more than it needed
+type TokenGrant struct {
+	AppID        int64             `json:"app_id"`                 // GitHub App the token acts as
+	Installation int64             `json:"installation_id"`        // Installation the token was minted for
+	Repositories []string          `json:"repositories,omitempty"` // Repositories the token is scoped to, empty for all of the installation
+	Permissions  map[string]string `json:"permissions"`            // Permissions granted, as reported by GitHub
+	ExpiresAt    time.Time         `json:"expires_at"`             // Token expiry
+}
+
+// describe renders the granted permissions as a single sorted line
+func (g *TokenGrant) describe() string {
+	var scopes []string
+	for _, name := range slices.Sorted(maps.Keys(g.Permissions)) {
+		scopes = append(scopes, name+":"+g.Permissions[name])
+	}
+	return strings.Join(scopes, ", ")
+}
+
+// tokenPermissions returns the minimal installation permissions the configured features
+// need. Pushing the target branch needs contents:write and reading the PRs
+// pull_requests:read; the other permissions follow the features using them.
+func tokenPermissions(cfg Config) map[string]string {
+	perms := map[string]string{
+		"metadata":      "read",
+		"contents":      "write",
+		"pull_requests": "read",
+	}
+	// Comments and labels on PRs go through the issues API, which PR write access covers
+	if cfg.CompareComment || cfg.ConventionalTitles || cfg.ConflictPartners || cfg.PreviewBranches || cfg.BatchPR ||
+		cfg.MembershipLabel != "" || cfg.UpdateBranches == updateBranchAPI {
+		perms["pull_requests"] = "write"
+	}
+	if cfg.TrackingIssue > 0 || cfg.ApprovalIssue > 0 || cfg.IncidentIssues {
+		perms["issues"] = "write"
+	}
+	if cfg.PromoteFrom != "" || cfg.RiskScores {
+		perms["checks"] = "read"
+	}
+	if cfg.Project != "" {
+		perms["organization_projects"] = "write"
+	}
+	if cfg.ProtectTarget {
+		perms["administration"] = "write"
+	}
+	return perms
+}
+
+// mustMintAppToken enforces minting the installation token of the run when App auth is configured
+func mustMintAppToken(cfg Config) (Config, *TokenGrant) {
+	if cfg.AppID == 0 {
+		return cfg, nil
+	}
+	cfg, grant, err := mintAppToken(cfg)
+	if err != nil {
+		log.Fatal("error minting GitHub App token:", err)
+	}
+	return cfg, grant
+}
+
+// mintAppToken mints an installation token of the GitHub App replacing github_token for the run.
+// Org and repos mode tokens are read-only and unscoped, every repository batch mints its own.
+func mintAppToken(cfg Config) (Config, *TokenGrant, error) {
+	key, err := loadAppKey(cfg.AppPrivateKey)
+	if err != nil {
+		return cfg, nil, err
+	}
+	grant, token, err := requestInstallationToken(cfg, key)
+	if err != nil {
+		return cfg, nil, err
+	}
+	cfg.GithubToken = token
+	if !multiRepoRun(cfg) {
+		reauthenticateOrigin(token)
+	}
+	installationToken = &appToken{cfg: cfg, key: key, token: token, expires: grant.ExpiresAt}
+	fmt.Printf("Minted GitHub App installation token (%s), expires %s.\n", grant.describe(), grant.ExpiresAt.Format(time.RFC3339))
+	return cfg, grant, nil
+}
+
+// multiRepoRun reports whether the run batches several repositories, each in its own
+// clone and bot process, rather than the repository checked out
+func multiRepoRun(cfg Config) bool {
+	return cfg.Org != "" || len(cfg.Repos) > 0
+}
+
+// requestInstallationToken mints an installation token of the GitHub App with the scope
+// of the run
+func requestInstallationToken(cfg Config, key *rsa.PrivateKey) (*TokenGrant, string, error) {
+	jwt, err := appJWT(cfg.AppID, key, time.Now())
+	if err != nil {
+		return nil, "", err
+	}
+
+	request := struct {
+		Repositories []string          `json:"repositories,omitempty"`
+		Permissions  map[string]string `json:"permissions"`
+	}{Permissions: map[string]string{"metadata": "read", "contents": "read"}}
+	if !multiRepoRun(cfg) {
+		request.Repositories = []string{cfg.Repo}
+		request.Permissions = tokenPermissions(cfg)
+	}
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, "", fmt.Errorf("request encoding failed: %w", err)
+	}
+
+	path := fmt.Sprintf("/app/installations/%d/access_tokens", cfg.AppInstallationID)
+	req, err := http.NewRequest("POST", cfg.APIURL+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("request creation failed: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := (&http.Client{Timeout: 15 * time.Second}).Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("request API failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return nil, "", newAPIError("POST", path, resp)
+	}
+	var minted struct {
+		Token        string            `json:"token"`
+		ExpiresAt    time.Time         `json:"expires_at"`
+		Permissions  map[string]string `json:"permissions"`
+		Repositories []struct {
+			Name string `json:"name"`
+		} `json:"repositories"`
+	}
+	if err := decodeResponse("POST", path, resp, cfg.MaxResponseBytes, &minted); err != nil {
+		return nil, "", err
+	}
+	if minted.Token == "" {
+		return nil, "", fmt.Errorf("POST %s returned no token", path)
+	}
+
+	grant := &TokenGrant{
+		AppID:        cfg.AppID,
+		Installation: cfg.AppInstallationID,
+		Permissions:  minted.Permissions,
+		ExpiresAt:    minted.ExpiresAt,
+	}
+	for _, r := range minted.Repositories {
+		grant.Repositories = append(grant.Repositories, r.Name)
+	}
+	return grant, minted.Token, nil
+}
+
+// appTokenRefreshMargin is how long before its expiry the installation token is reminted,
+// so no API call or push goes out with an expired token
+const appTokenRefreshMargin = 5 * time.Minute
+
+// installationToken is the installation token of the run with App auth, nil otherwise
+var installationToken *appToken
+
+// appToken is an installation token reminted when it nears its expiry
+type appToken struct {
+	mu      sync.Mutex
+	cfg     Config
+	key     *rsa.PrivateKey
+	token   string
+	expires time.Time
+}
+
+// current returns the token, reminted first when it expires within the refresh margin.
+// A failed refresh keeps the token, the calls fail once it is expired.
+func (t *appToken) current() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.expires.IsZero() || time.Until(t.expires) > appTokenRefreshMargin {
+		return t.token
+	}
+	grant, token, err := requestInstallationToken(t.cfg, t.key)
+	if err != nil {
+		slog.Warn("failed to refresh the GitHub App installation token", "error", err)
+		return t.token
+	}
+	t.token, t.expires = token, grant.ExpiresAt
+	if !multiRepoRun(t.cfg) {
+		reauthenticateOrigin(token)
+	}
+	fmt.Printf("Refreshed GitHub App installation token, expires %s.\n", grant.ExpiresAt.Format(time.RFC3339))
+	return token
+}
+
+// currentToken returns the token of the run: with App auth the installation token, reminted
+// when it nears its expiry, as cfg.GithubToken keeps the first one
+func currentToken(cfg Config) string {
+	if cfg.AppID != 0 && installationToken != nil {
+		return installationToken.current()
+	}
+	return cfg.GithubToken
+}
+
+// originAuthArgs returns the git options authenticating a fetch or push with the
+// installation token, reminted first when it nears its expiry, none without App auth. The
+// header replaces the one actions/checkout sets for the web URL, as GitHub rejects two.
+func originAuthArgs() []string {
+	if installationToken == nil {
+		return nil
+	}
+	token := installationToken.current()
+	key := "http." + installationToken.cfg.WebURL + "/.extraheader"
+	header := "AUTHORIZATION: basic " + base64.StdEncoding.EncodeToString([]byte("x-access-token:"+token))
+	return []string{"-c", key + "=", "-c", key + "=" + header}
+}
+
+// reauthenticateOrigin swaps the token of an origin URL carrying one, as in the clones of
+// org mode, for the scoped token: the read-only token of the org run cannot push
+func reauthenticateOrigin(token string) {
+	output, err := exec.Command("git", "remote", "get-url", "origin").Output()
+	if err != nil {
+		return
+	}
+	raw := strings.TrimSpace(string(output))
+	if u, err := url.Parse(raw); err != nil || u.User == nil || u.User.Username() != "x-access-token" {
+		return
+	}
+	// The URL holds the token, so it is kept out of the error
+	if err := exec.Command("git", "remote", "set-url", "origin", authenticatedURL(raw, token)).Run(); err != nil {
+		slog.Warn("failed to set the app token on the origin remote", "error", err)
+	}
+}
+
+// loadAppKey reads the PEM encoded RSA private key of the GitHub App, in the PKCS#1 form
+// GitHub generates or PKCS#8, from its file or from the PEM block itself, as passed
+// through MERGEBOT_APP_PRIVATE_KEY by CI secrets. The key never appears in the errors.
+func loadAppKey(source string) (*rsa.PrivateKey, error) {
+	path, data := source, []byte(source)
+	if strings.HasPrefix(strings.TrimSpace(source), "-----BEGIN") {
+		path = "(PEM block)"
+	} else {
+		var err error
+		if data, err = os.ReadFile(source); err != nil {
+			return nil, fmt.Errorf("read app private key failed: %w", err)
+		}
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("app private key '%s' is not PEM encoded", path)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse app private key '%s' failed: %w", path, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("app private key '%s' is not an RSA key", path)
+	}
+	return key, nil
+}
+
+// appJWT signs the short-lived RS256 JWT authenticating as the GitHub App. It is issued a
+// minute in the past to tolerate clock drift and expires well within GitHub's 10 minutes.
+func appJWT(appID int64, key *rsa.PrivateKey, now time.Time) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": strconv.FormatInt(appID, 10),
+	})
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("sign app JWT failed: %w", err)
+	}
+	return unsigned + "." + enc.EncodeToString(signature), nil
+}
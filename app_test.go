@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/josedpiambav/feature/mergebottest"
+)
+
+func TestRepoTargetsWithAppAuth(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	repo := mergebottest.NewRepo(t, "main")
+	srv := mergebottest.NewServer()
+	defer srv.Close()
+	srv.AddInstallation(mergebottest.Installation{
+		ID:           7,
+		AppID:        42,
+		Key:          &key.PublicKey,
+		Permissions:  map[string]string{"metadata": "read", "contents": "write", "pull_requests": "write", "issues": "write"},
+		Repositories: []string{"r"},
+	})
+	srv.AddRepository(mergebottest.Repository{Owner: "o", Name: "r", CloneURL: repo.Origin})
+	repo.PullRequest(1, "feat: one", map[string]string{"one.txt": "one\n"})
+	srv.AddPR(mergebottest.PR{Number: 1, Title: "feat: one", Base: "main", Author: "alice", Labels: []string{"ready"}})
+
+	dir := repo.Clone()
+	cmd := exec.Command(os.Args[0], "--app_id", "42", "--app_installation_id", "7", "--app_private_key", string(pemKey),
+		"--repos", "o/r", "--labels", "ready", "--state_dir", t.TempDir(), "--github_output", filepath.Join(t.TempDir(), "github_output"))
+	cmd.Dir = dir
+	cmd.Env = append(repo.Env(), botEnv+"=1", "GITHUB_API_URL="+srv.URL, "GITHUB_WORKSPACE="+dir)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+	if got := repo.Show("pre-main:one.txt"); got != "one\n" {
+		t.Errorf("pre-main one.txt = %q", got)
+	}
+
+	var scopes []string
+	for _, r := range srv.Requests() {
+		if r.Method != "POST" || !strings.HasSuffix(r.Path, "/access_tokens") {
+			continue
+		}
+		var body struct {
+			Repositories []string          `json:"repositories"`
+			Permissions  map[string]string `json:"permissions"`
+		}
+		if err := json.Unmarshal([]byte(r.Body), &body); err != nil {
+			t.Fatal(err)
+		}
+		scopes = append(scopes, strings.Join(body.Repositories, ",")+" contents:"+body.Permissions["contents"])
+	}
+	// The parent lists the repositories with a read-only token, the batch of o/r mints its own
+	if len(scopes) < 2 || scopes[0] != " contents:read" || scopes[1] != "r contents:write" {
+		t.Errorf("minted token scopes = %q, want an unscoped read-only one, then one for r", scopes)
+	}
+}
+
+func TestOriginAuthArgs(t *testing.T) {
+	if args := originAuthArgs(); args != nil {
+		t.Fatalf("auth args without App auth = %q", args)
+	}
+	installationToken = &appToken{cfg: Config{WebURL: "https://github.example.com"}, token: "ghs_secret"}
+	t.Cleanup(func() { installationToken = nil })
+
+	header := "AUTHORIZATION: basic " + base64.StdEncoding.EncodeToString([]byte("x-access-token:ghs_secret"))
+	want := []string{"-c", "http.https://github.example.com/.extraheader=", "-c", "http.https://github.example.com/.extraheader=" + header}
+	if got := originAuthArgs(); !slices.Equal(got, want) {
+		t.Errorf("auth args = %q, want %q", got, want)
+	}
+
+	t.Chdir(t.TempDir())
+	err := runOriginGit("fetch", "origin", "main")
+	if err == nil {
+		t.Fatal("fetch outside a repository succeeded")
+	}
+	if strings.Contains(err.Error(), header) || strings.Contains(err.Error(), "extraheader") {
+		t.Errorf("error leaks the credential: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Constants for approval-gated publishing
+const (
+	planRefPrefix        = "refs/feature-branching/plans/"       // Remote refs holding built, unpublished plans
+	approvalMarker       = "<!-- feature-branching:approval -->" // Identifies plan comments awaiting approval
+	approvalPollInterval = 10 * time.Second                      // Delay between approval comment checks
+)
+
+// approverAssociations lists the commenter roles allowed to approve a plan
+var approverAssociations = []string{"OWNER", "MEMBER", "COLLABORATOR"}
+
+// pushPlan publishes the built branch as a plan ref instead of the target branch,
+// so a second invocation with --publish_plan can force-push it once approved
+func pushPlan(cfg Config) (string, error) {
+	head, err := revParse("HEAD")
+	if err != nil {
+		return "", fmt.Errorf("resolve plan head failed: %w", err)
+	}
+	id := shortSHA(head)
+	if len(head) >= 12 {
+		id = head[:12]
+	}
+	if err := runOriginGit("push", "--force", "origin", "HEAD:"+planRefPrefix+id); err != nil {
+		return "", fmt.Errorf("push plan failed: %w", err)
+	}
+	return id, nil
+}
+
+// publishPlan force-pushes a previously built plan to the target branch and drops the plan ref
+func publishPlan(cfg Config) error {
+	ref := planRefPrefix + cfg.PublishPlan
+	if err := runOriginGit("fetch", "origin", "+"+ref+":"+ref); err != nil {
+		return fmt.Errorf("fetch plan '%s' failed: %w", cfg.PublishPlan, err)
+	}
+
+	// A plan built on an older trunk would drop the newer trunk commits from the target
+	if err := runOriginGit("fetch", "origin", cfg.TrunkBranch); err == nil && !isAncestor("origin/"+cfg.TrunkBranch, ref) {
+		slog.Warn("plan is not based on the current trunk", "plan", cfg.PublishPlan, "branch", cfg.TrunkBranch)
+	}
+
+	if err := runOriginGit("push", "--force", "origin", ref+":refs/heads/"+cfg.TargetBranch); err != nil {
+		return fmt.Errorf("push failed: %w", err)
+	}
+	if err := runOriginGit("push", "origin", "--delete", ref); err != nil {
+		slog.Warn("failed to delete plan ref", "error", err)
+	}
+	return nil
+}
+
+// awaitApproval comments the plan on the approval issue and blocks until a maintainer
+// replies /publish (approved) or /cancel (rejected), or the approval timeout expires
+func awaitApproval(client GitHubClient, cfg Config, merged []MergeRecord) error {
+	body, err := renderText(cfg, "approval_request", approvalRequestData{
+		Trunk:   cfg.TrunkBranch,
+		Target:  cfg.TargetBranch,
+		BatchID: cfg.BatchID,
+		Merged:  merged,
+		Timeout: cfg.ApprovalTimeout,
+	})
+	if err != nil {
+		return fmt.Errorf("build plan comment failed: %w", err)
+	}
+	if err := client.CreateIssueComment(cfg.ApprovalIssue, approvalMarker+"\n"+body); err != nil {
+		return fmt.Errorf("comment plan failed: %w", err)
+	}
+	comments, err := client.ListIssueComments(cfg.ApprovalIssue)
+	if err != nil {
+		return fmt.Errorf("list comments failed: %w", err)
+	}
+	var planID int64
+	for _, c := range comments {
+		if strings.Contains(c.Body, approvalMarker) {
+			planID = max(planID, c.ID)
+		}
+	}
+
+	fmt.Printf("Waiting for approval on issue #%d...", cfg.ApprovalIssue)
+	deadline := time.Now().Add(cfg.ApprovalTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(approvalPollInterval)
+		comments, err := client.ListIssueComments(cfg.ApprovalIssue)
+		if err != nil {
+			slog.Warn("failed to check approval comments", "error", err)
+			continue
+		}
+		for _, c := range comments {
+			if c.ID <= planID || !slices.Contains(approverAssociations, c.AuthorAssociation) {
+				continue
+			}
+			switch strings.TrimSpace(c.Body) {
+			case "/publish":
+				fmt.Println(" approved.")
+				return nil
+			case "/cancel":
+				fmt.Println(" cancelled.")
+				return errors.New("publish cancelled on the approval issue")
+			}
+		}
+	}
+	fmt.Println(" timed out.")
+	return fmt.Errorf("no approval within %s", cfg.ApprovalTimeout)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+)
+
+// auditFinding is a discrepancy between a published candidate and its ref history
+type auditFinding struct {
+	Commit string // Commit the finding is about, empty for the branch as a whole
+	Detail string
+}
+
+// runAudit implements the 'audit' subcommand: it checks that a published candidate is
+// exactly what the bot built from its ref history, so hand edits after the run are
+// caught. The branch must sit on the recorded trunk base, every first-parent commit must
+// reproduce the merge of its recorded PR heads or be a bookkeeping commit of the batch,
+// and signatures must verify.
+func runAudit(args []string) {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	trunk := fs.String("trunk_branch", "main", "Base branch name")
+	branch := fs.String("branch", "", "Candidate branch to audit (defaults to pre-<trunk_branch>)")
+	ignorePaths := fs.String("ignore_paths", "", "Comma-separated --ignore_paths of the runs, whose PR changes the candidate leaves out")
+	versionFile := fs.String("version_file", "", "--version_file of the runs, which bookkeeping commits may change")
+	requireSignatures := fs.Bool("require_signatures", false, "Report unsigned commits; signed commits are always verified")
+	allowedSigners := fs.String("allowed_signers", "", "SSH allowed signers file verifying SSH signatures (gpg.ssh.allowedSignersFile)")
+	fs.Parse(args)
+
+	if *branch == "" {
+		*branch = fmt.Sprintf("pre-%s", *trunk)
+	}
+	ignored := parseLabels(*ignorePaths)
+	if err := validatePathPatterns(ignored); err != nil {
+		log.Fatal("invalid configuration:", fmt.Errorf("invalid parameter 'ignore_paths': %w", err))
+	}
+	features := mustDetectGit(Config{})
+	if !features.MergeTree {
+		log.Fatal("invalid configuration:", fmt.Errorf("subcommand 'audit' requires 'git merge-tree --write-tree' (git %s)", features.Version))
+	}
+
+	if err := runOriginGit("fetch", "origin", *trunk, *branch); err != nil {
+		slog.Warn("failed to fetch branches, using local refs", "error", err)
+	}
+	a := candidateAudit{
+		trunkRef:       branchRef(*trunk),
+		targetRef:      branchRef(*branch),
+		ignored:        ignored,
+		bookkeeping:    []string{refHistoryFile, blameIgnoreRevsFile},
+		signatures:     *requireSignatures,
+		allowedSigners: *allowedSigners,
+	}
+	if *versionFile != "" {
+		a.bookkeeping = append(a.bookkeeping, *versionFile)
+	}
+	findings, err := a.run()
+	if err != nil {
+		log.Fatal("error auditing candidate:", err)
+	}
+
+	if len(findings) == 0 {
+		fmt.Printf("Audit of '%s' passed: %d commit(s) match the ref history of batch %s.\n", *branch, a.commits, a.batchID)
+		return
+	}
+	fmt.Printf("Audit of '%s' found %d discrepancy(ies) with its ref history:\n", *branch, len(findings))
+	for _, f := range findings {
+		if f.Commit != "" {
+			fmt.Printf("  %s  %s\n", shortSHA(f.Commit), f.Detail)
+		} else {
+			fmt.Printf("  %s\n", f.Detail)
+		}
+	}
+	os.Exit(1)
+}
+
+// candidateAudit holds the parameters and the progress of an audit
+type candidateAudit struct {
+	trunkRef, targetRef string   // Refs of trunk and of the audited candidate
+	ignored             []string // --ignore_paths patterns, left out of the PR changes
+	bookkeeping         []string // Files the bookkeeping commits of the bot may change
+	signatures          bool     // Whether unsigned commits are findings
+	allowedSigners      string   // SSH allowed signers file, empty for the Git config
+
+	batchID string // Batch of the audited history
+	commits int    // First-parent commits audited
+}
+
+// run audits the candidate against the ref history at its tip
+func (a *candidateAudit) run() ([]auditFinding, error) {
+	var findings []auditFinding
+	tip, err := revParse(a.targetRef)
+	if err != nil {
+		return nil, fmt.Errorf("read candidate failed: %w", err)
+	}
+	history, err := loadRefHistoryAt(tip)
+	if err != nil {
+		return nil, err
+	}
+	a.batchID = history.BatchID
+
+	// Trunk base
+	var base string
+	if history.Stamp != nil {
+		base = history.Stamp.Trunk
+		if runGitCommand("merge-base", "--is-ancestor", base, a.trunkRef) != nil {
+			findings = append(findings, auditFinding{Commit: base, Detail: fmt.Sprintf("recorded trunk base is not part of '%s'", a.trunkRef)})
+		}
+	} else {
+		findings = append(findings, auditFinding{Detail: "ref history has no build stamp, the trunk base cannot be verified"})
+		output, err := runGitCommandWithOutput("merge-base", tip, a.trunkRef)
+		if err != nil {
+			return nil, fmt.Errorf("find trunk base failed: %w", err)
+		}
+		base = strings.TrimSpace(output)
+	}
+	if runGitCommand("merge-base", "--is-ancestor", base, tip) != nil {
+		return append(findings, auditFinding{Commit: tip, Detail: fmt.Sprintf("candidate is not built on the recorded trunk base %s", shortSHA(base))}), nil
+	}
+	output, err := runGitCommandWithOutput("rev-list", "--first-parent", "--reverse", base+".."+tip)
+	if err != nil {
+		return nil, fmt.Errorf("list candidate commits failed: %w", err)
+	}
+	commits := strings.Fields(output)
+	a.commits = len(commits)
+
+	// Commits of the PRs, in single commit mode the records carry no commit and the
+	// first commit of the batch squashes every PR
+	heads := make(map[string][]MergeRecord)
+	single := len(history.Merges) > 0 && !slices.ContainsFunc(history.Merges, func(m MergeRecord) bool { return m.Commit != "" })
+	for _, m := range history.Merges {
+		if single && len(commits) > 0 {
+			m.Commit = commits[0]
+		}
+		if m.Commit == "" || !slices.Contains(commits, m.Commit) {
+			findings = append(findings, auditFinding{Commit: m.Commit, Detail: fmt.Sprintf("commit of PR #%d is not on the first-parent history of the candidate", m.PR)})
+			continue
+		}
+		heads[m.Commit] = append(heads[m.Commit], m)
+	}
+
+	parent := base
+	for _, c := range commits {
+		if first, err := revParse(c + "^1"); err != nil || first != parent {
+			findings = append(findings, auditFinding{Commit: c, Detail: fmt.Sprintf("first parent is not %s", shortSHA(parent))})
+		}
+		if history.BatchID != "" && !hasBatchTrailer(c, history.BatchID) {
+			findings = append(findings, auditFinding{Commit: c, Detail: fmt.Sprintf("commit does not carry the '%s: %s' trailer", batchIDTrailer, history.BatchID)})
+		}
+		var detail string
+		if merges, ok := heads[c]; ok {
+			detail, err = a.checkPRCommit(parent, c, merges)
+		} else {
+			detail, err = a.checkBookkeepingCommit(parent, c)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if detail != "" {
+			findings = append(findings, auditFinding{Commit: c, Detail: detail})
+		}
+		if detail = a.checkSignature(c); detail != "" {
+			findings = append(findings, auditFinding{Commit: c, Detail: detail})
+		}
+		parent = c
+	}
+	return findings, nil
+}
+
+// checkPRCommit merges the recorded heads of the PRs of a commit onto its first parent in
+// memory and compares the result with the commit, outside of the ignored paths and the
+// bookkeeping files
+func (a *candidateAudit) checkPRCommit(parent, commit string, merges []MergeRecord) (string, error) {
+	expected := parent
+	var prs []string
+	for _, m := range merges {
+		prs = append(prs, fmt.Sprintf("#%d", m.PR))
+		if m.Head == "" {
+			return fmt.Sprintf("PR #%d has no recorded head, its content cannot be verified", m.PR), nil
+		}
+		if err := ensureCommit(m.Head); err != nil {
+			runOriginGit("fetch", "origin", fmt.Sprintf("pull/%d/head", m.PR))
+			if err = ensureCommit(m.Head); err != nil {
+				return fmt.Sprintf("recorded head %s of PR #%d is unreachable", shortSHA(m.Head), m.PR), nil
+			}
+		}
+		merged, conflicts, err := mergeInMemory(expected, m.Head)
+		if err != nil {
+			return "", fmt.Errorf("merge PR #%d failed: %w", m.PR, err)
+		}
+		if len(conflicts) > 0 {
+			return fmt.Sprintf("recorded head %s of PR #%d does not merge cleanly, the commit cannot be reproduced", shortSHA(m.Head), m.PR), nil
+		}
+		expected = merged
+	}
+	files, err := changedFiles(expected, commit)
+	if err != nil {
+		return "", err
+	}
+	files = slices.DeleteFunc(files, func(f string) bool {
+		return matchesAnyPath(f, a.ignored) || slices.Contains(a.bookkeeping, f)
+	})
+	if len(files) > 0 {
+		return fmt.Sprintf("content differs from the merge of PR(s) %s: %s", strings.Join(prs, ", "), strings.Join(files, ", ")), nil
+	}
+	return "", nil
+}
+
+// checkBookkeepingCommit accepts a commit no PR is recorded for when it only changes the
+// files of the bot
+func (a *candidateAudit) checkBookkeepingCommit(parent, commit string) (string, error) {
+	files, err := changedFiles(parent, commit)
+	if err != nil {
+		return "", err
+	}
+	files = slices.DeleteFunc(files, func(f string) bool { return slices.Contains(a.bookkeeping, f) })
+	if len(files) > 0 {
+		return "extra commit changing " + strings.Join(files, ", "), nil
+	}
+	return "", nil
+}
+
+// checkSignature verifies the signature of a signed commit, and reports an unsigned one
+// when signatures are required
+func (a *candidateAudit) checkSignature(commit string) string {
+	raw, err := runGitCommandWithOutput("cat-file", "commit", commit)
+	if err != nil {
+		return fmt.Sprintf("read commit failed: %v", err)
+	}
+	header, _, _ := strings.Cut(raw, "\n\n")
+	if !strings.Contains(header, "\ngpgsig") {
+		if a.signatures {
+			return "commit is not signed"
+		}
+		return ""
+	}
+	args := []string{"verify-commit", commit}
+	if a.allowedSigners != "" {
+		args = append([]string{"-c", "gpg.ssh.allowedSignersFile=" + a.allowedSigners}, args...)
+	}
+	if _, err := runGitCommandWithOutput(args...); err != nil {
+		return "signature does not verify"
+	}
+	return ""
+}
+
+// changedFiles lists the files that differ between two commits
+func changedFiles(from, to string) ([]string, error) {
+	output, err := runGitCommandWithOutput("diff", "--name-only", "--no-renames", from, to)
+	if err != nil {
+		return nil, fmt.Errorf("diff %s..%s failed: %w", shortSHA(from), shortSHA(to), err)
+	}
+	return slices.DeleteFunc(strings.Split(output, "\n"), func(f string) bool { return f == "" }), nil
+}
+
+// hasBatchTrailer reports whether a commit message ends with the trailer of a batch
+func hasBatchTrailer(commit, batchID string) bool {
+	output, err := runGitCommandWithOutput("log", "-1", "--format=%(trailers:key="+batchIDTrailer+",valueonly)", commit)
+	if err != nil {
+		return false
+	}
+	return slices.Contains(strings.Fields(output), batchID)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/josedpiambav/feature/trailers"
+)
+
+// batchIDTrailer is the commit trailer carrying the batch ID
+const batchIDTrailer = trailers.BatchID
+
+// crockfordAlphabet is the ULID base32 alphabet
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newBatchID generates a ULID: 48 bits of millisecond timestamp followed by 80 random bits,
+// encoded as 26 Crockford base32 characters that sort by creation time
+func newBatchID() string {
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[:8], uint64(time.Now().UnixMilli())<<16)
+	rand.Read(id[6:])
+
+	var b strings.Builder
+	hi, lo := binary.BigEndian.Uint64(id[:8]), binary.BigEndian.Uint64(id[8:])
+	for i := 25; i >= 0; i-- {
+		// Extract 5 bits at position i*5 of the 130-bit big-endian value (2 leading zero bits)
+		shift := uint(i * 5)
+		var v uint64
+		switch {
+		case shift >= 64:
+			v = hi >> (shift - 64)
+		case shift > 59:
+			v = lo>>shift | hi<<(64-shift)
+		default:
+			v = lo >> shift
+		}
+		b.WriteByte(crockfordAlphabet[v&0x1f])
+	}
+	return b.String()
+}
+
+// prCommitMessage builds the message of a commit of the bot, ending with the trailers of
+// the run metadata: the batch, the PRs the commit merges, none for bookkeeping commits,
+// and the bot version
+func prCommitMessage(cfg Config, subject string, sources ...trailers.Source) string {
+	if cfg.BatchID == "" {
+		return subject
+	}
+	m := trailers.Metadata{BatchID: cfg.BatchID, Sources: sources, Version: botVersion()}
+	return subject + "\n\n" + strings.Join(m.Lines(), "\n")
+}
+
+// prSource returns the trailer source of a PR, with the revision merged
+func prSource(pr GitHubPR) trailers.Source {
+	head := pr.SHA
+	if head == "" {
+		head, _ = revParse(fmt.Sprintf("pr-%d", pr.Number))
+	}
+	return trailers.Source{PR: pr.Number, HeadSHA: head}
+}
+
+// botVersion returns the module version of the binary, or the VCS revision it was
+// built from for development builds
+func botVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "devel"
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" && len(s.Value) >= 12 {
+			return "devel+" + s.Value[:12]
+		}
+	}
+	return "devel"
+}
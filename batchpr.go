@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// batchPRMarker identifies the batch PR among the open PRs into trunk
+const batchPRMarker = "<!-- feature-branching:batch-pr -->"
+
+// findBatchPR returns the open batch PR of the target branch, 0 when there is none
+func findBatchPR(client GitHubClient, cfg Config) (int, error) {
+	prs, err := client.ListOpenPRs(cfg.TrunkBranch)
+	if err != nil {
+		return 0, err
+	}
+	for _, pr := range prs {
+		if pr.HeadRef == cfg.TargetBranch && strings.Contains(pr.Body, batchPRMarker) {
+			return pr.Number, nil
+		}
+	}
+	return 0, nil
+}
+
+// publishBatchPR opens, or updates, the draft PR from the target branch into trunk whose
+// description lists the batch, so reviewers get the diff, checks and comments of the PR
+// UI on the candidate. Draft PRs cannot be merged, and the eligibility filters never
+// batch a PR of the target branch. The PR is closed when the run publishes no batch.
+// Errors are logged as warnings since the branch has already been pushed.
+func publishBatchPR(client GitHubClient, cfg Config, prs []GitHubPR, merged []MergeRecord, diff *DiffSummary) {
+	number, err := findBatchPR(client, cfg)
+	if err != nil {
+		slog.Warn("failed to look up the batch PR", "error", err)
+		return
+	}
+	if len(merged) == 0 {
+		if number == 0 {
+			return
+		}
+		if err := client.CloseIssue(number); err != nil {
+			slog.Warn("failed to close batch PR", "pr_number", number, "error", err)
+			return
+		}
+		fmt.Printf("Batch PR #%d closed, the batch is empty.\n", number)
+		return
+	}
+
+	data := batchPRData{
+		Owner:   cfg.Owner,
+		Repo:    cfg.Repo,
+		Trunk:   cfg.TrunkBranch,
+		Target:  cfg.TargetBranch,
+		BatchID: cfg.BatchID,
+	}
+	if data.Head, err = revParse(cfg.TargetBranch); err != nil {
+		slog.Warn("failed to build batch PR", "error", err)
+		return
+	}
+	byNumber := make(map[int]GitHubPR, len(prs))
+	for _, pr := range prs {
+		byNumber[pr.Number] = pr
+	}
+	for _, m := range merged {
+		pr := byNumber[m.PR]
+		data.PRs = append(data.PRs, batchPREntry{Number: m.PR, Title: pr.Title, Author: pr.Author, Commit: m.Commit})
+	}
+	if diff != nil {
+		data.Diff = diff.markdown()
+	}
+	title, err := renderText(cfg, "batch_pr_title", data)
+	var body string
+	if err == nil {
+		body, err = renderText(cfg, "batch_pr_body", data)
+	}
+	if err != nil {
+		slog.Warn("failed to build batch PR", "error", err)
+		return
+	}
+
+	body = batchPRMarker + "\n" + body
+	if number > 0 {
+		if err := client.UpdatePR(number, title, body); err != nil {
+			slog.Warn("failed to update batch PR", "pr_number", number, "error", err)
+			return
+		}
+		fmt.Printf("Batch PR #%d updated with %d PR(s).\n", number, len(merged))
+		return
+	}
+	if number, err = client.CreatePR(title, cfg.TargetBranch, cfg.TrunkBranch, body, true); err != nil {
+		slog.Warn("failed to open batch PR", "error", err)
+		return
+	}
+	fmt.Printf("Batch PR #%d opened as a draft with %d PR(s).\n", number, len(merged))
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// Policies for merge conflicts on binary files
+const (
+	binaryConflictFail   = "fail"   // Report the conflict and abort the batch
+	binaryConflictOurs   = "ours"   // Keep the target branch version
+	binaryConflictTheirs = "theirs" // Take the PR version
+	binaryConflictSkip   = "skip"   // Leave the PR out of the batch and continue
+)
+
+// ErrBinaryConflict signals a PR skipped by the 'skip' binary conflict policy
+var ErrBinaryConflict = errors.New("binary files conflicted")
+
+// binaryProbeSize is how much of a blob is scanned for NUL bytes, like git's own heuristic
+const binaryProbeSize = 8000
+
+// applyBinaryConflictPolicy handles the binary files among the conflicts of the pending merge
+// per --binary_conflicts. It returns the conflicts left for the usual conflict handling
+// and the binary files among them.
+func applyBinaryConflictPolicy(cfg Config, files []string) ([]string, []string, error) {
+	var text, binary []string
+	for _, f := range files {
+		if isBinaryConflict(f) {
+			binary = append(binary, f)
+		} else {
+			text = append(text, f)
+		}
+	}
+	if len(binary) == 0 {
+		return files, nil, nil
+	}
+
+	switch cfg.BinaryConflicts {
+	case binaryConflictOurs, binaryConflictTheirs:
+		for _, f := range binary {
+			if err := resolveConflictSide(f, cfg.BinaryConflicts); err != nil {
+				return files, binary, err
+			}
+		}
+		return text, nil, nil
+	case binaryConflictSkip:
+		return files, binary, fmt.Errorf("%w: %s", ErrBinaryConflict, strings.Join(binary, ", "))
+	default:
+		return files, binary, nil
+	}
+}
+
+// conflictError applies the binary conflict policy to the conflicts of the pending merge
+// and describes the conflicts left, or returns nil when the policy resolved all of them
+func conflictError(cfg Config, files []string, gitOutput string) error {
+	remaining, binary, err := applyBinaryConflictPolicy(cfg, files)
+	if err != nil || len(remaining) == 0 {
+		return err
+	}
+	hunks := make(map[string][]string, len(remaining))
+	for _, f := range remaining {
+		if !slices.Contains(binary, f) {
+			hunks[f] = conflictHunks(f)
+		}
+	}
+	return &ConflictError{Files: remaining, GitOutput: gitOutput, Hunks: hunks, Binary: binary}
+}
+
+// isBinaryConflict reports whether a conflicting file is binary, either by its
+// gitattributes or because one of its conflict stages contains a NUL byte
+func isBinaryConflict(file string) bool {
+	if attr, err := runGitCommandWithOutput("check-attr", "binary", "--", file); err == nil &&
+		strings.HasSuffix(strings.TrimSpace(attr), ": set") {
+		return true
+	}
+	for _, blob := range conflictStages(file) {
+		content, err := exec.Command("git", "cat-file", "blob", blob).Output()
+		if err != nil {
+			continue
+		}
+		if bytes.IndexByte(content[:min(len(content), binaryProbeSize)], 0) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// conflictStages returns the blob of every index stage of a conflicting file, keyed by stage
+func conflictStages(file string) map[string]string {
+	stages := make(map[string]string)
+	output, err := runGitCommandWithOutput("ls-files", "--unmerged", "--", file)
+	if err != nil {
+		return stages
+	}
+	// Format per line: "<mode> <sha> <stage>\t<filename>"
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		meta, _, _ := strings.Cut(line, "\t")
+		if fields := strings.Fields(meta); len(fields) == 3 {
+			stages[fields[2]] = fields[1]
+		}
+	}
+	return stages
+}
+
+// resolveConflictSide resolves a conflicting file with one side of the merge,
+// deleting it when that side removed the file
+func resolveConflictSide(file, side string) error {
+	stage := "2"
+	if side == binaryConflictTheirs {
+		stage = "3"
+	}
+	if _, ok := conflictStages(file)[stage]; !ok {
+		if err := runGitCommand("rm", "--quiet", "--", file); err != nil {
+			return fmt.Errorf("resolve '%s' with %s failed: %w", file, side, err)
+		}
+		return nil
+	}
+	if err := runGitCommand("checkout", "--"+side, "--", file); err != nil {
+		return fmt.Errorf("resolve '%s' with %s failed: %w", file, side, err)
+	}
+	if err := runGitCommand("add", "--", file); err != nil {
+		return fmt.Errorf("stage '%s' failed: %w", file, err)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// runBisectMap maps a bad commit of the target branch back to the PR that introduced it,
+// optionally finding the commit with 'git bisect run' and rebuilding the candidate without that PR
+func runBisectMap(args []string) {
+	fs := flag.NewFlagSet("bisect-map", flag.ExitOnError)
+	trunk := fs.String("trunk_branch", "main", "Base branch name")
+	target := fs.String("target_branch", "", "Target branch name (defaults to pre-<trunk_branch>)")
+	commit := fs.String("commit", "", "Bad commit of the target branch")
+	run := fs.String("run", "", "Test command passed to 'git bisect run' to find the bad commit between trunk and target")
+	rebuild := fs.Bool("rebuild", false, "Rebuild the candidate without the offending PR into a local branch")
+	fs.Parse(args)
+
+	if *target == "" {
+		*target = fmt.Sprintf("pre-%s", *trunk)
+	}
+	if (*commit == "") == (*run == "") {
+		log.Fatal("invalid configuration:", fmt.Errorf("exactly one of 'commit' or 'run' is required"))
+	}
+	mustDetectGit(Config{})
+
+	if err := runOriginGit("fetch", "origin", *trunk, *target); err != nil {
+		slog.Warn("failed to fetch branches, using local refs", "error", err)
+	}
+	trunkRef, targetRef := branchRef(*trunk), branchRef(*target)
+
+	history, err := loadRefHistoryAt(targetRef)
+	if err != nil {
+		log.Fatal("error loading history:", err)
+	}
+
+	bad := *commit
+	if *run != "" {
+		if bad, err = bisectRun(trunkRef, targetRef, *run); err != nil {
+			log.Fatal("error bisecting:", err)
+		}
+		fmt.Printf("First bad commit: %s\n", shortSHA(bad))
+	}
+
+	culprits, err := introducingPRs(history, trunkRef, bad)
+	if err != nil {
+		log.Fatal("error mapping commit:", err)
+	}
+	if len(culprits) == 0 {
+		fmt.Printf("Commit %s is already part of '%s'; no PR of the batch introduced it.\n", shortSHA(bad), *trunk)
+		return
+	}
+	for _, m := range culprits {
+		fmt.Printf("Commit %s was introduced by PR #%d (batch commit %s).\n", shortSHA(bad), m.PR, shortSHA(m.Commit))
+	}
+
+	if *rebuild {
+		branch := fmt.Sprintf("bisect/%s-without-pr-%d", *target, culprits[0].PR)
+		if err := rebuildWithout(history, trunkRef, branch, culprits); err != nil {
+			log.Fatal("error rebuilding candidate:", err)
+		}
+		fmt.Printf("Rebuilt candidate without the offending PR(s) into local branch '%s'.\n", branch)
+	}
+}
+
+// branchRef prefers the remote-tracking ref of a branch, falling back to the local one
+func branchRef(branch string) string {
+	if _, err := revParse("refs/remotes/origin/" + branch); err == nil {
+		return "origin/" + branch
+	}
+	return branch
+}
+
+// loadRefHistoryAt reads the merge history stored on a ref
+func loadRefHistoryAt(ref string) (RefHistory, error) {
+	output, err := runGitCommandWithOutput("show", ref+":"+refHistoryFile)
+	if err != nil {
+		return RefHistory{}, fmt.Errorf("read history failed: %w", err)
+	}
+	return decodeRefHistory([]byte(output))
+}
+
+// bisectRun bisects the first-parent history between trunk and target with the test command
+// and returns the first bad commit. The bisect session is always reset afterwards.
+func bisectRun(trunkRef, targetRef, command string) (string, error) {
+	args := []string{"bisect", "start", "--first-parent", targetRef, trunkRef}
+	if features, err := detectGitFeatures(); err == nil && !features.BisectFirstParent {
+		// Older git also walks into merge commits of the merge commit mode
+		slog.Warn("git does not support 'bisect --first-parent', bisecting all commits", "git_version", features.Version)
+		args = slices.Delete(args, 2, 3)
+	}
+	if err := runGitCommand(args...); err != nil {
+		return "", fmt.Errorf("bisect start failed: %w", err)
+	}
+	defer runGitCommand("bisect", "reset")
+
+	if err := runGitCommand("bisect", "run", "sh", "-c", command); err != nil {
+		return "", fmt.Errorf("bisect run failed: %w", err)
+	}
+	return revParse("refs/bisect/bad")
+}
+
+// introducingPRs returns the merge records of the PR that introduced commit.
+// Records are in merge order, so the first batch commit containing it is the culprit;
+// in single commit mode every PR of the batch shares that commit.
+// An empty result means the commit already belongs to trunk.
+func introducingPRs(history RefHistory, trunkRef, commit string) ([]MergeRecord, error) {
+	if isAncestor(commit, trunkRef) {
+		return nil, nil
+	}
+	for _, m := range history.Merges {
+		if m.Commit == "" || !isAncestor(commit, m.Commit) {
+			continue
+		}
+		var culprits []MergeRecord
+		for _, other := range history.Merges {
+			if other.Commit == m.Commit {
+				culprits = append(culprits, other)
+			}
+		}
+		return culprits, nil
+	}
+	return nil, errors.New("commit is not part of any merged PR (bot commit or unknown commit)")
+}
+
+// isAncestor reports whether commit is an ancestor of, or equal to, ref
+func isAncestor(commit, ref string) bool {
+	return runGitCommand("merge-base", "--is-ancestor", commit, ref) == nil
+}
+
+// rebuildWithout squashes every recorded PR except the excluded ones onto trunk in a local branch
+func rebuildWithout(history RefHistory, trunkRef, branch string, excluded []MergeRecord) error {
+	skip := make(map[int]struct{}, len(excluded))
+	for _, m := range excluded {
+		skip[m.PR] = struct{}{}
+	}
+
+	if err := runGitCommand("checkout", "-B", branch, trunkRef); err != nil {
+		return fmt.Errorf("create branch failed: %w", err)
+	}
+	for _, m := range history.Merges {
+		if _, ok := skip[m.PR]; ok {
+			continue
+		}
+		pr := GitHubPR{Number: m.PR, Title: fmt.Sprintf("PR #%d", m.PR)}
+		if subject, err := runGitCommandWithOutput("log", "-1", "--format=%s", m.Commit); err == nil && m.Commit != "" {
+			pr.Title = strings.TrimSpace(subject)
+		}
+		fmt.Printf("  #%d \"%s\" ... ", pr.Number, pr.Title)
+		if err := processSinglePR(pr, Config{CommitMode: commitModePerPR}); err != nil && !errors.Is(err, ErrEmptyMerge) {
+			fmt.Println("FAILED")
+			runGitCommand("reset", "--hard", "HEAD")
+			return fmt.Errorf("PR #%d could not be merged: %w", pr.Number, err)
+		}
+		fmt.Println("OK")
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// blameIgnoreRevsFile lists commits skipped by 'git blame' (see blame.ignoreRevsFile)
+const blameIgnoreRevsFile = ".git-blame-ignore-revs"
+
+// mustUpdateBlameIgnoreRevs enforces the blame ignore list update
+func mustUpdateBlameIgnoreRevs(cfg Config) {
+	if err := updateBlameIgnoreRevs(cfg); err != nil {
+		log.Fatal("error updating blame ignore revs:", err)
+	}
+}
+
+// updateBlameIgnoreRevs appends the bot bookkeeping commits of the batch to the
+// blame ignore list inherited from trunk, so blame on the candidate points at PR commits.
+// The list is committed separately since a commit cannot reference its own SHA.
+func updateBlameIgnoreRevs(cfg Config) error {
+	// Only the history commits touch the history file, whatever their message template
+	output, err := runGitCommandWithOutput("log", "--format=%H", cfg.TrunkBranch+"..HEAD", "--", refHistoryFile)
+	if err != nil {
+		return fmt.Errorf("list bot commits failed: %w", err)
+	}
+	revs := strings.Fields(output)
+	if len(revs) == 0 {
+		return nil
+	}
+
+	existing, err := os.ReadFile(blameIgnoreRevsFile)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("file read failed: %w", err)
+	}
+
+	var b strings.Builder
+	b.Write(existing)
+	if len(existing) > 0 && !strings.HasSuffix(string(existing), "\n") {
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "# feature-branching bookkeeping commits on %s\n", cfg.TargetBranch)
+	for _, rev := range revs {
+		if !strings.Contains(string(existing), rev) {
+			b.WriteString(rev + "\n")
+		}
+	}
+
+	if err := os.WriteFile(blameIgnoreRevsFile, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("file write failed: %w", err)
+	}
+	if err := runGitCommand("add", blameIgnoreRevsFile); err != nil {
+		return fmt.Errorf("staging blame ignore revs failed: %w", err)
+	}
+	return runGitCommand("commit", "-m", prCommitMessage(cfg, "chore: update "+blameIgnoreRevsFile))
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Constants for the bucket storages
+const (
+	bucketTimeout    = 30 * time.Second // Timeout of a bucket request
+	s3DefaultRegion  = "us-east-1"      // Region of S3 buckets unless AWS_REGION is set
+	gcsDefaultURL    = "https://storage.googleapis.com"
+	gcsMetadataToken = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// bucketClient is the HTTP client of the bucket storages
+var bucketClient = &http.Client{Timeout: bucketTimeout}
+
+// bucketKey joins the prefix of a bucket storage and a key into an object name
+func bucketKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "/" + key
+}
+
+// bucketError describes a failed bucket request from its status and body
+func bucketError(method, object string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, errorBodyExcerpt))
+	err := fmt.Errorf("%s %s: status %d: %s", method, object, resp.StatusCode, strings.TrimSpace(string(body)))
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w (%w)", err, os.ErrNotExist)
+	}
+	return err
+}
+
+// s3Storage keeps the state as objects of an S3 bucket, or of an S3 compatible store when
+// AWS_ENDPOINT_URL is set. Requests are signed with the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN credentials of the environment.
+type s3Storage struct {
+	bucket   string // Bucket name
+	prefix   string // Object name prefix, without trailing slash
+	region   string // Bucket region
+	endpoint string // Custom endpoint addressing the bucket in the path, empty for AWS
+}
+
+// newS3Storage sets up the S3 storage from the environment
+func newS3Storage(bucket, prefix string) (Storage, error) {
+	if os.Getenv("AWS_ACCESS_KEY_ID") == "" || os.Getenv("AWS_SECRET_ACCESS_KEY") == "" {
+		return nil, fmt.Errorf("'s3://%s': S3 storage needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY", bucket)
+	}
+	s := s3Storage{bucket: bucket, prefix: prefix, region: os.Getenv("AWS_REGION"), endpoint: os.Getenv("AWS_ENDPOINT_URL")}
+	if s.region == "" {
+		s.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if s.region == "" {
+		s.region = s3DefaultRegion
+	}
+	s.endpoint = strings.TrimSuffix(s.endpoint, "/")
+	return s, nil
+}
+
+// awsEscape escapes a path segment as SigV4 canonical requests expect: everything but the
+// unreserved characters
+func awsEscape(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// do sends a request on an object, signed with AWS Signature Version 4
+func (s s3Storage) do(method, key string, body []byte) (*http.Response, error) {
+	segments := strings.Split(bucketKey(s.prefix, key), "/")
+	for i, seg := range segments {
+		segments[i] = awsEscape(seg)
+	}
+	objectPath := "/" + strings.Join(segments, "/")
+	host := fmt.Sprintf("%s.s3.%s.amazonaws.com", s.bucket, s.region)
+	base := "https://" + host
+	if s.endpoint != "" {
+		objectPath = "/" + awsEscape(s.bucket) + objectPath
+		base = s.endpoint
+	}
+	req, err := http.NewRequest(method, base+objectPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("request creation failed: %w", err)
+	}
+
+	now := time.Now().UTC()
+	payload := sha256.Sum256(body)
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": hex.EncodeToString(payload[:]),
+		"x-amz-date":           now.Format("20060102T150405Z"),
+	}
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		headers["x-amz-security-token"] = token
+	}
+	for name, value := range headers {
+		if name != "host" {
+			req.Header.Set(name, value)
+		}
+	}
+	req.Header.Set("Authorization", sigV4Authorization(method, objectPath, headers, headers["x-amz-content-sha256"],
+		s.region, "s3", os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), now))
+	req.Header.Set("User-Agent", userAgent)
+	return bucketClient.Do(req)
+}
+
+// sigV4Authorization computes the AWS Signature Version 4 Authorization header of a
+// request without query string, signing all of the given lowercase headers
+func sigV4Authorization(method, uri string, headers map[string]string, payloadHash, region, service, keyID, secret string, now time.Time) string {
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonical strings.Builder
+	fmt.Fprintf(&canonical, "%s\n%s\n\n", method, uri)
+	for _, name := range names {
+		fmt.Fprintf(&canonical, "%s:%s\n", name, strings.TrimSpace(headers[name]))
+	}
+	signed := strings.Join(names, ";")
+	fmt.Fprintf(&canonical, "\n%s\n%s", signed, payloadHash)
+
+	date := now.Format("20060102")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	digest := sha256.Sum256([]byte(canonical.String()))
+	toSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + scope + "\n" + hex.EncodeToString(digest[:])
+	key := []byte("AWS4" + secret)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	return fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		keyID, scope, signed, hex.EncodeToString(hmacSHA256(key, toSign)))
+}
+
+func (s s3Storage) Load(key string) ([]byte, error) {
+	resp, err := s.do("GET", key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, bucketError("GET", s.String()+"/"+key, resp)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (s s3Storage) Save(key string, data []byte) error {
+	resp, err := s.do("PUT", key, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return bucketError("PUT", s.String()+"/"+key, resp)
+	}
+	return nil
+}
+
+func (s s3Storage) String() string {
+	return "s3://" + bucketKey(s.bucket, s.prefix)
+}
+
+// gcsStorage keeps the state as objects of a Google Cloud Storage bucket, through the JSON
+// API at STORAGE_EMULATOR_HOST when set. Requests carry GOOGLE_OAUTH_ACCESS_TOKEN, or else
+// the token of the service account of the metadata server on Google Cloud.
+type gcsStorage struct {
+	bucket string // Bucket name
+	prefix string // Object name prefix, without trailing slash
+}
+
+// token returns the OAuth access token of the requests
+func (s gcsStorage) token() (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+	req, err := http.NewRequest("GET", gcsMetadataToken, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := bucketClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("GCS storage needs GOOGLE_OAUTH_ACCESS_TOKEN outside of Google Cloud: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", bucketError("GET", "metadata token", resp)
+	}
+	var grant struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&grant); err != nil {
+		return "", fmt.Errorf("metadata token decoding failed: %w", err)
+	}
+	return grant.AccessToken, nil
+}
+
+// do sends an authenticated request to the JSON API
+func (s gcsStorage) do(method, endpoint string, body []byte) (*http.Response, error) {
+	token, err := s.token()
+	if err != nil {
+		return nil, err
+	}
+	base := gcsDefaultURL
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		base = strings.TrimSuffix(host, "/")
+		if !strings.Contains(base, "://") {
+			base = "http://" + base
+		}
+	}
+	req, err := http.NewRequest(method, base+endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("request creation failed: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("User-Agent", userAgent)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	return bucketClient.Do(req)
+}
+
+func (s gcsStorage) Load(key string) ([]byte, error) {
+	object := bucketKey(s.prefix, key)
+	resp, err := s.do("GET", fmt.Sprintf("/storage/v1/b/%s/o/%s?alt=media", url.PathEscape(s.bucket), url.PathEscape(object)), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, bucketError("GET", s.String()+"/"+key, resp)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (s gcsStorage) Save(key string, data []byte) error {
+	object := bucketKey(s.prefix, key)
+	resp, err := s.do("POST", fmt.Sprintf("/upload/storage/v1/b/%s/o?uploadType=media&name=%s", url.PathEscape(s.bucket), url.QueryEscape(object)), data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return bucketError("POST", s.String()+"/"+key, resp)
+	}
+	return nil
+}
+
+func (s gcsStorage) String() string {
+	return "gs://" + bucketKey(s.bucket, s.prefix)
+}
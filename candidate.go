@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// candidateBranchData is the data available to the --target_template
+type candidateBranchData struct {
+	Trunk   string // Trunk branch name
+	Target  string // Moving target branch name
+	Date    string // UTC run date, YYYYMMDD
+	Time    string // UTC run time, HHMMSS
+	BatchID string // Run ID
+}
+
+// renderCandidateBranch renders the permanent branch name of the batch from the target template
+func renderCandidateBranch(cfg Config, now time.Time) (string, error) {
+	// label "deploy" is the value of the deploy/<value> required label
+	funcs := template.FuncMap{"label": func(namespace string) (string, error) { return requiredLabelValue(cfg, namespace) }}
+	tmpl, err := template.New("target_template").Option("missingkey=error").Funcs(funcs).Parse(cfg.TargetTemplate)
+	if err != nil {
+		return "", err
+	}
+	now = now.UTC()
+	data := candidateBranchData{
+		Trunk:   cfg.TrunkBranch,
+		Target:  cfg.TargetBranch,
+		Date:    now.Format("20060102"),
+		Time:    now.Format("150405"),
+		BatchID: cfg.BatchID,
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	name := strings.TrimSpace(b.String())
+	if err := validateBranchName(name); err != nil {
+		return "", fmt.Errorf("rendered name '%s': %w", name, err)
+	}
+	if name == cfg.TargetBranch || name == cfg.TrunkBranch {
+		return "", fmt.Errorf("rendered name '%s' must differ from the trunk and target branches", name)
+	}
+	return name, nil
+}
+
+// validateBranchName rejects names git refuses as branches (see git-check-ref-format)
+func validateBranchName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("empty branch name")
+	case strings.ContainsAny(name, " ~^:?*[\\\t\n") || strings.Contains(name, "..") || strings.Contains(name, "@{"):
+		return fmt.Errorf("invalid character sequence")
+	case strings.HasPrefix(name, "-") || strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") ||
+		strings.HasSuffix(name, ".") || strings.HasSuffix(name, ".lock") || strings.Contains(name, "//"):
+		return fmt.Errorf("invalid branch name")
+	}
+	return nil
+}
+
+// publishCandidateBranch pushes the batch under its permanent name next to the moving target
+// branch. The push is not forced, so an existing candidate is never rewritten.
+// Errors are logged as warnings since the target branch has already been published.
+func publishCandidateBranch(cfg Config) {
+	fmt.Printf("Pushing permanent candidate '%s'...", cfg.CandidateBranch)
+	if err := runOriginGit("push", "origin", cfg.TargetBranch+":refs/heads/"+cfg.CandidateBranch); err != nil {
+		fmt.Println(" FAILED")
+		slog.Warn("failed to push candidate branch (it may already exist)", "branch", cfg.CandidateBranch, "error", err)
+		return
+	}
+	fmt.Println(" done.")
+	setOutput(cfg, "candidate_branch", cfg.CandidateBranch)
+}
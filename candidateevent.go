@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Constants of the candidate ready event
+const (
+	candidateEventType       = "feature-branching.candidate.ready" // CloudEvents type
+	candidateSignatureHeader = "X-Feature-Branching-Signature-256" // HTTP header carrying the event signature
+	candidateSignatureAttr   = "signature"                         // SQS and Pub/Sub message attribute carrying the event signature
+	candidateSinkSQS         = "sqs:"                              // Sink prefix of SQS queue URLs
+	candidateSinkPubSub      = "pubsub:"                           // Sink prefix of Pub/Sub topics
+	pubSubAPIURL             = "https://pubsub.googleapis.com"     // Pub/Sub API, unless PUBSUB_EMULATOR_HOST is set
+)
+
+// cloudEvent is a CloudEvents 1.0 event in structured JSON mode
+type cloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	Data            any       `json:"data"`
+}
+
+// candidateEventData is the data of a candidate ready event
+type candidateEventData struct {
+	Repository      string             `json:"repository"`                 // owner/repo
+	Branch          string             `json:"branch"`                     // Published target branch
+	SHA             string             `json:"sha"`                        // Pushed target commit
+	Trunk           string             `json:"trunk"`                      // Base branch of the batch
+	CandidateBranch string             `json:"candidate_branch,omitempty"` // Permanent branch of the batch
+	BatchID         string             `json:"batch_id"`                   // Run ID
+	PRs             []candidateEventPR `json:"prs"`                        // Merged PRs in merge order
+}
+
+// candidateEventPR is a merged PR of a candidate ready event
+type candidateEventPR struct {
+	Number int    `json:"number"`           // PR number
+	Title  string `json:"title"`            // PR title
+	Head   string `json:"head,omitempty"`   // PR revision merged
+	Commit string `json:"commit,omitempty"` // Resulting commit, empty in single commit mode
+}
+
+// newCandidateEvent describes the published candidate. The ID is stable for a batch and
+// target, so consumers can drop redelivered events.
+func newCandidateEvent(cfg Config, candidate string, prs []GitHubPR, merged []MergeRecord) cloudEvent {
+	titles := make(map[int]string, len(prs))
+	for _, pr := range prs {
+		titles[pr.Number] = pr.Title
+	}
+	data := candidateEventData{
+		Repository:      cfg.Owner + "/" + cfg.Repo,
+		Branch:          cfg.TargetBranch,
+		SHA:             candidate,
+		Trunk:           cfg.TrunkBranch,
+		CandidateBranch: cfg.CandidateBranch,
+		BatchID:         cfg.BatchID,
+		PRs:             make([]candidateEventPR, 0, len(merged)),
+	}
+	for _, m := range merged {
+		data.PRs = append(data.PRs, candidateEventPR{Number: m.PR, Title: titles[m.PR], Head: m.Head, Commit: m.Commit})
+	}
+	return cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              cfg.BatchID + "/" + cfg.TargetBranch,
+		Source:          cfg.WebURL + "/" + cfg.Owner + "/" + cfg.Repo,
+		Type:            candidateEventType,
+		Subject:         cfg.TargetBranch,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data:            data,
+	}
+}
+
+// signEvent returns the "sha256=<hex>" HMAC of a serialized event, as GitHub signs webhooks
+func signEvent(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// publishCandidateEvent sends the signed candidate ready event to every configured sink,
+// so deployment systems can subscribe instead of polling the target branch.
+// Errors are logged as warnings since the branch has already been pushed.
+func publishCandidateEvent(cfg Config, candidate string, prs []GitHubPR, merged []MergeRecord) {
+	if len(cfg.EventSinks) == 0 {
+		return
+	}
+	payload, err := json.Marshal(newCandidateEvent(cfg, candidate, prs, merged))
+	if err != nil {
+		slog.Warn("failed to encode candidate event", "error", err)
+		return
+	}
+	signature := signEvent(cfg.EventSecret, payload)
+	client := &http.Client{Timeout: 15 * time.Second}
+
+	sent := 0
+	for _, sink := range cfg.EventSinks {
+		var err error
+		switch {
+		case strings.HasPrefix(sink, candidateSinkSQS):
+			err = sendSQSEvent(client, strings.TrimPrefix(sink, candidateSinkSQS), payload, signature)
+		case strings.HasPrefix(sink, candidateSinkPubSub):
+			err = sendPubSubEvent(client, strings.TrimPrefix(sink, candidateSinkPubSub), payload, signature)
+		default:
+			err = sendHTTPEvent(client, sink, payload, signature)
+		}
+		if err != nil {
+			slog.Warn("failed to send candidate event", "sink", redactSink(sink), "error", err)
+			continue
+		}
+		sent++
+	}
+	fmt.Printf("Candidate ready event sent to %d/%d sink(s).\n", sent, len(cfg.EventSinks))
+}
+
+// validateEventSink checks the syntax of a sink
+func validateEventSink(sink string) error {
+	switch {
+	case strings.HasPrefix(sink, candidateSinkPubSub):
+		topic := strings.TrimPrefix(sink, candidateSinkPubSub)
+		if !strings.HasPrefix(topic, "projects/") || !strings.Contains(topic, "/topics/") {
+			return fmt.Errorf("'%s' (expected pubsub:projects/<project>/topics/<topic>)", sink)
+		}
+		return nil
+	case strings.HasPrefix(sink, candidateSinkSQS):
+		sink = strings.TrimPrefix(sink, candidateSinkSQS)
+	}
+	if u, err := url.Parse(sink); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("'%s' (expected an http(s) URL, sqs:<queue URL> or pubsub:projects/<project>/topics/<topic>)", redactSink(sink))
+	}
+	return nil
+}
+
+// redactSink drops the credentials and query of a sink URL before it is logged
+func redactSink(sink string) string {
+	u, err := url.Parse(sink)
+	if err != nil || u.Host == "" {
+		return sink
+	}
+	u.User, u.RawQuery = nil, ""
+	return u.String()
+}
+
+// sendHTTPEvent POSTs the event in structured mode
+func sendHTTPEvent(client *http.Client, sink string, payload []byte, signature string) error {
+	req, err := http.NewRequest("POST", sink, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/cloudevents+json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(candidateSignatureHeader, signature)
+	return sendEventRequest(client, req)
+}
+
+// sendSQSEvent sends the event as a message of an SQS queue, signed with the AWS
+// credentials of the environment. The region is AWS_REGION, else the one of the queue host.
+func sendSQSEvent(client *http.Client, queueURL string, payload []byte, signature string) error {
+	queue, err := url.Parse(queueURL)
+	if err != nil {
+		return err
+	}
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if parts := strings.Split(queue.Host, "."); region == "" && len(parts) > 2 && parts[0] == "sqs" {
+		region = parts[1]
+	}
+	accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if region == "" || accessKey == "" || secretKey == "" {
+		return fmt.Errorf("SQS sinks need AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and a region")
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"QueueUrl":    queueURL,
+		"MessageBody": string(payload),
+		"MessageAttributes": map[string]any{
+			candidateSignatureAttr: map[string]string{"DataType": "String", "StringValue": signature},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", queue.Scheme+"://"+queue.Host+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "AmazonSQS.SendMessage")
+	signAWSRequest(req, body, region, "sqs", accessKey, secretKey, os.Getenv("AWS_SESSION_TOKEN"), time.Now().UTC())
+	return sendEventRequest(client, req)
+}
+
+// signAWSRequest adds the AWS Signature Version 4 headers of a request
+func signAWSRequest(req *http.Request, body []byte, region, service, accessKey, secretKey, token string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+
+	// Every header set so far is signed, in lowercase name order
+	names := []string{"host"}
+	values := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		names = append(names, lower)
+		values[lower] = strings.TrimSpace(req.Header.Get(name))
+	}
+	slices.Sort(names)
+	var headers strings.Builder
+	for _, name := range names {
+		headers.WriteString(name + ":" + values[name] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	hash := func(data []byte) string {
+		sum := sha256.Sum256(data)
+		return hex.EncodeToString(sum[:])
+	}
+	mac := func(key []byte, data string) []byte {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(data))
+		return h.Sum(nil)
+	}
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonical := strings.Join([]string{req.Method, path, req.URL.RawQuery, headers.String(), signed, hash(body)}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hash([]byte(canonical))
+	key := mac(mac(mac(mac([]byte("AWS4"+secretKey), date), region), service), "aws4_request")
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signed, hex.EncodeToString(mac(key, toSign))))
+}
+
+// sendPubSubEvent publishes the event to a Pub/Sub topic ("projects/p/topics/t") with the
+// GOOGLE_OAUTH_ACCESS_TOKEN of the environment, or to the PUBSUB_EMULATOR_HOST emulator
+func sendPubSubEvent(client *http.Client, topic string, payload []byte, signature string) error {
+	base := pubSubAPIURL
+	token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+	if host := os.Getenv("PUBSUB_EMULATOR_HOST"); host != "" {
+		base = "http://" + host
+	} else if token == "" {
+		return fmt.Errorf("Pub/Sub sinks need GOOGLE_OAUTH_ACCESS_TOKEN")
+	}
+
+	body, err := json.Marshal(map[string]any{"messages": []map[string]any{{
+		"data": base64.StdEncoding.EncodeToString(payload),
+		"attributes": map[string]string{
+			candidateSignatureAttr: signature,
+			"content-type":         "application/cloudevents+json",
+		},
+	}}})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", base+"/v1/"+topic+":publish", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return sendEventRequest(client, req)
+}
+
+// sendEventRequest sends a sink request, failing on non-2xx responses
+func sendEventRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, errorBodyExcerpt))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Constants for the changed path hints
+const (
+	changedPathTrailer     = "Changed-Path" // Commit trailer naming a path changed by the batch
+	changedPathTrailersMax = 100            // Paths listed in trailers before collapsing to top-level entries
+)
+
+// ChangedPaths records the paths the batch changes, for CI on the candidate to skip the
+// test suites of unaffected paths
+type ChangedPaths struct {
+	Paths []string  `json:"paths"`         // Paths the batch changes against trunk, sorted
+	PRs   []PRPaths `json:"prs,omitempty"` // Paths changed by each merged PR, in merge order
+}
+
+// PRPaths attributes changed paths to a merged PR
+type PRPaths struct {
+	PR    int      `json:"pr"`    // PR number
+	Paths []string `json:"paths"` // Paths changed by the PR's commit, sorted
+}
+
+// recordChangedPaths computes the paths changed by the merged PRs before the bookkeeping
+// commits, records them in the run report and publishes them as the changed_paths step
+// output (a JSON array) and the --changed_paths_file. PRs are attributed the paths of
+// their own commit, so it must run while the batch still has one commit per PR. Failures
+// are logged as warnings: without hints, CI runs every suite.
+func recordChangedPaths(cfg Config, merged []MergeRecord, report *RunReport) {
+	paths, err := diffPaths(cfg.TrunkBranch, "HEAD")
+	if err != nil {
+		slog.Warn("failed to list the changed paths", "error", err)
+		return
+	}
+	changed := &ChangedPaths{Paths: paths}
+	for _, m := range merged {
+		if m.Commit == "" {
+			continue
+		}
+		prPaths, err := diffPaths(m.Commit+"^", m.Commit)
+		if err != nil {
+			slog.Warn("failed to list the paths changed by PR", "pr_number", m.PR, "error", err)
+			continue
+		}
+		changed.PRs = append(changed.PRs, PRPaths{PR: m.PR, Paths: prPaths})
+	}
+	report.pathsChanged(changed)
+	fmt.Printf("Changed paths: %d against '%s'.\n", len(paths), cfg.TrunkBranch)
+
+	data, _ := json.Marshal(paths)
+	setOutput(cfg, "changed_paths", string(data))
+	if cfg.ChangedPathsFile != "" {
+		var b strings.Builder
+		for _, p := range paths {
+			b.WriteString(p + "\n")
+		}
+		if err := os.WriteFile(cfg.ChangedPathsFile, []byte(b.String()), 0644); err != nil {
+			slog.Warn("failed to write changed paths file", "error", err)
+		}
+	}
+}
+
+// diffPaths lists the paths changed between two revisions, sorted
+func diffPaths(from, to string) ([]string, error) {
+	output, err := runGitCommandWithOutput("diff", "--name-only", "-z", "--no-renames", from, to)
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for _, p := range strings.Split(output, "\x00") {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	slices.Sort(paths)
+	return paths, nil
+}
+
+// withChangedPathTrailers appends the Changed-Path trailers of --changed_paths_trailers
+// to a commit message built by prCommitMessage. Beyond changedPathTrailersMax paths they
+// list the top-level directories, with a trailing slash, and root files instead.
+func withChangedPathTrailers(cfg Config, report *RunReport, message string) string {
+	if !cfg.ChangedPathsTrailers || report.ChangedPaths == nil || len(report.ChangedPaths.Paths) == 0 {
+		return message
+	}
+	paths := report.ChangedPaths.Paths
+	if len(paths) > changedPathTrailersMax {
+		var top []string
+		for _, p := range paths {
+			if dir, _, ok := strings.Cut(p, "/"); ok {
+				p = dir + "/"
+			}
+			if !slices.Contains(top, p) {
+				top = append(top, p)
+			}
+		}
+		paths = top
+	}
+	var b strings.Builder
+	b.WriteString(message)
+	// Without the batch trailer the message has no trailer paragraph yet
+	if cfg.BatchID == "" {
+		b.WriteString("\n")
+	}
+	for _, p := range paths {
+		fmt.Fprintf(&b, "\n%s: %s", changedPathTrailer, p)
+	}
+	return b.String()
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Faults injected by --chaos
+const (
+	faultAPIError  = "api_500"    // GitHub API call answered with a 500
+	faultRateLimit = "rate_limit" // GitHub API call answered with an exhausted rate limit
+	faultConflict  = "conflict"   // PR merge reported as conflicting
+	faultPushRace  = "push_race"  // Push of the target branch rejected as if another writer moved it
+)
+
+// chaosFaults lists the faults --chaos accepts
+var chaosFaults = []string{faultAPIError, faultRateLimit, faultConflict, faultPushRace}
+
+// ChaosReport records the faults injected by --chaos, shared by the run report and the hooks
+type ChaosReport struct {
+	Seed     int64          `json:"seed"`     // Seed of the fault draws, replaying the same faults in the same order
+	Injected map[string]int `json:"injected"` // Injections per fault
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// chaos is the injector of the process, set up on the first draw so that every client
+// and hook of the run shares the seeded sequence
+var chaos struct {
+	sync.Mutex
+	report *ChaosReport
+}
+
+// parseChaos parses the chaos entries "fault=probability"
+func parseChaos(entries []string) (map[string]float64, error) {
+	rates := make(map[string]float64, len(entries))
+	for _, entry := range entries {
+		fault, value, ok := strings.Cut(entry, "=")
+		fault, value = strings.TrimSpace(fault), strings.TrimSpace(value)
+		p, err := strconv.ParseFloat(value, 64)
+		if !ok || !slices.Contains(chaosFaults, fault) || err != nil || p < 0 || p > 1 {
+			return nil, fmt.Errorf("'%s' (expected fault=probability with fault one of %s and probability between 0 and 1)",
+				entry, strings.Join(chaosFaults, ", "))
+		}
+		rates[fault] = p
+	}
+	return rates, nil
+}
+
+// chaosReport returns the injector of the run, nil when --chaos is off
+func chaosReport(cfg Config) *ChaosReport {
+	if len(cfg.Chaos) == 0 {
+		return nil
+	}
+	chaos.Lock()
+	defer chaos.Unlock()
+	if chaos.report == nil {
+		chaos.report = &ChaosReport{Seed: cfg.ChaosSeed, Injected: make(map[string]int), rng: rand.New(rand.NewSource(cfg.ChaosSeed))}
+	}
+	return chaos.report
+}
+
+// injectFault draws whether the fault strikes now, logging the injection. It is the hook
+// the API client, the merge and the push call before doing the real work.
+func injectFault(cfg Config, fault, detail string) bool {
+	p := cfg.Chaos[fault]
+	if p <= 0 {
+		return false
+	}
+	r := chaosReport(cfg)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.rng.Float64() >= p {
+		return false
+	}
+	r.Injected[fault]++
+	slog.Info("chaos: injecting fault", "fault", fault, "detail", detail)
+	return true
+}
+
+// printChaos summarizes the injected faults once the run is over
+func printChaos(cfg Config) {
+	r := chaosReport(cfg)
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var counts []string
+	total := 0
+	for _, fault := range chaosFaults {
+		if n := r.Injected[fault]; n > 0 {
+			counts = append(counts, fmt.Sprintf("%s=%d", fault, n))
+			total += n
+		}
+	}
+	fmt.Printf("Chaos: %d fault(s) injected with seed %d", total, r.Seed)
+	if total > 0 {
+		fmt.Printf(" (%s)", strings.Join(counts, ", "))
+	}
+	fmt.Println()
+}
+
+// chaosTransport answers GitHub API calls with server errors and exhausted rate limits
+// instead of sending them, as GitHub does when degraded
+type chaosTransport struct {
+	next http.RoundTripper
+	cfg  Config
+}
+
+func (t chaosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	call := req.Method + " " + req.URL.Path
+	switch {
+	case injectFault(t.cfg, faultAPIError, call):
+		return chaosResponse(req, http.StatusInternalServerError, nil, "Server Error (injected by --chaos)"), nil
+	case injectFault(t.cfg, faultRateLimit, call):
+		header := http.Header{}
+		header.Set("X-RateLimit-Limit", "5000")
+		header.Set("X-RateLimit-Remaining", "0")
+		header.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+		header.Set("Retry-After", "60")
+		return chaosResponse(req, http.StatusForbidden, header, "API rate limit exceeded (injected by --chaos)"), nil
+	}
+	return t.next.RoundTrip(req)
+}
+
+// chaosResponse builds a GitHub error response
+func chaosResponse(req *http.Request, status int, header http.Header, msg string) *http.Response {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-Type", "application/json")
+	body := fmt.Sprintf(`{"message":%q}`, msg)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
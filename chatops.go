@@ -0,0 +1,401 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Constants for the chatops server
+const (
+	rebuildCommandName = "/rebuild" // Comment prefix triggering a rebuild
+	maxWebhookBody     = 1 << 20    // Largest accepted webhook payload
+	rebuildQueueSize   = 16         // Rebuilds waiting for the running one
+)
+
+// rebuildPermissions lists the repository roles allowed to trigger rebuilds
+var rebuildPermissions = []string{"admin", "maintain", "write"}
+
+// eligibilityEvents lists the pull_request actions invalidating the cached eligibility of the PR
+var eligibilityEvents = []string{"synchronize", "labeled", "unlabeled", "edited", "reopened"}
+
+// serveOnlyFlags are consumed by the server and not forwarded to rebuilds;
+// batch_id is regenerated for every rebuild
+var serveOnlyFlags = []string{"listen", "webhook_secret", "chatops_targets", "batch_id", "freshness_interval", "max_age", "max_behind"}
+
+// rebuildCommand is a parsed '/rebuild [target] [--exclude N[,M]]' comment
+type rebuildCommand struct {
+	Target  string // Target branch to rebuild, the configured one when empty
+	Exclude []int  // PRs left out of the rebuild
+}
+
+// rebuildRequest is a rebuild accepted from a comment, waiting to run
+type rebuildRequest struct {
+	rebuildCommand
+	User     string // Commenter login, empty for rebuilds of stale targets
+	CloneURL string // Repository clone URL from the webhook payload
+}
+
+// requester describes who asked for the rebuild
+func (r rebuildRequest) requester() string {
+	if r.User == "" {
+		return "the freshness check"
+	}
+	return "@" + r.User
+}
+
+// issueCommentEvent is the subset of the issue_comment webhook payload used by chatops
+type issueCommentEvent struct {
+	Action string `json:"action"`
+	Issue  struct {
+		Number int `json:"number"`
+	} `json:"issue"`
+	Comment struct {
+		Body string `json:"body"`
+		User struct {
+			Login string `json:"login"`
+		} `json:"user"`
+	} `json:"comment"`
+	Repository struct {
+		FullName string `json:"full_name"`
+		CloneURL string `json:"clone_url"`
+	} `json:"repository"`
+}
+
+// pullRequestEvent is the subset of the pull_request webhook payload used by the eligibility cache
+type pullRequestEvent struct {
+	Action     string `json:"action"`
+	Number     int    `json:"number"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+// chatopsServer receives GitHub webhooks and runs the rebuilds requested on the tracking issue
+type chatopsServer struct {
+	cfg     Config
+	client  GitHubClient
+	secret  []byte
+	targets []string
+	args    []string // Flags forwarded to every rebuild
+	queue   chan rebuildRequest
+
+	mu      sync.Mutex
+	pending map[string]bool // Targets queued by the freshness check and not rebuilt yet
+}
+
+// runServe implements the 'serve' subcommand: a webhook server letting maintainers
+// comment '/rebuild' on the tracking issue to rebuild the target branch with overrides
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := fs.String("listen", ":8080", "Address receiving GitHub webhooks on /webhook")
+	secret := fs.String("webhook_secret", os.Getenv("WEBHOOK_SECRET"), "Secret validating webhook signatures (defaults to $WEBHOOK_SECRET)")
+	targets := fs.String("chatops_targets", "", "Target branches '/rebuild' may name (comma separated, the target branch when empty)")
+	interval := fs.Duration("freshness_interval", 0, "Check the freshness of the targets this often and rebuild the stale ones (requires a clone as working directory)")
+	limits := registerFreshnessFlags(fs)
+	cfg := mustParseConfig(fs, args)
+	mustDetectGit(cfg)
+
+	if cfg.TrackingIssue == 0 {
+		log.Fatal("invalid configuration:", fmt.Errorf("serve requires parameter 'tracking_issue'"))
+	}
+	if *secret == "" {
+		log.Fatal("invalid configuration:", fmt.Errorf("serve requires parameter 'webhook_secret'"))
+	}
+
+	s := &chatopsServer{
+		cfg:     cfg,
+		client:  mustNewGitHubClient(cfg),
+		secret:  []byte(*secret),
+		targets: parseLabels(*targets),
+		args:    forwardedArgs(fs),
+		queue:   make(chan rebuildRequest, rebuildQueueSize),
+		pending: make(map[string]bool),
+	}
+	if len(s.targets) == 0 {
+		s.targets = []string{cfg.TargetBranch}
+	}
+	if *interval > 0 {
+		if err := limits.validate(); err != nil {
+			log.Fatal("invalid configuration:", err)
+		}
+		cloneURL, err := runGitCommandWithOutput("remote", "get-url", "origin")
+		if err != nil {
+			log.Fatal("invalid configuration:", fmt.Errorf("parameter 'freshness_interval' requires a clone as working directory: %w", err))
+		}
+		go s.watchFreshness(*interval, *limits, strings.TrimSpace(cloneURL))
+	}
+	go s.runRebuilds()
+
+	mux := http.NewServeMux()
+	mux.Handle("POST /webhook", s)
+	fmt.Printf("Listening for '%s' comments on %s/%s#%d at %s/webhook\n", rebuildCommandName, cfg.Owner, cfg.Repo, cfg.TrackingIssue, *listen)
+	log.Fatal(http.ListenAndServe(*listen, mux))
+}
+
+// forwardedArgs renders the flags given to the server for the rebuild processes
+func forwardedArgs(fs *flag.FlagSet) []string {
+	var args []string
+	fs.Visit(func(f *flag.Flag) {
+		if !slices.Contains(serveOnlyFlags, f.Name) {
+			args = append(args, fmt.Sprintf("--%s=%s", f.Name, f.Value.String()))
+		}
+	})
+	return args
+}
+
+func (s *chatopsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, "reading body failed", http.StatusBadRequest)
+		return
+	}
+	if !validSignature(s.secret, body, r.Header.Get("X-Hub-Signature-256")) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	if r.Header.Get("X-GitHub-Event") == "pull_request" {
+		s.invalidatePR(w, body)
+		return
+	}
+	if r.Header.Get("X-GitHub-Event") != "issue_comment" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var event issueCommentEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	if event.Action != "created" || event.Issue.Number != s.cfg.TrackingIssue ||
+		!strings.EqualFold(event.Repository.FullName, s.cfg.Owner+"/"+s.cfg.Repo) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	cmd, ok, err := parseRebuildCommand(event.Comment.Body)
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	user := event.Comment.User.Login
+	if err == nil {
+		err = s.authorize(user, &cmd)
+	}
+	if err != nil {
+		s.reply(fmt.Sprintf("@%s `%s` rejected: %v", user, rebuildCommandName, err))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	select {
+	case s.queue <- rebuildRequest{rebuildCommand: cmd, User: user, CloneURL: event.Repository.CloneURL}:
+		s.reply(fmt.Sprintf("Rebuild of `%s` requested by @%s queued%s.", cmd.Target, user, excludeSuffix(cmd.Exclude)))
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		s.reply(fmt.Sprintf("@%s rebuild queue is full, try again once the running rebuilds finish.", user))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+// invalidatePR drops the cached eligibility of a PR that was pushed to, relabeled or edited
+func (s *chatopsServer) invalidatePR(w http.ResponseWriter, body []byte) {
+	var event pullRequestEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	if slices.Contains(eligibilityEvents, event.Action) &&
+		strings.EqualFold(event.Repository.FullName, s.cfg.Owner+"/"+s.cfg.Repo) {
+		invalidateEligibility(s.cfg, event.Number)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorize checks the commenter role and resolves the target branch of the command
+func (s *chatopsServer) authorize(user string, cmd *rebuildCommand) error {
+	permission, err := s.client.GetCollaboratorPermission(user)
+	if err != nil {
+		slog.Warn("failed to check permission", "user", user, "error", err)
+		return fmt.Errorf("permission check failed")
+	}
+	if !slices.Contains(rebuildPermissions, permission) {
+		return fmt.Errorf("requires %s permission (has: %s)", strings.Join(rebuildPermissions, ", "), permission)
+	}
+	if cmd.Target == "" {
+		cmd.Target = s.targets[0]
+	}
+	if !slices.Contains(s.targets, cmd.Target) {
+		return fmt.Errorf("target '%s' is not one of %s", cmd.Target, strings.Join(s.targets, ", "))
+	}
+	return nil
+}
+
+// runRebuilds runs the queued rebuilds one at a time, each in a fresh clone
+func (s *chatopsServer) runRebuilds() {
+	for req := range s.queue {
+		err := s.rebuild(req)
+		s.mu.Lock()
+		delete(s.pending, req.Target)
+		s.mu.Unlock()
+		status := "succeeded"
+		if err != nil {
+			status = fmt.Sprintf("failed: %v", err)
+		}
+		s.reply(fmt.Sprintf("Rebuild of `%s` requested by %s %s.", req.Target, req.requester(), status))
+	}
+}
+
+// watchFreshness checks the targets every interval and queues a rebuild of the stale ones,
+// unless one is already queued
+func (s *chatopsServer) watchFreshness(interval time.Duration, limits freshnessLimits, cloneURL string) {
+	for range time.Tick(interval) {
+		for _, target := range s.targets {
+			cfg := s.cfg
+			cfg.TargetBranch = target
+			f, err := checkFreshness(cfg, limits)
+			if err != nil {
+				slog.Warn("freshness check failed", "branch", target, "error", err)
+				continue
+			}
+			s.mu.Lock()
+			queue := len(f.Stale) > 0 && !s.pending[target]
+			if queue {
+				select {
+				case s.queue <- rebuildRequest{rebuildCommand: rebuildCommand{Target: target}, CloneURL: cloneURL}:
+					s.pending[target] = true
+				default:
+					queue = false
+					slog.Warn("rebuild queue is full, stale target is rebuilt on a later check", "branch", target)
+				}
+			}
+			s.mu.Unlock()
+			if queue {
+				s.reply(fmt.Sprintf("Rebuild of `%s` queued by the freshness check: %s.", target, strings.Join(f.Stale, ", ")))
+			}
+		}
+	}
+}
+
+// rebuild clones the repository and runs a batch with the overrides of the request
+func (s *chatopsServer) rebuild(req rebuildRequest) error {
+	workdir, err := os.MkdirTemp("", "feature-branching-rebuild-")
+	if err != nil {
+		return fmt.Errorf("create clone dir failed: %w", err)
+	}
+	defer os.RemoveAll(workdir)
+
+	dir := filepath.Join(workdir, s.cfg.Repo)
+	if err := cloneRepository(req.CloneURL, currentToken(s.cfg), dir); err != nil {
+		return err
+	}
+
+	args := append(slices.Clone(s.args), "--target_branch", req.Target, "--batch_id", newBatchID())
+	if len(req.Exclude) > 0 {
+		excluded := append(slices.Clone(s.cfg.ExcludePRs), req.Exclude...)
+		args = append(args, "--exclude_prs", joinPRNumbers(excluded))
+	}
+	fmt.Printf("\n=== Rebuild of '%s' requested by %s ===\n", req.Target, req.requester())
+	return runBotIn(dir, args)
+}
+
+// reply comments on the tracking issue, logging failures
+func (s *chatopsServer) reply(body string) {
+	if err := s.client.CreateIssueComment(s.cfg.TrackingIssue, body); err != nil {
+		slog.Warn("failed to comment on tracking issue", "issue_number", s.cfg.TrackingIssue, "error", err)
+	}
+}
+
+// validSignature checks the X-Hub-Signature-256 HMAC of a webhook payload
+func validSignature(secret, body []byte, header string) bool {
+	sig, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// parseRebuildCommand parses the first line of a comment as a rebuild command.
+// It returns false when the comment is not a rebuild command at all.
+func parseRebuildCommand(body string) (rebuildCommand, bool, error) {
+	var cmd rebuildCommand
+	line, _, _ := strings.Cut(strings.TrimSpace(body), "\n")
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != rebuildCommandName {
+		return cmd, false, nil
+	}
+
+	usage := fmt.Sprintf("usage: %s [target] [--exclude N[,M]]", rebuildCommandName)
+	for i := 1; i < len(fields); i++ {
+		field := fields[i]
+		var list string
+		switch {
+		case field == "--exclude":
+			if i+1 >= len(fields) {
+				return cmd, true, fmt.Errorf("'--exclude' needs a PR number (%s)", usage)
+			}
+			i++
+			list = fields[i]
+		case strings.HasPrefix(field, "--exclude="):
+			list = strings.TrimPrefix(field, "--exclude=")
+		case strings.HasPrefix(field, "-"):
+			return cmd, true, fmt.Errorf("unknown option '%s' (%s)", field, usage)
+		case cmd.Target == "":
+			cmd.Target = field
+			continue
+		default:
+			return cmd, true, fmt.Errorf("unexpected argument '%s' (%s)", field, usage)
+		}
+
+		for _, s := range strings.Split(list, ",") {
+			n, err := strconv.Atoi(strings.TrimPrefix(s, "#"))
+			if err != nil || n <= 0 {
+				return cmd, true, fmt.Errorf("'%s' is not a PR number", s)
+			}
+			cmd.Exclude = append(cmd.Exclude, n)
+		}
+	}
+	return cmd, true, nil
+}
+
+// excludeSuffix describes excluded PRs in rebuild comments
+func excludeSuffix(prs []int) string {
+	if len(prs) == 0 {
+		return ""
+	}
+	refs := make([]string, len(prs))
+	for i, n := range prs {
+		refs[i] = fmt.Sprintf("#%d", n)
+	}
+	return " (excluding " + strings.Join(refs, ", ") + ")"
+}
+
+// joinPRNumbers renders PR numbers as a comma separated flag value
+func joinPRNumbers(prs []int) string {
+	items := make([]string, len(prs))
+	for i, n := range prs {
+		items[i] = strconv.Itoa(n)
+	}
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// subcommand is an operation of the command line, selected by its first argument
+type subcommand struct {
+	name    string              // First argument selecting the subcommand
+	summary string              // One-line description listed by 'help'
+	run     func(args []string) // Entry point, receiving the arguments after the name
+}
+
+// subcommands lists the operations of the command line. 'run' is the default one, used
+// when the first argument is a flag, so existing invocations keep building batches.
+var subcommands = []subcommand{
+	{"run", "Build the batch of the qualifying PRs into the target branch and publish it (default)", runBatch},
+	{"plan", "Show the PRs a run would merge and why the others are left out, without changing anything", runPlan},
+	{"status", "Inspect the composition of the published target branch from its ref history", runStatus},
+	{"history", "Query the ref histories of the recorded runs; 'history compact' trims the conflict stats", runHistory},
+	{"audit", "Verify that a published candidate matches its ref history and was not edited after the run", runAudit},
+	{"explain", "Print every filter verdict per PR", runExplain},
+	{"stats", "Rank the conflict-prone PRs, authors and paths", runStats},
+	{"bisect-map", "Map a bad commit of the target branch back to the PR that introduced it", runBisectMap},
+	{"gc", "Delete the generated remote branches past their retention period", runGC},
+	{"rebuild", "Reconstruct the candidate of a past run from the results branch", runRebuild},
+	{"convert-history", "Rewrite a ref history file in another format", runConvertHistory},
+	{"check-freshness", "Fail when the target branch is too old or too far behind trunk", runCheckFreshness},
+	{"serve", "Serve the webhook rebuilding the target branch on '/rebuild' comments of the tracking issue", runServe},
+	{"config", "Validate a configuration ('config doctor') or print the parameter schema ('config schema')", runConfig},
+	{"selftest", "Run the bot end to end against a scratch repository", runSelftest},
+	{"replay", "Print the timeline or re-derive the report of a recorded run", runReplay},
+	{"docker", "Entrypoint of the container image, mapping the action inputs to parameters", runDocker},
+}
+
+// runCLI dispatches the command line to its subcommand
+func runCLI(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		runBatch(args)
+		return
+	}
+	if args[0] == "help" {
+		printSubcommands()
+		return
+	}
+	for _, c := range subcommands {
+		if c.name == args[0] {
+			c.run(args[1:])
+			return
+		}
+	}
+	log.Fatal("invalid configuration:", unknownSubcommandError(args[0]))
+}
+
+// unknownSubcommandError reports an unknown subcommand, suggesting the closest one
+func unknownSubcommandError(name string) error {
+	best, bestDistance := "", len(name)/3+1
+	for _, c := range subcommands {
+		if d := editDistance(strings.ToLower(name), c.name); d < bestDistance {
+			best, bestDistance = c.name, d
+		}
+	}
+	if best != "" {
+		return fmt.Errorf("unknown subcommand '%s' (did you mean '%s'?)", name, best)
+	}
+	return fmt.Errorf("unknown subcommand '%s' (see 'help')", name)
+}
+
+// printSubcommands implements 'help', listing the subcommands
+func printSubcommands() {
+	bin := filepath.Base(os.Args[0])
+	fmt.Fprintf(os.Stdout, "Usage: %s [subcommand] [flags]\n\nSubcommands:\n", bin)
+	for _, c := range subcommands {
+		fmt.Fprintf(os.Stdout, "  %-16s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(os.Stdout, "\nRun '%s <subcommand> -h' for the flags of a subcommand.\n", bin)
+}
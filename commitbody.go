@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Formats of the commit bodies taken from PR descriptions
+const (
+	commitBodyPlain    = "plain"    // Markdown converted to plain text
+	commitBodyMarkdown = "markdown" // Description as written
+)
+
+// Markdown constructs rewritten by the plain text conversion
+var (
+	markdownComment   = regexp.MustCompile(`(?s)<!--.*?-->`)
+	markdownHeading   = regexp.MustCompile(`^\s{0,3}(#{1,6})\s+(.*?)(?:\s+#+)?\s*$`)
+	markdownImage     = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	markdownLink      = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)[^)]*\)`)
+	markdownAutolink  = regexp.MustCompile(`<((?:https?|mailto):[^>\s]+)>`)
+	markdownHTMLTag   = regexp.MustCompile(`</?[A-Za-z][A-Za-z0-9-]*(?:\s[^>]*)?/?>`)
+	markdownStrong    = regexp.MustCompile(`\*\*(\S(?:.*?\S)?)\*\*|__(\S(?:.*?\S)?)__`)
+	markdownEmphasis  = regexp.MustCompile(`(^|[^\w*])\*(\S(?:[^*]*?\S)?)\*`)
+	markdownUnderline = regexp.MustCompile(`(^|\W)_(\S(?:[^_]*?\S)?)_(\W|$)`)
+	markdownStrike    = regexp.MustCompile(`~~(\S(?:.*?\S)?)~~`)
+	markdownCode      = regexp.MustCompile("`+([^`]+)`+")
+	markdownRule      = regexp.MustCompile(`^\s{0,3}(?:(?:\*\s*){3,}|(?:-\s*){3,}|(?:_\s*){3,})$`)
+	markdownTableRule = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(?:\|\s*:?-+:?\s*)*\|?\s*$`)
+	markdownBullet    = regexp.MustCompile(`^(\s*)[*+]\s+`)
+	markdownEscape    = regexp.MustCompile("\\\\([\\\\`*_{}\\[\\]()#+\\-.!|~<>])")
+)
+
+// markdownEscaped offsets the escaped ASCII characters into the private use area while
+// the inline markup is dropped
+const markdownEscaped rune = 0xE000
+
+// prMessage builds the commit message of a PR commit: the subject, the PR description
+// as body with --commit_body, and the batch trailer
+func prMessage(cfg Config, pr GitHubPR, subject string) string {
+	if body := commitBody(cfg, pr); body != "" {
+		subject += "\n\n" + body
+	}
+	return prCommitMessage(cfg, subject, prSource(pr))
+}
+
+// commitBody returns the commit body taken from a PR description: the whole description
+// or its --commit_body_section, without the directives block, converted and truncated
+// as configured. Empty when the description has nothing to contribute.
+func commitBody(cfg Config, pr GitHubPR) string {
+	if !cfg.CommitBody {
+		return ""
+	}
+	body := stripDirectivesBlock(strings.ReplaceAll(pr.Body, "\r\n", "\n"))
+	if cfg.CommitBodySection != "" {
+		section, ok := markdownSection(body, cfg.CommitBodySection)
+		if !ok {
+			return ""
+		}
+		body = section
+	}
+	if cfg.CommitBodyFormat == commitBodyPlain {
+		body = markdownToPlainText(body)
+	}
+	lines := compactLines(strings.Split(body, "\n"))
+	if cfg.CommitBodyMaxLines > 0 && len(lines) > cfg.CommitBodyMaxLines {
+		omitted := len(lines) - cfg.CommitBodyMaxLines
+		lines = append(lines[:cfg.CommitBodyMaxLines], "", fmt.Sprintf("[%d more line(s) in the description of PR #%d]", omitted, pr.Number))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// stripDirectivesBlock removes the fenced 'mergebot:' block, meant for the bot, from a PR description
+func stripDirectivesBlock(body string) string {
+	lines := strings.Split(body, "\n")
+	for i := 0; i < len(lines); i++ {
+		fence := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(fence, "```") && !strings.HasPrefix(fence, "~~~") {
+			continue
+		}
+		marker := fence[:3]
+		end := i + 1
+		for end < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[end]), marker) {
+			end++
+		}
+		if isDirectivesBlock(lines[i+1 : end]) {
+			return strings.Join(append(lines[:i:i], lines[min(end+1, len(lines)):]...), "\n")
+		}
+		i = end
+	}
+	return body
+}
+
+// markdownSection returns the lines under the ATX heading titled title, compared with
+// Unicode case folding, up to the next heading of the same or a higher level
+func markdownSection(body, title string) (string, bool) {
+	lines := strings.Split(body, "\n")
+	start, level := -1, 0
+	fenced := false
+	for i, line := range lines {
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fenced = !fenced
+		}
+		m := markdownHeading.FindStringSubmatch(line)
+		if fenced || m == nil {
+			continue
+		}
+		if start >= 0 && len(m[1]) <= level {
+			return strings.Join(lines[start:i], "\n"), true
+		}
+		if start < 0 && strings.EqualFold(m[2], strings.TrimSpace(title)) {
+			start, level = i+1, len(m[1])
+		}
+	}
+	if start < 0 {
+		return "", false
+	}
+	return strings.Join(lines[start:], "\n"), true
+}
+
+// markdownToPlainText renders the Markdown of a PR description as plain text for a
+// commit message: markup is dropped, links keep their URL and code blocks are indented
+func markdownToPlainText(body string) string {
+	var out []string
+	fence := ""
+	for _, line := range strings.Split(markdownComment.ReplaceAllString(body, ""), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+				continue
+			}
+			out = append(out, "    "+line)
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+		if markdownRule.MatchString(line) || (strings.Contains(line, "-") && markdownTableRule.MatchString(line)) {
+			continue
+		}
+		if m := markdownHeading.FindStringSubmatch(line); m != nil {
+			line = m[2]
+		}
+		line = markdownBullet.ReplaceAllString(line, "$1- ")
+
+		// Code spans are kept verbatim, only the text around them is unmarked
+		var b strings.Builder
+		last := 0
+		for _, span := range markdownCode.FindAllStringSubmatchIndex(line, -1) {
+			b.WriteString(plainInline(line[last:span[0]]))
+			b.WriteString(line[span[2]:span[3]])
+			last = span[1]
+		}
+		b.WriteString(plainInline(line[last:]))
+		out = append(out, b.String())
+	}
+	return strings.Join(out, "\n")
+}
+
+// plainInline drops the inline markup of Markdown text outside code spans. Escaped
+// characters are set aside first, so they are never taken for markup.
+func plainInline(text string) string {
+	text = markdownEscape.ReplaceAllStringFunc(text, func(s string) string {
+		return string(markdownEscaped + rune(s[1]))
+	})
+	text = markdownImage.ReplaceAllString(text, "$1")
+	text = markdownLink.ReplaceAllStringFunc(text, func(s string) string {
+		m := markdownLink.FindStringSubmatch(s)
+		if m[1] == m[2] {
+			return m[2]
+		}
+		return m[1] + " (" + m[2] + ")"
+	})
+	text = markdownAutolink.ReplaceAllString(text, "$1")
+	text = markdownHTMLTag.ReplaceAllString(text, "")
+	text = markdownStrong.ReplaceAllString(text, "${1}${2}")
+	text = markdownEmphasis.ReplaceAllString(text, "$1$2")
+	text = markdownUnderline.ReplaceAllString(text, "$1$2$3")
+	text = markdownStrike.ReplaceAllString(text, "$1")
+	text = strings.Map(func(r rune) rune {
+		if r >= markdownEscaped && r < markdownEscaped+0x80 {
+			return r - markdownEscaped
+		}
+		return r
+	}, text)
+	return html.UnescapeString(text)
+}
+
+// compactLines trims trailing spaces, collapses runs of blank lines and drops the
+// leading and trailing ones
+func compactLines(lines []string) []string {
+	var out []string
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		if line == "" && (len(out) == 0 || out[len(out)-1] == "") {
+			continue
+		}
+		out = append(out, line)
+	}
+	for len(out) > 0 && out[len(out)-1] == "" {
+		out = out[:len(out)-1]
+	}
+	return out
+}
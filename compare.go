@@ -0,0 +1,79 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+)
+
+// compareMarker identifies the compare link comment on issues and PRs
+const compareMarker = "<!-- feature-branching:compare -->"
+
+// publishCompareLink comments a compare link and commit range for the published
+// target branch on the tracking issue and/or every merged PR.
+// Errors are logged as warnings since the branch has already been pushed.
+func publishCompareLink(client GitHubClient, cfg Config, merged []MergeRecord, diff *DiffSummary) {
+	body, err := compareCommentBody(cfg, merged, diff)
+	if err != nil {
+		slog.Warn("failed to build compare comment", "error", err)
+		return
+	}
+
+	if cfg.TrackingIssue > 0 {
+		if err := upsertComment(client, cfg.TrackingIssue, compareMarker, body); err != nil {
+			slog.Warn("failed to comment on tracking issue", "issue_number", cfg.TrackingIssue, "error", err)
+		}
+	}
+	if cfg.CompareComment {
+		for _, m := range merged {
+			if err := upsertComment(client, m.PR, compareMarker, body); err != nil {
+				slog.Warn("failed to comment on PR", "pr_number", m.PR, "error", err)
+			}
+		}
+	}
+}
+
+// compareCommentBody renders the compare link, commit range, merged PR list and diff summary
+func compareCommentBody(cfg Config, merged []MergeRecord, diff *DiffSummary) (string, error) {
+	base, err := revParse(cfg.TrunkBranch)
+	if err != nil {
+		return "", err
+	}
+	head, err := revParse(cfg.TargetBranch)
+	if err != nil {
+		return "", err
+	}
+
+	data := compareCommentData{
+		WebURL:          cfg.WebURL,
+		Owner:           cfg.Owner,
+		Repo:            cfg.Repo,
+		Trunk:           cfg.TrunkBranch,
+		Target:          cfg.TargetBranch,
+		BatchID:         cfg.BatchID,
+		Base:            base,
+		Head:            head,
+		CandidateBranch: cfg.CandidateBranch,
+		Merged:          merged,
+	}
+	if diff != nil {
+		data.Diff = diff.markdown()
+	}
+	return renderText(cfg, "compare_comment", data)
+}
+
+// revParse resolves a revision to its full commit SHA
+func revParse(rev string) (string, error) {
+	output, err := runGitCommandWithOutput("rev-parse", rev)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// shortSHA abbreviates a commit SHA for display
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
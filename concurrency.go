@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultConcurrencyGroup names the repositories matching no configured group
+const defaultConcurrencyGroup = "default"
+
+// ConcurrencyGroup limits the org mode repositories matching its patterns, typically
+// the repositories sharing a GHES instance or a token
+type ConcurrencyGroup struct {
+	Name        string   `json:"name"`        // Group name
+	Patterns    []string `json:"patterns"`    // Globs matched against repository names
+	Parallelism int      `json:"parallelism"` // Repositories of the group batched at once
+	RateLimit   int      `json:"rate_limit"`  // API requests per minute shared by the group, 0 for no limit
+}
+
+// parseConcurrencyGroups parses the concurrency_groups entries
+// "name:parallelism[:requests_per_minute]=pattern|pattern"
+func parseConcurrencyGroups(entries []string) ([]ConcurrencyGroup, error) {
+	var groups []ConcurrencyGroup
+	for _, entry := range entries {
+		invalid := fmt.Errorf("invalid parameter 'concurrency_groups': '%s' (expected name:parallelism[:requests_per_minute]=pattern|pattern)", entry)
+		spec, patterns, ok := strings.Cut(entry, "=")
+		fields := strings.Split(spec, ":")
+		if !ok || len(fields) < 2 || len(fields) > 3 {
+			return nil, invalid
+		}
+		g := ConcurrencyGroup{Name: strings.TrimSpace(fields[0])}
+		if g.Name == "" || g.Name == defaultConcurrencyGroup {
+			return nil, invalid
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(fields[1]))
+		if err != nil || n <= 0 {
+			return nil, invalid
+		}
+		g.Parallelism = n
+		if len(fields) == 3 {
+			n, err := strconv.Atoi(strings.TrimSpace(fields[2]))
+			if err != nil || n < 0 {
+				return nil, invalid
+			}
+			g.RateLimit = n
+		}
+		for _, pattern := range strings.Split(patterns, "|") {
+			if pattern = strings.TrimSpace(pattern); pattern == "" {
+				continue
+			}
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid parameter 'concurrency_groups': '%s': %w", pattern, err)
+			}
+			g.Patterns = append(g.Patterns, pattern)
+		}
+		if len(g.Patterns) == 0 {
+			return nil, invalid
+		}
+		for _, other := range groups {
+			if other.Name == g.Name {
+				return nil, fmt.Errorf("invalid parameter 'concurrency_groups': duplicate group '%s'", g.Name)
+			}
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+// concurrencyGroupOf returns the first group matching a repository name, else the
+// default group of org_parallelism repositories
+func concurrencyGroupOf(cfg Config, name string) ConcurrencyGroup {
+	for _, g := range cfg.ConcurrencyGroups {
+		for _, pattern := range g.Patterns {
+			if ok, _ := path.Match(pattern, name); ok {
+				return g
+			}
+		}
+	}
+	return ConcurrencyGroup{Name: defaultConcurrencyGroup, Parallelism: max(cfg.OrgParallelism, 1)}
+}
+
+// processRateLimit is the share of the group rate limit of each of its bot processes.
+// Processes of a group run at most parallelism at a time, so together they stay within
+// the group limit; 0 keeps the limit of the original arguments.
+func (g ConcurrencyGroup) processRateLimit() int {
+	if g.RateLimit == 0 {
+		return 0
+	}
+	return max(g.RateLimit/g.Parallelism, 1)
+}
+
+// repoScheduler runs the org mode repositories, at most the parallelism of each group at
+// once. Groups have their own slots, so a group of many repositories does not starve the
+// others. Concurrent repositories have their output buffered and printed once done.
+type repoScheduler struct {
+	cfg        Config
+	slots      map[string]chan struct{} // Running repositories of every group
+	sequential bool                     // A single repository runs at a time, so its output is streamed
+
+	mu sync.Mutex // Serializes the output of the repositories
+	wg sync.WaitGroup
+}
+
+func newRepoScheduler(cfg Config, repos []Repository) *repoScheduler {
+	s := &repoScheduler{cfg: cfg, slots: make(map[string]chan struct{})}
+	total := 0
+	for _, r := range repos {
+		g := concurrencyGroupOf(cfg, r.Name)
+		if _, ok := s.slots[g.Name]; !ok {
+			s.slots[g.Name] = make(chan struct{}, g.Parallelism)
+			total += g.Parallelism
+		}
+	}
+	s.sequential = len(s.slots) <= 1 && total <= 1
+	return s
+}
+
+// start runs fn for a repository once a slot of its group is free, passing the group
+// and the writer of its output
+func (s *repoScheduler) start(r Repository, fn func(g ConcurrencyGroup, out io.Writer)) {
+	g := concurrencyGroupOf(s.cfg, r.Name)
+	if s.sequential {
+		fn(g, os.Stdout)
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		slots := s.slots[g.Name]
+		slots <- struct{}{}
+		defer func() { <-slots }()
+
+		var out bytes.Buffer
+		fn(g, &out)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		os.Stdout.Write(out.Bytes())
+	}()
+}
+
+// wait blocks until every started repository ran
+func (s *repoScheduler) wait() {
+	s.wg.Wait()
+}
+
+// rateLimitedTransport spaces the API requests of the process so they stay within
+// api_rate_limit requests per minute
+type rateLimitedTransport struct {
+	next     http.RoundTripper
+	interval time.Duration
+
+	mu   sync.Mutex
+	slot time.Time // Earliest start of the next request
+}
+
+func newRateLimitedTransport(next http.RoundTripper, perMinute int) *rateLimitedTransport {
+	return &rateLimitedTransport{next: next, interval: time.Minute / time.Duration(perMinute)}
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	now := time.Now()
+	start := now
+	if t.slot.After(now) {
+		start = t.slot
+	}
+	t.slot = start.Add(t.interval)
+	t.mu.Unlock()
+
+	if wait := start.Sub(now); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// loadConfigFile reads the parameters of a --config file: a flat JSON object or YAML
+// mapping from parameter names to values, YAML when the file is named *.yaml or *.yml
+// or does not start with '{'
+func loadConfigFile(file string) (map[string]any, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	ext := strings.ToLower(filepath.Ext(file))
+	if ext == ".json" || (ext != ".yaml" && ext != ".yml" && bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))) {
+		var settings map[string]any
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return nil, fmt.Errorf("parse config file failed: %w", err)
+		}
+		return settings, nil
+	}
+	settings, err := parseConfigYAML(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("parse config file failed: %w", err)
+	}
+	return settings, nil
+}
+
+// applyConfigFile sets the parameters of the config file that were not given on the
+// command line
+func applyConfigFile(fs *flag.FlagSet, settings map[string]any) error {
+	explicit := make(map[string]struct{})
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = struct{}{} })
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if key == "config" {
+			return fmt.Errorf("parameter 'config' cannot be set by a config file")
+		}
+		if fs.Lookup(key) == nil {
+			return unknownOptionError(fs, key)
+		}
+		if _, ok := explicit[key]; ok || settings[key] == nil {
+			continue
+		}
+		if err := setOption(fs, key, settings[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseConfigYAML parses the YAML subset of config files: top-level 'key: value' pairs
+// whose values are scalars, '[a, b]' flow lists, '- item' block lists or '|' literal
+// blocks. Scalars are kept as strings and checked against the parameter types; '~',
+// 'null' and empty values leave the parameter unset.
+func parseConfigYAML(text string) (map[string]any, error) {
+	settings := make(map[string]any)
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			return nil, fmt.Errorf("line %d: unexpected indentation (config files are flat)", i+1)
+		}
+		key, value, found := strings.Cut(line, ":")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("line %d: expected key: value, got '%s'", i+1, trimmed)
+		}
+		if _, dup := settings[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key '%s'", i+1, key)
+		}
+		value = stripYAMLComment(strings.TrimSpace(value))
+
+		// Indented lines belong to the value of the key
+		end := i + 1
+		for end < len(lines) && (strings.TrimSpace(lines[end]) == "" || lines[end][0] == ' ' || lines[end][0] == '\t') {
+			end++
+		}
+		nested := lines[i+1 : end]
+		keyLine := i + 1
+		i = end - 1
+
+		var err error
+		switch {
+		case value == "|" || value == "|-":
+			settings[key] = yamlLiteralBlock(nested, value == "|")
+		case value == "":
+			settings[key], err = yamlBlockList(nested)
+		case hasYAMLContent(nested):
+			err = fmt.Errorf("unexpected indented lines after '%s: %s'", key, value)
+		case strings.HasPrefix(value, "["):
+			settings[key], err = yamlFlowList(value)
+		default:
+			settings[key], err = yamlScalar(value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", keyLine, err)
+		}
+	}
+	return settings, nil
+}
+
+// stripYAMLComment removes a trailing ' #' comment outside of quotes
+func stripYAMLComment(value string) string {
+	quote := byte(0)
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || value[i-1] == ' ' || value[i-1] == '\t'):
+			return strings.TrimSpace(value[:i])
+		}
+	}
+	return value
+}
+
+// hasYAMLContent reports whether lines hold anything but blanks and comments
+func hasYAMLContent(lines []string) bool {
+	for _, line := range lines {
+		if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			return true
+		}
+	}
+	return false
+}
+
+// yamlScalar decodes a plain, single- or double-quoted scalar, nil for null
+func yamlScalar(value string) (any, error) {
+	switch {
+	case value == "" || value == "~" || value == "null":
+		return nil, nil
+	case strings.HasPrefix(value, `"`):
+		s, err := strconv.Unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted string %s", value)
+		}
+		return s, nil
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return nil, fmt.Errorf("invalid quoted string %s", value)
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	case strings.HasPrefix(value, "{"):
+		return nil, fmt.Errorf("nested mappings are not supported")
+	}
+	return value, nil
+}
+
+// yamlFlowList decodes a '[a, "b"]' list of scalars
+func yamlFlowList(value string) (any, error) {
+	inner, ok := strings.CutPrefix(value, "[")
+	if inner, ok = strings.CutSuffix(inner, "]"); !ok {
+		return nil, fmt.Errorf("invalid list %s", value)
+	}
+	items := []any{}
+	if strings.TrimSpace(inner) == "" {
+		return items, nil
+	}
+	for _, item := range strings.Split(inner, ",") {
+		s, err := yamlScalar(strings.TrimSpace(item))
+		if err != nil || s == nil {
+			return nil, fmt.Errorf("invalid list item '%s'", strings.TrimSpace(item))
+		}
+		items = append(items, s)
+	}
+	return items, nil
+}
+
+// yamlBlockList decodes the '- item' lines of a block list, nil when there are none
+func yamlBlockList(lines []string) (any, error) {
+	var items []any
+	for _, line := range lines {
+		trimmed := stripYAMLComment(strings.TrimSpace(line))
+		if trimmed == "" {
+			continue
+		}
+		rest, ok := strings.CutPrefix(trimmed, "-")
+		if !ok {
+			return nil, fmt.Errorf("expected a '- item' list entry, got '%s'", trimmed)
+		}
+		s, err := yamlScalar(strings.TrimSpace(rest))
+		if err != nil || s == nil {
+			return nil, fmt.Errorf("invalid list item '%s'", trimmed)
+		}
+		items = append(items, s)
+	}
+	if items == nil {
+		return nil, nil
+	}
+	return items, nil
+}
+
+// yamlLiteralBlock joins the lines of a '|' block, without their common indentation,
+// keeping the final newline unless the block is '|-'
+func yamlLiteralBlock(lines []string, keepNewline bool) string {
+	indent := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			if n := len(line) - len(strings.TrimLeft(line, " \t")); indent < 0 || n < indent {
+				indent = n
+			}
+		}
+	}
+	var b strings.Builder
+	for _, line := range lines {
+		if len(line) >= indent && indent >= 0 {
+			line = line[indent:]
+		} else {
+			line = strings.TrimSpace(line)
+		}
+		b.WriteString(line + "\n")
+	}
+	block := strings.TrimRight(b.String(), "\n")
+	if keepNewline && block != "" {
+		block += "\n"
+	}
+	return block
+}
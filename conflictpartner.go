@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// conflictPairMarker marks the conflict partner comments of PRs
+const conflictPairMarker = "<!-- feature-branching:conflict-pair -->"
+
+// ConflictPairing identifies what a conflicting PR conflicts with
+type ConflictPairing struct {
+	PR            int      `json:"pr"`                       // Conflicting PR
+	Author        string   `json:"author"`                   // Author of the conflicting PR
+	Trunk         bool     `json:"trunk"`                    // The PR conflicts with trunk alone, no partner is involved
+	Partner       int      `json:"partner,omitempty"`        // First merged PR the conflict appears with, 0 when not found
+	PartnerAuthor string   `json:"partner_author,omitempty"` // Author of the partner
+	Pairwise      bool     `json:"pairwise"`                 // The PR also conflicts with trunk and the partner alone
+	Files         []string `json:"files"`                    // Conflicting files the probes looked for
+	Probes        int      `json:"probes"`                   // Probe merges run
+}
+
+// describe renders the pairing as a single line
+func (p *ConflictPairing) describe() string {
+	switch {
+	case p.Trunk:
+		return fmt.Sprintf("PR #%d conflicts with trunk itself", p.PR)
+	case p.Partner == 0:
+		return fmt.Sprintf("no single conflict partner found for PR #%d", p.PR)
+	case p.Pairwise:
+		return fmt.Sprintf("PR #%d conflicts with PR #%d", p.PR, p.Partner)
+	}
+	return fmt.Sprintf("PR #%d conflicts with the batch once PR #%d is merged, but not with PR #%d alone", p.PR, p.Partner, p.Partner)
+}
+
+// conflictProbe merges a PR branch into a probe state of the target branch in memory and
+// reports whether any of files conflicts; with no files, whether anything conflicts
+func conflictProbe(base, branch string, files []string) (bool, error) {
+	cmd := exec.Command("git", "merge-tree", "--write-tree", "--name-only", "--no-messages", base, branch)
+	output, err := cmd.Output()
+	if err == nil {
+		return false, nil
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		return false, fmt.Errorf("'git merge-tree' failed: %w", err)
+	}
+	// The output is the tree ID followed by the conflicted paths
+	conflicted := strings.Split(strings.TrimSpace(string(output)), "\n")[1:]
+	if len(files) == 0 {
+		return true, nil
+	}
+	return slices.ContainsFunc(conflicted, func(f string) bool { return slices.Contains(files, f) }), nil
+}
+
+// findConflictPartner bisects the PRs merged before a conflicting PR for the first one its
+// conflicting files conflict with: each probe merges the PR into the state of trunk with
+// the PRs up to one of them. The partner is then probed alone on trunk, telling a pairwise
+// conflict from one needing several PRs.
+func findConflictPartner(cfg Config, pr GitHubPR, conflict *ConflictError, merged []MergeRecord) (*ConflictPairing, error) {
+	branch := fmt.Sprintf("pr-%d", pr.Number)
+	pairing := &ConflictPairing{PR: pr.Number, Author: pr.Author, Files: conflict.Files}
+	probe := func(base string) (bool, error) {
+		pairing.Probes++
+		return conflictProbe(base, branch, conflict.Files)
+	}
+
+	conflicts, err := probe(cfg.TrunkBranch)
+	if err != nil {
+		return nil, err
+	}
+	if conflicts {
+		pairing.Trunk = true
+		return pairing, nil
+	}
+	if len(merged) == 0 {
+		return pairing, nil
+	}
+	states, err := probeStates(cfg, merged)
+	if err != nil {
+		return nil, err
+	}
+	if conflicts, err = probe(states[len(states)-1]); err != nil || !conflicts {
+		// Conflicts the in-memory merge does not reproduce, e.g. on restored ignored paths
+		return pairing, err
+	}
+
+	// Invariant: the PR merges cleanly with merged[:lo] and conflicts with merged[:hi]
+	lo, hi := 0, len(merged)
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		conflicts, err := probe(states[mid-1])
+		if err != nil {
+			return nil, err
+		}
+		if conflicts {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	partner := merged[hi-1]
+	pairing.Partner = partner.PR
+
+	if hi == 1 {
+		// The first merged PR sits on trunk alone already
+		pairing.Pairwise = true
+		return pairing, nil
+	}
+	alone, err := probeBranch(cfg.TrunkBranch, partner.Head)
+	if err != nil {
+		return pairing, nil
+	}
+	pairing.Pairwise, err = probe(alone)
+	return pairing, err
+}
+
+// probeStates returns for every merged PR the commit of trunk with the PRs up to it merged.
+// These are the commits of the merged PRs, except in single commit mode where the batch
+// is staged uncommitted and the states are rebuilt as probe branches.
+func probeStates(cfg Config, merged []MergeRecord) ([]string, error) {
+	states := make([]string, len(merged))
+	if cfg.CommitMode != commitModeSingle {
+		for i, m := range merged {
+			states[i] = m.Commit
+		}
+		return states, nil
+	}
+	base := cfg.TrunkBranch
+	for i, m := range merged {
+		state, err := probeBranch(base, m.Head)
+		if err != nil {
+			return nil, fmt.Errorf("rebuild state after PR #%d: %w", m.PR, err)
+		}
+		states[i], base = state, state
+	}
+	return states, nil
+}
+
+// probeBranch creates a dangling commit of trunk with the changes of head merged in, the
+// probe branch of a pairwise check; no ref or working tree is touched
+func probeBranch(trunk, head string) (string, error) {
+	output, err := runGitCommandWithOutput("merge-tree", "--write-tree", "--no-messages", trunk, head)
+	if err != nil {
+		return "", err
+	}
+	tree := strings.Fields(output)[0]
+	commit, err := runGitCommandWithOutput("commit-tree", tree, "-p", trunk, "-m", "conflict partner probe")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(commit), nil
+}
+
+// pairConflict looks for the conflict partner of a conflicting PR when enabled, filling the
+// authors from the batch. Probe failures are logged as warnings and yield no pairing.
+func pairConflict(cfg Config, pr GitHubPR, conflict *ConflictError, merged []MergeRecord, prs []GitHubPR) *ConflictPairing {
+	if !cfg.ConflictPartners {
+		return nil
+	}
+	if features, err := detectGitFeatures(); err == nil && !features.MergeTree {
+		slog.Warn("git does not support 'merge-tree --write-tree', skipping conflict partner detection", "git_version", features.Version)
+		return nil
+	}
+	pairing, err := findConflictPartner(cfg, pr, conflict, merged)
+	if err != nil {
+		slog.Warn("conflict partner detection failed for PR", "pr_number", pr.Number, "error", err)
+		return nil
+	}
+	for _, other := range prs {
+		if other.Number == pairing.Partner {
+			pairing.PartnerAuthor = other.Author
+		}
+	}
+	fmt.Printf("Conflict partner: %s (%d probe(s)).\n", pairing.describe(), pairing.Probes)
+	return pairing
+}
+
+// notifyConflictPair comments the pairing on both PRs, so their authors learn who to agree
+// with. Errors are logged as warnings since the run is already failing.
+func notifyConflictPair(client GitHubClient, cfg Config, pairing *ConflictPairing) {
+	if pairing == nil || pairing.Partner == 0 {
+		return
+	}
+	body, err := renderText(cfg, "conflict_pair", conflictPairData{
+		Target:          cfg.TargetBranch,
+		BatchID:         cfg.BatchID,
+		ConflictPairing: *pairing,
+	})
+	if err != nil {
+		slog.Warn("failed to build conflict partner comment", "error", err)
+		return
+	}
+	for _, number := range []int{pairing.PR, pairing.Partner} {
+		if err := upsertComment(client, number, conflictPairMarker, body); err != nil {
+			slog.Warn("failed to comment on PR", "pr_number", number, "error", err)
+		}
+	}
+}
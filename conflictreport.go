@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ConflictReport describes a squash merge conflict for artifact upload
+type ConflictReport struct {
+	PR           int              `json:"pr"`                // Conflicting PR number
+	Title        string           `json:"title"`             // Conflicting PR title
+	TrunkBranch  string           `json:"trunk_branch"`      // Base branch of the batch
+	TargetBranch string           `json:"target_branch"`     // Branch the PR was merged into
+	BatchID      string           `json:"batch_id"`          // Run in which the conflict occurred
+	MergedPRs    []int            `json:"merged_prs"`        // PRs merged before the conflict
+	GitOutput    string           `json:"git_output"`        // Raw git merge --squash output
+	Files        []ConflictFile   `json:"files"`             // Per-file conflict details
+	Partner      *ConflictPairing `json:"partner,omitempty"` // Conflict partner, when detected
+	GeneratedAt  time.Time        `json:"generated_at"`      // Report timestamp
+}
+
+// ConflictFile holds the conflict details of a single path
+type ConflictFile struct {
+	Path           string   `json:"path"`            // Conflicting file path
+	Hunks          []string `json:"hunks"`           // Conflict marker blocks found in the file
+	InvolvedPRs    []int    `json:"involved_prs"`    // PRs whose changes touch this path
+	SuggestedOwner string   `json:"suggested_owner"` // Top trunk blame author for the path
+}
+
+// writeConflictReport writes the conflict details to the configured path.
+// Errors are logged as warnings since the run is already failing.
+func writeConflictReport(cfg Config, pr GitHubPR, conflict *ConflictError, merged []MergeRecord) {
+	report := ConflictReport{
+		PR:           pr.Number,
+		Title:        pr.Title,
+		TrunkBranch:  cfg.TrunkBranch,
+		TargetBranch: cfg.TargetBranch,
+		BatchID:      cfg.BatchID,
+		MergedPRs:    make([]int, 0, len(merged)),
+		GitOutput:    conflict.GitOutput,
+		Partner:      conflict.Pairing,
+		GeneratedAt:  time.Now().UTC(),
+	}
+	for _, m := range merged {
+		report.MergedPRs = append(report.MergedPRs, m.PR)
+	}
+
+	for _, path := range conflict.Files {
+		report.Files = append(report.Files, ConflictFile{
+			Path:           path,
+			Hunks:          conflict.Hunks[path],
+			InvolvedPRs:    append(mergedPRsTouching(cfg, path, merged), pr.Number),
+			SuggestedOwner: topBlameAuthor(cfg.TrunkBranch, path),
+		})
+	}
+
+	// Conflict markers must stay readable, so HTML escaping is disabled
+	var data bytes.Buffer
+	enc := json.NewEncoder(&data)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		slog.Warn("conflict report serialization failed", "error", err)
+		return
+	}
+	if dir := filepath.Dir(cfg.ConflictReport); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			slog.Warn("failed to create conflict report dir", "error", err)
+			return
+		}
+	}
+	if err := os.WriteFile(cfg.ConflictReport, data.Bytes(), 0644); err != nil {
+		slog.Warn("failed to write conflict report", "error", err)
+		return
+	}
+	fmt.Printf("Conflict report written to '%s'.\n", cfg.ConflictReport)
+}
+
+// conflictHunks extracts the conflict marker blocks of a working tree file, each bounded
+// like command output
+func conflictHunks(path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var hunks []string
+	var current []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "<<<<<<< "):
+			current = []string{line}
+		case current != nil && strings.HasPrefix(line, ">>>>>>> "):
+			hunks = append(hunks, truncateOutput(strings.Join(append(current, line), "\n")))
+			current = nil
+		case current != nil:
+			current = append(current, line)
+		}
+	}
+	return hunks
+}
+
+// mergedPRsTouching returns the already merged PRs whose commit changed path
+func mergedPRsTouching(cfg Config, path string, merged []MergeRecord) []int {
+	output, err := runGitCommandWithOutput("log", "--format=%H",
+		fmt.Sprintf("%s..HEAD", cfg.TrunkBranch), "--", path)
+	if err != nil {
+		return nil
+	}
+	touched := make(map[string]struct{})
+	for _, sha := range strings.Fields(output) {
+		touched[sha] = struct{}{}
+	}
+
+	var prs []int
+	for _, m := range merged {
+		if _, ok := touched[m.Commit]; ok {
+			prs = append(prs, m.PR)
+		}
+	}
+	return prs
+}
+
+// topBlameAuthor returns the author owning most lines of path on rev
+func topBlameAuthor(rev, path string) string {
+	output, err := runGitCommandWithOutput("blame", "--line-porcelain", rev, "--", path)
+	if err != nil {
+		return ""
+	}
+	counts := make(map[string]int)
+	best := ""
+	for _, line := range strings.Split(output, "\n") {
+		author, ok := strings.CutPrefix(line, "author ")
+		if !ok {
+			continue
+		}
+		counts[author]++
+		if counts[author] > counts[best] || best == "" {
+			best = author
+		}
+	}
+	return best
+}
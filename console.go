@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// ANSI escape sequences used for colored output
+const (
+	ansiReset  = "\033[0m"
+	ansiBold   = "\033[1m"
+	ansiDim    = "\033[2m"
+	ansiRed    = "\033[31m"
+	ansiGreen  = "\033[32m"
+	ansiYellow = "\033[33m"
+	ansiCyan   = "\033[36m"
+)
+
+// console decorates progress output when attached to a terminal.
+// Non-TTY output (CI logs, redirected files) stays plain.
+type console struct {
+	tty   bool      // stdout is a terminal
+	color bool      // ANSI colors enabled
+	start time.Time // progress start, for elapsed time
+}
+
+// newConsole detects the terminal and honors --no_color and the NO_COLOR convention
+func newConsole(cfg Config) *console {
+	tty := isTerminal(os.Stdout)
+	return &console{
+		tty:   tty,
+		color: tty && !cfg.NoColor && os.Getenv("NO_COLOR") == "",
+		start: time.Now(),
+	}
+}
+
+// isTerminal reports whether f is a character device such as a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// paint wraps s in the given ANSI style when colors are enabled
+func (c *console) paint(style, s string) string {
+	if !c.color {
+		return s
+	}
+	return style + s + ansiReset
+}
+
+// ok, warn and fail color PR status words
+func (c *console) ok(s string) string   { return c.paint(ansiGreen, s) }
+func (c *console) warn(s string) string { return c.paint(ansiYellow, s) }
+func (c *console) fail(s string) string { return c.paint(ansiRed+ansiBold, s) }
+
+// progress returns the running batch summary appended to PR lines on a terminal
+func (c *console) progress(merged, done, total int) string {
+	if !c.tty {
+		return ""
+	}
+	elapsed := time.Since(c.start).Round(100 * time.Millisecond)
+	return " " + c.paint(ansiDim, fmt.Sprintf("[%d merged, %d/%d done, %s]", merged, done, total, elapsed))
+}
+
+// current prints the PR being merged; on a terminal the PR marker is highlighted
+func (c *console) current(i, total int, pr GitHubPR) {
+	marker := fmt.Sprintf("#%d", pr.Number)
+	fmt.Printf("  [%d/%d] %s \"%s\" ... ", i+1, total, c.paint(ansiCyan, marker), pr.Title)
+}
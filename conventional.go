@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// conventionalMarker identifies the title suggestion comment on a PR
+const conventionalMarker = "<!-- feature-branching:conventional-title -->"
+
+// conventionalTypes lists the accepted conventional commit types
+var conventionalTypes = []string{"feat", "fix", "docs", "style", "refactor", "perf", "test", "build", "ci", "chore", "revert"}
+
+// conventionalTitlePattern matches "type(scope)!: subject" with an accepted type
+var conventionalTitlePattern = regexp.MustCompile(`^(` + strings.Join(conventionalTypes, "|") + `)(\([^()\s][^()]*\))?!?: \S`)
+
+// titleTypeAliases maps loose title prefixes and leading verbs to conventional types
+var titleTypeAliases = map[string]string{
+	"feat": "feat", "feature": "feat", "add": "feat", "adds": "feat", "added": "feat", "implement": "feat", "support": "feat",
+	"fix": "fix", "fixes": "fix", "fixed": "fix", "bug": "fix", "bugfix": "fix", "hotfix": "fix",
+	"doc": "docs", "docs": "docs", "documentation": "docs",
+	"refactor": "refactor", "cleanup": "refactor",
+	"perf": "perf", "performance": "perf", "optimize": "perf",
+	"test": "test", "tests": "test",
+	"build": "build", "deps": "build", "bump": "build",
+	"ci": "ci", "chore": "chore",
+	"revert": "revert", "reverts": "revert",
+	"style": "style", "format": "style",
+}
+
+// filterConventionalTitle requires a conventional commit title when configured,
+// since PR titles become the commit subjects of the target branch
+func filterConventionalTitle(cfg Config, pr GitHubPR) (bool, string) {
+	if !cfg.ConventionalTitles {
+		return true, "conventional titles not required"
+	}
+	if !conventionalTitlePattern.MatchString(pr.Title) {
+		return false, fmt.Sprintf("title is not a conventional commit (suggested: %q)", suggestConventionalTitle(pr.Title))
+	}
+	return true, "title is a conventional commit"
+}
+
+// suggestConventionalTitle proposes a conventional commit title for a free-form title,
+// reusing a loose "Type: subject" / "[type] subject" prefix or the leading verb
+func suggestConventionalTitle(title string) string {
+	subject := strings.TrimSpace(title)
+	typ := ""
+
+	if rest, ok := strings.CutPrefix(subject, "["); ok {
+		if tag, after, ok := strings.Cut(rest, "]"); ok {
+			if t, known := titleTypeAliases[strings.ToLower(strings.TrimSpace(tag))]; known {
+				typ, subject = t, strings.TrimSpace(after)
+			}
+		}
+	}
+	if typ == "" {
+		if prefix, after, ok := strings.Cut(subject, ":"); ok {
+			word := strings.ToLower(strings.TrimSpace(strings.SplitN(prefix, "(", 2)[0]))
+			if t, known := titleTypeAliases[word]; known {
+				typ, subject = t, strings.TrimSpace(after)
+			}
+		}
+	}
+	if typ == "" {
+		first := strings.ToLower(strings.Trim(strings.SplitN(subject, " ", 2)[0], ".,;"))
+		typ = "chore"
+		if t, known := titleTypeAliases[first]; known {
+			typ = t
+		}
+	}
+
+	// Conventional subjects start lowercase unless they begin with an acronym
+	if r, size := utf8.DecodeRuneInString(subject); size > 0 {
+		if next, _ := utf8.DecodeRuneInString(subject[size:]); !unicode.IsUpper(next) {
+			subject = string(unicode.ToLower(r)) + subject[size:]
+		}
+	}
+	return typ + ": " + strings.TrimRight(subject, ".")
+}
+
+// commentTitleSuggestions posts a title suggestion on labeled PRs excluded only
+// because of their title. Errors are logged as warnings.
+func commentTitleSuggestions(client GitHubClient, cfg Config, prs []GitHubPR, cache *EligibilityCache) {
+	for _, pr := range prs {
+		if e := cache.lookup(pr); e != nil && e.Commented {
+			continue
+		}
+		verdicts := cache.evaluate(cfg, pr)
+		if isEligible(verdicts) {
+			continue
+		}
+		onlyTitle := true
+		for _, v := range verdicts {
+			if !v.Passed && v.Filter != "conventional title" {
+				onlyTitle = false
+			}
+		}
+		if !onlyTitle {
+			continue
+		}
+
+		body, err := renderText(cfg, "title_suggestion", titleSuggestionData{
+			Target:     cfg.TargetBranch,
+			Title:      pr.Title,
+			Suggestion: suggestConventionalTitle(pr.Title),
+		})
+		if err != nil {
+			slog.Warn("failed to build title suggestion for PR", "pr_number", pr.Number, "error", err)
+			continue
+		}
+		if err := upsertComment(client, pr.Number, conventionalMarker, body); err != nil {
+			slog.Warn("failed to comment title suggestion on PR", "pr_number", pr.Number, "error", err)
+			continue
+		}
+		if e := cache.lookup(pr); e != nil {
+			e.Commented = true
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// dependsOnPattern matches a 'Depends-on: owner/repo#N' line of a PR body
+var dependsOnPattern = regexp.MustCompile(`(?mi)^[ \t]*Depends-on:[ \t]*([\w.-]+/[\w.-]+)#(\d+)[ \t]*\r?$`)
+
+// PRDependency is a cross-repo dependency declared by a PR of the batch
+type PRDependency struct {
+	PR      int    `json:"pr"`      // Declaring PR
+	Repo    string `json:"repo"`    // Dependency repository as "owner/repo"
+	Number  int    `json:"number"`  // Dependency PR number
+	Present bool   `json:"present"` // Whether the dependency was in its candidate branch when checked
+}
+
+// String renders the dependency as it is declared
+func (d PRDependency) String() string {
+	return fmt.Sprintf("%s#%d", d.Repo, d.Number)
+}
+
+// RunManifest records the outcome of one repository of a multi-repo run, so the other
+// repositories can check their cross-repo dependencies against it
+type RunManifest struct {
+	Repo         string         `json:"repo"`         // Repository as "owner/repo"
+	BatchID      string         `json:"batch_id"`     // Run ID shared by every repository of the run
+	Merged       []int          `json:"merged"`       // PRs published in the candidate branch
+	Dependencies []PRDependency `json:"dependencies"` // Cross-repo dependencies of the candidate PRs
+}
+
+// parseDependencies extracts the cross-repo dependencies of a PR; references to the
+// repository of the PR itself are ignored
+func parseDependencies(cfg Config, pr GitHubPR) []PRDependency {
+	var deps []PRDependency
+	for _, m := range dependsOnPattern.FindAllStringSubmatch(pr.Body, -1) {
+		if strings.EqualFold(m[1], cfg.Owner+"/"+cfg.Repo) {
+			continue
+		}
+		number, _ := strconv.Atoi(m[2])
+		deps = append(deps, PRDependency{PR: pr.Number, Repo: m[1], Number: number})
+	}
+	return deps
+}
+
+// runManifestPath returns the manifest file of a repository in the run manifest directory
+func runManifestPath(dir, repo string) string {
+	return filepath.Join(dir, filepath.FromSlash(strings.ToLower(repo))+".json")
+}
+
+// loadRunManifest reads the manifest of a repository; a missing manifest means nothing
+// was published for it yet
+func loadRunManifest(dir, repo string) (RunManifest, error) {
+	var m RunManifest
+	data, err := os.ReadFile(runManifestPath(dir, repo))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("parse run manifest of %s failed: %w", repo, err)
+	}
+	return m, nil
+}
+
+// dependencyPresent reports whether the dependency PR is published in its candidate branch for this run
+func dependencyPresent(dir, batchID string, dep PRDependency) (bool, error) {
+	m, err := loadRunManifest(dir, dep.Repo)
+	if err != nil {
+		return false, err
+	}
+	return m.BatchID == batchID && slices.Contains(m.Merged, dep.Number), nil
+}
+
+// gateDependencies leaves out the PRs whose cross-repo dependencies are missing from the
+// candidate branches of this run. Dependencies are only coordinated in multi-repo runs,
+// which share a run manifest directory.
+func gateDependencies(cfg Config, prs []GitHubPR, report *RunReport) ([]GitHubPR, []PRDependency) {
+	if cfg.RunManifestDir == "" {
+		return prs, nil
+	}
+
+	var kept []GitHubPR
+	var all []PRDependency
+	for _, pr := range prs {
+		deps := parseDependencies(cfg, pr)
+		var missing []string
+		for i := range deps {
+			present, err := dependencyPresent(cfg.RunManifestDir, cfg.BatchID, deps[i])
+			if err != nil {
+				slog.Warn("failed to check dependency of PR", "dependency", deps[i], "pr_number", pr.Number, "error", err)
+			}
+			deps[i].Present = present
+			if !present {
+				missing = append(missing, deps[i].String())
+			}
+		}
+		all = append(all, deps...)
+		if len(missing) > 0 {
+			detail := fmt.Sprintf("depends on %s, missing from the candidate branch of this run", strings.Join(missing, ", "))
+			fmt.Printf("Holding back PR #%d: %s.\n", pr.Number, detail)
+			report.add(pr, OutcomeBlocked, detail, 0)
+			continue
+		}
+		kept = append(kept, pr)
+	}
+	return kept, all
+}
+
+// writeRunManifest publishes the merged PRs and dependencies of this repository to the run.
+// Errors are logged as warnings; dependents then treat the PRs as missing.
+func writeRunManifest(cfg Config, merged []MergeRecord, deps []PRDependency) {
+	if cfg.RunManifestDir == "" {
+		return
+	}
+	m := RunManifest{
+		Repo:         cfg.Owner + "/" + cfg.Repo,
+		BatchID:      cfg.BatchID,
+		Merged:       []int{},
+		Dependencies: deps,
+	}
+	for _, rec := range merged {
+		m.Merged = append(m.Merged, rec.PR)
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		slog.Warn("run manifest serialization failed", "error", err)
+		return
+	}
+	file := runManifestPath(cfg.RunManifestDir, m.Repo)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		slog.Warn("failed to create run manifest dir", "error", err)
+		return
+	}
+	if err := os.WriteFile(file, append(data, '\n'), 0644); err != nil {
+		slog.Warn("failed to write run manifest", "error", err)
+	}
+}
+
+// staleDependencyRepos returns the repositories of a run whose recorded dependencies no
+// longer match the published candidates, so they must be rebuilt
+func staleDependencyRepos(dir, batchID string, repos []string) []string {
+	var stale []string
+	for _, repo := range repos {
+		m, err := loadRunManifest(dir, repo)
+		if err != nil {
+			slog.Warn("failed to load run manifest", "repo", repo, "error", err)
+			continue
+		}
+		for _, dep := range m.Dependencies {
+			present, err := dependencyPresent(dir, batchID, dep)
+			if err == nil && present != dep.Present {
+				stale = append(stale, repo)
+				break
+			}
+		}
+	}
+	return stale
+}
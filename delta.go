@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+)
+
+// Constants for delta notifications
+const (
+	previousTargetRef = "refs/feature-branching/previous"  // Local ref the previously published target is fetched into
+	deltaMarker       = "<!-- feature-branching:delta -->" // Marker of delta comments
+)
+
+// revisionChange is a PR kept in the batch at another head revision
+type revisionChange struct {
+	PR   int    // PR number
+	From string // Head merged by the previous candidate
+	To   string // Head merged now
+}
+
+// batchDelta describes how a candidate differs from the previously published one
+type batchDelta struct {
+	Entered []MergeRecord    // PRs new to the batch
+	Left    []MergeRecord    // PRs of the previous batch dropped since
+	Changed []revisionChange // PRs merged again at another revision
+}
+
+// empty reports whether the candidate has the same PRs at the same revisions
+func (d batchDelta) empty() bool {
+	return len(d.Entered) == 0 && len(d.Left) == 0 && len(d.Changed) == 0
+}
+
+// loadPreviousMerges reads the merges of the published target branch the lease pins,
+// nil when the branch does not exist yet. Errors are logged as warnings and make
+// every PR count as entered, since they only cost a larger notification.
+func loadPreviousMerges(cfg Config, lease pushLease) []MergeRecord {
+	if lease.Target == "" {
+		return nil
+	}
+	if err := runOriginGit("fetch", "origin", "+refs/heads/"+cfg.TargetBranch+":"+previousTargetRef); err != nil {
+		slog.Warn("failed to fetch the previous target branch", "branch", cfg.TargetBranch, "error", err)
+		return nil
+	}
+	history, err := loadRefHistoryAt(lease.Target)
+	if err != nil {
+		slog.Warn("failed to read the history of the previous target branch", "branch", cfg.TargetBranch, "error", err)
+		return nil
+	}
+	return history.Merges
+}
+
+// diffBatches compares the merges of the new candidate with the previous one. Revisions
+// are compared when both histories recorded the merged heads.
+func diffBatches(previous, merged []MergeRecord) batchDelta {
+	var d batchDelta
+	before := make(map[int]MergeRecord, len(previous))
+	for _, m := range previous {
+		before[m.PR] = m
+	}
+	for _, m := range merged {
+		old, ok := before[m.PR]
+		switch {
+		case !ok:
+			d.Entered = append(d.Entered, m)
+		case old.Head != "" && m.Head != "" && old.Head != m.Head:
+			d.Changed = append(d.Changed, revisionChange{PR: m.PR, From: old.Head, To: m.Head})
+		}
+	}
+	for _, m := range previous {
+		if !slices.ContainsFunc(merged, func(n MergeRecord) bool { return n.PR == m.PR }) {
+			d.Left = append(d.Left, m)
+		}
+	}
+	return d
+}
+
+// publishDelta notifies only what changed since the previous candidate: a delta comment
+// on the tracking issue and the compare comment on the PRs that entered or changed.
+// Errors are logged as warnings since the branch has already been pushed.
+func publishDelta(client GitHubClient, cfg Config, previous, merged []MergeRecord, diff *DiffSummary) {
+	delta := diffBatches(previous, merged)
+	if delta.empty() {
+		fmt.Println("Batch unchanged since the previous candidate: nothing to notify.")
+		return
+	}
+	fmt.Printf("Batch delta: %d PR(s) entered, %d left, %d at a new revision.\n",
+		len(delta.Entered), len(delta.Left), len(delta.Changed))
+
+	if cfg.TrackingIssue > 0 {
+		data := deltaCommentData{
+			WebURL:  cfg.WebURL,
+			Owner:   cfg.Owner,
+			Repo:    cfg.Repo,
+			Trunk:   cfg.TrunkBranch,
+			Target:  cfg.TargetBranch,
+			BatchID: cfg.BatchID,
+			Entered: delta.Entered,
+			Left:    delta.Left,
+			Changed: delta.Changed,
+		}
+		if diff != nil {
+			data.Diff = diff.markdown()
+		}
+		body, err := renderText(cfg, "delta_comment", data)
+		if err == nil {
+			err = client.CreateIssueComment(cfg.TrackingIssue, deltaMarker+"\n"+body)
+		}
+		if err != nil {
+			slog.Warn("failed to post batch delta on tracking issue", "issue_number", cfg.TrackingIssue, "error", err)
+		}
+	}
+
+	if cfg.CompareComment {
+		body, err := compareCommentBody(cfg, merged, diff)
+		if err != nil {
+			slog.Warn("failed to build compare comment", "error", err)
+			return
+		}
+		var notified []int
+		for _, m := range delta.Entered {
+			notified = append(notified, m.PR)
+		}
+		for _, c := range delta.Changed {
+			notified = append(notified, c.PR)
+		}
+		for _, pr := range notified {
+			if err := upsertComment(client, pr, compareMarker, body); err != nil {
+				slog.Warn("failed to comment on PR", "pr_number", pr, "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/josedpiambav/feature/trailers"
+)
+
+// DepsGroup records the dependency update PRs collapsed into a single commit
+type DepsGroup struct {
+	Commit string   `json:"commit"` // Combined commit on the target branch
+	PRs    []int    `json:"prs"`    // Dependency update PRs, in merge order
+	Titles []string `json:"titles"` // Titles of the PRs, in the same order
+}
+
+// markdown renders the group for the job summary
+func (g *DepsGroup) markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%d dependency update(s)** grouped into `%s`:\n", len(g.PRs), shortSHA(g.Commit))
+	for i, n := range g.PRs {
+		fmt.Fprintf(&b, "- #%d %s\n", n, g.Titles[i])
+	}
+	return b.String()
+}
+
+// isDepsPR reports whether a PR is a dependency update, opened by one of the --deps_authors
+// or labeled with one of the --deps_labels
+func isDepsPR(cfg Config, pr GitHubPR) bool {
+	if slices.ContainsFunc(cfg.DepsAuthors, func(a string) bool { return strings.EqualFold(a, pr.Author) }) {
+		return true
+	}
+	return len(cfg.DepsLabels) > 0 && hasAnyLabel(pr.Labels, cfg.DepsLabels)
+}
+
+// orderDepsLast moves the dependency update PRs to the end of the batch, keeping the
+// relative order otherwise, so their commits can be collapsed once merged
+func orderDepsLast(cfg Config, prs []GitHubPR) []GitHubPR {
+	ordered := slices.Clone(prs)
+	slices.SortStableFunc(ordered, func(a, b GitHubPR) int {
+		switch da, db := isDepsPR(cfg, a), isDepsPR(cfg, b); {
+		case da == db:
+			return 0
+		case db:
+			return -1
+		}
+		return 1
+	})
+	return ordered
+}
+
+// mustGroupDeps enforces the collapse of the dependency update commits
+func mustGroupDeps(cfg Config, prs []GitHubPR, merges []MergeRecord, report *RunReport) []MergeRecord {
+	merges, err := groupDeps(cfg, prs, merges, report)
+	if err != nil {
+		log.Fatal("error grouping dependency updates:", err)
+	}
+	return merges
+}
+
+// groupDeps collapses the commits of the dependency update PRs, merged last, into a single
+// squash commit listing them. Fewer than two merged updates are left as they are. The
+// records of the updates point at the combined commit, as in single commit mode.
+func groupDeps(cfg Config, prs []GitHubPR, merges []MergeRecord, report *RunReport) ([]MergeRecord, error) {
+	byNumber := make(map[int]GitHubPR, len(prs))
+	for _, pr := range prs {
+		byNumber[pr.Number] = pr
+	}
+	start := len(merges)
+	for start > 0 && isDepsPR(cfg, byNumber[merges[start-1].PR]) {
+		start--
+	}
+	if len(merges)-start < 2 {
+		return merges, nil
+	}
+
+	group := &DepsGroup{}
+	var sources []trailers.Source
+	var body strings.Builder
+	for _, m := range merges[start:] {
+		title := byNumber[m.PR].Title
+		group.PRs = append(group.PRs, m.PR)
+		group.Titles = append(group.Titles, title)
+		sources = append(sources, trailers.Source{PR: m.PR, HeadSHA: m.Head})
+		fmt.Fprintf(&body, "- #%d %s\n", m.PR, title)
+	}
+	if err := runGitCommand("reset", "--soft", merges[start].Commit+"^1"); err != nil {
+		return nil, fmt.Errorf("reset before the dependency updates failed: %w", err)
+	}
+	subject := fmt.Sprintf("Update dependencies (%d PR(s))", len(group.PRs))
+	if err := runGitCommand("commit", "-m", subject, "-m", prCommitMessage(cfg, strings.TrimRight(body.String(), "\n"), sources...)); err != nil {
+		return nil, fmt.Errorf("create dependency updates commit failed: %w", err)
+	}
+	head, err := revParse("HEAD")
+	if err != nil {
+		head = "unknown"
+	}
+	group.Commit = head
+
+	merges = slices.Clone(merges)
+	for i := start; i < len(merges); i++ {
+		merges[i].Commit = head
+	}
+	report.depsGrouped(group)
+	numbers := make([]string, len(group.PRs))
+	for i, n := range group.PRs {
+		numbers[i] = fmt.Sprintf("#%d", n)
+	}
+	fmt.Printf("Grouped %d dependency update PR(s) into %s: %s\n", len(group.PRs), shortSHA(head), strings.Join(numbers, ", "))
+	return merges, nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Limits of the rendered batch diff summary
+const (
+	diffSummaryDirs  = 10 // Top-level directories listed before collapsing the rest
+	diffSummaryFiles = 5  // Riskiest files listed
+)
+
+// diffRootDir names files at the repository root in the directory breakdown
+const diffRootDir = "(root)"
+
+// DiffSummary is the aggregate diff of the candidate branch against trunk
+type DiffSummary struct {
+	Files       int         `json:"files"`       // Files changed
+	Insertions  int         `json:"insertions"`  // Lines added
+	Deletions   int         `json:"deletions"`   // Lines removed
+	Directories []PathChurn `json:"directories"` // Top-level directories touched, by churn
+	Riskiest    []PathChurn `json:"riskiest"`    // Files with the highest churn
+}
+
+// PathChurn is the churn (lines added plus removed) of a file or directory
+type PathChurn struct {
+	Path  string `json:"path"`            // File or top-level directory
+	Files int    `json:"files,omitempty"` // Files changed below a directory
+	Churn int    `json:"churn"`           // Lines added plus removed; binary files count as 0
+}
+
+// summarizeBatchDiff computes the diff summary of the built candidate, logging failures
+// as warnings since the summary is informational
+func summarizeBatchDiff(cfg Config) *DiffSummary {
+	summary, err := batchDiffSummary(cfg)
+	if err != nil {
+		slog.Warn("failed to summarize batch diff", "error", err)
+		return nil
+	}
+	fmt.Printf("Batch diff against '%s': %d file(s) changed, +%d -%d in %d top-level dir(s).\n",
+		cfg.TrunkBranch, summary.Files, summary.Insertions, summary.Deletions, len(summary.Directories))
+	setOutput(cfg, "files_changed", strconv.Itoa(summary.Files))
+	return summary
+}
+
+// batchDiffSummary aggregates 'git diff --numstat' of the target branch against trunk.
+// The bot bookkeeping files are left out since every candidate changes them.
+func batchDiffSummary(cfg Config) (*DiffSummary, error) {
+	output, err := runGitCommandWithOutput("diff", "--numstat", "-z", "--no-renames", cfg.TrunkBranch, cfg.TargetBranch, "--",
+		".", ":(exclude)"+refHistoryFile, ":(exclude)"+blameIgnoreRevsFile)
+	if err != nil {
+		return nil, fmt.Errorf("diff against trunk failed: %w", err)
+	}
+
+	summary := &DiffSummary{}
+	dirs := make(map[string]*PathChurn)
+	var files []PathChurn
+	for _, record := range strings.Split(output, "\x00") {
+		fields := strings.SplitN(record, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		// Binary files report '-' for both counts
+		added, _ := strconv.Atoi(fields[0])
+		deleted, _ := strconv.Atoi(fields[1])
+		file := fields[2]
+
+		summary.Files++
+		summary.Insertions += added
+		summary.Deletions += deleted
+		files = append(files, PathChurn{Path: file, Churn: added + deleted})
+
+		dir := diffRootDir
+		if top, _, ok := strings.Cut(file, "/"); ok {
+			dir = top + "/"
+		}
+		if dirs[dir] == nil {
+			dirs[dir] = &PathChurn{Path: dir}
+		}
+		dirs[dir].Files++
+		dirs[dir].Churn += added + deleted
+	}
+
+	for _, d := range dirs {
+		summary.Directories = append(summary.Directories, *d)
+	}
+	sortByChurn(summary.Directories)
+	sortByChurn(files)
+	summary.Riskiest = files[:min(len(files), diffSummaryFiles)]
+	return summary, nil
+}
+
+// sortByChurn orders paths by descending churn, then by path
+func sortByChurn(paths []PathChurn) {
+	sort.Slice(paths, func(i, j int) bool {
+		if paths[i].Churn != paths[j].Churn {
+			return paths[i].Churn > paths[j].Churn
+		}
+		return paths[i].Path < paths[j].Path
+	})
+}
+
+// markdown renders the summary for the job summary and notification comments
+func (s *DiffSummary) markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%d file(s) changed**, +%d -%d\n", s.Files, s.Insertions, s.Deletions)
+	if len(s.Directories) > 0 {
+		b.WriteString("\n| Directory | Files | Churn |\n| --- | ---: | ---: |\n")
+		for _, d := range s.Directories[:min(len(s.Directories), diffSummaryDirs)] {
+			fmt.Fprintf(&b, "| `%s` | %d | %d |\n", d.Path, d.Files, d.Churn)
+		}
+		if rest := len(s.Directories) - diffSummaryDirs; rest > 0 {
+			fmt.Fprintf(&b, "\n...and %d more director(ies).\n", rest)
+		}
+	}
+	if len(s.Riskiest) > 0 {
+		b.WriteString("\nRiskiest files by churn:\n")
+		for _, f := range s.Riskiest {
+			fmt.Fprintf(&b, "- `%s` (%d line(s))\n", f.Path, f.Churn)
+		}
+	}
+	return b.String()
+}
+
+// writeBatchSummary appends the batch diff summary and the grouped dependency updates
+// to the GitHub job summary
+func writeBatchSummary(cfg Config, report *RunReport) {
+	if cfg.StepSummary == "" || (report.Diff == nil && report.Deps == nil) {
+		return
+	}
+	f, err := os.OpenFile(cfg.StepSummary, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		slog.Warn("failed to open job summary file", "error", err)
+		return
+	}
+	defer f.Close()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "### `%s` vs `%s`\n\n", cfg.TargetBranch, cfg.TrunkBranch)
+	if report.Diff != nil {
+		b.WriteString(report.Diff.markdown() + "\n")
+	}
+	if report.Deps != nil {
+		b.WriteString(report.Deps.markdown() + "\n")
+	}
+	if _, err := f.WriteString(b.String()); err != nil {
+		slog.Warn("failed to write job summary", "error", err)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// directivesKey opens the block of per-PR overrides in a fenced block of the PR description
+const directivesKey = "mergebot:"
+
+// prDirectiveValues lists every directive PR authors may set and its accepted values
+var prDirectiveValues = map[string][]string{
+	"strategy": {"squash", "merge"}, // Commit strategy of the PR, overriding a per-PR --commit_mode
+	"verify":   {"skip", "run"},     // Opt out of verify_cmd, honored when every batched PR opts out
+	"order":    {"first", "last"},   // Position of the PR in the batch
+}
+
+// prDirectives are the per-PR overrides parsed from the PR description, e.g.
+//
+//	```yaml
+//	mergebot:
+//	  strategy: merge
+//	  order: last
+//	```
+type prDirectives map[string]string
+
+// parsePRDirectives reads the first fenced 'mergebot:' block of a PR description,
+// returning nil when there is none
+func parsePRDirectives(body string) (prDirectives, error) {
+	lines := strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		fence := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(fence, "```") && !strings.HasPrefix(fence, "~~~") {
+			continue
+		}
+		marker := fence[:3]
+		end := i + 1
+		for end < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[end]), marker) {
+			end++
+		}
+		if block := lines[i+1 : end]; isDirectivesBlock(block) {
+			return parseDirectivesBlock(block)
+		}
+		i = end
+	}
+	return nil, nil
+}
+
+// isDirectivesBlock reports whether the first non-blank line of a fenced block opens the directives
+func isDirectivesBlock(block []string) bool {
+	for _, line := range block {
+		if strings.TrimSpace(line) != "" {
+			return strings.TrimSpace(line) == directivesKey
+		}
+	}
+	return false
+}
+
+// parseDirectivesBlock parses the indented 'key: value' pairs under the 'mergebot:' key
+func parseDirectivesBlock(block []string) (prDirectives, error) {
+	directives := prDirectives{}
+	opened := false
+	for _, line := range block {
+		if before, _, found := strings.Cut(line, " #"); found {
+			line = before
+		}
+		text := strings.TrimSpace(line)
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if !opened {
+			opened = true
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			return nil, fmt.Errorf("unexpected line '%s' outside the '%s' block", text, strings.TrimSuffix(directivesKey, ":"))
+		}
+		key, value, found := strings.Cut(text, ":")
+		if !found {
+			return nil, fmt.Errorf("invalid directive '%s' (expected key: value)", text)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.ToLower(strings.Trim(strings.TrimSpace(value), `"'`))
+		if _, dup := directives[key]; dup {
+			return nil, fmt.Errorf("duplicate directive '%s'", key)
+		}
+		directives[key] = value
+	}
+	return directives, nil
+}
+
+// validate checks the directives against the keys permitted by --pr_directives
+func (d prDirectives) validate(cfg Config) error {
+	for _, key := range sortedDirectiveKeys(d) {
+		values, known := prDirectiveValues[key]
+		if !known {
+			return fmt.Errorf("unknown directive '%s'", key)
+		}
+		if !slices.Contains(cfg.PRDirectives, key) {
+			return fmt.Errorf("directive '%s' is not permitted", key)
+		}
+		if !slices.Contains(values, d[key]) {
+			return fmt.Errorf("invalid value '%s' for directive '%s' (expected %s)", d[key], key, strings.Join(values, " or "))
+		}
+	}
+	return nil
+}
+
+// String formats the directives as sorted key=value pairs
+func (d prDirectives) String() string {
+	var pairs []string
+	for _, key := range sortedDirectiveKeys(d) {
+		pairs = append(pairs, key+"="+d[key])
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// sortedDirectiveKeys returns the directive keys in sorted order
+func sortedDirectiveKeys(d prDirectives) []string {
+	keys := make([]string, 0, len(d))
+	for key := range d {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// directivesOf returns the valid directives of a PR; invalid blocks are ignored, since the
+// eligibility filter already rejects them for PRs coming from the API
+func directivesOf(cfg Config, pr GitHubPR) prDirectives {
+	if len(cfg.PRDirectives) == 0 {
+		return nil
+	}
+	d, err := parsePRDirectives(pr.Body)
+	if err != nil || d.validate(cfg) != nil {
+		return nil
+	}
+	return d
+}
+
+// filterDirectives rejects PRs whose 'mergebot:' block is malformed or sets a directive
+// outside the --pr_directives allowlist
+func filterDirectives(cfg Config, pr GitHubPR) (bool, string) {
+	if len(cfg.PRDirectives) == 0 {
+		return true, "PR directives disabled"
+	}
+	d, err := parsePRDirectives(pr.Body)
+	if err == nil {
+		err = d.validate(cfg)
+	}
+	if err != nil {
+		return false, fmt.Sprintf("invalid '%s' block: %s", strings.TrimSuffix(directivesKey, ":"), err)
+	}
+	if len(d) == 0 {
+		return true, "no directives"
+	}
+	return true, "directives " + d.String()
+}
+
+// prCommitMode returns the commit mode of a PR, honoring its strategy directive unless the
+// whole batch is squashed into a single commit
+func prCommitMode(cfg Config, pr GitHubPR) string {
+	if cfg.CommitMode == commitModeSingle {
+		return cfg.CommitMode
+	}
+	switch directivesOf(cfg, pr)["strategy"] {
+	case "merge":
+		return commitModeMerge
+	case "squash":
+		return commitModePerPR
+	}
+	return cfg.CommitMode
+}
+
+// orderByDirectives moves the PRs asking to go first to the front of the batch and the
+// ones asking to go last to its end, keeping the relative order otherwise
+func orderByDirectives(cfg Config, prs []GitHubPR) {
+	if len(cfg.PRDirectives) == 0 {
+		return
+	}
+	rank := func(pr GitHubPR) int {
+		switch directivesOf(cfg, pr)["order"] {
+		case "first":
+			return -1
+		case "last":
+			return 1
+		}
+		return 0
+	}
+	slices.SortStableFunc(prs, func(a, b GitHubPR) int { return rank(a) - rank(b) })
+}
+
+// batchSkipsVerification reports whether every PR of the batch opted out of verification
+func batchSkipsVerification(cfg Config, prs []GitHubPR) bool {
+	if len(prs) == 0 {
+		return false
+	}
+	for _, pr := range prs {
+		if directivesOf(cfg, pr)["verify"] != "skip" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Repository represents a simplified organization repository
+type Repository struct {
+	Name          string   `json:"name"`           // Repository name
+	FullName      string   `json:"full_name"`      // Owner and name, as owner/name
+	CloneURL      string   `json:"clone_url"`      // HTTPS clone URL
+	DefaultBranch string   `json:"default_branch"` // Default branch name
+	Topics        []string `json:"topics"`         // Repository topics
+	Archived      bool     `json:"archived"`       // Archived repositories are read-only
+}
+
+// runOrgBatches discovers the organization repositories matching the configured
+// topic and name pattern and batches each of them in a fresh clone. Every repository
+// runs in its own bot process so a failing repository does not abort the others.
+// Repositories whose cross-repo dependencies changed once every repository ran are
+// rebuilt, until the candidates of the run agree. Repositories run one at a time unless
+// concurrency groups or org_parallelism allow more.
+func runOrgBatches(cfg Config, args []string) {
+	client := mustNewGitHubClient(cfg)
+	repos, err := client.ListOrgRepos(cfg.Org)
+	if err != nil {
+		log.Fatal("error discovering repositories:", err)
+	}
+
+	var selected []Repository
+	for _, r := range repos {
+		if isDiscoveredRepo(cfg, r) {
+			selected = append(selected, r)
+		}
+	}
+	fmt.Printf("Discovered %d/%d repositories in '%s'.\n", len(selected), len(repos), cfg.Org)
+	if len(selected) == 0 {
+		return
+	}
+	for i, r := range selected {
+		if r.FullName == "" {
+			selected[i].FullName = cfg.Org + "/" + r.Name
+		}
+	}
+	batchRepositories(cfg, args, selected, nil)
+}
+
+// batchRepositories batches each repository in a fresh clone, in its own bot process, with
+// the original arguments and the per-repository ones of repoArgs. Repositories run at most
+// the parallelism of their concurrency group at once, and the ones whose cross-repo
+// dependencies changed once every repository ran are rebuilt. It exits with an error when
+// a repository failed.
+func batchRepositories(cfg Config, args []string, selected []Repository, repoArgs func(r Repository) []string) {
+	workdir, err := os.MkdirTemp("", "feature-branching-")
+	if err != nil {
+		log.Fatal("error creating clone dir:", err)
+	}
+	defer os.RemoveAll(workdir)
+
+	manifests := filepath.Join(workdir, "manifests")
+	args = append(slices.Clone(args), "--run_manifest_dir", manifests)
+	var mu sync.Mutex
+	failed := make(map[string]error)
+	scheduler := newRepoScheduler(cfg, selected)
+	if !scheduler.sequential {
+		// Configured up front, so concurrent bot processes find their clone already trusted
+		// and do not contend for the global config lock
+		mustSetupGitConfig()
+		for _, r := range selected {
+			dir := filepath.Join(workdir, r.FullName)
+			if err := runGitCommand("config", "--global", "--add", "safe.directory", dir); err != nil {
+				log.Fatalf("error trusting clone of '%s': %v", r.FullName, err)
+			}
+			defer runGitCommand("config", "--global", "--unset", "safe.directory", "^"+regexp.QuoteMeta(dir)+"$")
+		}
+	}
+	run := func(i int, r Repository) {
+		scheduler.start(r, func(g ConcurrencyGroup, out io.Writer) {
+			fmt.Fprintf(out, "\n=== [%d/%d] %s ===\n", i+1, len(selected), r.FullName)
+			if len(cfg.ConcurrencyGroups) > 0 {
+				fmt.Fprintf(out, "Concurrency group: %s\n", g.Name)
+			}
+			dir := filepath.Join(workdir, r.FullName)
+			os.RemoveAll(dir)
+			os.Remove(runManifestPath(manifests, r.FullName))
+			batchArgs := slices.Clone(args)
+			if repoArgs != nil {
+				batchArgs = append(batchArgs, repoArgs(r)...)
+			}
+			if limit := g.processRateLimit(); limit > 0 {
+				batchArgs = append(batchArgs, "--api_rate_limit", strconv.Itoa(limit))
+			}
+			err := runRepoBatch(cfg, batchArgs, r, dir, out)
+			if err != nil {
+				fmt.Fprintf(out, "Repository %s FAILED: %v\n", r.FullName, err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			delete(failed, r.FullName)
+			if err != nil {
+				failed[r.FullName] = err
+			}
+		})
+	}
+	for i, r := range selected {
+		run(i, r)
+	}
+	scheduler.wait()
+
+	names := make([]string, len(selected))
+	for i, r := range selected {
+		names[i] = r.FullName
+	}
+	// A dependency chain spans at most every repository, so one round per repository
+	// settles it; dependency cycles are never satisfied and need no rebuild
+	for round := 1; round < len(selected); round++ {
+		stale := staleDependencyRepos(manifests, cfg.BatchID, names)
+		if len(stale) == 0 {
+			break
+		}
+		fmt.Printf("\nRebuilding %d repositories whose cross-repo dependencies changed: %s\n", len(stale), strings.Join(stale, ", "))
+		for i, r := range selected {
+			if slices.Contains(stale, names[i]) {
+				run(i, r)
+			}
+		}
+		scheduler.wait()
+	}
+
+	fmt.Printf("\n%d/%d repositories batched successfully.\n", len(selected)-len(failed), len(selected))
+	if len(failed) > 0 {
+		var repos []string
+		for _, r := range selected {
+			if _, ok := failed[r.FullName]; ok {
+				repos = append(repos, r.FullName)
+			}
+		}
+		log.Fatalf("batch failed for: %s", strings.Join(repos, ", "))
+	}
+}
+
+// isDiscoveredRepo reports whether a repository matches the discovery criteria
+func isDiscoveredRepo(cfg Config, r Repository) bool {
+	if r.Archived {
+		return false
+	}
+	if cfg.RepoTopic != "" && !slices.ContainsFunc(r.Topics, func(t string) bool { return strings.EqualFold(t, cfg.RepoTopic) }) {
+		return false
+	}
+	if cfg.RepoPattern != "" {
+		if ok, err := path.Match(cfg.RepoPattern, r.Name); err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// runRepoBatch clones a repository and runs the bot on it with the original arguments,
+// writing its output to out. Flags are last-wins, so the repository is selected by
+// appending owner and repo.
+func runRepoBatch(cfg Config, args []string, r Repository, dir string, out io.Writer) error {
+	if err := cloneRepository(r.CloneURL, currentToken(cfg), dir); err != nil {
+		return err
+	}
+	owner, name, _ := strings.Cut(r.FullName, "/")
+	return runBotWithOutput(dir, append(slices.Clone(args), "--org=", "--repos=", "--owner", owner, "--repo", name, "--batch_id", cfg.BatchID), out)
+}
+
+// cloneRepository clones a repository into dir with the token
+func cloneRepository(cloneURL, token, dir string) error {
+	clone := exec.Command("git", "clone", "--quiet", authenticatedURL(cloneURL, token), dir)
+	if output, err := runBounded(clone); err != nil {
+		return fmt.Errorf("clone failed: %s", firstLine(output))
+	}
+	return nil
+}
+
+// runBotIn runs the bot executable on the clone in dir, sharing this process output
+func runBotIn(dir string, args []string) error {
+	return runBotWithOutput(dir, args, os.Stdout)
+}
+
+// runBotWithOutput runs the bot executable on the clone in dir, writing its output to out
+func runBotWithOutput(dir string, args []string, out io.Writer) error {
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GITHUB_WORKSPACE="+dir)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	return cmd.Run()
+}
+
+// authenticatedURL embeds the token into HTTP(S) clone URLs; other URLs are returned as-is
+func authenticatedURL(raw, token string) string {
+	u, err := url.Parse(raw)
+	if err != nil || token == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return raw
+	}
+	u.User = url.UserPassword("x-access-token", token)
+	return u.String()
+}
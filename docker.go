@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// runDocker implements the 'docker' subcommand, the entrypoint of the container image:
+// the action inputs are mapped to parameters and the run executes with an isolated
+// global Git config, so the settings it needs never leak into later jobs of a
+// self-hosted runner. Extra arguments override the inputs.
+func runDocker(args []string) {
+	bot, err := os.Executable()
+	if err != nil {
+		log.Fatal("error locating the binary:", err)
+	}
+	runArgs := append(inputArgs(os.Getenv), args...)
+	if actionsContainer() {
+		fmt.Println("GitHub Actions container detected, inputs mapped to parameters.")
+	}
+
+	isolation, err := isolateGitConfig()
+	if err != nil {
+		log.Fatal("error isolating the global Git config:", err)
+	}
+	cmd := exec.Command(bot, runArgs...)
+	cmd.Env = append(os.Environ(), "GIT_CONFIG_GLOBAL="+isolation.file)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	// The run gets the signals of the container to stop gracefully, the config is restored once it exited
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	code := 0
+	if err := cmd.Start(); err != nil {
+		slog.Error("error starting the run", "error", err)
+		code = 1
+	} else {
+		done := make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+		for waiting := true; waiting; {
+			select {
+			case sig := <-signals:
+				cmd.Process.Signal(sig)
+			case err = <-done:
+				waiting = false
+			}
+		}
+		var exitErr *exec.ExitError
+		switch {
+		case errors.As(err, &exitErr):
+			code = max(exitErr.ExitCode(), 1)
+		case err != nil:
+			slog.Error("error waiting for the run", "error", err)
+			code = 1
+		}
+	}
+	signal.Stop(signals)
+	isolation.restore()
+	os.Exit(code)
+}
+
+// actionsContainer reports whether the process runs as the container of a Docker action
+func actionsContainer() bool {
+	if os.Getenv("GITHUB_ACTIONS") != "true" {
+		return false
+	}
+	for _, marker := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(marker); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// inputArgs maps the action inputs (INPUT_<NAME> variables, with the name upper-cased
+// and either underscores or dashes) to the parameters of the same name, skipping the
+// empty ones. Without inputs, the repository, outputs file and job summary of the
+// workflow run are used.
+func inputArgs(getenv func(string) string) []string {
+	fs := flag.NewFlagSet("docker", flag.ContinueOnError)
+	// Flags are registered before any validation, so the error of an empty configuration is irrelevant
+	parseConfig(fs, nil)
+
+	var args []string
+	set := make(map[string]bool)
+	fs.VisitAll(func(f *flag.Flag) {
+		name := strings.ToUpper(f.Name)
+		value := getenv("INPUT_" + name)
+		if value == "" {
+			value = getenv("INPUT_" + strings.ReplaceAll(name, "_", "-"))
+		}
+		if value != "" {
+			args = append(args, fmt.Sprintf("--%s=%s", f.Name, value))
+			set[f.Name] = true
+		}
+	})
+
+	owner, repo, ok := strings.Cut(getenv("GITHUB_REPOSITORY"), "/")
+	if !ok {
+		owner, repo = "", ""
+	}
+	defaults := []struct{ name, value string }{
+		{"owner", owner},
+		{"repo", repo},
+		{"github_output", getenv("GITHUB_OUTPUT")},
+		{"step_summary", getenv("GITHUB_STEP_SUMMARY")},
+	}
+	for _, d := range defaults {
+		if !set[d.name] && d.value != "" {
+			args = append(args, fmt.Sprintf("--%s=%s", d.name, d.value))
+		}
+	}
+	return args
+}
+
+// gitConfigIsolation is the global Git config of a run, apart from the one of the user
+type gitConfigIsolation struct {
+	file      string            // Isolated config file, including the global config of the user
+	dir       string            // Directory of the isolated file, removed on restore
+	snapshots map[string][]byte // Content of the global config files of the user, nil when absent
+}
+
+// isolateGitConfig creates the isolated global config. It includes the global config of
+// the user, so their settings still apply, while every write lands in the isolated file.
+// The user's files are snapshotted so that writes bypassing the isolation, e.g. from a
+// hook, can be undone.
+func isolateGitConfig() (*gitConfigIsolation, error) {
+	dir, err := os.MkdirTemp("", "feature-branching-git-")
+	if err != nil {
+		return nil, err
+	}
+	iso := &gitConfigIsolation{file: filepath.Join(dir, "gitconfig"), dir: dir, snapshots: make(map[string][]byte)}
+	var include strings.Builder
+	for _, path := range globalGitConfigFiles() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			iso.snapshots[path] = nil
+			continue
+		}
+		iso.snapshots[path] = data
+		fmt.Fprintf(&include, "[include]\n\tpath = %s\n", strings.ReplaceAll(path, `\`, `\\`))
+	}
+	if err := os.WriteFile(iso.file, []byte(include.String()), 0600); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return iso, nil
+}
+
+// globalGitConfigFiles lists the files Git reads as global config
+func globalGitConfigFiles() []string {
+	if path := os.Getenv("GIT_CONFIG_GLOBAL"); path != "" {
+		return []string{path}
+	}
+	var files []string
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		files = append(files, filepath.Join(xdg, "git", "config"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if os.Getenv("XDG_CONFIG_HOME") == "" {
+			files = append(files, filepath.Join(home, ".config", "git", "config"))
+		}
+		files = append(files, filepath.Join(home, ".gitconfig"))
+	}
+	return files
+}
+
+// restore puts back the global config files of the user the run changed and removes the
+// isolated config
+func (iso *gitConfigIsolation) restore() {
+	defer os.RemoveAll(iso.dir)
+	for path, before := range iso.snapshots {
+		after, err := os.ReadFile(path)
+		if (err == nil && before != nil && bytes.Equal(after, before)) || (err != nil && before == nil) {
+			continue
+		}
+		if before == nil {
+			err = os.Remove(path)
+		} else {
+			err = os.WriteFile(path, before, 0644)
+		}
+		if err != nil {
+			slog.Warn("failed to restore the global Git config", "path", path, "error", err)
+			continue
+		}
+		fmt.Printf("Restored the global Git config %s changed during the run.\n", path)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+)
+
+// doctorRule is a cross-parameter consistency check of the configuration
+type doctorRule struct {
+	fatal bool                    // Whether a finding makes the configuration unusable
+	check func(cfg Config) string // Returns the problem, empty when the configuration passes
+}
+
+// doctorRules lists the consistency checks run by 'config doctor'. Most catch parameters
+// silently ignored because of another one.
+var doctorRules = []doctorRule{
+	{check: func(cfg Config) string {
+		if cfg.CommitMode == commitModeSingle && cfg.BlameIgnoreRevs {
+			return "'blame_ignore_revs' has no effect with commit_mode single, the batch is a single commit"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if cfg.CommitMode == commitModeSingle && (cfg.Semver || cfg.VersionFile != "") {
+			return "'semver' and 'version_file' have no effect with commit_mode single"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if cfg.CommitMode == commitModeSingle && slices.Contains(cfg.PRDirectives, "strategy") {
+			return "directive 'strategy' has no effect with commit_mode single"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if cfg.MergeRefs && cfg.CommitMode == commitModeMerge {
+			return "'merge_refs' only detects conflicts early with commit_mode merge, test merges are never reused"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if len(cfg.UpdateBranchLabels) > 0 && cfg.UpdateBranches == "" {
+			return "'update_branch_labels' has no effect without 'update_branches'"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if cfg.ConflictStats == "" && (cfg.StatsKeepRuns > 0 || cfg.StatsArchive != "" || cfg.StatsArchiveBranch != "") {
+			return "'stats_keep_runs', 'stats_archive' and 'stats_archive_branch' have no effect without 'conflict_stats'"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if !isFileStorage(cfg.Storage) && cfg.ConflictStats == "" && cfg.EligibilityCache == "" && !cfg.NotifyDedupe {
+			return "'storage' has no effect without 'conflict_stats', 'eligibility_cache' or 'notify_dedupe'"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if cfg.VerifyFullCheckout && cfg.VerifyCmd == "" {
+			return "'verify_full_checkout' has no effect without 'verify_cmd'"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if cfg.BisectOnFailure && cfg.VerifyCmd == "" {
+			return "'bisect_on_failure' has no effect without 'verify_cmd'"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if cfg.GroupDeps && cfg.CommitMode == commitModeSingle {
+			return "'group_deps' has no effect with commit_mode single, the whole batch is one commit"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if cfg.ProtectTarget && cfg.Rulesets == rulesetsIgnore {
+			return "'protect_target' with rulesets ignore: a 'protect_bypass' missing the bot only shows as a rejected push; set 'rulesets' to adapt to fail fast"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if cfg.CommitBody && cfg.CommitMode == commitModeSingle {
+			return "'commit_body' has no effect with commit_mode single, the batch commit lists the PR titles"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if !cfg.CommitBody && cfg.CommitBodySection != "" {
+			return "'commit_body_section' has no effect without 'commit_body'"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if cfg.RangeDiffComment && cfg.TrackingIssue == 0 {
+			return "'range_diff_comment' has no effect without 'tracking_issue'"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if len(cfg.Chaos) > 0 {
+			return fmt.Sprintf("'chaos' is on, runs fail on purpose (seed %d); keep it out of production configurations", cfg.ChaosSeed)
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if cfg.Chaos[faultPushRace] > 0 && cfg.PushRetries == 0 {
+			return "'chaos' push races are never retried with push_retries 0, every injected race fails the run"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if cfg.Project == "" && (cfg.ProjectField != "Status" || !maps.Equal(cfg.ProjectColumns, defaultProjectColumns)) {
+			return "'project_field' and 'project_columns' have no effect without 'project'"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if cfg.HookLimits != (HookLimits{}) && cfg.VerifyCmd == "" {
+			return "'hook_timeout', 'hook_cpu' and 'hook_memory' have no effect without a hook command such as 'verify_cmd'"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if len(cfg.PromoteChecks) > 0 && cfg.PromoteFrom == "" {
+			return "'promote_checks' has no effect without 'promote_from'"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if cfg.LintPolicy == lintPolicyFix && !lintEnabled(cfg) {
+			return "'lint_policy' fix has no effect without a lint rule ('lint_max_length', 'lint_ticket_pattern' or 'lint_forbidden_words')"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if cfg.LintFixTemplate != defaultLintFixTemplate && (cfg.LintPolicy != lintPolicyFix || cfg.LintTicketPattern == "") {
+			return "'lint_fix_template' is only used with lint_policy fix and a 'lint_ticket_pattern'"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if !cfg.IncidentIssues && len(cfg.IncidentAssignees) > 0 {
+			return "'incident_assignees' has no effect without 'incident_issues'"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if cfg.NotifyDedupe && cfg.TrackingIssue == 0 && !cfg.CompareComment && !cfg.IncidentIssues {
+			return "'notify_dedupe' has no effect without 'tracking_issue', 'compare_comment' or 'incident_issues'"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if cfg.NotifyDelta && cfg.TrackingIssue == 0 && !cfg.CompareComment {
+			return "'notify_delta' has no effect without 'tracking_issue' or 'compare_comment'"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if cfg.NotifyDedupe && cfg.NotifyDigest > 0 && cfg.TrackingIssue == 0 {
+			return "the notification digest is dropped without a 'tracking_issue'"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if (cfg.MaxPRsPerAuthor > 0 || len(cfg.AuthorTeams) > 0) && cfg.MaxPRs == 0 {
+			return "'max_prs_per_author' and 'author_teams' have no effect without 'max_prs'"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if len(cfg.AuthorTeams) > 0 && cfg.MaxPRsPerAuthor == 0 {
+			return "'author_teams' has no effect without 'max_prs_per_author'"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if cfg.EventSecret != "" && len(cfg.EventSinks) == 0 {
+			return "'event_secret' has no effect without 'event_sinks'"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if cfg.SigningFormat != "ssh" && cfg.SigningKey == "" {
+			return "'signing_format' has no effect without 'signing_key'"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if cfg.Org == "" && (len(cfg.ConcurrencyGroups) > 0 || cfg.OrgParallelism != 1) {
+			return "'concurrency_groups' and 'org_parallelism' have no effect without 'org'"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if cfg.MergeQueue && (cfg.MaxPRs > 0 || len(cfg.ExcludePRs) > 0) {
+			return "'max_prs' and 'exclude_prs' have no effect with 'merge_queue', the queue decides the batch"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if cfg.MergeQueue && len(cfg.LabelQuotas) > 0 {
+			return "'label_quotas' has no effect with 'merge_queue', the queue decides the batch"
+		}
+		return ""
+	}},
+	{check: func(cfg Config) string {
+		if cfg.ResultsBranch != "" && cfg.PlanOnly {
+			return "'results_branch' is not updated by 'plan_only' runs, which do not push the target branch"
+		}
+		return ""
+	}},
+	{fatal: true, check: func(cfg Config) string {
+		if cfg.Org == "" && !remoteBranchExists(cfg.TrunkBranch) {
+			return fmt.Sprintf("trunk branch '%s' does not exist on origin", cfg.TrunkBranch)
+		}
+		return ""
+	}},
+	{fatal: true, check: func(cfg Config) string {
+		if cfg.PromoteFrom != "" && !remoteBranchExists(cfg.PromoteFrom) {
+			return fmt.Sprintf("promotion stage branch '%s' does not exist on origin", cfg.PromoteFrom)
+		}
+		return ""
+	}},
+}
+
+// runConfig implements the 'config' subcommand: 'config schema' prints the typed
+// parameter schema as JSON, 'config doctor' validates a configuration
+func runConfig(args []string) {
+	if len(args) == 0 || (args[0] != "schema" && args[0] != "doctor") {
+		log.Fatal("invalid configuration:", fmt.Errorf("usage: config schema | config doctor [flags]"))
+	}
+	fs := flag.NewFlagSet("config "+args[0], flag.ExitOnError)
+	if args[0] == "schema" {
+		// Flags are registered before any validation, so the error of an empty configuration is irrelevant
+		parseConfig(fs, nil)
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(configSchema(fs)); err != nil {
+			log.Fatal("error writing schema:", err)
+		}
+		return
+	}
+	if !runDoctor(fs, args[1:]) {
+		os.Exit(1)
+	}
+}
+
+// runDoctor validates the parameters, the git features they need and their consistency,
+// reporting every finding. It returns false when the configuration cannot run.
+func runDoctor(fs *flag.FlagSet, args []string) bool {
+	cfg, err := parseConfig(fs, args)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		return false
+	}
+	ok := true
+	features, err := detectGitFeatures()
+	if err == nil {
+		err = requireGitFeatures(cfg, features)
+	}
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		ok = false
+	}
+	for _, rule := range doctorRules {
+		problem := rule.check(cfg)
+		switch {
+		case problem == "":
+		case rule.fatal:
+			fmt.Printf("error: %s\n", problem)
+			ok = false
+		default:
+			fmt.Printf("warning: %s\n", problem)
+		}
+	}
+	if ok {
+		fmt.Println("Configuration OK.")
+	}
+	return ok
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// dryRunBatch implements --dry_run, merging the selected PRs in memory with 'git merge-tree'.
+// Conflicting PRs are left out of the simulation, so the report covers every PR.
+func dryRunBatch(client GitHubClient, cfg Config, report *RunReport) {
+	prs := mustPlanPRs(client, cfg, report)
+	if len(prs) == 0 {
+		fmt.Printf("\n%s\n", message(cfg, "run.no_prs", strings.Join(cfg.RequiredLabels, ", ")))
+		writeRunReport(cfg, report)
+		return
+	}
+	logPRsToMerge(cfg, prs)
+	fmt.Printf("Simulating the merges into '%s' (dry run):\n", cfg.TargetBranch)
+
+	base, err := revParse(cfg.TrunkBranch)
+	if err != nil {
+		log.Fatal("error reading trunk branch:", err)
+	}
+	con := newConsole(cfg)
+	merged, aborted := 0, 0
+	// The run would stop at the first PR that fails to merge
+	abort := func(pr GitHubPR) {
+		if aborted == 0 {
+			aborted = pr.Number
+		}
+	}
+	for i, pr := range prs {
+		con.current(i, len(prs), pr)
+		start := time.Now()
+		branch, err := fetchPRBranch(pr, cfg)
+		if err != nil {
+			fmt.Printf("%s\n         %s\n", con.fail(message(cfg, "merge.failed")), message(cfg, "merge.reason", firstLine(err.Error())))
+			report.add(pr, OutcomeFailed, err.Error(), time.Since(start))
+			abort(pr)
+			continue
+		}
+		next, conflicts, err := mergeInMemory(base, branch)
+		switch {
+		case err != nil:
+			fmt.Printf("%s\n         %s\n", con.fail(message(cfg, "merge.failed")), message(cfg, "merge.reason", firstLine(err.Error())))
+			report.add(pr, OutcomeFailed, err.Error(), time.Since(start))
+			abort(pr)
+		case len(conflicts) > 0:
+			fmt.Printf("%s (%s)\n", con.fail(message(cfg, "merge.conflict")), strings.Join(conflicts, ", "))
+			report.addConflict(pr, &ConflictError{Files: conflicts}, "dry run: conflicts in "+strings.Join(conflicts, ", "), time.Since(start))
+			abort(pr)
+		default:
+			if same, _ := sameTree(base, next); same {
+				fmt.Println(con.warn(message(cfg, "merge.skipped")) + " (" + message(cfg, "merge.already_included") + ")" + con.progress(merged, i+1, len(prs)))
+				report.add(pr, OutcomeAlreadyIncluded, "dry run: "+ErrEmptyMerge.Error(), time.Since(start))
+				continue
+			}
+			base = next
+			merged++
+			fmt.Println(con.ok(message(cfg, "merge.ok")) + con.progress(merged, i+1, len(prs)))
+			report.add(pr, OutcomeMerged, "dry run: would merge", time.Since(start))
+		}
+	}
+
+	fmt.Printf("\n%s\n", message(cfg, "merge.summary", merged, len(prs)))
+	if aborted > 0 {
+		fmt.Printf("A run would abort at PR #%d and leave '%s' unchanged.\n", aborted, cfg.TargetBranch)
+	}
+	fmt.Printf("Dry run: '%s' was not rebuilt, nothing was committed or pushed.\n", cfg.TargetBranch)
+	writeRunReport(cfg, report)
+}
+
+// mergeInMemory merges head onto base with 'git merge-tree' into a dangling commit,
+// returning the conflicted files instead when the merge is not clean. No ref, index or
+// working tree is touched.
+func mergeInMemory(base, head string) (string, []string, error) {
+	output, err := exec.Command("git", "merge-tree", "--write-tree", "--name-only", "--no-messages", base, head).Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		// The output is the tree ID followed by the conflicted paths
+		return "", strings.Split(strings.TrimSpace(string(output)), "\n")[1:], nil
+	} else if err != nil {
+		return "", nil, fmt.Errorf("'git merge-tree' failed: %w", err)
+	}
+	cmd := exec.Command("git", "commit-tree", strings.TrimSpace(string(output)), "-p", base, "-m", "in-memory merge")
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME="+botCommitterName, "GIT_AUTHOR_EMAIL="+botCommitterMail,
+		"GIT_COMMITTER_NAME="+botCommitterName, "GIT_COMMITTER_EMAIL="+botCommitterMail)
+	commit, err := cmd.Output()
+	if err != nil {
+		return "", nil, fmt.Errorf("'git commit-tree' failed: %w", err)
+	}
+	return strings.TrimSpace(string(commit)), nil, nil
+}
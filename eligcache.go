@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+)
+
+// EligibilityCache stores the filter verdicts of PRs per head revision, so unchanged PRs
+// are not re-evaluated, nor re-commented, on every run
+type EligibilityCache struct {
+	Config  string                       `json:"config"`  // Fingerprint of the filter configuration the verdicts were computed with
+	Entries map[string]*EligibilityEntry `json:"entries"` // Cached evaluations by PR number
+
+	store     Storage      // Storage of the cache
+	key       string       // Storage key of the cache
+	hits      map[int]bool // PRs served from entries of earlier runs
+	evaluated map[int]bool // PRs evaluated in this run
+}
+
+// EligibilityEntry is the cached evaluation of a PR
+type EligibilityEntry struct {
+	HeadSHA   string          `json:"head_sha"`  // Head revision the PR was evaluated at
+	Inputs    string          `json:"inputs"`    // Fingerprint of the PR metadata the filters read
+	Verdicts  []FilterVerdict `json:"verdicts"`  // Filter verdicts
+	Commented bool            `json:"commented"` // Title suggestion already posted for this evaluation
+}
+
+// loadEligibilityCache reads the eligibility cache, returning nil when caching is disabled.
+// A cache computed with another filter configuration is discarded.
+func loadEligibilityCache(cfg Config) *EligibilityCache {
+	if cfg.EligibilityCache == "" {
+		return nil
+	}
+	cache := &EligibilityCache{store: stateStorage(cfg), key: cfg.EligibilityCache, hits: make(map[int]bool), evaluated: make(map[int]bool)}
+	data, err := cache.store.Load(cache.key)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("failed to read eligibility cache", "error", err)
+	} else if err == nil {
+		if err := json.Unmarshal(data, cache); err != nil {
+			slog.Warn("ignoring corrupt eligibility cache", "error", err)
+		}
+	}
+	if fp := filterConfigFingerprint(cfg); cache.Config != fp {
+		cache.Config = fp
+		cache.Entries = nil
+	}
+	if cache.Entries == nil {
+		cache.Entries = make(map[string]*EligibilityEntry)
+	}
+	return cache
+}
+
+// filterConfigFingerprint hashes the configuration read by the eligibility filters
+func filterConfigFingerprint(cfg Config) string {
+	return fingerprint(cfg.TrunkBranch, cfg.TargetBranch, cfg.RequiredLabels, cfg.LabelNamespaces, cfg.ConventionalTitles, cfg.ExcludePRs,
+		cfg.LintMaxLength, cfg.LintTicketPattern, cfg.LintForbiddenWords, cfg.LintPolicy, cfg.LintFixTemplate, cfg.PRDirectives)
+}
+
+// prInputsFingerprint hashes the PR metadata read by the eligibility filters, so label,
+// title and description edits, which do not move the head, invalidate the entry too
+func prInputsFingerprint(pr GitHubPR) string {
+	return fingerprint(pr.State, pr.Draft, pr.Base.Ref, pr.Labels, pr.Title, pr.Body)
+}
+
+// fingerprint returns a short hash of the JSON encoding of values
+func fingerprint(values ...any) string {
+	data, _ := json.Marshal(values)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// lookup returns the cached entry of a PR when it was evaluated at its current head and metadata
+func (c *EligibilityCache) lookup(pr GitHubPR) *EligibilityEntry {
+	if c == nil || pr.HeadSHA == "" {
+		return nil
+	}
+	e := c.Entries[strconv.Itoa(pr.Number)]
+	if e == nil || e.HeadSHA != pr.HeadSHA || e.Inputs != prInputsFingerprint(pr) {
+		return nil
+	}
+	return e
+}
+
+// evaluate returns the verdicts of a PR, from the cache when it is unchanged
+func (c *EligibilityCache) evaluate(cfg Config, pr GitHubPR) []FilterVerdict {
+	if e := c.lookup(pr); e != nil {
+		if !c.evaluated[pr.Number] {
+			c.hits[pr.Number] = true
+		}
+		return e.Verdicts
+	}
+	verdicts := evaluatePR(cfg, pr)
+	if c != nil && pr.HeadSHA != "" {
+		c.evaluated[pr.Number] = true
+		c.Entries[strconv.Itoa(pr.Number)] = &EligibilityEntry{
+			HeadSHA:  pr.HeadSHA,
+			Inputs:   prInputsFingerprint(pr),
+			Verdicts: verdicts,
+		}
+	}
+	return verdicts
+}
+
+// invalidate drops the cached evaluation of a PR
+func (c *EligibilityCache) invalidate(number int) {
+	delete(c.Entries, strconv.Itoa(number))
+}
+
+// save writes the cache, dropping the PRs that are no longer open.
+// Errors are logged as warnings since the cache only saves API calls.
+func (c *EligibilityCache) save(open []GitHubPR) {
+	if c == nil {
+		return
+	}
+	for key := range c.Entries {
+		if !slices.ContainsFunc(open, func(pr GitHubPR) bool { return strconv.Itoa(pr.Number) == key }) {
+			delete(c.Entries, key)
+		}
+	}
+	fmt.Printf("Eligibility cache: %d of %d open PR(s) unchanged since their last evaluation.\n", len(c.hits), len(open))
+	if err := c.write(); err != nil {
+		slog.Warn("failed to write eligibility cache", "error", err)
+	}
+}
+
+// write writes the cache to the storage
+func (c *EligibilityCache) write() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cache serialization failed: %w", err)
+	}
+	return c.store.Save(c.key, data)
+}
+
+// invalidateEligibility drops the cached evaluation of a PR from the cache file,
+// used by the webhook server when a PR is pushed to, relabeled or edited
+func invalidateEligibility(cfg Config, number int) {
+	cache := loadEligibilityCache(cfg)
+	if cache == nil || cache.Entries[strconv.Itoa(number)] == nil {
+		return
+	}
+	cache.invalidate(number)
+	if err := cache.write(); err != nil {
+		slog.Warn("failed to invalidate eligibility of PR", "pr_number", number, "error", err)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+)
+
+// FilterVerdict records the outcome of a single eligibility filter on a PR
+type FilterVerdict struct {
+	Filter string `json:"filter"` // Filter name
+	Passed bool   `json:"passed"` // Whether the PR passed the filter
+	Detail string `json:"detail"` // Human readable explanation
+}
+
+// prFilter is a named eligibility check applied to every candidate PR
+type prFilter struct {
+	name string
+	eval func(cfg Config, pr GitHubPR) (bool, string)
+}
+
+// prFilters lists the eligibility filters in evaluation order.
+// Both batching and the 'explain' subcommand use this list, so every new filter
+// must be registered here to be visible to PR authors.
+var prFilters = []prFilter{
+	{name: "state", eval: filterState},
+	{name: "draft", eval: filterDraft},
+	{name: "base branch", eval: filterBaseBranch},
+	{name: "head branch", eval: filterHeadBranch},
+	{name: "labels", eval: filterLabels},
+	{name: "label namespaces", eval: filterLabelNamespaces},
+	{name: "conventional title", eval: filterConventionalTitle},
+	{name: "commit message", eval: filterCommitMessage},
+	{name: "directives", eval: filterDirectives},
+	{name: "excluded", eval: filterExcluded},
+}
+
+// unevaluatedFilters are the criteria authors ask about that batching does not check,
+// listed by 'explain' so no PR is reported fine on them
+var unevaluatedFilters = []prFilter{
+	{name: "checks", eval: notEvaluated("check runs are not required, 'verify_cmd' tests the batch instead")},
+	{name: "approvals", eval: notEvaluated("reviews are not required, use 'labels' to batch approved PRs only")},
+	{name: "size", eval: notEvaluated("PR size is not limited")},
+}
+
+// notEvaluated returns the eval of a criterion batching does not check
+func notEvaluated(reason string) func(Config, GitHubPR) (bool, string) {
+	return func(Config, GitHubPR) (bool, string) {
+		return true, "not evaluated: " + reason
+	}
+}
+
+// evaluatePR runs every eligibility filter against a PR
+func evaluatePR(cfg Config, pr GitHubPR) []FilterVerdict {
+	verdicts := make([]FilterVerdict, 0, len(prFilters))
+	for _, f := range prFilters {
+		passed, detail := f.eval(cfg, pr)
+		verdicts = append(verdicts, FilterVerdict{Filter: f.name, Passed: passed, Detail: detail})
+	}
+	return verdicts
+}
+
+// isEligible reports whether every verdict passed
+func isEligible(verdicts []FilterVerdict) bool {
+	for _, v := range verdicts {
+		if !v.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// failedVerdicts summarizes the filters a PR did not pass
+func failedVerdicts(verdicts []FilterVerdict) string {
+	var failed []string
+	for _, v := range verdicts {
+		if !v.Passed {
+			failed = append(failed, fmt.Sprintf("%s: %s", v.Filter, v.Detail))
+		}
+	}
+	return strings.Join(failed, "; ")
+}
+
+// filterExcluded rejects the PRs excluded from the batch by --exclude_prs
+func filterExcluded(cfg Config, pr GitHubPR) (bool, string) {
+	if slices.Contains(cfg.ExcludePRs, pr.Number) {
+		return false, "excluded from the batch"
+	}
+	return true, "not excluded"
+}
+
+// filterHeadBranch rejects the PRs of the target branch, such as the batch PR, which
+// would merge the candidate into itself
+func filterHeadBranch(cfg Config, pr GitHubPR) (bool, string) {
+	if pr.HeadRef != "" && pr.HeadRef == cfg.TargetBranch {
+		return false, fmt.Sprintf("PR is from the target branch '%s'", cfg.TargetBranch)
+	}
+	return true, "PR is not from the target branch"
+}
+
+// filterState requires the PR to be open
+func filterState(_ Config, pr GitHubPR) (bool, string) {
+	if pr.State != "open" {
+		return false, fmt.Sprintf("PR is %s", pr.State)
+	}
+	return true, "PR is open"
+}
+
+// filterDraft rejects draft PRs, which are not ready for the batch
+func filterDraft(_ Config, pr GitHubPR) (bool, string) {
+	if pr.Draft {
+		return false, "PR is a draft"
+	}
+	return true, "PR is ready for review"
+}
+
+// filterBaseBranch requires the PR to target the trunk branch
+func filterBaseBranch(cfg Config, pr GitHubPR) (bool, string) {
+	if pr.Base.Ref != cfg.TrunkBranch {
+		return false, fmt.Sprintf("PR targets '%s', not '%s'", pr.Base.Ref, cfg.TrunkBranch)
+	}
+	return true, fmt.Sprintf("PR targets '%s'", cfg.TrunkBranch)
+}
+
+// filterLabels requires at least one of the configured labels
+func filterLabels(cfg Config, pr GitHubPR) (bool, string) {
+	if len(cfg.RequiredLabels) == 0 {
+		return true, "no labels required"
+	}
+	has := strings.Join(pr.Labels, ", ")
+	if has == "" {
+		has = "none"
+	}
+	required := strings.Join(cfg.RequiredLabels, ", ")
+	if !hasAnyLabel(pr.Labels, cfg.RequiredLabels) {
+		return false, fmt.Sprintf("none of [%s] present (has: %s)", required, has)
+	}
+	return true, fmt.Sprintf("matches one of [%s] (has: %s)", required, has)
+}
+
+// runExplain implements the 'explain' subcommand printing every filter verdict per PR
+func runExplain(args []string) {
+	fs := flag.NewFlagSet("explain", flag.ExitOnError)
+	number := fs.Int("pr", 0, "Only explain this PR number (may target any base branch)")
+	cfg := mustParseConfig(fs, args)
+	client := mustNewGitHubClient(cfg)
+
+	var prs []GitHubPR
+	if *number > 0 {
+		pr, err := client.GetPR(*number)
+		if err != nil {
+			log.Fatal("error fetching PR:", err)
+		}
+		prs = []GitHubPR{pr}
+	} else {
+		var err error
+		if prs, err = client.ListOpenPRs(cfg.TrunkBranch); err != nil {
+			log.Fatal("error fetching PRs:", err)
+		}
+	}
+
+	if len(prs) == 0 {
+		fmt.Printf("No open PRs targeting '%s'.\n", cfg.TrunkBranch)
+		return
+	}
+
+	eligible := 0
+	for _, pr := range prs {
+		verdicts := evaluatePR(cfg, pr)
+		status := "EXCLUDED"
+		if isEligible(verdicts) {
+			status = "ELIGIBLE"
+			eligible++
+		}
+		fmt.Printf("#%d \"%s\" -> %s\n", pr.Number, pr.Title, status)
+		for _, v := range verdicts {
+			mark := "PASS"
+			if !v.Passed {
+				mark = "FAIL"
+			}
+			fmt.Printf("  [%s] %-12s %s\n", mark, v.Filter+":", v.Detail)
+		}
+		for _, f := range unevaluatedFilters {
+			_, detail := f.eval(cfg, pr)
+			fmt.Printf("  [%s] %-12s %s\n", "SKIP", f.name+":", detail)
+		}
+	}
+	fmt.Printf("\n%d/%d PR(s) eligible for '%s'.\n", eligible, len(prs), cfg.TargetBranch)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/josedpiambav/feature/mergebottest"
+)
+
+func TestEvaluatePRRejectsDrafts(t *testing.T) {
+	cfg := Config{TrunkBranch: "main", TargetBranch: "pre-main"}
+	pr := GitHubPR{Number: 1, State: "open", Draft: true}
+	pr.Base.Ref = "main"
+	verdicts := evaluatePR(cfg, pr)
+	if isEligible(verdicts) {
+		t.Fatalf("draft PR eligible: %+v", verdicts)
+	}
+	if got := failedVerdicts(verdicts); got != "draft: PR is a draft" {
+		t.Errorf("failed verdicts = %q", got)
+	}
+}
+
+func TestExplainListsDraftAndUnevaluatedFilters(t *testing.T) {
+	repo := mergebottest.NewRepo(t, "main")
+	srv := mergebottest.NewServer()
+	defer srv.Close()
+	srv.AddPR(mergebottest.PR{Number: 1, Title: "feat: one", Base: "main", Author: "alice", Labels: []string{"ready"}, Draft: true})
+
+	cmd := exec.Command(os.Args[0], "explain", "--github_token", "test", "--owner", "o", "--repo", "r", "--labels", "ready")
+	cmd.Dir = repo.Clone()
+	cmd.Env = append(repo.Env(), botEnv+"=1", "GITHUB_API_URL="+srv.URL)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("explain failed: %v\n%s", err, out)
+	}
+	for _, want := range []string{"#1 \"feat: one\" -> EXCLUDED", "[FAIL] draft:", "[SKIP] checks:", "[SKIP] approvals:", "[SKIP] size:"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("explain output missing %q:\n%s", want, out)
+		}
+	}
+}
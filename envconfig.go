@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// envConfigPrefix prefixes the environment variables setting the parameters, as in
+// MERGEBOT_LABELS for --labels
+const envConfigPrefix = "MERGEBOT_"
+
+// envFallbacks are the variables of the GitHub Actions environment used for a parameter
+// missing from the command line and its MERGEBOT_ variable
+var envFallbacks = map[string]func(fs *flag.FlagSet, getenv func(string) string) string{
+	"github_token": func(fs *flag.FlagSet, getenv func(string) string) string {
+		// The workflow token would conflict with the installation token of a GitHub App
+		if fs.Lookup("app_id").Value.String() != "0" {
+			return ""
+		}
+		return getenv("GITHUB_TOKEN")
+	},
+	"owner": func(_ *flag.FlagSet, getenv func(string) string) string {
+		owner, _, _ := strings.Cut(getenv("GITHUB_REPOSITORY"), "/")
+		return owner
+	},
+	"repo": func(_ *flag.FlagSet, getenv func(string) string) string {
+		_, repo, _ := strings.Cut(getenv("GITHUB_REPOSITORY"), "/")
+		return repo
+	},
+}
+
+// applyEnvConfig sets the parameters missing from the command line from their
+// MERGEBOT_<NAME> variable, the name upper-cased, or else from the GitHub Actions
+// environment. Values go through the validation of the command line, and take
+// precedence over the config and tenant files.
+func applyEnvConfig(fs *flag.FlagSet, getenv func(string) string) error {
+	explicit := make(map[string]struct{})
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = struct{}{} })
+
+	var names []string
+	fs.VisitAll(func(f *flag.Flag) { names = append(names, f.Name) })
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := explicit[name]; ok {
+			continue
+		}
+		source := envConfigPrefix + strings.ToUpper(name)
+		value := getenv(source)
+		if value == "" && envFallbacks[name] != nil {
+			source, value = "the GitHub Actions environment", envFallbacks[name](fs, getenv)
+		}
+		if value == "" {
+			continue
+		}
+		if err := checkOptionValue(optionType(fs.Lookup(name)), value); err != nil {
+			return fmt.Errorf("invalid parameter '%s' from %s: %w", name, source, err)
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("invalid parameter '%s' from %s: %w", name, source, err)
+		}
+	}
+	return nil
+}
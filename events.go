@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RunEventType names a step of a run in its event log
+type RunEventType string
+
+// Run event types, in the order a run usually emits them
+const (
+	EventRunStarted        RunEventType = "RunStarted"        // Branches and batch ID of the run
+	EventTokenMinted       RunEventType = "TokenMinted"       // GitHub App installation token of the run
+	EventPRDiscovered      RunEventType = "PRDiscovered"      // Open PR considered by the run
+	EventPRFiltered        RunEventType = "PRFiltered"        // PR held back before merging (filtered or blocked)
+	EventMergeAttempted    RunEventType = "MergeAttempted"    // PR merged, already included or failed to merge
+	EventConflictDetected  RunEventType = "ConflictDetected"  // PR conflicted with the batch
+	EventPRSkipped         RunEventType = "PRSkipped"         // PR not reached (aborted, deferred or closed meanwhile)
+	EventPoliciesEvaluated RunEventType = "PoliciesEvaluated" // Batching policies decided which PRs to hold back
+	EventRiskScored        RunEventType = "RiskScored"        // Risk scores of the PRs and the batch
+	EventDeadlineReached   RunEventType = "DeadlineReached"   // Run deadline deferred the remaining PRs
+	EventPRsReclassified   RunEventType = "PRsReclassified"   // Batch rebuilt without the PRs closed since discovery
+	EventPathsChanged      RunEventType = "PathsChanged"      // Paths changed by the batch and by each merged PR
+	EventDepsGrouped       RunEventType = "DepsGrouped"       // Dependency update PRs collapsed into a single commit
+	EventCandidateBuilt    RunEventType = "CandidateBuilt"    // Candidate diff against trunk summarized
+	EventHookRan           RunEventType = "HookRan"           // Hook command ran, with its limits and output
+	EventVerifyBisected    RunEventType = "VerifyBisected"    // Failing verification bisected, culprits excluded
+	EventPublished         RunEventType = "Published"         // Target branch pushed
+	EventRunFinished       RunEventType = "RunFinished"       // Run ended, with its GitHub API usage
+)
+
+// RunEvent is an entry of the event log of a run. Only the fields of its type are set.
+type RunEvent struct {
+	Seq       int              `json:"seq"`                 // Position in the run, from 1
+	Type      RunEventType     `json:"type"`                // Event type
+	At        time.Time        `json:"at"`                  // When the event happened
+	Trunk     string           `json:"trunk,omitempty"`     // RunStarted: base branch of the batch
+	Target    string           `json:"target,omitempty"`    // RunStarted: branch the batch is merged into
+	BatchID   string           `json:"batch_id,omitempty"`  // RunStarted: run ID
+	Token     *TokenGrant      `json:"token,omitempty"`     // TokenMinted: repositories and permissions granted
+	PR        int              `json:"pr,omitempty"`        // PRDiscovered: PR number
+	Title     string           `json:"title,omitempty"`     // PRDiscovered: PR title
+	Result    *PRResult        `json:"result,omitempty"`    // Outcome of a PR
+	Policy    []PolicyDecision `json:"policy,omitempty"`    // PoliciesEvaluated: decision of every policy
+	Risk      *RiskReport      `json:"risk,omitempty"`      // RiskScored: PR and batch scores
+	Cutoff    *RunCutoff       `json:"cutoff,omitempty"`    // DeadlineReached: deferred PRs
+	Closed    map[int]string   `json:"closed,omitempty"`    // PRsReclassified: state of the closed PRs
+	Rebuilt   []int            `json:"rebuilt,omitempty"`   // PRsReclassified: PRs merged again by the rebuild
+	Paths     *ChangedPaths    `json:"paths,omitempty"`     // PathsChanged: paths of the batch and of each PR
+	Deps      *DepsGroup       `json:"deps,omitempty"`      // DepsGrouped: combined commit and its PRs
+	Diff      *DiffSummary     `json:"diff,omitempty"`      // CandidateBuilt: candidate diff against trunk
+	Hook      *HookRun         `json:"hook,omitempty"`      // HookRan: command, limits, outcome and output tail
+	Bisection *VerifyBisection `json:"bisection,omitempty"` // VerifyBisected: verifications and culprits
+	Candidate string           `json:"candidate,omitempty"` // Published: pushed target SHA
+	API       *APIUsage        `json:"api,omitempty"`       // RunFinished: GitHub API usage
+}
+
+// eventTypeOf returns the event recording a PR outcome
+func eventTypeOf(outcome PROutcome) RunEventType {
+	switch outcome {
+	case OutcomeFiltered, OutcomeBlocked:
+		return EventPRFiltered
+	case OutcomeConflict:
+		return EventConflictDetected
+	case OutcomeNotAttempted, OutcomeDeferred, OutcomeClosed:
+		return EventPRSkipped
+	}
+	return EventMergeAttempted
+}
+
+// eventLogPath returns the event log file of the run, empty when the log is disabled.
+// Multi-target runs share a batch ID, so the target branch is part of the name.
+func eventLogPath(cfg Config) string {
+	if cfg.EventLog == "" {
+		return ""
+	}
+	return filepath.Join(cfg.EventLog, cfg.BatchID+"-"+url.PathEscape(cfg.TargetBranch)+".jsonl")
+}
+
+// record appends an event to the run and applies it to the report. With an event log
+// the event is persisted right away, so the log of a crashed run stays replayable.
+func (r *RunReport) record(e RunEvent) {
+	e.Seq = len(r.events) + 1
+	if e.At.IsZero() {
+		e.At = time.Now().UTC()
+	}
+	r.events = append(r.events, e)
+	r.apply(e)
+	logRunEvent(e)
+	if r.eventLog != "" {
+		if err := appendRunEvent(r.eventLog, e); err != nil {
+			slog.Warn("failed to write event log", "error", err)
+		}
+	}
+}
+
+// apply folds an event into the report; reports are derived from events only
+func (r *RunReport) apply(e RunEvent) {
+	switch e.Type {
+	case EventRunStarted:
+		r.TrunkBranch, r.TargetBranch, r.BatchID, r.StartedAt = e.Trunk, e.Target, e.BatchID, e.At
+	case EventTokenMinted:
+		r.Token = e.Token
+	case EventPRFiltered, EventMergeAttempted, EventConflictDetected, EventPRSkipped:
+		if e.Result != nil {
+			r.Results = append(r.Results, *e.Result)
+		}
+	case EventPoliciesEvaluated:
+		r.Policy = e.Policy
+	case EventHookRan:
+		if e.Hook != nil {
+			r.Hooks = append(r.Hooks, *e.Hook)
+		}
+	case EventRiskScored:
+		r.Risk = e.Risk
+	case EventVerifyBisected:
+		r.Bisection = e.Bisection
+	case EventDepsGrouped:
+		r.Deps = e.Deps
+	case EventDeadlineReached:
+		r.Cutoff = e.Cutoff
+	case EventPRsReclassified:
+		r.applyReclassify(e.Closed, e.Rebuilt)
+	case EventPathsChanged:
+		r.ChangedPaths = e.Paths
+	case EventCandidateBuilt:
+		r.Diff = e.Diff
+	case EventPublished:
+		r.Candidate = e.Candidate
+	case EventRunFinished:
+		r.API = e.API
+	}
+}
+
+// tokenMinted records the installation token the run acts with
+func (r *RunReport) tokenMinted(grant *TokenGrant) {
+	r.record(RunEvent{Type: EventTokenMinted, Token: grant})
+}
+
+// discovered records the open PRs considered by the run
+func (r *RunReport) discovered(prs []GitHubPR) {
+	for _, pr := range prs {
+		r.record(RunEvent{Type: EventPRDiscovered, PR: pr.Number, Title: pr.Title})
+	}
+}
+
+// policiesEvaluated records the decisions of the batching policies
+func (r *RunReport) policiesEvaluated(decisions []PolicyDecision) {
+	r.record(RunEvent{Type: EventPoliciesEvaluated, Policy: decisions})
+}
+
+// riskScored records the risk scores of the run
+func (r *RunReport) riskScored(risk *RiskReport) {
+	r.record(RunEvent{Type: EventRiskScored, Risk: risk})
+}
+
+// deadline records the run deadline deferring the remaining PRs
+func (r *RunReport) deadline(deferred []int) {
+	r.record(RunEvent{Type: EventDeadlineReached, Cutoff: &RunCutoff{At: time.Now().UTC(), Deferred: deferred}})
+}
+
+// pathsChanged records the paths changed by the batch and by each merged PR
+func (r *RunReport) pathsChanged(paths *ChangedPaths) {
+	r.record(RunEvent{Type: EventPathsChanged, Paths: paths})
+}
+
+// depsGrouped records the collapse of the dependency update PRs
+func (r *RunReport) depsGrouped(group *DepsGroup) {
+	r.record(RunEvent{Type: EventDepsGrouped, Deps: group})
+}
+
+// candidateBuilt records the diff summary of the candidate, nil when unavailable
+func (r *RunReport) candidateBuilt(diff *DiffSummary) {
+	r.record(RunEvent{Type: EventCandidateBuilt, Diff: diff})
+}
+
+// hookRan records a hook command run
+func (r *RunReport) hookRan(run HookRun) {
+	r.record(RunEvent{Type: EventHookRan, Hook: &run})
+}
+
+// verifyBisected records the bisection of a failing verification
+func (r *RunReport) verifyBisected(bisection *VerifyBisection) {
+	r.record(RunEvent{Type: EventVerifyBisected, Bisection: bisection})
+}
+
+// published records the target branch push
+func (r *RunReport) published(candidate string) {
+	r.record(RunEvent{Type: EventPublished, Candidate: candidate})
+}
+
+// finish records the end of the run once, with the GitHub API usage tracked so far
+func (r *RunReport) finish() {
+	if n := len(r.events); n > 0 && r.events[n-1].Type == EventRunFinished {
+		return
+	}
+	r.record(RunEvent{Type: EventRunFinished, API: r.API})
+}
+
+// appendRunEvent appends an event as a JSON line to an event log file
+func appendRunEvent(path string, e RunEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadRunEvents reads an event log file
+func loadRunEvents(path string) ([]RunEvent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []RunEvent
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var e RunEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
+
+// replayRunReport rebuilds the report of a run from its events
+func replayRunReport(events []RunEvent) *RunReport {
+	r := &RunReport{}
+	for _, e := range events {
+		r.events = append(r.events, e)
+		r.apply(e)
+	}
+	return r
+}
+
+// describe renders an event as a timeline line
+func (e RunEvent) describe() string {
+	var detail string
+	switch e.Type {
+	case EventRunStarted:
+		detail = fmt.Sprintf("batch %s: %s -> %s", e.BatchID, e.Trunk, e.Target)
+	case EventTokenMinted:
+		if e.Token != nil {
+			detail = fmt.Sprintf("installation %d: %s", e.Token.Installation, e.Token.describe())
+		}
+	case EventPRDiscovered:
+		detail = fmt.Sprintf("#%d %s", e.PR, e.Title)
+	case EventPRFiltered, EventMergeAttempted, EventConflictDetected, EventPRSkipped:
+		if e.Result != nil {
+			detail = fmt.Sprintf("#%d %s", e.Result.Number, e.Result.Outcome)
+			if e.Result.Detail != "" {
+				detail += ": " + firstLine(e.Result.Detail)
+			}
+		}
+	case EventPoliciesEvaluated:
+		denied := 0
+		for _, d := range e.Policy {
+			denied += len(d.Denied)
+		}
+		detail = fmt.Sprintf("%d policy(ies), %d PR(s) denied", len(e.Policy), denied)
+	case EventRiskScored:
+		if e.Risk != nil {
+			detail = fmt.Sprintf("%d PR(s) scored, batch %.1f, %d held back", len(e.Risk.PRs), e.Risk.Batch, len(e.Risk.Held))
+		}
+	case EventDeadlineReached:
+		if e.Cutoff != nil {
+			detail = fmt.Sprintf("%d PR(s) deferred", len(e.Cutoff.Deferred))
+		}
+	case EventPRsReclassified:
+		detail = fmt.Sprintf("%d PR(s) closed, %d rebuilt", len(e.Closed), len(e.Rebuilt))
+	case EventPathsChanged:
+		if e.Paths != nil {
+			detail = fmt.Sprintf("%d path(s), %d PR(s) attributed", len(e.Paths.Paths), len(e.Paths.PRs))
+		}
+	case EventDepsGrouped:
+		if e.Deps != nil {
+			detail = fmt.Sprintf("%d PR(s) into %s", len(e.Deps.PRs), shortSHA(e.Deps.Commit))
+		}
+	case EventCandidateBuilt:
+		if e.Diff != nil {
+			detail = fmt.Sprintf("%d file(s), +%d -%d", e.Diff.Files, e.Diff.Insertions, e.Diff.Deletions)
+		}
+	case EventHookRan:
+		if e.Hook != nil {
+			detail = e.Hook.describe()
+		}
+	case EventVerifyBisected:
+		if e.Bisection != nil {
+			detail = fmt.Sprintf("%d verification(s), %d culprit(s)", len(e.Bisection.Steps), len(e.Bisection.Culprits))
+		}
+	case EventPublished:
+		detail = shortSHA(e.Candidate)
+	case EventRunFinished:
+		if e.API != nil {
+			detail = fmt.Sprintf("%d API call(s)", e.API.Calls)
+		}
+	}
+	return strings.TrimRight(fmt.Sprintf("%4d %s %-17s %s", e.Seq, e.At.Format(time.RFC3339), e.Type, detail), " ")
+}
+
+// runReplay implements the 'replay' subcommand: it prints the timeline of a recorded run,
+// or re-derives its report in any --report format for debugging and compliance review
+func runReplay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	format := fs.String("report", "", "Emit the report derived from the events in this format ("+strings.Join(validReportFormats(), ", ")+") instead of the timeline")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		log.Fatal("invalid configuration:", fmt.Errorf("usage: replay [--report format] <event log file>"))
+	}
+	if _, ok := reportEmitters[*format]; *format != "" && !ok {
+		log.Fatal("invalid configuration:", fmt.Errorf("invalid parameter 'report': '%s' (expected one of %s)", *format, strings.Join(validReportFormats(), ", ")))
+	}
+	events, err := loadRunEvents(fs.Arg(0))
+	if err != nil {
+		log.Fatal("error reading event log:", err)
+	}
+
+	if *format != "" {
+		if err := reportEmitters[*format](replayRunReport(events), os.Stdout); err != nil {
+			log.Fatal("error writing report:", err)
+		}
+		return
+	}
+	for _, e := range events {
+		fmt.Println(e.describe())
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseAuthorTeams parses the author_teams entries "team=login|login" into the team of
+// every login. Logins are matched case-insensitively, like on GitHub.
+func parseAuthorTeams(entries []string) (map[string]string, error) {
+	teams := make(map[string]string)
+	for _, entry := range entries {
+		team, members, ok := strings.Cut(entry, "=")
+		team = strings.TrimSpace(team)
+		if !ok || team == "" || strings.TrimSpace(members) == "" {
+			return nil, fmt.Errorf("invalid parameter 'author_teams': '%s' (expected team=login|login)", entry)
+		}
+		for _, login := range strings.Split(members, "|") {
+			login = strings.ToLower(strings.TrimSpace(login))
+			if login == "" {
+				continue
+			}
+			if other, ok := teams[login]; ok && other != team {
+				return nil, fmt.Errorf("invalid parameter 'author_teams': '%s' belongs to teams '%s' and '%s'", login, other, team)
+			}
+			teams[login] = team
+		}
+	}
+	return teams, nil
+}
+
+// fairnessGroup returns the group a PR counts against: the team of its author, else the author
+func fairnessGroup(cfg Config, pr GitHubPR) string {
+	login := strings.ToLower(pr.Author)
+	if team, ok := cfg.AuthorTeams[login]; ok {
+		return "team " + team
+	}
+	return "author " + login
+}
+
+// limitBatch caps the batch at max_prs PRs, deferring the rest to the next run. With
+// max_prs_per_author, each author or team gets up to that many PRs in queue order
+// first, and the room left is shared round-robin between groups, so one group's
+// flood of PRs does not crowd out the others.
+func limitBatch(cfg Config, prs []GitHubPR, report *RunReport) []GitHubPR {
+	if cfg.MaxPRs <= 0 || len(prs) <= cfg.MaxPRs {
+		return prs
+	}
+
+	selected := make([]bool, len(prs))
+	count := 0
+	if cfg.MaxPRsPerAuthor > 0 {
+		// Groups in order of their first PR, each with its PRs beyond the cap
+		perGroup := make(map[string]int)
+		var groups []string
+		overflow := make(map[string][]int)
+		for i, pr := range prs {
+			group := fairnessGroup(cfg, pr)
+			if _, ok := perGroup[group]; !ok {
+				groups = append(groups, group)
+				perGroup[group] = 0
+			}
+			if perGroup[group] < cfg.MaxPRsPerAuthor && count < cfg.MaxPRs {
+				selected[i] = true
+				count++
+				perGroup[group]++
+				continue
+			}
+			overflow[group] = append(overflow[group], i)
+		}
+		for count < cfg.MaxPRs {
+			progressed := false
+			for _, group := range groups {
+				if count == cfg.MaxPRs || len(overflow[group]) == 0 {
+					continue
+				}
+				selected[overflow[group][0]] = true
+				overflow[group] = overflow[group][1:]
+				count++
+				progressed = true
+			}
+			if !progressed {
+				break
+			}
+		}
+	} else {
+		for i := range prs[:cfg.MaxPRs] {
+			selected[i] = true
+		}
+	}
+
+	var batch []GitHubPR
+	detail := fmt.Sprintf("batch size cap of %d PR(s) reached", cfg.MaxPRs)
+	if cfg.MaxPRsPerAuthor > 0 {
+		detail += fmt.Sprintf(" (%d per author or team before round-robin)", cfg.MaxPRsPerAuthor)
+	}
+	for i, pr := range prs {
+		if selected[i] {
+			batch = append(batch, pr)
+			continue
+		}
+		report.add(pr, OutcomeDeferred, detail, 0)
+	}
+	fmt.Printf("Batch size cap of %d reached: deferring %d PR(s) to the next run.\n", cfg.MaxPRs, len(prs)-len(batch))
+	return batch
+}
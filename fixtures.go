@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Fixture is a recorded GitHub API interaction.
+// Credentials and hosts are never stored, so fixtures can be attached to bug reports.
+type Fixture struct {
+	Method      string            `json:"method"`       // HTTP method
+	Path        string            `json:"path"`         // Request path including the query string
+	RequestBody string            `json:"request_body"` // Raw request payload
+	Status      int               `json:"status"`       // Response status code
+	Headers     map[string]string `json:"headers"`      // Selected response headers
+	Body        string            `json:"body"`         // Raw response body
+}
+
+// recordedHeaders lists the response headers kept in fixtures
+var recordedHeaders = []string{"Content-Type", "Link", "X-RateLimit-Remaining", "X-GitHub-Request-Id"}
+
+// recordTransport forwards requests and writes every interaction to a fixture file
+type recordTransport struct {
+	dir  string
+	next http.RoundTripper
+
+	mu  sync.Mutex
+	seq int
+}
+
+// newRecordTransport creates the fixture directory and returns a recording transport
+func newRecordTransport(dir string, next http.RoundTripper) (*recordTransport, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create record dir failed: %w", err)
+	}
+	return &recordTransport{dir: dir, next: next}, nil
+}
+
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		if reqBody, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	fixture := Fixture{
+		Method:      req.Method,
+		Path:        req.URL.RequestURI(),
+		RequestBody: string(reqBody),
+		Status:      resp.StatusCode,
+		Headers:     make(map[string]string),
+		Body:        string(respBody),
+	}
+	for _, h := range recordedHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			fixture.Headers[h] = v
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seq++
+	data, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("fixture serialization failed: %w", err)
+	}
+	name := filepath.Join(t.dir, fmt.Sprintf("%04d-%s.json", t.seq, strings.ToLower(req.Method)))
+	if err := os.WriteFile(name, data, 0644); err != nil {
+		return nil, fmt.Errorf("fixture write failed: %w", err)
+	}
+	return resp, nil
+}
+
+// replayTransport answers requests from recorded fixtures without network access.
+// Interactions are matched by method and path in recording order, so repeated
+// identical requests replay their responses in sequence.
+type replayTransport struct {
+	mu       sync.Mutex
+	fixtures []Fixture
+	used     []bool
+}
+
+// newReplayTransport loads every fixture of dir in file name order
+func newReplayTransport(dir string) (*replayTransport, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("list fixtures failed: %w", err)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no fixtures found in '%s'", dir)
+	}
+	sort.Strings(names)
+
+	t := &replayTransport{}
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("fixture read failed: %w", err)
+		}
+		var f Fixture
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, fmt.Errorf("fixture '%s' decoding failed: %w", filepath.Base(name), err)
+		}
+		t.fixtures = append(t.fixtures, f)
+	}
+	t.used = make([]bool, len(t.fixtures))
+	return t, nil
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	path := req.URL.RequestURI()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, f := range t.fixtures {
+		if t.used[i] || f.Method != req.Method || f.Path != path {
+			continue
+		}
+		t.used[i] = true
+
+		header := make(http.Header)
+		for k, v := range f.Headers {
+			header.Set(k, v)
+		}
+		return &http.Response{
+			Status:     fmt.Sprintf("%d %s", f.Status, http.StatusText(f.Status)),
+			StatusCode: f.Status,
+			Header:     header,
+			Body:       io.NopCloser(strings.NewReader(f.Body)),
+			Request:    req,
+		}, nil
+	}
+	return nil, fmt.Errorf("no recorded response for %s %s", req.Method, path)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// freshnessLimits bounds how far a target branch may lag behind before it must be rebuilt
+type freshnessLimits struct {
+	MaxAge    time.Duration // Largest age of the build, 0 disables the check
+	MaxBehind int           // Most trunk commits missing from the build, 0 disables the check
+}
+
+// freshness is the state of a published target branch relative to trunk
+type freshness struct {
+	BuiltAt time.Time // Build time
+	Trunk   string    // Trunk commit the branch was built on
+	Behind  int       // Trunk commits newer than the build
+	Stale   []string  // Exceeded limits, empty when the branch is fresh
+}
+
+// registerFreshnessFlags declares the freshness limit flags on fs
+func registerFreshnessFlags(fs *flag.FlagSet) *freshnessLimits {
+	limits := &freshnessLimits{}
+	fs.DurationVar(&limits.MaxAge, "max_age", 0, "Largest age of the target branch build, e.g. 12h (0 disables the check)")
+	fs.IntVar(&limits.MaxBehind, "max_behind", 0, "Most trunk commits the target branch may miss (0 disables the check)")
+	return limits
+}
+
+// validate rejects limits checking nothing
+func (l freshnessLimits) validate() error {
+	if l.MaxAge < 0 || l.MaxBehind < 0 {
+		return fmt.Errorf("invalid parameters 'max_age' and 'max_behind': limits must not be negative")
+	}
+	if l.MaxAge == 0 && l.MaxBehind == 0 {
+		return fmt.Errorf("missing required parameter: 'max_age' or 'max_behind'")
+	}
+	return nil
+}
+
+// checkFreshness fetches trunk and the target branch and compares the build stamp of the
+// target history with the limits. Branches built before stamps were recorded fall back to
+// the target tip commit time and its merge base with trunk.
+func checkFreshness(cfg Config, limits freshnessLimits) (freshness, error) {
+	var f freshness
+	if err := runOriginGit("fetch", "origin", cfg.TrunkBranch, cfg.TargetBranch); err != nil {
+		return f, fmt.Errorf("fetch failed: %w", err)
+	}
+	trunkRef, targetRef := "origin/"+cfg.TrunkBranch, "origin/"+cfg.TargetBranch
+
+	history, err := loadRefHistoryAt(targetRef)
+	if err == nil && history.Stamp != nil {
+		f.BuiltAt, f.Trunk = history.Stamp.BuiltAt, history.Stamp.Trunk
+	} else {
+		date, err := runGitCommandWithOutput("log", "-1", "--format=%cI", targetRef)
+		if err != nil {
+			return f, fmt.Errorf("read build time failed: %w", err)
+		}
+		if f.BuiltAt, err = time.Parse(time.RFC3339, strings.TrimSpace(date)); err != nil {
+			return f, fmt.Errorf("read build time failed: %w", err)
+		}
+		base, err := runGitCommandWithOutput("merge-base", targetRef, trunkRef)
+		if err != nil {
+			return f, fmt.Errorf("find trunk revision failed: %w", err)
+		}
+		f.Trunk = strings.TrimSpace(base)
+	}
+
+	count, err := runGitCommandWithOutput("rev-list", "--count", f.Trunk+".."+trunkRef)
+	if err != nil {
+		return f, fmt.Errorf("count trunk commits failed: %w", err)
+	}
+	if f.Behind, err = strconv.Atoi(strings.TrimSpace(count)); err != nil {
+		return f, fmt.Errorf("count trunk commits failed: %w", err)
+	}
+
+	if age := time.Since(f.BuiltAt); limits.MaxAge > 0 && age > limits.MaxAge {
+		f.Stale = append(f.Stale, fmt.Sprintf("built %s ago (max %s)", age.Round(time.Second), limits.MaxAge))
+	}
+	if limits.MaxBehind > 0 && f.Behind > limits.MaxBehind {
+		f.Stale = append(f.Stale, fmt.Sprintf("%d trunk commit(s) behind (max %d)", f.Behind, limits.MaxBehind))
+	}
+	return f, nil
+}
+
+// runCheckFreshness implements the 'check-freshness' subcommand, failing when the
+// published target branch is older or further behind trunk than the limits allow
+func runCheckFreshness(args []string) {
+	fs := flag.NewFlagSet("check-freshness", flag.ExitOnError)
+	limits := registerFreshnessFlags(fs)
+	cfg := mustParseConfig(fs, args)
+	mustRequireOutputs(cfg)
+	mustDetectGit(cfg)
+	if err := limits.validate(); err != nil {
+		log.Fatal("invalid configuration:", err)
+	}
+
+	f, err := checkFreshness(cfg, *limits)
+	if err != nil {
+		log.Fatal("error checking freshness:", err)
+	}
+	fmt.Printf("'%s' was built %s on %s@%s, %d trunk commit(s) behind.\n", cfg.TargetBranch,
+		f.BuiltAt.Format(time.RFC3339), cfg.TrunkBranch, shortSHA(f.Trunk), f.Behind)
+	setOutput(cfg, "trunk_behind", strconv.Itoa(f.Behind))
+	setOutput(cfg, "stale", strconv.FormatBool(len(f.Stale) > 0))
+	if len(f.Stale) > 0 {
+		log.Fatalf("'%s' is stale: %s", cfg.TargetBranch, strings.Join(f.Stale, ", "))
+	}
+	fmt.Println("Target branch is fresh.")
+}
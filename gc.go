@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// staleBranch is a generated remote branch eligible for garbage collection
+type staleBranch struct {
+	name   string // Branch name without the remote prefix
+	reason string // Why the branch is stale
+}
+
+// runGC deletes generated remote branches whose tip is older than the retention period,
+// and preview branches of PRs that are no longer open. Trunk and the current target are kept.
+func runGC(args []string) {
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	retention := fs.Duration("retention", 30*24*time.Hour, "Delete generated branches whose last commit is older than this")
+	prefixes := fs.String("prefixes", "pre-,"+previewBranchPrefix, "Comma separated prefixes of generated branches")
+	closedPreviews := fs.Bool("closed_previews", true, "Delete preview branches of PRs that are no longer open")
+	dryRun := fs.Bool("dry_run", false, "Only list the branches that would be deleted")
+	cfg := mustParseConfig(fs, args)
+	mustDetectGit(cfg)
+
+	if err := runOriginGit("fetch", "--prune", "origin"); err != nil {
+		log.Fatal("error fetching branches:", err)
+	}
+
+	var client GitHubClient
+	if *closedPreviews {
+		client = mustNewGitHubClient(cfg)
+	}
+	stale, err := findStaleBranches(client, cfg, parseLabels(*prefixes), *retention)
+	if err != nil {
+		log.Fatal("error listing branches:", err)
+	}
+
+	if len(stale) == 0 {
+		fmt.Println("No stale generated branches found.")
+		return
+	}
+
+	deleted := 0
+	for _, b := range stale {
+		if *dryRun {
+			fmt.Printf("  would delete '%s' (%s)\n", b.name, b.reason)
+			continue
+		}
+		fmt.Printf("  deleting '%s' (%s) ... ", b.name, b.reason)
+		if err := runOriginGit("push", "origin", "--delete", b.name); err != nil {
+			fmt.Printf("FAILED\n         Reason: %s\n", firstLine(err.Error()))
+			continue
+		}
+		fmt.Println("OK")
+		deleted++
+	}
+	if !*dryRun {
+		fmt.Printf("\n%d/%d stale branch(es) deleted.\n", deleted, len(stale))
+	}
+}
+
+// findStaleBranches lists the remote branches matching a generated prefix that are stale
+func findStaleBranches(client GitHubClient, cfg Config, prefixes []string, retention time.Duration) ([]staleBranch, error) {
+	output, err := runGitCommandWithOutput("for-each-ref", "--format=%(refname:lstrip=3) %(committerdate:unix)", "refs/remotes/origin/")
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-retention)
+	var stale []staleBranch
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		name, date, ok := strings.Cut(line, " ")
+		if !ok || name == "HEAD" || name == cfg.TrunkBranch || name == cfg.TargetBranch || !hasAnyPrefix(name, prefixes) {
+			continue
+		}
+
+		if unix, err := strconv.ParseInt(date, 10, 64); err == nil && time.Unix(unix, 0).Before(cutoff) {
+			stale = append(stale, staleBranch{name, fmt.Sprintf("last commit %s", time.Unix(unix, 0).UTC().Format(time.DateOnly))})
+			continue
+		}
+
+		if client == nil || !strings.HasPrefix(name, previewBranchPrefix) {
+			continue
+		}
+		number, err := strconv.Atoi(strings.TrimPrefix(name, previewBranchPrefix+"pr-"))
+		if err != nil {
+			continue
+		}
+		pr, err := client.GetPR(number)
+		if err != nil {
+			slog.Warn("failed to fetch PR", "pr_number", number, "error", err)
+			continue
+		}
+		if pr.State != "open" {
+			stale = append(stale, staleBranch{name, fmt.Sprintf("PR #%d is %s", number, pr.State)})
+		}
+	}
+	return stale, nil
+}
+
+// hasAnyPrefix reports whether name starts with one of the prefixes
+func hasAnyPrefix(name string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// minGitVersion is the oldest git release supporting every command of the merge pipeline
+var minGitVersion = gitVersion{2, 0, 0}
+
+// gitVersion is a parsed "major.minor.patch" git release
+type gitVersion [3]int
+
+func (v gitVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+}
+
+// atLeast reports whether v is the same or a newer release than other
+func (v gitVersion) atLeast(other gitVersion) bool {
+	for i := range v {
+		if v[i] != other[i] {
+			return v[i] > other[i]
+		}
+	}
+	return true
+}
+
+// gitFeatures describes the git binary found on the PATH and the optional features it supports
+type gitFeatures struct {
+	Path              string     // Resolved git executable
+	Version           gitVersion // Reported release
+	MergeTree         bool       // 'git merge-tree --write-tree' (2.38)
+	ForceWithLease    bool       // 'git push --force-with-lease' (1.8.5)
+	Switch            bool       // 'git switch' (2.23)
+	Worktree          bool       // 'git worktree' (2.5), used by rebase_fallback and local branch updates
+	BisectFirstParent bool       // 'git bisect start --first-parent' (2.29)
+	SparseCheckout    bool       // 'git sparse-checkout' scoped to a worktree (2.35), used by the verification sandbox
+	RangeDiff         bool       // 'git range-diff' (2.19), used by range_diff_comment
+}
+
+// names lists the supported optional features for display
+func (f gitFeatures) names() []string {
+	var names []string
+	for _, feature := range []struct {
+		name      string
+		supported bool
+	}{
+		{"merge-tree", f.MergeTree},
+		{"force-with-lease", f.ForceWithLease},
+		{"switch", f.Switch},
+		{"worktree", f.Worktree},
+		{"bisect --first-parent", f.BisectFirstParent},
+		{"sparse-checkout", f.SparseCheckout},
+		{"range-diff", f.RangeDiff},
+	} {
+		if feature.supported {
+			names = append(names, feature.name)
+		}
+	}
+	return names
+}
+
+// detectGitFeatures locates git and probes its version once per process
+var detectGitFeatures = sync.OnceValues(func() (gitFeatures, error) {
+	path, err := exec.LookPath("git")
+	if err != nil {
+		return gitFeatures{}, errors.New("git executable not found in PATH; install git in the runner image")
+	}
+	output, err := exec.Command(path, "version").Output()
+	if err != nil {
+		return gitFeatures{}, fmt.Errorf("running '%s version' failed: %w", path, err)
+	}
+	version, err := parseGitVersion(string(output))
+	if err != nil {
+		return gitFeatures{}, err
+	}
+	return gitFeatures{
+		Path:              path,
+		Version:           version,
+		MergeTree:         version.atLeast(gitVersion{2, 38, 0}),
+		ForceWithLease:    version.atLeast(gitVersion{1, 8, 5}),
+		Switch:            version.atLeast(gitVersion{2, 23, 0}),
+		Worktree:          version.atLeast(gitVersion{2, 5, 0}),
+		BisectFirstParent: version.atLeast(gitVersion{2, 29, 0}),
+		SparseCheckout:    version.atLeast(gitVersion{2, 35, 0}),
+		RangeDiff:         version.atLeast(gitVersion{2, 19, 0}),
+	}, nil
+})
+
+// parseGitVersion parses 'git version' output such as "git version 2.39.5 (Apple Git-154)"
+func parseGitVersion(output string) (gitVersion, error) {
+	fields := strings.Fields(output)
+	if len(fields) < 3 || fields[0] != "git" || fields[1] != "version" {
+		return gitVersion{}, fmt.Errorf("unrecognized git version output: %q", strings.TrimSpace(output))
+	}
+	var v gitVersion
+	for i, part := range strings.SplitN(fields[2], ".", 4) {
+		if i == len(v) {
+			break
+		}
+		// Vendor suffixes such as "2.39.5.windows.1" or "2.45.0-rc1" end the number
+		digits := strings.TrimRightFunc(part, func(r rune) bool { return r < '0' || r > '9' })
+		n, err := strconv.Atoi(digits)
+		if err != nil {
+			break
+		}
+		v[i] = n
+	}
+	if v == (gitVersion{}) {
+		return v, fmt.Errorf("unrecognized git version: %q", fields[2])
+	}
+	return v, nil
+}
+
+// mustDetectGit enforces a usable git binary supporting the configured features
+func mustDetectGit(cfg Config) gitFeatures {
+	features, err := detectGitFeatures()
+	if err == nil {
+		err = requireGitFeatures(cfg, features)
+	}
+	if err != nil {
+		log.Fatal("error checking git:", err)
+	}
+	return features
+}
+
+// requireGitFeatures fails early when the configuration needs a feature git lacks,
+// instead of failing mid-pipeline with git's own usage output
+func requireGitFeatures(cfg Config, f gitFeatures) error {
+	if !f.Version.atLeast(minGitVersion) {
+		return fmt.Errorf("git %s is too old (requires %s or later)", f.Version, minGitVersion)
+	}
+	if !f.Worktree {
+		if cfg.RebaseFallback {
+			return fmt.Errorf("parameter 'rebase_fallback' requires git worktree support (git %s)", f.Version)
+		}
+		if cfg.UpdateBranches == updateBranchLocal {
+			return fmt.Errorf("parameter 'update_branches' local requires git worktree support (git %s)", f.Version)
+		}
+		if len(cfg.BuildTargets) > 0 {
+			return fmt.Errorf("parameter 'build_targets' requires git worktree support (git %s)", f.Version)
+		}
+		if cfg.VerifyCmd != "" {
+			return fmt.Errorf("parameter 'verify_cmd' requires git worktree support (git %s)", f.Version)
+		}
+	}
+	if !f.MergeTree && cfg.DryRun {
+		return fmt.Errorf("parameter 'dry_run' requires 'git merge-tree --write-tree' (git %s)", f.Version)
+	}
+	if !f.RangeDiff && cfg.RangeDiffComment {
+		return fmt.Errorf("parameter 'range_diff_comment' requires 'git range-diff' (git %s)", f.Version)
+	}
+	if !f.MergeTree && cfg.PreverifyParallelism > 0 {
+		return fmt.Errorf("parameter 'preverify_parallelism' requires 'git merge-tree --write-tree' (git %s)", f.Version)
+	}
+	if !f.MergeTree && cfg.BisectOnFailure && cfg.CommitMode == commitModeSingle {
+		return fmt.Errorf("parameter 'bisect_on_failure' with commit_mode single requires 'git merge-tree --write-tree' (git %s)", f.Version)
+	}
+	return nil
+}
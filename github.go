@@ -0,0 +1,891 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// GitHubClient abstracts every GitHub API call made by the bot,
+// so the pipeline can run against recorded fixtures or fakes
+type GitHubClient interface {
+	// ListOpenPRs retrieves all open PRs targeting base, oldest first
+	ListOpenPRs(base string) ([]GitHubPR, error)
+	// GetPR retrieves a single PR by number
+	GetPR(number int) (GitHubPR, error)
+	// ListIssueComments retrieves all comments of an issue or pull request
+	ListIssueComments(number int) ([]IssueComment, error)
+	// CreateIssueComment adds a comment to an issue or pull request
+	CreateIssueComment(number int, body string) error
+	// UpdateIssueComment replaces the body of an existing comment
+	UpdateIssueComment(id int64, body string) error
+	// ListOpenIssues retrieves open issues carrying label
+	ListOpenIssues(label string) ([]Issue, error)
+	// CreateIssue opens a new issue
+	CreateIssue(title, body string, labels, assignees []string) error
+	// CloseIssue closes an issue
+	CloseIssue(number int) error
+	// UpdatePRBranch asks GitHub to merge the base branch into the PR branch at headSHA
+	UpdatePRBranch(number int, headSHA string) error
+	// ListOrgRepos retrieves all repositories of an organization
+	ListOrgRepos(org string) ([]Repository, error)
+	// GetRepository retrieves the configured repository
+	GetRepository() (Repository, error)
+	// CreatePR opens a pull request of the head branch against base, as a draft when
+	// draft is set, returning its number
+	CreatePR(title, head, base, body string, draft bool) (int, error)
+	// UpdatePR replaces the title and description of a pull request
+	UpdatePR(number int, title, body string) error
+	// ListLabeledPRs retrieves the numbers of the open and closed PRs carrying label
+	ListLabeledPRs(label string) ([]int, error)
+	// AddLabel adds a label to an issue or pull request
+	AddLabel(number int, label string) error
+	// RemoveLabel removes a label from an issue or pull request
+	RemoveLabel(number int, label string) error
+	// DeleteLabel deletes a label of the repository, removing it from every issue and pull request
+	DeleteLabel(label string) error
+	// GetCollaboratorPermission retrieves the permission of a user on the repository (admin, maintain, write, triage, read or none)
+	GetCollaboratorPermission(user string) (string, error)
+	// ListCheckRuns retrieves the check runs of a commit
+	ListCheckRuns(ref string) ([]CheckRun, error)
+	// ListMergeQueue retrieves the entries of the native merge queue of branch, in queue order
+	ListMergeQueue(branch string) ([]MergeQueueEntry, error)
+	// ListBranchRules retrieves the active ruleset rules applying to branch
+	ListBranchRules(branch string) ([]BranchRule, error)
+	// GetRuleset retrieves a ruleset of the repository or of its organization
+	GetRuleset(id int64) (Ruleset, error)
+	// ListRulesets retrieves the rulesets defined by the repository itself
+	ListRulesets() ([]Ruleset, error)
+	// CreateRuleset creates a repository ruleset, returning its ID
+	CreateRuleset(spec RulesetSpec) (int64, error)
+	// UpdateRuleset replaces a repository ruleset
+	UpdateRuleset(id int64, spec RulesetSpec) error
+	// GetProject retrieves a Projects (v2) board of a user or organization with its single select field
+	GetProject(owner string, number int, field string) (Project, error)
+	// ListProjectItems retrieves the pull request items of a project with their field value
+	ListProjectItems(projectID, field string) ([]ProjectItem, error)
+	// AddProjectItem adds a pull request of the repository to a project, returning its item ID
+	AddProjectItem(projectID string, number int) (string, error)
+	// SetProjectItemOption sets the single select field of a project item to an option
+	SetProjectItemOption(projectID, itemID, fieldID, optionID string) error
+}
+
+// Project represents a simplified Projects (v2) board
+type Project struct {
+	ID      string            `json:"id"`       // Project node ID
+	Title   string            `json:"title"`    // Project title
+	FieldID string            `json:"field_id"` // Node ID of the single select field
+	Options map[string]string `json:"options"`  // Option node IDs of the field, by name
+}
+
+// ProjectItem represents a pull request item of a project
+type ProjectItem struct {
+	ID     string `json:"id"`     // Item node ID
+	Repo   string `json:"repo"`   // Repository of the PR, as owner/name
+	Number int    `json:"number"` // PR number
+	State  string `json:"state"`  // PR state: OPEN, CLOSED or MERGED
+	Option string `json:"option"` // Option of the single select field, empty when unset
+}
+
+// BranchRule represents an active ruleset rule applying to a branch
+type BranchRule struct {
+	Type      string `json:"type"`           // Rule type (required_signatures, required_linear_history, non_fast_forward, ...)
+	Source    string `json:"ruleset_source"` // Repository or organization defining the ruleset
+	RulesetID int64  `json:"ruleset_id"`     // Ruleset holding the rule
+}
+
+// Ruleset represents a simplified repository or organization ruleset
+type Ruleset struct {
+	ID     int64  `json:"id"`                      // Ruleset ID
+	Name   string `json:"name"`                    // Ruleset name
+	Bypass string `json:"current_user_can_bypass"` // Whether the token may bypass it: always, pull_requests_only or never
+}
+
+// RulesetSpec is the definition of a repository ruleset on branches, as created or updated
+type RulesetSpec struct {
+	Name         string            `json:"name"`          // Ruleset name
+	Target       string            `json:"target"`        // Refs the ruleset applies to: branch
+	Enforcement  string            `json:"enforcement"`   // active, evaluate or disabled
+	BypassActors []RulesetBypass   `json:"bypass_actors"` // Actors exempted from the rules
+	Conditions   RulesetConditions `json:"conditions"`    // Branches the ruleset applies to
+	Rules        []RulesetRule     `json:"rules"`         // Rules enforced
+}
+
+// RulesetBypass is an actor exempted from the rules of a ruleset
+type RulesetBypass struct {
+	ActorID    int64  `json:"actor_id"`    // App, team or role ID (1 for OrganizationAdmin)
+	ActorType  string `json:"actor_type"`  // Integration, Team, RepositoryRole or OrganizationAdmin
+	BypassMode string `json:"bypass_mode"` // always or pull_request
+}
+
+// RulesetConditions selects the refs of a ruleset
+type RulesetConditions struct {
+	RefName struct {
+		Include []string `json:"include"` // Refs included, as refs/heads/<branch>
+		Exclude []string `json:"exclude"` // Refs excluded
+	} `json:"ref_name"`
+}
+
+// RulesetRule is a rule of a ruleset, with the parameters of its type
+type RulesetRule struct {
+	Type       string         `json:"type"`                 // Rule type (update, deletion, non_fast_forward, ...)
+	Parameters map[string]any `json:"parameters,omitempty"` // Parameters of the rule type
+}
+
+// MergeQueueEntry represents a simplified entry of a native merge queue
+type MergeQueueEntry struct {
+	Position int    `json:"position"` // 1-based position in the queue
+	State    string `json:"state"`    // QUEUED, AWAITING_CHECKS, MERGEABLE, UNMERGEABLE or LOCKED
+	Number   int    `json:"number"`   // Enqueued PR number
+	HeadSHA  string `json:"head_sha"` // PR head the queue merges
+}
+
+// CheckRun represents a simplified check run of a commit
+type CheckRun struct {
+	Name       string `json:"name"`       // Check name
+	Status     string `json:"status"`     // queued, in_progress or completed
+	Conclusion string `json:"conclusion"` // Outcome of a completed run (success, failure, neutral, skipped, ...)
+}
+
+// IssueComment represents a simplified issue or pull request comment
+type IssueComment struct {
+	ID                int64  `json:"id"`                 // Comment ID
+	Body              string `json:"body"`               // Comment body (markdown)
+	AuthorAssociation string `json:"author_association"` // Commenter role in the repository (OWNER, MEMBER, ...)
+}
+
+// restClient implements GitHubClient over the GitHub REST API
+type restClient struct {
+	cfg   Config
+	http  *http.Client
+	usage *APIUsage
+}
+
+// newGitHubClient builds the REST client, recording or replaying API traffic when configured
+func newGitHubClient(cfg Config) (GitHubClient, error) {
+	var transport http.RoundTripper = http.DefaultTransport
+	switch {
+	case cfg.ReplayDir != "":
+		replay, err := newReplayTransport(cfg.ReplayDir)
+		if err != nil {
+			return nil, err
+		}
+		transport = replay
+	case cfg.RecordDir != "":
+		record, err := newRecordTransport(cfg.RecordDir, transport)
+		if err != nil {
+			return nil, err
+		}
+		transport = record
+	}
+	if len(cfg.Chaos) > 0 {
+		transport = chaosTransport{next: transport, cfg: cfg}
+	}
+	if cfg.APIRateLimit > 0 {
+		transport = newRateLimitedTransport(transport, cfg.APIRateLimit)
+	}
+
+	usage := &APIUsage{}
+	return &restClient{
+		cfg:   cfg,
+		http:  &http.Client{Timeout: 15 * time.Second, Transport: newMeteredTransport(transport, usage, cfg.MaxResponseBytes)},
+		usage: usage,
+	}, nil
+}
+
+// Usage reports the API calls made by the client
+func (c *restClient) Usage() *APIUsage {
+	return c.usage
+}
+
+// mustNewGitHubClient enforces a usable API client
+func mustNewGitHubClient(cfg Config) GitHubClient {
+	client, err := newGitHubClient(cfg)
+	if err != nil {
+		log.Fatal("error creating GitHub client:", err)
+	}
+	return client
+}
+
+// do performs a GitHub API call relative to the configured API URL.
+// The payload is JSON-encoded when non-nil and the response is decoded into out when non-nil.
+func (c *restClient) do(method, path string, payload, out any) error {
+	return c.send(method, c.cfg.APIURL, path, payload, out)
+}
+
+// send performs a GitHub API call relative to the base URL
+func (c *restClient) send(method, base, path string, payload, out any) error {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("request encoding failed: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, base+path, body)
+	if err != nil {
+		return fmt.Errorf("request creation failed: %w", err)
+	}
+
+	req.Header.Set("Authorization", "token "+c.authToken())
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("User-Agent", userAgent)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("request API failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return newAPIError(method, path, resp)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return decodeResponse(method, path, resp, c.cfg.MaxResponseBytes, out)
+}
+
+// authToken returns the token of the calls
+func (c *restClient) authToken() string {
+	return currentToken(c.cfg)
+}
+
+// repoPath prefixes a path with the configured repository
+func (c *restClient) repoPath(format string, args ...any) string {
+	return fmt.Sprintf("/repos/%s/%s", c.cfg.Owner, c.cfg.Repo) + fmt.Sprintf(format, args...)
+}
+
+func (c *restClient) ListOpenPRs(base string) ([]GitHubPR, error) {
+	var allPRs []GitHubPR
+	for page := 1; ; page++ {
+		var batch []rawPR
+		path := c.repoPath("/pulls?state=open&base=%s&sort=created&direction=asc&per_page=100&page=%d",
+			url.QueryEscape(base), page)
+		if err := c.do("GET", path, nil, &batch); err != nil {
+			return nil, err
+		}
+
+		for _, raw := range batch {
+			allPRs = append(allPRs, raw.toGitHubPR())
+		}
+
+		if len(batch) < 100 {
+			return allPRs, nil
+		}
+	}
+}
+
+func (c *restClient) GetPR(number int) (GitHubPR, error) {
+	var raw rawPR
+	if err := c.do("GET", c.repoPath("/pulls/%d", number), nil, &raw); err != nil {
+		return GitHubPR{}, err
+	}
+	return raw.toGitHubPR(), nil
+}
+
+func (c *restClient) GetCollaboratorPermission(user string) (string, error) {
+	var out struct {
+		Permission string `json:"permission"`
+		RoleName   string `json:"role_name"`
+	}
+	if err := c.do("GET", c.repoPath("/collaborators/%s/permission", url.PathEscape(user)), nil, &out); err != nil {
+		return "", err
+	}
+	// role_name distinguishes maintain and triage, which permission folds into write and read
+	if out.RoleName != "" {
+		return out.RoleName, nil
+	}
+	return out.Permission, nil
+}
+
+func (c *restClient) ListCheckRuns(ref string) ([]CheckRun, error) {
+	var runs []CheckRun
+	for page := 1; ; page++ {
+		var batch struct {
+			CheckRuns []CheckRun `json:"check_runs"`
+		}
+		if err := c.do("GET", c.repoPath("/commits/%s/check-runs?per_page=100&page=%d", url.PathEscape(ref), page), nil, &batch); err != nil {
+			return nil, err
+		}
+		runs = append(runs, batch.CheckRuns...)
+		if len(batch.CheckRuns) < 100 {
+			return runs, nil
+		}
+	}
+}
+
+// mergeQueueQuery pages through the merge queue entries of a branch
+const mergeQueueQuery = `query($owner: String!, $repo: String!, $branch: String!, $after: String) {
+  repository(owner: $owner, name: $repo) {
+    mergeQueue(branch: $branch) {
+      entries(first: 100, after: $after) {
+        nodes { position state pullRequest { number headRefOid } }
+        pageInfo { hasNextPage endCursor }
+      }
+    }
+  }
+}`
+
+func (c *restClient) ListMergeQueue(branch string) ([]MergeQueueEntry, error) {
+	var entries []MergeQueueEntry
+	var after *string
+	for {
+		var out struct {
+			Repository struct {
+				MergeQueue *struct {
+					Entries struct {
+						Nodes []struct {
+							Position    int    `json:"position"`
+							State       string `json:"state"`
+							PullRequest struct {
+								Number     int    `json:"number"`
+								HeadRefOid string `json:"headRefOid"`
+							} `json:"pullRequest"`
+						} `json:"nodes"`
+						PageInfo struct {
+							HasNextPage bool    `json:"hasNextPage"`
+							EndCursor   *string `json:"endCursor"`
+						} `json:"pageInfo"`
+					} `json:"entries"`
+				} `json:"mergeQueue"`
+			} `json:"repository"`
+		}
+		vars := map[string]any{"owner": c.cfg.Owner, "repo": c.cfg.Repo, "branch": branch, "after": after}
+		if err := c.graphql(mergeQueueQuery, vars, &out); err != nil {
+			return nil, err
+		}
+		// Branches without a merge queue have a null queue
+		queue := out.Repository.MergeQueue
+		if queue == nil {
+			return nil, fmt.Errorf("branch '%s' has no merge queue", branch)
+		}
+		for _, node := range queue.Entries.Nodes {
+			entries = append(entries, MergeQueueEntry{
+				Position: node.Position,
+				State:    node.State,
+				Number:   node.PullRequest.Number,
+				HeadSHA:  node.PullRequest.HeadRefOid,
+			})
+		}
+		if !queue.Entries.PageInfo.HasNextPage {
+			return entries, nil
+		}
+		after = queue.Entries.PageInfo.EndCursor
+	}
+}
+
+// graphql performs a GitHub GraphQL query, decoding its data into out
+func (c *restClient) graphql(query string, variables map[string]any, out any) error {
+	var resp struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	payload := map[string]any{"query": query, "variables": variables}
+	// Validated by parseConfig
+	endpoint, _ := url.Parse(c.cfg.GraphQLURL)
+	path := endpoint.Path
+	endpoint.Path = ""
+	if err := c.send("POST", endpoint.String(), path, payload, &resp); err != nil {
+		return err
+	}
+	if len(resp.Errors) > 0 {
+		return fmt.Errorf("GraphQL query failed: %s", resp.Errors[0].Message)
+	}
+	if err := json.Unmarshal(resp.Data, out); err != nil {
+		return fmt.Errorf("GraphQL response decoding failed: %w", err)
+	}
+	return nil
+}
+
+// graphqlBaseURL returns the base URL of the GraphQL endpoint: GitHub Enterprise Server
+// serves it at /api/graphql next to the /api/v3 REST API
+func graphqlBaseURL(apiURL string) string {
+	if base, ok := strings.CutSuffix(apiURL, "/api/v3"); ok {
+		return base + "/api"
+	}
+	return apiURL
+}
+
+// resolveAPIURLs returns the REST and GraphQL endpoints of --api_url and --graphql_url.
+// An API URL without a path other than api.github.com is the web URL of a GitHub
+// Enterprise Server instance, whose REST API is served under /api/v3. Without
+// --api_url, the endpoints exported by Actions runners (GITHUB_API_URL and
+// GITHUB_GRAPHQL_URL) are used as they are, which also lets test harnesses point the bot
+// at a fake API server. The GraphQL endpoint defaults to the one next to the REST API.
+func resolveAPIURLs(apiURL, graphqlURL string, getenv func(string) string) (string, string, error) {
+	rest := strings.TrimRight(apiURL, "/")
+	if rest != "" {
+		u, err := parseAPIURL(rest)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid parameter 'api_url': %w", err)
+		}
+		if u.Path == "" && u.Host != "api.github.com" {
+			u.Path = "/api/v3"
+		}
+		rest = u.String()
+	} else {
+		rest = strings.TrimRight(getenv("GITHUB_API_URL"), "/")
+		if graphqlURL == "" {
+			graphqlURL = getenv("GITHUB_GRAPHQL_URL")
+		}
+	}
+	if rest == "" {
+		rest = githubAPI
+	}
+
+	gql := strings.TrimRight(graphqlURL, "/")
+	if gql == "" {
+		gql = graphqlBaseURL(rest) + "/graphql"
+	}
+	if _, err := parseAPIURL(gql); err != nil {
+		return "", "", fmt.Errorf("invalid parameter 'graphql_url': %w", err)
+	}
+	return rest, gql, nil
+}
+
+// resolveWebURL returns the web URL of the GitHub instance serving the REST API rest:
+// github.com for api.github.com, the URL before /api/v3 for GitHub Enterprise Server.
+// Without --api_url, the GITHUB_SERVER_URL of Actions runners is used as it is.
+func resolveWebURL(apiURL, rest string, getenv func(string) string) string {
+	if server := strings.TrimRight(getenv("GITHUB_SERVER_URL"), "/"); apiURL == "" && server != "" {
+		return server
+	}
+	if rest == githubAPI {
+		return githubWeb
+	}
+	if base, ok := strings.CutSuffix(rest, "/api/v3"); ok {
+		return base
+	}
+	return rest
+}
+
+// parseAPIURL parses an absolute http(s) URL of the API
+func parseAPIURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.RawQuery != "" {
+		return nil, fmt.Errorf("'%s' (expected an http(s) URL, e.g. https://github.example.com/api/v3)", raw)
+	}
+	return u, nil
+}
+
+func (c *restClient) UpdatePRBranch(number int, headSHA string) error {
+	payload := map[string]string{"expected_head_sha": headSHA}
+	return c.do("PUT", c.repoPath("/pulls/%d/update-branch", number), payload, nil)
+}
+
+func (c *restClient) ListIssueComments(number int) ([]IssueComment, error) {
+	var all []IssueComment
+	for page := 1; ; page++ {
+		var batch []IssueComment
+		path := c.repoPath("/issues/%d/comments?per_page=100&page=%d", number, page)
+		if err := c.do("GET", path, nil, &batch); err != nil {
+			return nil, err
+		}
+		all = append(all, batch...)
+		if len(batch) < 100 {
+			return all, nil
+		}
+	}
+}
+
+func (c *restClient) CreateIssueComment(number int, body string) error {
+	return c.do("POST", c.repoPath("/issues/%d/comments", number), map[string]string{"body": body}, nil)
+}
+
+func (c *restClient) UpdateIssueComment(id int64, body string) error {
+	return c.do("PATCH", c.repoPath("/issues/comments/%d", id), map[string]string{"body": body}, nil)
+}
+
+func (c *restClient) ListOpenIssues(label string) ([]Issue, error) {
+	var issues []Issue
+	for page := 1; ; page++ {
+		var batch []Issue
+		path := c.repoPath("/issues?state=open&per_page=100&page=%d&labels=%s", page, url.QueryEscape(label))
+		if err := c.do("GET", path, nil, &batch); err != nil {
+			return nil, err
+		}
+		issues = append(issues, batch...)
+		if len(batch) < 100 {
+			return issues, nil
+		}
+	}
+}
+
+func (c *restClient) ListLabeledPRs(label string) ([]int, error) {
+	var numbers []int
+	for page := 1; ; page++ {
+		var batch []struct {
+			Number      int             `json:"number"`
+			PullRequest json.RawMessage `json:"pull_request"`
+		}
+		path := c.repoPath("/issues?state=all&per_page=100&page=%d&labels=%s", page, url.QueryEscape(label))
+		if err := c.do("GET", path, nil, &batch); err != nil {
+			return nil, err
+		}
+		// The issues endpoint also lists PRs, which carry a pull_request field
+		for _, item := range batch {
+			if item.PullRequest != nil {
+				numbers = append(numbers, item.Number)
+			}
+		}
+		if len(batch) < 100 {
+			return numbers, nil
+		}
+	}
+}
+
+func (c *restClient) AddLabel(number int, label string) error {
+	return c.do("POST", c.repoPath("/issues/%d/labels", number), map[string][]string{"labels": {label}}, nil)
+}
+
+func (c *restClient) RemoveLabel(number int, label string) error {
+	return c.do("DELETE", c.repoPath("/issues/%d/labels/%s", number, url.PathEscape(label)), nil, nil)
+}
+
+func (c *restClient) DeleteLabel(label string) error {
+	return c.do("DELETE", c.repoPath("/labels/%s", url.PathEscape(label)), nil, nil)
+}
+
+func (c *restClient) CreateIssue(title, body string, labels, assignees []string) error {
+	payload := map[string]any{
+		"title":     title,
+		"body":      body,
+		"labels":    labels,
+		"assignees": assignees,
+	}
+	return c.do("POST", c.repoPath("/issues"), payload, nil)
+}
+
+func (c *restClient) CloseIssue(number int) error {
+	return c.do("PATCH", c.repoPath("/issues/%d", number), map[string]string{"state": "closed"}, nil)
+}
+
+func (c *restClient) ListOrgRepos(org string) ([]Repository, error) {
+	var all []Repository
+	for page := 1; ; page++ {
+		var batch []Repository
+		path := fmt.Sprintf("/orgs/%s/repos?type=all&per_page=100&page=%d", url.PathEscape(org), page)
+		if err := c.do("GET", path, nil, &batch); err != nil {
+			return nil, err
+		}
+		all = append(all, batch...)
+		if len(batch) < 100 {
+			return all, nil
+		}
+	}
+}
+
+func (c *restClient) GetRepository() (Repository, error) {
+	var repo Repository
+	err := c.do("GET", c.repoPath(""), nil, &repo)
+	return repo, err
+}
+
+func (c *restClient) CreatePR(title, head, base, body string, draft bool) (int, error) {
+	payload := map[string]any{"title": title, "head": head, "base": base, "body": body, "draft": draft}
+	var created struct {
+		Number int `json:"number"`
+	}
+	if err := c.do("POST", c.repoPath("/pulls"), payload, &created); err != nil {
+		return 0, err
+	}
+	return created.Number, nil
+}
+
+func (c *restClient) UpdatePR(number int, title, body string) error {
+	return c.do("PATCH", c.repoPath("/pulls/%d", number), map[string]string{"title": title, "body": body}, nil)
+}
+
+func (c *restClient) ListBranchRules(branch string) ([]BranchRule, error) {
+	var rules []BranchRule
+	for page := 1; ; page++ {
+		var batch []BranchRule
+		if err := c.do("GET", c.repoPath("/rules/branches/%s?per_page=100&page=%d", url.PathEscape(branch), page), nil, &batch); err != nil {
+			return nil, err
+		}
+		rules = append(rules, batch...)
+		if len(batch) < 100 {
+			return rules, nil
+		}
+	}
+}
+
+func (c *restClient) GetRuleset(id int64) (Ruleset, error) {
+	var ruleset Ruleset
+	err := c.do("GET", c.repoPath("/rulesets/%d?includes_parents=true", id), nil, &ruleset)
+	return ruleset, err
+}
+
+func (c *restClient) ListRulesets() ([]Ruleset, error) {
+	var rulesets []Ruleset
+	for page := 1; ; page++ {
+		var batch []Ruleset
+		if err := c.do("GET", c.repoPath("/rulesets?includes_parents=false&per_page=100&page=%d", page), nil, &batch); err != nil {
+			return nil, err
+		}
+		rulesets = append(rulesets, batch...)
+		if len(batch) < 100 {
+			return rulesets, nil
+		}
+	}
+}
+
+func (c *restClient) CreateRuleset(spec RulesetSpec) (int64, error) {
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	if err := c.do("POST", c.repoPath("/rulesets"), spec, &created); err != nil {
+		return 0, err
+	}
+	return created.ID, nil
+}
+
+func (c *restClient) UpdateRuleset(id int64, spec RulesetSpec) error {
+	return c.do("PUT", c.repoPath("/rulesets/%d", id), spec, nil)
+}
+
+// projectQuery finds a project of a user or organization with a single select field
+const projectQuery = `query($owner: String!, $number: Int!, $field: String!) {
+  repositoryOwner(login: $owner) {
+    ... on ProjectV2Owner {
+      projectV2(number: $number) {
+        id title
+        field(name: $field) { ... on ProjectV2SingleSelectField { id options { id name } } }
+      }
+    }
+  }
+}`
+
+func (c *restClient) GetProject(owner string, number int, field string) (Project, error) {
+	var out struct {
+		RepositoryOwner *struct {
+			ProjectV2 *struct {
+				ID    string `json:"id"`
+				Title string `json:"title"`
+				Field *struct {
+					ID      string `json:"id"`
+					Options []struct {
+						ID   string `json:"id"`
+						Name string `json:"name"`
+					} `json:"options"`
+				} `json:"field"`
+			} `json:"projectV2"`
+		} `json:"repositoryOwner"`
+	}
+	vars := map[string]any{"owner": owner, "number": number, "field": field}
+	if err := c.graphql(projectQuery, vars, &out); err != nil {
+		return Project{}, err
+	}
+	if out.RepositoryOwner == nil || out.RepositoryOwner.ProjectV2 == nil {
+		return Project{}, fmt.Errorf("project %s/%d not found", owner, number)
+	}
+	p := out.RepositoryOwner.ProjectV2
+	// Fields of another type come back as an empty object
+	if p.Field == nil || p.Field.ID == "" {
+		return Project{}, fmt.Errorf("project %s/%d has no single select field '%s'", owner, number, field)
+	}
+	project := Project{ID: p.ID, Title: p.Title, FieldID: p.Field.ID, Options: make(map[string]string)}
+	for _, o := range p.Field.Options {
+		project.Options[o.Name] = o.ID
+	}
+	return project, nil
+}
+
+// projectItemsQuery pages through the items of a project with the value of a field
+const projectItemsQuery = `query($project: ID!, $field: String!, $after: String) {
+  node(id: $project) {
+    ... on ProjectV2 {
+      items(first: 100, after: $after) {
+        nodes {
+          id
+          fieldValueByName(name: $field) { ... on ProjectV2ItemFieldSingleSelectValue { name } }
+          content { ... on PullRequest { number state repository { nameWithOwner } } }
+        }
+        pageInfo { hasNextPage endCursor }
+      }
+    }
+  }
+}`
+
+func (c *restClient) ListProjectItems(projectID, field string) ([]ProjectItem, error) {
+	var items []ProjectItem
+	var after *string
+	for {
+		var out struct {
+			Node struct {
+				Items struct {
+					Nodes []struct {
+						ID    string `json:"id"`
+						Value *struct {
+							Name string `json:"name"`
+						} `json:"fieldValueByName"`
+						Content *struct {
+							Number     int    `json:"number"`
+							State      string `json:"state"`
+							Repository struct {
+								NameWithOwner string `json:"nameWithOwner"`
+							} `json:"repository"`
+						} `json:"content"`
+					} `json:"nodes"`
+					PageInfo struct {
+						HasNextPage bool    `json:"hasNextPage"`
+						EndCursor   *string `json:"endCursor"`
+					} `json:"pageInfo"`
+				} `json:"items"`
+			} `json:"node"`
+		}
+		vars := map[string]any{"project": projectID, "field": field, "after": after}
+		if err := c.graphql(projectItemsQuery, vars, &out); err != nil {
+			return nil, err
+		}
+		for _, node := range out.Node.Items.Nodes {
+			// Issues and draft items have no pull request content
+			if node.Content == nil || node.Content.Number == 0 {
+				continue
+			}
+			item := ProjectItem{ID: node.ID, Repo: node.Content.Repository.NameWithOwner, Number: node.Content.Number, State: node.Content.State}
+			if node.Value != nil {
+				item.Option = node.Value.Name
+			}
+			items = append(items, item)
+		}
+		if !out.Node.Items.PageInfo.HasNextPage {
+			return items, nil
+		}
+		after = out.Node.Items.PageInfo.EndCursor
+	}
+}
+
+// pullRequestIDQuery resolves the node ID of a pull request
+const pullRequestIDQuery = `query($owner: String!, $repo: String!, $number: Int!) {
+  repository(owner: $owner, name: $repo) { pullRequest(number: $number) { id } }
+}`
+
+// addProjectItemMutation adds content to a project; adding it again returns the existing item
+const addProjectItemMutation = `mutation($project: ID!, $content: ID!) {
+  addProjectV2ItemById(input: {projectId: $project, contentId: $content}) { item { id } }
+}`
+
+func (c *restClient) AddProjectItem(projectID string, number int) (string, error) {
+	var pr struct {
+		Repository struct {
+			PullRequest *struct {
+				ID string `json:"id"`
+			} `json:"pullRequest"`
+		} `json:"repository"`
+	}
+	vars := map[string]any{"owner": c.cfg.Owner, "repo": c.cfg.Repo, "number": number}
+	if err := c.graphql(pullRequestIDQuery, vars, &pr); err != nil {
+		return "", err
+	}
+	if pr.Repository.PullRequest == nil {
+		return "", fmt.Errorf("PR #%d not found", number)
+	}
+	var out struct {
+		AddProjectV2ItemByID struct {
+			Item struct {
+				ID string `json:"id"`
+			} `json:"item"`
+		} `json:"addProjectV2ItemById"`
+	}
+	vars = map[string]any{"project": projectID, "content": pr.Repository.PullRequest.ID}
+	if err := c.graphql(addProjectItemMutation, vars, &out); err != nil {
+		return "", err
+	}
+	return out.AddProjectV2ItemByID.Item.ID, nil
+}
+
+// setProjectItemOptionMutation sets a single select field value of a project item
+const setProjectItemOptionMutation = `mutation($project: ID!, $item: ID!, $field: ID!, $option: String!) {
+  updateProjectV2ItemFieldValue(input: {projectId: $project, itemId: $item, fieldId: $field, value: {singleSelectOptionId: $option}}) {
+    projectV2Item { id }
+  }
+}`
+
+func (c *restClient) SetProjectItemOption(projectID, itemID, fieldID, optionID string) error {
+	var out json.RawMessage
+	vars := map[string]any{"project": projectID, "item": itemID, "field": fieldID, "option": optionID}
+	return c.graphql(setProjectItemOptionMutation, vars, &out)
+}
+
+// rawPR mirrors the GitHub API pull request payload fields used by the bot
+type rawPR struct {
+	Number    int    `json:"number"`
+	Title     string `json:"title"`
+	State     string `json:"state"`
+	Draft     bool   `json:"draft"`
+	CreatedAt string `json:"created_at"`
+	User      struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	Base struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+	Head struct {
+		Ref string `json:"ref"`
+		SHA string `json:"sha"`
+	} `json:"head"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	Body string `json:"body"`
+}
+
+// toGitHubPR converts the API payload into the simplified PR structure
+func (raw rawPR) toGitHubPR() GitHubPR {
+	labels := make([]string, len(raw.Labels))
+	for j, l := range raw.Labels {
+		labels[j] = l.Name
+	}
+	return GitHubPR{
+		Number:    raw.Number,
+		Title:     raw.Title,
+		State:     raw.State,
+		Draft:     raw.Draft,
+		CreatedAt: raw.CreatedAt,
+		Author:    raw.User.Login,
+		HeadSHA:   raw.Head.SHA,
+		HeadRef:   raw.Head.Ref,
+		Base:      raw.Base,
+		Labels:    labels,
+		Body:      raw.Body,
+	}
+}
+
+// upsertComment creates or updates the bot comment identified by marker.
+// The marker is an HTML comment embedded in the body, so repeated runs
+// edit a single comment instead of flooding the conversation.
+func upsertComment(client GitHubClient, number int, marker, body string) error {
+	comments, err := client.ListIssueComments(number)
+	if err != nil {
+		return fmt.Errorf("list comments failed: %w", err)
+	}
+
+	body = marker + "\n" + body
+	for _, c := range comments {
+		if !strings.Contains(c.Body, marker) {
+			continue
+		}
+		if c.Body == body {
+			return nil
+		}
+		return client.UpdateIssueComment(c.ID, body)
+	}
+
+	return client.CreateIssueComment(number, body)
+}
@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestResolveWebURL(t *testing.T) {
+	for _, tc := range []struct {
+		apiURL, server, want string
+	}{
+		{want: "https://github.com"},
+		{server: "https://github.example.com", want: "https://github.example.com"},
+		{apiURL: "https://github.example.com", want: "https://github.example.com"},
+		{apiURL: "https://github.example.com/api/v3", server: "https://github.com", want: "https://github.example.com"},
+	} {
+		getenv := func(name string) string {
+			if name == "GITHUB_SERVER_URL" {
+				return tc.server
+			}
+			return ""
+		}
+		rest, _, err := resolveAPIURLs(tc.apiURL, "", getenv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := resolveWebURL(tc.apiURL, rest, getenv); got != tc.want {
+			t.Errorf("web URL of api_url %q and GITHUB_SERVER_URL %q = %q, want %q", tc.apiURL, tc.server, got, tc.want)
+		}
+	}
+}
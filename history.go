@@ -0,0 +1,506 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// historyCommitData is the data available to --history_commit_message templates
+type historyCommitData struct {
+	BatchID      string // Run ID
+	TrunkBranch  string // Base branch of the batch
+	TargetBranch string // Branch the batch was merged into
+	Count        int    // Number of merged PRs
+	PRs          []int  // Merged PR numbers in merge order
+}
+
+// parseHistoryCommitMessage parses the history commit message template
+func parseHistoryCommitMessage(text string) (*template.Template, error) {
+	return template.New("history_commit_message").Option("missingkey=error").Parse(text)
+}
+
+// historyCommitMessage renders the configured history commit message for the merges
+func historyCommitMessage(cfg Config, merges []MergeRecord) (string, error) {
+	tmpl, err := parseHistoryCommitMessage(cfg.HistoryCommitMessage)
+	if err != nil {
+		return "", err
+	}
+	data := historyCommitData{
+		BatchID:      cfg.BatchID,
+		TrunkBranch:  cfg.TrunkBranch,
+		TargetBranch: cfg.TargetBranch,
+		Count:        len(merges),
+		PRs:          make([]int, len(merges)),
+	}
+	for i, m := range merges {
+		data.PRs[i] = m.PR
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(b.String()) == "" {
+		return refHistoryCommitMessage, nil
+	}
+	return b.String(), nil
+}
+
+// historyCodec serializes the ref history in a given file format
+type historyCodec struct {
+	encode func(h RefHistory) ([]byte, error)
+	decode func(data []byte) (RefHistory, error)
+	sniff  func(data []byte) bool // Reports whether data looks like this format
+}
+
+// historyCodecs maps every --history_format to its codec.
+// Readers detect the format from the content, so the file name never changes.
+var historyCodecs = map[string]historyCodec{
+	"json": {encode: encodeHistoryJSON, decode: decodeHistoryJSON, sniff: sniffHistoryJSON},
+	"yaml": {encode: encodeHistoryYAML, decode: decodeHistoryYAML, sniff: sniffHistoryYAML},
+	"toml": {encode: encodeHistoryTOML, decode: decodeHistoryTOML, sniff: sniffHistoryTOML},
+}
+
+// validHistoryFormats lists the supported --history_format values
+func validHistoryFormats() []string {
+	formats := make([]string, 0, len(historyCodecs))
+	for f := range historyCodecs {
+		formats = append(formats, f)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// decodeRefHistory parses a ref history in any supported format
+func decodeRefHistory(data []byte) (RefHistory, error) {
+	for _, format := range validHistoryFormats() {
+		if codec := historyCodecs[format]; codec.sniff(data) {
+			return codec.decode(data)
+		}
+	}
+	return RefHistory{}, fmt.Errorf("unrecognized history format")
+}
+
+func sniffHistoryJSON(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+}
+
+func encodeHistoryJSON(h RefHistory) ([]byte, error) {
+	return json.MarshalIndent(h, "", "  ")
+}
+
+func decodeHistoryJSON(data []byte) (RefHistory, error) {
+	var h RefHistory
+	if err := json.Unmarshal(data, &h); err != nil {
+		return h, fmt.Errorf("history decoding failed: %w", err)
+	}
+	return h, nil
+}
+
+func sniffHistoryYAML(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("merges:")) || bytes.Contains(data, []byte("\nmerges:")) ||
+		bytes.HasPrefix(data, []byte("batch_id:"))
+}
+
+func encodeHistoryYAML(h RefHistory) ([]byte, error) {
+	var b strings.Builder
+	if h.BatchID != "" {
+		fmt.Fprintf(&b, "batch_id: %s\n", strconv.Quote(h.BatchID))
+	}
+	if h.Cutoff != nil {
+		fmt.Fprintf(&b, "cutoff:\n  at: %s\n  deferred: %s\n", h.Cutoff.At.Format(time.RFC3339Nano), formatPRList(h.Cutoff.Deferred))
+	}
+	if h.Stamp != nil {
+		fmt.Fprintf(&b, "stamp:\n  built_at: %s\n  trunk: %s\n", h.Stamp.BuiltAt.Format(time.RFC3339Nano), strconv.Quote(h.Stamp.Trunk))
+	}
+	if len(h.Merges) == 0 {
+		b.WriteString("merges: []\n")
+	} else {
+		b.WriteString("merges:\n")
+	}
+	for _, m := range h.Merges {
+		fmt.Fprintf(&b, "  - pr: %d\n", m.PR)
+		if m.Commit != "" {
+			fmt.Fprintf(&b, "    commit: %s\n", strconv.Quote(m.Commit))
+		}
+		if m.Head != "" {
+			fmt.Fprintf(&b, "    head: %s\n", strconv.Quote(m.Head))
+		}
+		fmt.Fprintf(&b, "    timestamp: %s\n", m.Timestamp.Format(time.RFC3339Nano))
+	}
+	// List items open merge records, so the policy list comes after them
+	if len(h.Policy) > 0 {
+		b.WriteString("policy:\n")
+	}
+	for _, d := range h.Policy {
+		fmt.Fprintf(&b, "  - policy: %s\n    scope: %s\n    expr: %s\n    denied: %s\n",
+			strconv.Quote(d.Policy), strconv.Quote(d.Scope), strconv.Quote(d.Expr), formatPRList(d.Denied))
+	}
+	return []byte(b.String()), nil
+}
+
+// decodeHistoryYAML parses the YAML subset written by encodeHistoryYAML
+func decodeHistoryYAML(data []byte) (RefHistory, error) {
+	return decodeHistoryLines(data, ":", func(line string) (bool, string) {
+		if rest, ok := strings.CutPrefix(line, "- "); ok {
+			return true, rest
+		}
+		return false, line
+	})
+}
+
+func sniffHistoryTOML(data []byte) bool {
+	return bytes.Contains(data, []byte("[[merges]]")) || bytes.Contains(data, []byte("merges = []")) ||
+		bytes.HasPrefix(data, []byte("batch_id ="))
+}
+
+func encodeHistoryTOML(h RefHistory) ([]byte, error) {
+	var b strings.Builder
+	if h.BatchID != "" {
+		fmt.Fprintf(&b, "batch_id = %s\n", strconv.Quote(h.BatchID))
+	}
+	if len(h.Merges) == 0 {
+		b.WriteString("merges = []\n")
+	}
+	for _, m := range h.Merges {
+		fmt.Fprintf(&b, "\n[[merges]]\npr = %d\n", m.PR)
+		if m.Commit != "" {
+			fmt.Fprintf(&b, "commit = %s\n", strconv.Quote(m.Commit))
+		}
+		if m.Head != "" {
+			fmt.Fprintf(&b, "head = %s\n", strconv.Quote(m.Head))
+		}
+		fmt.Fprintf(&b, "timestamp = %s\n", m.Timestamp.Format(time.RFC3339Nano))
+	}
+	for _, d := range h.Policy {
+		fmt.Fprintf(&b, "\n[[policy]]\npolicy = %s\nscope = %s\nexpr = %s\ndenied = %s\n",
+			strconv.Quote(d.Policy), strconv.Quote(d.Scope), strconv.Quote(d.Expr), formatPRList(d.Denied))
+	}
+	// Tables end at the next header, so the cutoff and stamp tables come last
+	if h.Cutoff != nil {
+		fmt.Fprintf(&b, "\n[cutoff]\nat = %s\ndeferred = %s\n", h.Cutoff.At.Format(time.RFC3339Nano), formatPRList(h.Cutoff.Deferred))
+	}
+	if h.Stamp != nil {
+		fmt.Fprintf(&b, "\n[stamp]\nbuilt_at = %s\ntrunk = %s\n", h.Stamp.BuiltAt.Format(time.RFC3339Nano), strconv.Quote(h.Stamp.Trunk))
+	}
+	return []byte(b.String()), nil
+}
+
+// formatPRList renders PR numbers as an inline YAML/TOML array
+func formatPRList(prs []int) string {
+	items := make([]string, len(prs))
+	for i, pr := range prs {
+		items[i] = strconv.Itoa(pr)
+	}
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+// parsePRList parses an inline array written by formatPRList
+func parsePRList(value string) ([]int, error) {
+	inner, ok := strings.CutPrefix(value, "[")
+	if inner, ok = strings.CutSuffix(inner, "]"); !ok {
+		return nil, fmt.Errorf("invalid list %q", value)
+	}
+	prs := []int{}
+	for _, item := range strings.Split(inner, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		pr, err := strconv.Atoi(item)
+		if err != nil {
+			return nil, err
+		}
+		prs = append(prs, pr)
+	}
+	return prs, nil
+}
+
+// decodeHistoryTOML parses the TOML subset written by encodeHistoryTOML
+func decodeHistoryTOML(data []byte) (RefHistory, error) {
+	return decodeHistoryLines(data, "=", func(line string) (bool, string) {
+		return line == "[[merges]]", ""
+	})
+}
+
+// decodeHistoryLines parses line-based "key<sep> value" history files.
+// startsRecord reports whether a line opens a new merge record and returns its remainder.
+func decodeHistoryLines(data []byte, sep string, startsRecord func(line string) (bool, string)) (RefHistory, error) {
+	var h RefHistory
+	var current *MergeRecord
+	section := "" // Top-level table being read, "cutoff", "stamp" or "policy"
+	var decision *PolicyDecision
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || line == "merges:" || line == "merges: []" || line == "merges = []" {
+			continue
+		}
+		if line == "cutoff:" || line == "[cutoff]" {
+			h.Cutoff, current, section = &RunCutoff{}, nil, "cutoff"
+			continue
+		}
+		if line == "stamp:" || line == "[stamp]" {
+			h.Stamp, current, section = &BuildStamp{}, nil, "stamp"
+			continue
+		}
+		if line == "policy:" {
+			current, section = nil, "policy"
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "- "); line == "[[policy]]" || section == "policy" && ok {
+			h.Policy = append(h.Policy, PolicyDecision{})
+			decision, current, section = &h.Policy[len(h.Policy)-1], nil, "policy"
+			if line = rest; line == "" || line == "[[policy]]" {
+				continue
+			}
+		}
+		if opens, rest := startsRecord(line); opens {
+			section = ""
+			h.Merges = append(h.Merges, MergeRecord{})
+			current = &h.Merges[len(h.Merges)-1]
+			if line = rest; line == "" {
+				continue
+			}
+		}
+
+		key, value, ok := strings.Cut(line, sep)
+		if !ok {
+			return h, fmt.Errorf("history decoding failed: invalid line %d", n)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+
+		if key == "batch_id" && current == nil {
+			h.BatchID = value
+			continue
+		}
+		if section == "cutoff" {
+			var err error
+			switch key {
+			case "at":
+				h.Cutoff.At, err = time.Parse(time.RFC3339Nano, value)
+			case "deferred":
+				h.Cutoff.Deferred, err = parsePRList(value)
+			}
+			if err != nil {
+				return h, fmt.Errorf("history decoding failed: line %d: %w", n, err)
+			}
+			continue
+		}
+		if section == "policy" {
+			if decision == nil {
+				return h, fmt.Errorf("history decoding failed: unexpected key %q on line %d", key, n)
+			}
+			var err error
+			switch key {
+			case "policy":
+				decision.Policy = value
+			case "scope":
+				decision.Scope = value
+			case "expr":
+				decision.Expr = value
+			case "denied":
+				decision.Denied, err = parsePRList(value)
+			}
+			if err != nil {
+				return h, fmt.Errorf("history decoding failed: line %d: %w", n, err)
+			}
+			continue
+		}
+		if section == "stamp" {
+			var err error
+			switch key {
+			case "built_at":
+				h.Stamp.BuiltAt, err = time.Parse(time.RFC3339Nano, value)
+			case "trunk":
+				h.Stamp.Trunk = value
+			}
+			if err != nil {
+				return h, fmt.Errorf("history decoding failed: line %d: %w", n, err)
+			}
+			continue
+		}
+		if current == nil {
+			return h, fmt.Errorf("history decoding failed: unexpected key %q on line %d", key, n)
+		}
+		var err error
+		switch key {
+		case "pr":
+			current.PR, err = strconv.Atoi(value)
+		case "commit":
+			current.Commit = value
+		case "head":
+			current.Head = value
+		case "timestamp":
+			current.Timestamp, err = time.Parse(time.RFC3339Nano, value)
+		}
+		if err != nil {
+			return h, fmt.Errorf("history decoding failed: line %d: %w", n, err)
+		}
+	}
+	return h, scanner.Err()
+}
+
+// runConvertHistory implements the 'convert-history' subcommand rewriting a history file in another format
+func runConvertHistory(args []string) {
+	fs := flag.NewFlagSet("convert-history", flag.ExitOnError)
+	format := fs.String("history_format", "", fmt.Sprintf("Target format (%s)", strings.Join(validHistoryFormats(), ", ")))
+	input := fs.String("file", refHistoryFile, "History file to convert")
+	output := fs.String("output", "", "Converted file path ('-' for stdout, the input file when empty)")
+	fs.Parse(args)
+
+	codec, ok := historyCodecs[*format]
+	if !ok {
+		log.Fatal("invalid configuration:", fmt.Errorf("invalid parameter 'history_format': '%s' (expected one of %s)",
+			*format, strings.Join(validHistoryFormats(), ", ")))
+	}
+
+	data, err := os.ReadFile(*input)
+	if err != nil {
+		log.Fatal("error reading history:", err)
+	}
+	history, err := decodeRefHistory(data)
+	if err != nil {
+		log.Fatal("error reading history:", err)
+	}
+	if data, err = codec.encode(history); err != nil {
+		log.Fatal("error encoding history:", err)
+	}
+
+	switch *output {
+	case "-":
+		os.Stdout.Write(data)
+	case "":
+		*output = *input
+		fallthrough
+	default:
+		if err := os.WriteFile(*output, data, 0644); err != nil {
+			log.Fatal("error writing history:", err)
+		}
+		fmt.Printf("Converted %d merge record(s) to %s in '%s'.\n", len(history.Merges), *format, *output)
+	}
+}
+
+// historyRun is a run listed by the 'history' subcommand, in its JSON output
+type historyRun struct {
+	Candidate string `json:"candidate"` // Candidate SHA the run pushed
+	RefHistory
+}
+
+// runHistory implements the 'history' subcommand listing the runs of the target branch
+// from the ref histories recorded on the results branch, or from the ref history of the
+// published branch without one; 'history compact' trims the conflict stats instead
+func runHistory(args []string) {
+	if len(args) > 0 && args[0] == "compact" {
+		runHistoryCompact(args[1:])
+		return
+	}
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	trunk := fs.String("trunk_branch", "main", "Base branch name")
+	target := fs.String("target_branch", "", "Target branch name (defaults to pre-<trunk_branch>)")
+	results := fs.String("results_branch", "", "Results branch the runs were recorded on (see --results_branch of the bot); only the published run is listed without it")
+	pr := fs.Int("pr", 0, "Only list the runs that merged this PR number")
+	since := fs.String("since", "", "Only list the runs built at or after this timestamp (RFC 3339 or YYYY-MM-DD)")
+	limit := fs.Int("limit", 0, "List only the most recent runs, 0 for all")
+	format := fs.String("format", "text", "Output format: text, or json for one JSON object per run")
+	fs.Parse(args)
+
+	if *target == "" {
+		*target = fmt.Sprintf("pre-%s", *trunk)
+	}
+	var from time.Time
+	if *since != "" {
+		var err error
+		if from, err = time.Parse(time.RFC3339, *since); err != nil {
+			if from, err = time.Parse(time.DateOnly, *since); err != nil {
+				log.Fatal("invalid configuration:", fmt.Errorf("invalid parameter 'since': '%s' (expected RFC 3339 or YYYY-MM-DD)", *since))
+			}
+		}
+	}
+	if *format != "text" && *format != "json" {
+		log.Fatal("invalid configuration:", fmt.Errorf("invalid parameter 'format': '%s' (expected text or json)", *format))
+	}
+	mustDetectGit(Config{})
+
+	var records []runRecord
+	if *results != "" {
+		if err := runOriginGit("fetch", "origin", "+refs/heads/"+*results+":"+resultsRef); err != nil {
+			log.Fatal("error fetching results branch:", err)
+		}
+		var err error
+		if records, err = loadRunRecords(resultsRef, *target); err != nil {
+			log.Fatal("error loading run records:", err)
+		}
+	} else {
+		if err := runOriginGit("fetch", "origin", *target); err != nil {
+			slog.Warn("failed to fetch the target branch, using local refs", "branch", *target, "error", err)
+		}
+		ref := branchRef(*target)
+		h, err := loadRefHistoryAt(ref)
+		if err != nil {
+			log.Fatal("error loading history:", err)
+		}
+		candidate, _ := revParse(ref)
+		record := runRecord{Candidate: candidate, History: h}
+		if h.Stamp != nil {
+			record.BuiltAt = h.Stamp.BuiltAt
+		}
+		records = []runRecord{record}
+	}
+
+	var runs []runRecord
+	for _, r := range records {
+		if (*pr == 0 || slices.ContainsFunc(r.History.Merges, func(m MergeRecord) bool { return m.PR == *pr })) &&
+			(from.IsZero() || !r.BuiltAt.Before(from)) {
+			runs = append(runs, r)
+		}
+	}
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].BuiltAt.Before(runs[j].BuiltAt) })
+	if *limit > 0 && len(runs) > *limit {
+		runs = runs[len(runs)-*limit:]
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		for _, r := range runs {
+			if err := enc.Encode(historyRun{Candidate: r.Candidate, RefHistory: r.History}); err != nil {
+				log.Fatal("error encoding history:", err)
+			}
+		}
+		return
+	}
+	if len(runs) == 0 {
+		fmt.Printf("No run of '%s' matches.\n", *target)
+		return
+	}
+	for _, r := range runs {
+		h := r.History
+		built, trunkSHA := "unknown", "unknown"
+		if h.Stamp != nil {
+			built, trunkSHA = r.BuiltAt.Format(time.RFC3339), shortSHA(h.Stamp.Trunk)
+		}
+		prs := make([]string, len(h.Merges))
+		for i, m := range h.Merges {
+			prs[i] = fmt.Sprintf("#%d", m.PR)
+			if m.PR == *pr && m.Head != "" {
+				prs[i] += "@" + shortSHA(m.Head)
+			}
+		}
+		fmt.Printf("%s  %s  batch %s  trunk %s  %d PR(s): %s\n", built, shortSHA(r.Candidate), h.BatchID,
+			trunkSHA, len(h.Merges), strings.Join(prs, " "))
+	}
+}
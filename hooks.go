@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// hookOutputExcerpt is the tail of the hook output kept in the run report
+const hookOutputExcerpt = 4 * 1024
+
+// HookLimits bounds the resources of a hook command. Zero values leave a resource unbounded.
+type HookLimits struct {
+	Timeout time.Duration `json:"timeout,omitempty"` // Wall-clock limit, the process group is killed past it
+	CPU     time.Duration `json:"cpu,omitempty"`     // CPU time limit (RLIMIT_CPU), rounded up to seconds
+	Memory  int64         `json:"memory,omitempty"`  // Address space limit in bytes (RLIMIT_AS), rounded up to KiB
+}
+
+// HookRun records a hook command run in the run report
+type HookRun struct {
+	Hook     string        `json:"hook"`             // Hook name, e.g. verify
+	PR       int           `json:"pr,omitempty"`     // PR verified merged alone onto trunk, for the preverify hook
+	Command  string        `json:"command"`          // Shell command run
+	Limits   HookLimits    `json:"limits"`           // Limits the command ran under
+	Duration time.Duration `json:"duration"`         // Wall-clock time taken
+	ExitCode int           `json:"exit_code"`        // Exit code, -1 when killed by a signal or the timeout
+	Limit    string        `json:"limit,omitempty"`  // Limit the command was stopped by, if known
+	Output   string        `json:"output,omitempty"` // Tail of the combined output
+}
+
+// describe renders the outcome of the run as a single line
+func (h *HookRun) describe() string {
+	switch {
+	case h.Limit != "":
+		return fmt.Sprintf("%s stopped by the %s limit after %s", h.Hook, h.Limit, h.Duration.Round(time.Millisecond))
+	case h.ExitCode != 0:
+		return fmt.Sprintf("%s exited %d after %s", h.Hook, h.ExitCode, h.Duration.Round(time.Millisecond))
+	}
+	return fmt.Sprintf("%s passed in %s", h.Hook, h.Duration.Round(time.Millisecond))
+}
+
+// parseByteSize parses a size such as 512M or 2G, in bytes with binary multiples
+func parseByteSize(value string) (int64, error) {
+	digits := strings.TrimRightFunc(value, unicode.IsLetter)
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size '%s' (expected bytes or a K, M or G suffixed size)", value)
+	}
+	switch strings.TrimSuffix(strings.ToUpper(value[len(digits):]), "B") {
+	case "":
+		return n, nil
+	case "K", "KI":
+		return n << 10, nil
+	case "M", "MI":
+		return n << 20, nil
+	case "G", "GI":
+		return n << 30, nil
+	}
+	return 0, fmt.Errorf("invalid size '%s' (expected bytes or a K, M or G suffixed size)", value)
+}
+
+// hookShell returns the sh script applying the rlimits before running the command, which
+// the script receives as its first argument. Limits set by ulimit are inherited by every
+// process the command starts. The hard CPU limit is a second past the soft one, so a
+// process exceeding it gets SIGXCPU and is reported as such before it is killed.
+func hookShell(limits HookLimits) string {
+	var script []string
+	if limits.CPU > 0 {
+		seconds := int64((limits.CPU + time.Second - 1) / time.Second)
+		script = append(script, fmt.Sprintf("ulimit -S -t %d", seconds), fmt.Sprintf("ulimit -H -t %d", seconds+1))
+	}
+	if limits.Memory > 0 {
+		script = append(script, fmt.Sprintf("ulimit -v %d", (limits.Memory+1023)/1024))
+	}
+	return strings.Join(append(script, `exec sh -c "$1"`), " && ")
+}
+
+// runHook runs a hook command in dir under the limits, streaming its output to stdout
+// while keeping a bounded copy for the report. Past the timeout the whole process group
+// is killed, so background processes of the command cannot hang the batch.
+func runHook(name, command, dir string, limits HookLimits, report *RunReport) error {
+	run, err := runHookTo(name, command, dir, limits, os.Stdout, os.Stderr)
+	report.hookRan(run)
+	fmt.Println(run.describe() + ".")
+	return err
+}
+
+// runHookTo runs a hook command as runHook does with its output streamed to stdout and
+// stderr, and returns the run for the caller to record
+func runHookTo(name, command, dir string, limits HookLimits, stdout, stderr io.Writer) (HookRun, error) {
+	ctx := context.Background()
+	if limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, "sh", "-c", hookShell(limits), "sh", command)
+	cmd.Dir = dir
+	output := &boundedOutput{}
+	defer output.Close()
+	cmd.Stdout = io.MultiWriter(stdout, output)
+	cmd.Stderr = io.MultiWriter(stderr, output)
+	killProcessGroup(cmd)
+	// Processes left holding the output pipes cannot hang the wait past the kill
+	cmd.WaitDelay = 5 * time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+	run := HookRun{Hook: name, Command: command, Limits: limits, Duration: time.Since(start), ExitCode: cmd.ProcessState.ExitCode()}
+	if out := output.String(); len(out) > hookOutputExcerpt {
+		run.Output = out[len(out)-hookOutputExcerpt:]
+	} else {
+		run.Output = out
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		run.Limit = "timeout"
+		err = fmt.Errorf("wall-clock limit of %s exceeded", limits.Timeout)
+	case errors.As(err, &exitErr) && strings.Contains(exitErr.String(), "CPU time limit exceeded"):
+		run.Limit = "cpu"
+		err = fmt.Errorf("CPU time limit of %s exceeded", limits.CPU)
+	}
+	return run, err
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os/exec"
+
+// killProcessGroup leaves the default cancellation, which kills the command process only
+func killProcessGroup(cmd *exec.Cmd) {}
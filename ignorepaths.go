@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// validatePathPatterns checks the --ignore_paths glob patterns
+func validatePathPatterns(patterns []string) error {
+	for _, p := range patterns {
+		for _, segment := range strings.Split(strings.TrimSuffix(p, "/"), "/") {
+			if _, err := path.Match(segment, ""); err != nil {
+				return fmt.Errorf("pattern '%s': %w", p, err)
+			}
+		}
+	}
+	return nil
+}
+
+// matchesAnyPath reports whether file matches one of the patterns.
+// Patterns are matched per path segment; '**' spans any number of segments
+// and a trailing '/' matches everything below a directory.
+func matchesAnyPath(file string, patterns []string) bool {
+	for _, p := range patterns {
+		if dir, ok := strings.CutSuffix(p, "/"); ok {
+			p = dir + "/**"
+		}
+		if matchSegments(strings.Split(p, "/"), strings.Split(file, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches path segments against pattern segments
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
+
+// restoreIgnoredPaths reverts the ignored paths touched by the pending merge to their
+// HEAD version, deleting the ones HEAD does not have, so contributor edits to them
+// never reach the target branch. Conflicts on ignored paths are resolved the same way.
+// It returns the conflicting files left unresolved.
+func restoreIgnoredPaths(cfg Config, conflicts []string) ([]string, error) {
+	output, err := runGitCommandWithOutput("diff", "--cached", "--name-only", "HEAD")
+	if err != nil {
+		return conflicts, fmt.Errorf("list merged paths failed: %w", err)
+	}
+	files := append(strings.Fields(output), conflicts...)
+
+	restored := make(map[string]struct{})
+	for _, f := range files {
+		if _, done := restored[f]; done || !matchesAnyPath(f, cfg.IgnorePaths) {
+			continue
+		}
+		if runGitCommand("cat-file", "-e", "HEAD:"+f) == nil {
+			err = runGitCommand("checkout", "HEAD", "--", f)
+		} else if err = runGitCommand("rm", "--cached", "--force", "--quiet", "--", f); err == nil {
+			err = os.RemoveAll(f)
+		}
+		if err != nil {
+			return conflicts, fmt.Errorf("restore ignored path '%s' failed: %w", f, err)
+		}
+		restored[f] = struct{}{}
+	}
+
+	var remaining []string
+	for _, f := range conflicts {
+		if _, ok := restored[f]; !ok {
+			remaining = append(remaining, f)
+		}
+	}
+	return remaining, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Issue represents a simplified GitHub issue
+type Issue struct {
+	Number int    `json:"number"` // Issue number
+	Title  string `json:"title"`  // Issue title
+	State  string `json:"state"`  // Issue state (open/closed)
+}
+
+// incidentTitle returns the title identifying the incident issue of a target branch
+func incidentTitle(cfg Config) (string, error) {
+	return renderText(cfg, "incident_title", incidentData{Target: cfg.TargetBranch, BatchID: cfg.BatchID})
+}
+
+// findIncidentIssue returns the open incident issue of the target branch, if any
+func findIncidentIssue(client GitHubClient, cfg Config) (*Issue, error) {
+	issues, err := client.ListOpenIssues(cfg.IncidentLabel)
+	if err != nil {
+		return nil, err
+	}
+	title, err := incidentTitle(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, issue := range issues {
+		if issue.Title == title {
+			return &issue, nil
+		}
+	}
+	return nil, nil
+}
+
+// reportIncident opens or updates the labeled incident issue with the failure details.
+// Errors are logged as warnings so the original failure remains the reported one.
+func reportIncident(client GitHubClient, cfg Config, cause error) {
+	if !cfg.IncidentIssues {
+		return
+	}
+
+	body, err := renderText(cfg, "incident_body", incidentData{
+		Target:  cfg.TargetBranch,
+		BatchID: cfg.BatchID,
+		At:      time.Now().UTC().Format(time.RFC3339),
+		Cause:   cause.Error(),
+		RunURL:  workflowRunURL(),
+	})
+	if err != nil {
+		slog.Warn("failed to build incident issue body", "error", err)
+		return
+	}
+
+	issue, err := findIncidentIssue(client, cfg)
+	if err != nil {
+		slog.Warn("failed to look up incident issue", "error", err)
+		return
+	}
+
+	// A repeated failure only goes to the digest, unless its incident issue was closed meanwhile
+	notify := loadNotifyState(cfg)
+	defer notify.save()
+	if !notify.failure(cfg, cause) && issue != nil {
+		notify.publishDigest(client, cfg)
+		return
+	}
+
+	if issue != nil {
+		if err := client.CreateIssueComment(issue.Number, body); err != nil {
+			slog.Warn("failed to update incident issue", "issue_number", issue.Number, "error", err)
+		}
+		return
+	}
+
+	// The lookup above rendered the title successfully
+	title, _ := incidentTitle(cfg)
+	labels := []string{cfg.IncidentLabel}
+	if err := client.CreateIssue(title, body, labels, cfg.IncidentAssignees); err != nil {
+		slog.Warn("failed to open incident issue", "error", err)
+	}
+}
+
+// resolveIncident closes the open incident issue of the target branch after a successful run
+func resolveIncident(client GitHubClient, cfg Config) {
+	if !cfg.IncidentIssues {
+		return
+	}
+
+	issue, err := findIncidentIssue(client, cfg)
+	if err != nil {
+		slog.Warn("failed to look up incident issue", "error", err)
+		return
+	}
+	if issue == nil {
+		return
+	}
+
+	body, err := renderText(cfg, "incident_resolved", incidentData{
+		Target:  cfg.TargetBranch,
+		BatchID: cfg.BatchID,
+		At:      time.Now().UTC().Format(time.RFC3339),
+		RunURL:  workflowRunURL(),
+	})
+	if err != nil {
+		slog.Warn("failed to build incident resolution comment", "error", err)
+		return
+	}
+
+	if err := client.CreateIssueComment(issue.Number, body); err != nil {
+		slog.Warn("failed to comment on incident issue", "issue_number", issue.Number, "error", err)
+	}
+
+	if err := client.CloseIssue(issue.Number); err != nil {
+		slog.Warn("failed to close incident issue", "issue_number", issue.Number, "error", err)
+	}
+}
+
+// workflowRunURL returns the current GitHub Actions run URL, if running in Actions
+func workflowRunURL() string {
+	server, repo, runID := os.Getenv("GITHUB_SERVER_URL"), os.Getenv("GITHUB_REPOSITORY"), os.Getenv("GITHUB_RUN_ID")
+	if server == "" || repo == "" || runID == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/actions/runs/%s", server, repo, runID)
+}
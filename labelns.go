@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Constants for the label namespaces
+const (
+	labelNamespaceSep      = "/"                     // Separates the namespace of a label from its value, as in deploy/prod
+	labelNamespaceWildcard = labelNamespaceSep + "*" // Suffix of a required label matching any value of its namespace
+)
+
+// namespaceValue returns the value of a label in namespace, e.g. "prod" for deploy/prod in
+// deploy. Namespaces compare with Unicode case folding and may nest, as in team/infra/db.
+func namespaceValue(label, namespace string) (string, bool) {
+	label = strings.TrimSpace(label)
+	prefix := namespace + labelNamespaceSep
+	if len(label) <= len(prefix) || !strings.EqualFold(label[:len(prefix)], prefix) {
+		return "", false
+	}
+	return label[len(prefix):], true
+}
+
+// matchLabel reports whether a PR label matches a configured label: the same label, or
+// any label of the namespace of a 'namespace/*' entry
+func matchLabel(label, configured string) bool {
+	if namespace, ok := strings.CutSuffix(configured, labelNamespaceWildcard); ok {
+		_, ok = namespaceValue(label, namespace)
+		return ok
+	}
+	return strings.EqualFold(strings.TrimSpace(label), configured)
+}
+
+// namespaceValues returns the values of the labels of a namespace, in label order
+func namespaceValues(labels []string, namespace string) []string {
+	var values []string
+	for _, l := range labels {
+		if v, ok := namespaceValue(l, namespace); ok {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// filterLabelNamespaces requires exactly one label of every --label_namespaces namespace
+func filterLabelNamespaces(cfg Config, pr GitHubPR) (bool, string) {
+	if len(cfg.LabelNamespaces) == 0 {
+		return true, "no label namespaces required"
+	}
+	var found []string
+	for _, namespace := range cfg.LabelNamespaces {
+		values := namespaceValues(pr.Labels, namespace)
+		switch len(values) {
+		case 0:
+			return false, fmt.Sprintf("no '%s%s<value>' label", namespace, labelNamespaceSep)
+		case 1:
+			found = append(found, namespace+labelNamespaceSep+values[0])
+		default:
+			return false, fmt.Sprintf("%d '%s' labels (%s), expected exactly one", len(values), namespace, strings.Join(values, ", "))
+		}
+	}
+	return true, fmt.Sprintf("one label per namespace (%s)", strings.Join(found, ", "))
+}
+
+// requiredLabelValue returns the value the required labels give a namespace, for the
+// 'label' function of the branch templates: --labels deploy/staging gives deploy the
+// value staging
+func requiredLabelValue(cfg Config, namespace string) (string, error) {
+	var value string
+	for _, l := range cfg.RequiredLabels {
+		v, ok := namespaceValue(l, namespace)
+		if !ok || v == "*" {
+			continue
+		}
+		if value != "" && !strings.EqualFold(v, value) {
+			return "", fmt.Errorf("required labels give namespace '%s' several values (%s, %s)", namespace, value, v)
+		}
+		value = v
+	}
+	if value == "" {
+		return "", fmt.Errorf("no required label in namespace '%s'", namespace)
+	}
+	return value, nil
+}
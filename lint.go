@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// Policies applied to squash subjects failing the lint rules
+const (
+	lintPolicyReject = "reject" // Leave the PR out of the batch
+	lintPolicyFix    = "fix"    // Rewrite the subject, rejecting the PR when it still fails
+)
+
+// defaultLintFixTemplate prefixes subjects missing a ticket ID with the one found in the PR body
+const defaultLintFixTemplate = "{{.Ticket}} {{.Title}}"
+
+// lintFixData is the data available to --lint_fix_template
+type lintFixData struct {
+	Title  string // PR title
+	Number int    // PR number
+	Author string // PR author login
+	Ticket string // First ticket ID found in the PR body
+}
+
+// lintRule is a named check of the squash subject generated for a PR
+type lintRule struct {
+	name    string
+	enabled func(cfg Config) bool
+	check   func(cfg Config, subject string) string // Returns the problem, empty when the subject passes
+	fix     func(cfg Config, pr GitHubPR, subject string) string
+}
+
+// lintRules lists the commit subject rules in the order fixes are applied;
+// the length limit comes last so it also bounds the fixed subject
+var lintRules = []lintRule{
+	{name: "ticket", enabled: func(cfg Config) bool { return cfg.LintTicketPattern != "" }, check: lintTicket, fix: fixTicket},
+	{name: "forbidden words", enabled: func(cfg Config) bool { return len(cfg.LintForbiddenWords) > 0 }, check: lintForbiddenWords, fix: fixForbiddenWords},
+	{name: "length", enabled: func(cfg Config) bool { return cfg.LintMaxLength > 0 }, check: lintLength, fix: fixLength},
+}
+
+// lintEnabled reports whether any commit subject rule is configured
+func lintEnabled(cfg Config) bool {
+	for _, r := range lintRules {
+		if r.enabled(cfg) {
+			return true
+		}
+	}
+	return false
+}
+
+// lintSubject returns the problems of a commit subject
+func lintSubject(cfg Config, subject string) []string {
+	var problems []string
+	for _, r := range lintRules {
+		if !r.enabled(cfg) {
+			continue
+		}
+		if problem := r.check(cfg, subject); problem != "" {
+			problems = append(problems, r.name+": "+problem)
+		}
+	}
+	return problems
+}
+
+// fixedSubject applies the fixes of the failing rules to the subject of a PR
+func fixedSubject(cfg Config, pr GitHubPR) string {
+	subject := pr.Title
+	for _, r := range lintRules {
+		if r.enabled(cfg) && r.check(cfg, subject) != "" {
+			subject = r.fix(cfg, pr, subject)
+		}
+	}
+	return subject
+}
+
+// filterCommitMessage requires the squash subject of the PR to pass the lint rules,
+// once fixed when the fix policy is configured
+func filterCommitMessage(cfg Config, pr GitHubPR) (bool, string) {
+	if !lintEnabled(cfg) {
+		return true, "no commit message rules"
+	}
+	subject := pr.Title
+	if cfg.LintPolicy == lintPolicyFix {
+		subject = fixedSubject(cfg, pr)
+	}
+	if problems := lintSubject(cfg, subject); len(problems) > 0 {
+		return false, fmt.Sprintf("commit subject %q fails %s", subject, strings.Join(problems, ", "))
+	}
+	if subject != pr.Title {
+		return true, fmt.Sprintf("commit subject fixed to %q", subject)
+	}
+	return true, "commit subject passes the rules"
+}
+
+// applySubjectFixes rewrites the titles of the batched PRs to their fixed commit subjects
+func applySubjectFixes(cfg Config, prs []GitHubPR) {
+	if cfg.LintPolicy != lintPolicyFix || !lintEnabled(cfg) {
+		return
+	}
+	for i, pr := range prs {
+		if subject := fixedSubject(cfg, pr); subject != pr.Title {
+			fmt.Printf("Commit subject of PR #%d fixed: %q -> %q\n", pr.Number, pr.Title, subject)
+			prs[i].Title = subject
+		}
+	}
+}
+
+func lintTicket(cfg Config, subject string) string {
+	if !regexp.MustCompile(cfg.LintTicketPattern).MatchString(subject) {
+		return fmt.Sprintf("no ticket ID matching '%s'", cfg.LintTicketPattern)
+	}
+	return ""
+}
+
+// fixTicket renders the fix template with the ticket ID found in the PR body;
+// without one the subject is left as-is and the PR rejected
+func fixTicket(cfg Config, pr GitHubPR, subject string) string {
+	ticket := regexp.MustCompile(cfg.LintTicketPattern).FindString(pr.Body)
+	if ticket == "" {
+		return subject
+	}
+	tmpl, err := parseLintFixTemplate(cfg.LintFixTemplate)
+	if err != nil {
+		return subject
+	}
+	var b strings.Builder
+	data := lintFixData{Title: subject, Number: pr.Number, Author: pr.Author, Ticket: ticket}
+	if err := tmpl.Execute(&b, data); err != nil {
+		return subject
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+func lintForbiddenWords(cfg Config, subject string) string {
+	var found []string
+	for _, w := range subjectWords(subject) {
+		for _, forbidden := range cfg.LintForbiddenWords {
+			if strings.EqualFold(w, forbidden) {
+				found = append(found, w)
+			}
+		}
+	}
+	if len(found) > 0 {
+		return fmt.Sprintf("contains %s", strings.Join(found, ", "))
+	}
+	return ""
+}
+
+// fixForbiddenWords drops the forbidden words from the subject
+func fixForbiddenWords(cfg Config, _ GitHubPR, subject string) string {
+	var kept []string
+	for _, field := range strings.Fields(subject) {
+		forbidden := false
+		for _, w := range subjectWords(field) {
+			for _, f := range cfg.LintForbiddenWords {
+				forbidden = forbidden || strings.EqualFold(w, f)
+			}
+		}
+		if !forbidden {
+			kept = append(kept, field)
+		}
+	}
+	return strings.Join(kept, " ")
+}
+
+// subjectWords splits a subject into words, ignoring punctuation
+func subjectWords(subject string) []string {
+	return strings.FieldsFunc(subject, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+}
+
+func lintLength(cfg Config, subject string) string {
+	if n := len([]rune(subject)); n > cfg.LintMaxLength {
+		return fmt.Sprintf("%d characters (max %d)", n, cfg.LintMaxLength)
+	}
+	return ""
+}
+
+// fixLength truncates the subject at the last word boundary within the limit
+func fixLength(cfg Config, _ GitHubPR, subject string) string {
+	runes := []rune(subject)
+	if len(runes) <= cfg.LintMaxLength {
+		return subject
+	}
+	cut := string(runes[:cfg.LintMaxLength])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " .,;:-")
+}
+
+// parseLintFixTemplate parses the commit subject fix template
+func parseLintFixTemplate(text string) (*template.Template, error) {
+	return template.New("lint_fix_template").Option("missingkey=error").Parse(text)
+}
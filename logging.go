@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Formats of the log records
+const (
+	logFormatText = "text" // Lines of the standard logger, for humans
+	logFormatJSON = "json" // One JSON object per line, for log aggregators
+)
+
+// logRunEvents is set in JSON format, where the events of the run are logged as they are
+// recorded, so aggregators follow a run without parsing its console output
+var logRunEvents bool
+
+// setupLogging installs the logger of --log_format and --log_level as the slog default.
+// In JSON format the records carry the batch ID, and the messages left to the standard
+// logger, the fatal errors, are emitted as error records.
+func setupLogging(cfg Config) {
+	var level slog.Level
+	// Validated by parseConfig
+	level.UnmarshalText([]byte(cfg.LogLevel))
+	if cfg.LogFormat != logFormatJSON {
+		slog.SetLogLoggerLevel(level)
+		return
+	}
+	handler := slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+	slog.SetDefault(slog.New(handler).With("batch_id", cfg.BatchID))
+	log.SetFlags(0)
+	log.SetOutput(logBridge{})
+	logRunEvents = true
+}
+
+// logBridge writes the messages of the standard logger as error records of the slog default
+type logBridge struct{}
+
+func (logBridge) Write(p []byte) (int, error) {
+	slog.Error(strings.TrimSpace(string(p)))
+	return len(p), nil
+}
+
+// logRunEvent logs an event of the run in JSON format, with the phase of the run it belongs
+// to and the PR, outcome and duration of the PR results. Failed PRs and hooks are warnings.
+func logRunEvent(e RunEvent) {
+	if !logRunEvents {
+		return
+	}
+	level := slog.LevelInfo
+	attrs := []any{"phase", runPhaseOf(e.Type), "seq", e.Seq}
+	if e.Trunk != "" {
+		attrs = append(attrs, "trunk_branch", e.Trunk, "branch", e.Target)
+	}
+	if e.PR > 0 {
+		attrs = append(attrs, "pr_number", e.PR)
+	}
+	if r := e.Result; r != nil {
+		attrs = append(attrs, "pr_number", r.Number, "outcome", r.Outcome, "duration", r.Duration)
+		if r.Detail != "" {
+			attrs = append(attrs, "detail", r.Detail)
+		}
+		if len(r.Files) > 0 {
+			attrs = append(attrs, "files", r.Files)
+		}
+		switch r.Outcome {
+		case OutcomeConflict, OutcomeFailed, OutcomeCulprit, OutcomeBinaryConflict:
+			level = slog.LevelWarn
+		}
+	}
+	if h := e.Hook; h != nil {
+		attrs = append(attrs, "hook", h.Hook, "exit_code", h.ExitCode, "duration", h.Duration)
+		if h.PR > 0 {
+			attrs = append(attrs, "pr_number", h.PR)
+		}
+		if h.Limit != "" {
+			attrs = append(attrs, "limit", h.Limit)
+		}
+		if h.ExitCode != 0 {
+			level = slog.LevelWarn
+		}
+	}
+	if e.Cutoff != nil {
+		attrs = append(attrs, "deferred", e.Cutoff.Deferred)
+	}
+	if e.Deps != nil {
+		attrs = append(attrs, "prs", e.Deps.PRs, "commit", e.Deps.Commit)
+	}
+	if e.Bisection != nil {
+		attrs = append(attrs, "culprits", e.Bisection.Culprits)
+	}
+	if e.Candidate != "" {
+		attrs = append(attrs, "candidate", e.Candidate)
+	}
+	slog.Log(context.Background(), level, string(e.Type), attrs...)
+}
+
+// runPhaseOf returns the phase of the run an event belongs to
+func runPhaseOf(t RunEventType) string {
+	switch t {
+	case EventRunStarted, EventTokenMinted:
+		return "setup"
+	case EventPRDiscovered, EventPRFiltered, EventPoliciesEvaluated, EventRiskScored:
+		return "selection"
+	case EventHookRan, EventVerifyBisected:
+		return "verify"
+	case EventPublished, EventRunFinished:
+		return "publish"
+	}
+	return "merge"
+}
@@ -1,55 +1,242 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
-	"net/http"
+	"log/slog"
 	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/josedpiambav/feature/trailers"
 )
 
 // Constants for application configuration
 const (
 	refHistoryFile = ".ref-history"           // File to track merge history
 	githubAPI      = "https://api.github.com" // GitHub API endpoint
+	githubWeb      = "https://github.com"     // GitHub web URL
 	userAgent      = "GitHubMergeBot/1.0"     // User agent for API requests
+
+	refHistoryCommitMessage = "chore: update ref-history" // Subject of the history bookkeeping commit
+)
+
+// Empty-batch policies applied when no PRs qualify
+const (
+	emptyBatchReset  = "reset"  // Force-push the target branch as a mirror of trunk
+	emptyBatchLeave  = "leave"  // Leave the remote target branch untouched
+	emptyBatchDelete = "delete" // Delete the remote target branch
+)
+
+// Zero-merge policies applied when every candidate PR failed to merge
+const (
+	zeroMergesTrunk = "trunk" // Push the target branch as a mirror of trunk
+	zeroMergesKeep  = "keep"  // Keep the previous remote target branch
+	zeroMergesFail  = "fail"  // Fail the run
+)
+
+// Commit modes for the target branch
+const (
+	commitModePerPR  = "per-pr" // One squash commit per PR
+	commitModeSingle = "single" // One squash commit for the whole batch
+	commitModeMerge  = "merge"  // One --no-ff merge commit per PR, preserving PR history
 )
 
 // Config holds application configuration parameters
 type Config struct {
-	GithubToken    string   `json:"github_token"`    // GitHub access token
-	Owner          string   `json:"owner"`           // Repository owner
-	Repo           string   `json:"repo"`            // Repository name
-	TrunkBranch    string   `json:"trunk_branch"`    // Base branch (usually main/master)
-	TargetBranch   string   `json:"target_branch"`   // Target branch for merges
-	RequiredLabels []string `json:"required_labels"` // Required PR labels
-	GitHubOutput   string   `json:"github_output"`   // GitHub output path
+	GithubToken          string             `json:"github_token"`             // GitHub access token
+	AppID                int64              `json:"app_id"`                   // GitHub App authenticating the run instead of github_token, 0 when unused
+	AppInstallationID    int64              `json:"app_installation_id"`      // Installation of the GitHub App minting the run token
+	AppPrivateKey        string             `json:"app_private_key"`          // PEM file of the GitHub App private key
+	Owner                string             `json:"owner"`                    // Repository owner
+	Repo                 string             `json:"repo"`                     // Repository name
+	BatchID              string             `json:"batch_id"`                 // Unique run ID correlating commits, history, reports and notifications
+	Org                  string             `json:"org"`                      // Organization whose repositories are discovered and batched
+	Repos                []RepoTarget       `json:"repos"`                    // Repositories batched in turn instead of owner/repo, with their branches
+	RepoTopic            string             `json:"repo_topic"`               // Topic required on discovered repositories
+	RepoPattern          string             `json:"repo_pattern"`             // Glob pattern matched against discovered repository names
+	ConcurrencyGroups    []ConcurrencyGroup `json:"concurrency_groups"`       // Groups of discovered repositories with their own parallelism and API rate limit
+	OrgParallelism       int                `json:"org_parallelism"`          // Discovered repositories outside concurrency groups batched at once
+	RunManifestDir       string             `json:"run_manifest_dir"`         // Directory shared by the repositories of a multi-repo run
+	ConfigFile           string             `json:"config"`                   // YAML or JSON file of parameter values, overridden by the command line
+	TenantConfig         string             `json:"tenant_config"`            // JSON file with shared defaults and per-repository overrides
+	TenantConfigSHA256   []string           `json:"tenant_config_sha256"`     // Allowed SHA-256 checksums of the tenant config
+	TenantConfigKeys     []string           `json:"tenant_config_public_key"` // Ed25519 public keys signing the tenant config
+	TrunkBranch          string             `json:"trunk_branch"`             // Base branch (usually main/master)
+	TargetBranch         string             `json:"target_branch"`            // Target branch for merges
+	TargetTemplate       string             `json:"target_template"`          // Template of the permanent branch every batch is also pushed to
+	PromoteFrom          string             `json:"promote_from"`             // Earlier promotion stage branch the target branch is built from
+	PromoteChecks        []string           `json:"promote_checks"`           // Checks of the earlier stage that must succeed, all when empty
+	MergeQueue           bool               `json:"merge_queue"`              // Build the target branch from the PRs of the native trunk merge queue instead of labels
+	CandidateBranch      string             `json:"candidate_branch"`         // Permanent branch rendered from TargetTemplate
+	EventSinks           []string           `json:"event_sinks"`              // HTTP URLs, SQS queues and Pub/Sub topics receiving the candidate ready event
+	EventSecret          string             `json:"event_secret"`             // HMAC-SHA256 key signing the candidate ready event
+	RequiredLabels       []string           `json:"required_labels"`          // Required PR labels
+	LabelNamespaces      []string           `json:"label_namespaces"`         // Namespaces of which every PR carries exactly one label
+	ExcludePRs           []int              `json:"exclude_prs"`              // PRs left out of the batch
+	GitHubOutput         string             `json:"github_output"`            // GitHub output path
+	StepSummary          string             `json:"step_summary"`             // GitHub job summary path
+	PreviewBranches      bool               `json:"preview_branches"`         // Push per-PR preview branches
+	BatchPR              bool               `json:"batch_pr"`                 // Keep a draft PR from the target branch into trunk describing the batch
+	TrackingIssue        int                `json:"tracking_issue"`           // Issue receiving run comments
+	CompareComment       bool               `json:"compare_comment"`          // Comment compare link on merged PRs
+	NotifyDedupe         bool               `json:"notify_dedupe"`            // Only notify on membership changes, new conflicts and new failures
+	NotifyDelta          bool               `json:"notify_delta"`             // Notify only the PRs that entered, left or changed revision since the previous candidate
+	RangeDiffComment     bool               `json:"range_diff_comment"`       // Comment the range-diff against the previous candidate on the tracking issue
+	NotifyDigest         time.Duration      `json:"notify_digest"`            // Interval of the digest of the other events on the tracking issue
+	MembershipLabel      string             `json:"membership_label"`         // Label kept on exactly the PRs in the target branch
+	RebaseFallback       bool               `json:"rebase_fallback"`          // Retry conflicting PRs rebased onto target
+	BuildTargets         []BuildTarget      `json:"build_targets"`            // Target branches built concurrently from one fetch
+	PrefetchedPRs        bool               `json:"prefetched_prs"`           // PR branches were fetched by the multi-target build
+	VerifyCmd            string             `json:"verify_cmd"`               // Shell command verifying the target branch before it is pushed
+	HookLimits           HookLimits         `json:"hook_limits"`              // Resource limits of the hook commands, such as verify_cmd
+	VerifyFullCheckout   bool               `json:"verify_full_checkout"`     // Verify a full checkout instead of the changed directories
+	BisectOnFailure      bool               `json:"bisect_on_failure"`        // Bisect a failing verification, excluding the culprit PRs
+	PreverifyParallelism int                `json:"preverify_parallelism"`    // Concurrent verifications of the PRs merged alone onto trunk before the assembly, 0 disables
+	ConflictReport       string             `json:"conflict_report"`          // Conflict report artifact path
+	ChangedPathsFile     string             `json:"changed_paths_file"`       // File listing the paths changed by the batch, one per line
+	ChangedPathsTrailers bool               `json:"changed_paths_trailers"`   // Add Changed-Path trailers to the batch commits
+	ConflictPartners     bool               `json:"conflict_partners"`        // Bisect the merged PRs for the one a conflicting PR conflicts with
+	ConflictStats        string             `json:"conflict_stats"`           // Conflict statistics file path
+	EligibilityCache     string             `json:"eligibility_cache"`        // Eligibility cache file path
+	StatsKeepRuns        int                `json:"stats_keep_runs"`          // Runs kept in the conflict statistics, 0 keeps all
+	StatsArchive         string             `json:"stats_archive"`            // Archive file receiving older conflict events
+	StatsArchiveBranch   string             `json:"stats_archive_branch"`     // Branch receiving the archive of older conflict events
+	ResultsBranch        string             `json:"results_branch"`           // Branch receiving the run report of every pushed candidate
+	StateDir             string             `json:"state_dir"`                // Directory for persistent state files
+	Storage              string             `json:"storage"`                  // Storage of the state and history: file, git:<branch>, s3://, gs:// or sqlite:<path>
+	APIURL               string             `json:"api_url"`                  // GitHub API endpoint
+	GraphQLURL           string             `json:"graphql_url"`              // GitHub GraphQL endpoint
+	WebURL               string             `json:"web_url"`                  // GitHub web URL of the links in texts, derived from the API endpoint
+	RecordDir            string             `json:"record_dir"`               // Directory recording API fixtures
+	ReplayDir            string             `json:"replay_dir"`               // Directory replaying API fixtures
+	Chaos                map[string]float64 `json:"chaos"`                    // Probability of every injected fault, empty when chaos mode is off
+	ChaosSeed            int64              `json:"chaos_seed"`               // Seed of the injected faults
+	MaxResponseBytes     int64              `json:"max_response_bytes"`       // Largest API response body decoded
+	APIRateLimit         int                `json:"api_rate_limit"`           // GitHub API requests per minute of the process, 0 for no limit
+	PRsFile              string             `json:"prs_file"`                 // Candidate PR list file ("-" for stdin)
+	PolicyFile           string             `json:"policy_file"`              // JSON file of the batching policies
+	Policies             []Policy           `json:"policies"`                 // Batching policies loaded from policy_file
+	EmptyBatch           string             `json:"empty_batch"`              // Policy applied when no PRs qualify
+	ZeroMerges           string             `json:"zero_merges"`              // Policy applied when every candidate PR failed to merge
+	CommitMode           string             `json:"commit_mode"`              // One commit per PR or a single commit for the batch
+	GroupDeps            bool               `json:"group_deps"`               // Collapse the dependency update PRs into a single commit
+	DepsAuthors          []string           `json:"deps_authors"`             // Authors of the dependency update PRs
+	DepsLabels           []string           `json:"deps_labels"`              // Labels of the dependency update PRs
+	DryRun               bool               `json:"dry_run"`                  // Simulate the merges in memory and report them, without touching the target branch
+	CommitBody           bool               `json:"commit_body"`              // Use the PR description as the body of the PR commit messages
+	CommitBodySection    string             `json:"commit_body_section"`      // Heading of the description section used as the commit body, the whole description when empty
+	CommitBodyMaxLines   int                `json:"commit_body_max_lines"`    // Lines of the description kept in a commit body, 0 for all
+	CommitBodyFormat     string             `json:"commit_body_format"`       // Format of the commit body: plain or markdown
+	Rulesets             string             `json:"rulesets"`                 // Handling of the rulesets of the target branch: ignore, adapt or fail
+	ProtectTarget        bool               `json:"protect_target"`           // Keep a ruleset restricting the published target branch to the bypass actors
+	ProtectBypass        []RulesetBypass    `json:"protect_bypass"`           // Actors allowed to update the protected target branch
+	ProtectChecks        []string           `json:"protect_checks"`           // Status checks the ruleset of the target branch requires
+	SigningKey           string             `json:"signing_key"`              // Key signing the commits of the run, empty for unsigned commits
+	SigningFormat        string             `json:"signing_format"`           // Format of the signing key, as Git's gpg.format
+	HistoryFormat        string             `json:"history_format"`           // Serialization format of the .ref-history file
+	HistoryCommitMessage string             `json:"history_commit_message"`   // Template of the history commit message
+	BlameIgnoreRevs      bool               `json:"blame_ignore_revs"`        // List bot bookkeeping commits in .git-blame-ignore-revs
+	UpdateBranches       string             `json:"update_branches"`          // Update PRs behind trunk through the API or locally
+	UpdateBranchLabels   []string           `json:"update_branch_labels"`     // Labels selecting PRs for branch updates (all when empty)
+	IgnorePaths          []string           `json:"ignore_paths"`             // Path patterns whose PR changes are never merged
+	BinaryConflicts      string             `json:"binary_conflicts"`         // Policy for conflicts on binary files
+	MergeRefs            bool               `json:"merge_refs"`               // Use GitHub's test-merge refs to detect conflicts early and reuse clean merges
+	ConventionalTitles   bool               `json:"conventional_titles"`      // Only batch PRs whose title is a conventional commit
+	LintMaxLength        int                `json:"lint_max_length"`          // Longest squash subject, 0 disables the rule
+	LintTicketPattern    string             `json:"lint_ticket_pattern"`      // Pattern of the ticket ID required in squash subjects
+	LintForbiddenWords   []string           `json:"lint_forbidden_words"`     // Words squash subjects must not contain
+	LintPolicy           string             `json:"lint_policy"`              // Handling of subjects failing the rules (reject or fix)
+	LintFixTemplate      string             `json:"lint_fix_template"`        // Template adding the ticket ID to fixed subjects
+	TextTemplates        map[string]string  `json:"text_templates"`           // Overrides of the bot-authored text templates, by name
+	Project              string             `json:"project"`                  // Projects (v2) board tracking the batched PRs, as owner/number
+	ProjectField         string             `json:"project_field"`            // Single select field of the project holding the stage of the PRs
+	ProjectColumns       map[string]string  `json:"project_columns"`          // Option of the project field for every stage
+	RiskScores           bool               `json:"risk_scores"`              // Score the risk of every PR and of the batch
+	RiskOrder            bool               `json:"risk_order"`               // Merge the PRs from the least risky
+	MaxRisk              float64            `json:"max_risk"`                 // Highest PR risk score batched, 0 disables the gate
+	MaxBatchRisk         float64            `json:"max_batch_risk"`           // Highest batch risk score, later PRs are deferred past it (0 disables the gate)
+	Locale               string             `json:"locale"`                   // Locale of the console messages and bot-authored texts
+	Messages             messageCatalog     `json:"messages"`                 // Console messages in the locale, with the overrides of messages_file
+	PRDirectives         []string           `json:"pr_directives"`            // Directive keys PR authors may set in a 'mergebot:' block of the description
+	Semver               bool               `json:"semver"`                   // Suggest the next semantic version from the merged PRs
+	VersionFile          string             `json:"version_file"`             // File receiving a version bump commit on the target branch
+	PlanOnly             bool               `json:"plan_only"`                // Build the branch into a plan ref instead of publishing it
+	PublishPlan          string             `json:"publish_plan"`             // Publish a previously built plan instead of running a batch
+	ApprovalIssue        int                `json:"approval_issue"`           // Issue where a maintainer must comment /publish before pushing
+	ApprovalTimeout      time.Duration      `json:"approval_timeout"`         // Maximum wait for the approval comment
+	MaxRunDuration       time.Duration      `json:"max_run_duration"`         // Stop merging and publish the partial batch after this long
+	PushRetries          int                `json:"push_retries"`             // Push attempts repeated when another writer moved the target branch
+	MaxPRs               int                `json:"max_prs"`                  // Largest batch, later PRs are deferred to the next run (0 is unlimited)
+	MaxPRsPerAuthor      int                `json:"max_prs_per_author"`       // PRs of an author or team selected before the others get a turn under max_prs
+	AuthorTeams          map[string]string  `json:"author_teams"`             // Team of the lowercased author logins, sharing max_prs_per_author
+	LabelQuotas          []LabelQuota       `json:"label_quotas"`             // Bounds on the PRs of each label in a batch
+	Reconcile            bool               `json:"reconcile"`                // Re-query merged PRs before pushing and drop closed ones
+	NoColor              bool               `json:"no_color"`                 // Disable colored terminal output
+	LogFormat            string             `json:"log_format"`               // Format of the log records: text or json
+	LogLevel             string             `json:"log_level"`                // Minimum level of the log records: debug, info, warn or error
+	Report               string             `json:"report"`                   // Per-PR outcome report format
+	ReportFile           string             `json:"report_file"`              // Per-PR outcome report path ("-" for stdout)
+	ReportDir            string             `json:"report_dir"`               // Directory receiving every report and an index.json manifest
+	EventLog             string             `json:"event_log"`                // Directory receiving the replayable event log of every run
+	IncidentIssues       bool               `json:"incident_issues"`          // Open an issue when a run fails
+	IncidentLabel        string             `json:"incident_label"`           // Label identifying incident issues
+	IncidentAssignees    []string           `json:"incident_assignees"`       // Maintainers assigned to incidents
 }
 
 // RefHistory tracks merged pull requests
 type RefHistory struct {
-	Merges []MergeRecord `json:"merges"` // List of merge records
+	BatchID string           `json:"batch_id,omitempty"` // Run that produced the history
+	Cutoff  *RunCutoff       `json:"cutoff,omitempty"`   // Set when the run deadline deferred PRs
+	Policy  []PolicyDecision `json:"policy,omitempty"`   // Decisions of the batching policies
+	Stamp   *BuildStamp      `json:"stamp,omitempty"`    // Build time and trunk revision, read by freshness checks
+	Merges  []MergeRecord    `json:"merges"`             // List of merge records
+}
+
+// BuildStamp records when, and on which trunk revision, the target branch was built
+type BuildStamp struct {
+	BuiltAt time.Time `json:"built_at"` // Build time
+	Trunk   string    `json:"trunk"`    // Trunk commit the batch was merged onto
+}
+
+// RunCutoff records where a deadline-bounded run stopped merging
+type RunCutoff struct {
+	At       time.Time `json:"at"`       // When the deadline was reached
+	Deferred []int     `json:"deferred"` // PRs left for the next run
 }
 
 // MergeRecord represents a single merged PR
 type MergeRecord struct {
-	PR        int       `json:"pr"`        // Pull Request number
-	Commit    string    `json:"commit"`    // Resulting commit SHA
-	Timestamp time.Time `json:"timestamp"` // Merge timestamp
+	PR        int       `json:"pr"`               // Pull Request number
+	Commit    string    `json:"commit,omitempty"` // Resulting commit SHA (empty in single commit mode)
+	Head      string    `json:"head,omitempty"`   // PR revision merged, pinned by later promotion stages
+	Timestamp time.Time `json:"timestamp"`        // Merge timestamp
 }
 
 // ConflictError represents a squash merge failure caused by file conflicts
 type ConflictError struct {
-	Files     []string // conflicting file paths
-	GitOutput string   // raw output from git merge --squash, shown directly to the user
+	Files     []string            // conflicting file paths
+	GitOutput string              // raw output from git merge --squash, shown directly to the user
+	Hunks     map[string][]string // conflict marker blocks per file, captured before the tree is reset
+	Binary    []string            // binary files among Files, which have no conflict markers
+	Pairing   *ConflictPairing    // conflict partner found, nil when not looked for
 }
 
 func (e *ConflictError) Error() string {
+	if len(e.Files) == 0 {
+		return "merge conflict reported by GitHub"
+	}
+	if len(e.Binary) > 0 {
+		return fmt.Sprintf("merge conflict in %d file(s), binary: %s", len(e.Files), strings.Join(e.Binary, ", "))
+	}
 	return fmt.Sprintf("merge conflict in %d file(s)", len(e.Files))
 }
 
@@ -59,122 +246,945 @@ var ErrEmptyMerge = errors.New("PR changes are already included in the target br
 
 // GitHubPR represents a simplified Pull Request structure
 type GitHubPR struct {
-	Number    int    `json:"number"`     // PR number
-	Title     string `json:"title"`      // PR title
-	State     string `json:"state"`      // PR state (open/closed)
-	CreatedAt string `json:"created_at"` // PR createAt
+	Number    int    `json:"number"`             // PR number
+	Title     string `json:"title"`              // PR title
+	State     string `json:"state"`              // PR state (open/closed)
+	CreatedAt string `json:"created_at"`         // PR createAt
+	Author    string `json:"author"`             // PR author login
+	SHA       string `json:"sha"`                // Pinned head revision, when set the PR is merged at exactly this commit
+	HeadSHA   string `json:"head_sha"`           // Current head revision reported by the API
+	HeadRef   string `json:"head_ref,omitempty"` // Head branch reported by the API
+	Draft     bool   `json:"draft,omitempty"`    // Whether the PR is a draft
 	Base      struct {
 		Ref string `json:"ref"` // Base branch reference
 	} `json:"base"`
 	Labels []string `json:"labels"` // List of PR labels
+	Body   string   `json:"body"`   // PR description
 }
 
 func main() {
-	cfg := mustParseConfig()
+	runCLI(os.Args[1:])
+}
+
+// runBatch implements the 'run' subcommand, the default one: it builds the batch of the
+// qualifying PRs into the target branch and publishes it
+func runBatch(args []string) {
+	cfg := mustParseConfig(flag.CommandLine, args)
+	mustRequireOutputs(cfg)
+	features := mustDetectGit(cfg)
+	cfg, grant := mustMintAppToken(cfg)
+	if cfg.Org != "" {
+		runOrgBatches(cfg, args)
+		return
+	}
+	if len(cfg.Repos) > 0 {
+		runRepoTargets(cfg, args)
+		return
+	}
+	if len(cfg.BuildTargets) > 0 {
+		runBuildTargets(cfg, args)
+		return
+	}
 	defer setOutput(cfg, "target_branch", cfg.TargetBranch)
+	defer setOutput(cfg, "batch_id", cfg.BatchID)
 
-	printHeader(cfg)
+	printHeader(cfg, features)
 	mustSetupGitConfig()
+	setupCommitSigning(cfg)
+	if err := ensureStateDir(cfg.StateDir); err != nil {
+		log.Fatal("error preparing state dir:", err)
+	}
 
-	prs := mustFetchQualifiedPRs(cfg)
+	client := mustNewGitHubClient(cfg)
+	report := newRunReport(cfg)
+	report.API = apiUsageOf(client)
+	report.Chaos = chaosReport(cfg)
+	if grant != nil {
+		report.tokenMinted(grant)
+	}
+	defer reportAPIUsage(cfg, report.API)
+	defer printChaos(cfg)
+	cfg = mustApplyRulesets(client, cfg)
+	if cfg.DryRun {
+		dryRunBatch(client, cfg, report)
+		return
+	}
+	if cfg.PublishPlan != "" {
+		fmt.Print(message(cfg, "run.publishing_plan", cfg.PublishPlan, cfg.TargetBranch))
+		if err := publishPlan(cfg); err != nil {
+			reportIncident(client, cfg, err)
+			log.Fatalf("\n%v", err)
+		}
+		fmt.Println(message(cfg, "run.done"))
+		resolveIncident(client, cfg)
+		return
+	}
 
-	fmt.Printf("Preparing target branch '%s' from '%s'...\n", cfg.TargetBranch, cfg.TrunkBranch)
-	prepareTargetBranch(cfg)
+	var prs []GitHubPR
+	if cfg.PRsFile != "" {
+		prs = mustLoadPRsFile(cfg)
+		report.discovered(prs)
+	} else if cfg.MergeQueue {
+		prs = mustFetchQueuedPRs(client, cfg, report)
+	} else if cfg.PromoteFrom != "" {
+		var promotable bool
+		if prs, promotable = mustFetchPromotedPRs(client, cfg, report); !promotable {
+			writeRunReport(cfg, report)
+			return
+		}
+	} else {
+		prs = mustFetchQualifiedPRs(client, cfg, report)
+	}
+	prs, deps := gateDependencies(cfg, prs, report)
+	writeRunManifest(cfg, nil, deps)
 
 	if len(prs) == 0 {
 		labels := strings.Join(cfg.RequiredLabels, ", ")
-		fmt.Printf("\nNo qualifying PRs found for labels [%s].\n", labels)
-		fmt.Printf("Pushing '%s' as a clean mirror of '%s'...", cfg.TargetBranch, cfg.TrunkBranch)
-		if err := pushChanges(cfg); err != nil {
-			log.Fatalf("\npush failed: %v", err)
+		fmt.Printf("\n%s\n", message(cfg, "run.no_prs", labels))
+		if err := publishEmptyBatch(cfg, report); err != nil {
+			reportIncident(client, cfg, err)
+			writeRunReport(cfg, report)
+			log.Fatalf("\n%v", err)
+		}
+		if cfg.ProtectTarget && cfg.EmptyBatch == emptyBatchReset {
+			protectTargetBranch(client, cfg)
+		}
+		resolveIncident(client, cfg)
+		writeRunReport(cfg, report)
+		if cfg.EmptyBatch != emptyBatchLeave {
+			notify := loadNotifyState(cfg)
+			notify.candidate(cfg, report, nil)
+			notify.save()
+		}
+		if cfg.MembershipLabel != "" && cfg.EmptyBatch != emptyBatchLeave {
+			syncMembershipLabel(client, cfg, nil)
+		}
+		if cfg.BatchPR && cfg.EmptyBatch != emptyBatchLeave {
+			publishBatchPR(client, cfg, nil, nil, nil)
 		}
-		fmt.Println(" done.")
+		syncProject(client, cfg, report, false)
 		return
 	}
 
-	mergedPRs, err := processPRs(prs, cfg.TargetBranch)
-	if err != nil {
-		log.Fatalf("merge process aborted: %v", err)
+	fmt.Println(message(cfg, "run.preparing", cfg.TargetBranch, cfg.TrunkBranch))
+	prepareTargetBranch(cfg)
+	lease := mustCapturePushLease(cfg)
+	var previous []MergeRecord
+	if cfg.NotifyDelta || cfg.RangeDiffComment {
+		previous = loadPreviousMerges(cfg, lease)
+	}
+	updatePRBranches(client, cfg, prs)
+	if len(cfg.Policies) > 0 {
+		prs = applyPolicies(cfg, prs, report)
+		// The policies fetched the PR branches for their diff stats
+		cfg.PrefetchedPRs = true
+	}
+	if cfg.RiskScores {
+		prs = applyRiskScores(client, cfg, prs, report)
+		cfg.PrefetchedPRs = true
+	}
+	if cfg.PreverifyParallelism > 0 {
+		prs = preverifyPRs(client, cfg, prs, report)
+		cfg.PrefetchedPRs = true
+	}
+
+	mergedPRs, ok := buildBatch(client, cfg, prs, report)
+	if !ok {
+		return
+	}
+
+	if cfg.PlanOnly {
+		id, err := pushPlan(cfg)
+		if err != nil {
+			writeRunReport(cfg, report)
+			log.Fatalf("\n%v", err)
+		}
+		fmt.Printf("\n%s\n", message(cfg, "run.plan_built", id, id))
+		setOutput(cfg, "plan_id", id)
+		writeRunReport(cfg, report)
+		return
+	}
+	if cfg.ApprovalIssue > 0 {
+		if err := awaitApproval(client, cfg, mergedPRs); err != nil {
+			writeRunReport(cfg, report)
+			log.Fatalf("\n%s", message(cfg, "run.not_approved", err))
+		}
+	}
+
+	if cfg.Reconcile {
+		if prs, mergedPRs, ok = reconcileBatch(client, cfg, prs, mergedPRs, report); !ok {
+			return
+		}
+	}
+
+	report.candidateBuilt(summarizeBatchDiff(cfg))
+	if cfg.VerifyCmd != "" && batchSkipsVerification(cfg, prs) {
+		fmt.Println(message(cfg, "run.verify_skipped"))
+	} else if cfg.VerifyCmd != "" {
+		err := verifyBatch(cfg, report)
+		if err != nil && cfg.BisectOnFailure {
+			if prs, mergedPRs, ok, err = bisectBatch(client, cfg, prs, mergedPRs, err, report); !ok {
+				return
+			}
+		}
+		if err != nil {
+			reportIncident(client, cfg, fmt.Errorf("verification failed: %w", err))
+			writeRunReport(cfg, report)
+			log.Fatalf("\n%s", message(cfg, "run.verify_failed", err))
+		}
+	}
+
+	fmt.Print(message(cfg, "run.pushing", cfg.TargetBranch))
+	if err := pushChanges(cfg, lease, report); err != nil {
+		reportIncident(client, cfg, fmt.Errorf("push failed: %w", err))
+		writeRunReport(cfg, report)
+		log.Fatalf("\n%s", message(cfg, "run.push_failed", err))
+	}
+	fmt.Println(message(cfg, "run.done"))
+	if cfg.ResultsBranch != "" {
+		fmt.Println(message(cfg, "run.results_published", shortSHA(report.Candidate), cfg.ResultsBranch))
 	}
-	if len(mergedPRs) > 0 {
-		updateMergeHistory(mergedPRs)
+	writeRunManifest(cfg, mergedPRs, deps)
+	if cfg.ProtectTarget {
+		protectTargetBranch(client, cfg)
 	}
+	if cfg.CandidateBranch != "" {
+		publishCandidateBranch(cfg)
+	}
+	publishCandidateEvent(cfg, report.Candidate, prs, mergedPRs)
+	resolveIncident(client, cfg)
+	writeRunReport(cfg, report)
+	writeBatchSummary(cfg, report)
 
-	fmt.Printf("Pushing '%s' to remote...", cfg.TargetBranch)
-	if err := pushChanges(cfg); err != nil {
-		log.Fatalf("\npush failed: %v", err)
+	if cfg.MembershipLabel != "" {
+		syncMembershipLabel(client, cfg, mergedPRs)
+	}
+	syncProject(client, cfg, report, true)
+	notify := loadNotifyState(cfg)
+	if notify.candidate(cfg, report, mergedPRs) && (cfg.TrackingIssue > 0 || cfg.CompareComment) {
+		if cfg.NotifyDelta {
+			publishDelta(client, cfg, previous, mergedPRs, report.Diff)
+		} else {
+			publishCompareLink(client, cfg, mergedPRs, report.Diff)
+		}
+	}
+	notify.publishDigest(client, cfg)
+	notify.save()
+	if cfg.RangeDiffComment && cfg.TrackingIssue > 0 {
+		publishRangeDiff(client, cfg, lease, previous, mergedPRs, report.Candidate)
+	}
+	if cfg.PreviewBranches {
+		publishPreviewBranches(client, cfg, prs, mergedPRs)
+	}
+	if cfg.BatchPR {
+		publishBatchPR(client, cfg, prs, mergedPRs, report.Diff)
 	}
-	fmt.Println(" done.")
+}
+
+// publishEmptyBatch applies the configured empty-batch policy to the remote target branch
+func publishEmptyBatch(cfg Config, report *RunReport) error {
+	switch cfg.EmptyBatch {
+	case emptyBatchLeave:
+		fmt.Println(message(cfg, "empty.leave", cfg.TargetBranch))
+		return nil
+
+	case emptyBatchDelete:
+		if !remoteBranchExists(cfg.TargetBranch) {
+			fmt.Println(message(cfg, "empty.missing", cfg.TargetBranch))
+			return nil
+		}
+		fmt.Print(message(cfg, "empty.deleting", cfg.TargetBranch))
+		if err := runOriginGit("push", "origin", "--delete", cfg.TargetBranch); err != nil {
+			return fmt.Errorf("delete failed: %w", err)
+		}
+		fmt.Println(message(cfg, "run.done"))
+		return nil
+
+	default:
+		fmt.Println(message(cfg, "run.preparing", cfg.TargetBranch, cfg.TrunkBranch))
+		prepareTargetBranch(cfg)
+		lease, err := capturePushLease(cfg)
+		if err != nil {
+			return err
+		}
+		fmt.Print(message(cfg, "empty.mirror", cfg.TargetBranch, cfg.TrunkBranch))
+		if err := pushChanges(cfg, lease, report); err != nil {
+			return fmt.Errorf("push failed: %w", err)
+		}
+		fmt.Println(message(cfg, "run.done"))
+		return nil
+	}
+}
+
+// applyZeroMerges applies the configured policy when every candidate PR failed to merge
+func applyZeroMerges(cfg Config) error {
+	fmt.Printf("\n%s\n", message(cfg, "zero.none", cfg.TargetBranch))
+	switch cfg.ZeroMerges {
+	case zeroMergesFail:
+		return errors.New("no PR could be merged")
+	case zeroMergesKeep:
+		fmt.Println(message(cfg, "zero.keep", cfg.TargetBranch))
+	default:
+		fmt.Println(message(cfg, "zero.mirror", cfg.TargetBranch, cfg.TrunkBranch))
+	}
+	return nil
 }
 
 // printHeader prints a summary of the action configuration
-func printHeader(cfg Config) {
+func printHeader(cfg Config, git gitFeatures) {
 	sep := strings.Repeat("=", 50)
 	labels := strings.Join(cfg.RequiredLabels, ", ")
 	if labels == "" {
-		labels = "(none — all open PRs qualify)"
+		labels = message(cfg, "header.no_labels")
 	}
 	fmt.Println(sep)
-	fmt.Println("  Feature Branching")
-	fmt.Printf("  Repo   : %s/%s\n", cfg.Owner, cfg.Repo)
-	fmt.Printf("  Trunk  : %s\n", cfg.TrunkBranch)
-	fmt.Printf("  Target : %s\n", cfg.TargetBranch)
-	fmt.Printf("  Labels : %s\n", labels)
+	fmt.Println(message(cfg, "header.title"))
+	fmt.Println(message(cfg, "header.repo", cfg.Owner, cfg.Repo))
+	fmt.Println(message(cfg, "header.trunk", cfg.TrunkBranch))
+	fmt.Println(message(cfg, "header.target", cfg.TargetBranch))
+	if cfg.PromoteFrom != "" {
+		labels = message(cfg, "header.promoted", cfg.PromoteFrom)
+	}
+	if cfg.MergeQueue {
+		labels = message(cfg, "header.merge_queue", cfg.TrunkBranch)
+	}
+	fmt.Println(message(cfg, "header.labels", labels))
+	fmt.Println(message(cfg, "header.batch", cfg.BatchID))
+	fmt.Println(message(cfg, "header.git", git.Version, strings.Join(git.names(), ", ")))
+	if cfg.PreviewBranches {
+		fmt.Println(message(cfg, "header.preview", previewBranchPrefix+"pr-N"))
+	}
+	if !isFileStorage(cfg.Storage) {
+		fmt.Println(message(cfg, "header.storage", stateStorage(cfg)))
+	}
+	if len(cfg.Chaos) > 0 {
+		fmt.Println(message(cfg, "header.chaos", cfg.ChaosSeed))
+	}
 	fmt.Println(sep)
 	fmt.Println()
 }
 
 // mustParseConfig enforces valid configuration
-func mustParseConfig() Config {
-	cfg, err := parseConfig()
+func mustParseConfig(fs *flag.FlagSet, args []string) Config {
+	cfg, err := parseConfig(fs, args)
 	if err != nil {
 		log.Fatal("invalid configuration:", err)
 	}
+	setupLogging(cfg)
 	return cfg
 }
 
-// parseConfig initializes configuration from flags
-func parseConfig() (Config, error) {
+// mustRequireOutputs rejects a missing 'github_output' for the subcommands writing outputs
+func mustRequireOutputs(cfg Config) {
+	if cfg.GitHubOutput == "" {
+		log.Fatal("invalid configuration:", fmt.Errorf("missing required parameter: 'github_output'"))
+	}
+}
+
+// parseConfig initializes configuration from flags.
+// Callers may register additional flags on fs before calling it.
+func parseConfig(fs *flag.FlagSet, args []string) (Config, error) {
 	var cfg Config
-	var labels string
-
-	flag.StringVar(&cfg.GithubToken, "github_token", "", "GitHub access token")
-	flag.StringVar(&cfg.Owner, "owner", "", "Repository owner")
-	flag.StringVar(&cfg.Repo, "repo", "", "Repository name")
-	flag.StringVar(&cfg.TrunkBranch, "trunk_branch", "main", "Base branch name")
-	flag.StringVar(&cfg.TargetBranch, "target_branch", "", "Target branch name")
-	flag.StringVar(&labels, "labels", "", "Required PR labels (comma separated)")
-	flag.StringVar(&cfg.GitHubOutput, "github_output", "", "GitHub outputs file path")
-	flag.Parse()
-
-	if cfg.GithubToken == "" {
+	var labels, assignees, updateLabels, ignorePaths, excludePRs, buildTargets, tenantSHA256, tenantKeys, forbiddenWords, directives, promoteChecks, authorTeams, textTemplates, labelQuotas, messagesFile, hookMemory, projectColumns, concurrencyGroups, eventSinks, chaosFaults, labelNamespaces, depsAuthors, depsLabels, repos, protectBypass, protectChecks, apiURL, graphqlURL string
+	var repeatedLabels labelList
+
+	fs.StringVar(&cfg.GithubToken, "github_token", "", "GitHub access token")
+	fs.StringVar(&apiURL, "api_url", "", "GitHub REST API URL, GITHUB_API_URL or https://api.github.com by default; for GitHub Enterprise Server the instance URL, e.g. https://github.example.com (/api/v3 is added)")
+	fs.StringVar(&graphqlURL, "graphql_url", "", "GitHub GraphQL API URL, by default the one next to the REST API (e.g. https://github.example.com/api/graphql)")
+	fs.Int64Var(&cfg.AppID, "app_id", 0, "GitHub App ID; the run mints an installation token scoped to the repository and the permissions of its features instead of using github_token")
+	fs.Int64Var(&cfg.AppInstallationID, "app_installation_id", 0, "Installation ID of the GitHub App")
+	fs.StringVar(&cfg.AppPrivateKey, "app_private_key", "", "Path of the PEM private key of the GitHub App, or the PEM key itself (e.g. from a secret through MERGEBOT_APP_PRIVATE_KEY)")
+	fs.StringVar(&cfg.Owner, "owner", "", "Repository owner")
+	fs.StringVar(&cfg.Repo, "repo", "", "Repository name")
+	fs.StringVar(&cfg.BatchID, "batch_id", "", "Run ID recorded in commits, history and notifications (a ULID is generated when empty)")
+	fs.StringVar(&cfg.Org, "org", "", "Organization whose repositories are discovered and batched instead of owner/repo")
+	fs.StringVar(&repos, "repos", "", "Comma separated repositories batched in turn instead of owner/repo, each in its own clone, as owner/name[:target_branch[:trunk_branch]] (e.g. 'acme/users:pre-main,acme/billing::develop')")
+	fs.StringVar(&cfg.RepoTopic, "repo_topic", "", "Only batch discovered repositories carrying this topic")
+	fs.StringVar(&cfg.RepoPattern, "repo_pattern", "", "Only batch discovered repositories whose name matches this glob")
+	fs.StringVar(&concurrencyGroups, "concurrency_groups", "", "Comma separated groups of discovered repositories batched with their own parallelism and a shared API rate limit, as name:parallelism[:requests_per_minute]=glob|glob (e.g. 'ghes:2:3000=api-*|web-*')")
+	fs.IntVar(&cfg.OrgParallelism, "org_parallelism", 1, "Repositories of org mode or 'repos' outside concurrency groups batched at once")
+	fs.StringVar(&cfg.RunManifestDir, "run_manifest_dir", "", "Directory where the repositories of a multi-repo run publish their merged PRs, so 'Depends-on: owner/repo#N' PRs wait for their dependency (set by org mode)")
+	fs.StringVar(&cfg.ConfigFile, "config", "", "YAML or JSON file mapping parameter names to values (e.g. 'labels: [ready]'), for configurations committed to the repository; command line flags take precedence")
+	fs.StringVar(&cfg.TenantConfig, "tenant_config", "", "JSON file of flag defaults and per-repository overrides, as a path, an http(s) URL or 'owner/repo:path[@ref]'; command line flags take precedence")
+	fs.StringVar(&tenantSHA256, "tenant_config_sha256", "", "Allowed SHA-256 checksums of the tenant config (comma separated)")
+	fs.StringVar(&tenantKeys, "tenant_config_public_key", "", "Base64 ed25519 public keys, one of which must sign the tenant config in '<tenant_config>.sig' (comma separated)")
+	fs.StringVar(&cfg.TrunkBranch, "trunk_branch", "main", "Base branch name")
+	fs.StringVar(&cfg.TargetBranch, "target_branch", "", "Target branch name")
+	fs.StringVar(&eventSinks, "event_sinks", "", "Comma separated sinks receiving a signed CloudEvents 'candidate ready' event once the target is published: http(s) URLs, 'sqs:<queue URL>' (AWS credentials from the environment) or 'pubsub:projects/<p>/topics/<t>' (GOOGLE_OAUTH_ACCESS_TOKEN)")
+	fs.StringVar(&cfg.EventSecret, "event_secret", "", "Secret signing the candidate ready event, sent as 'sha256=<HMAC>' in the X-Feature-Branching-Signature-256 header or 'signature' message attribute")
+	fs.StringVar(&cfg.TargetTemplate, "target_template", "", "Template of a permanent branch every batch is also pushed to, next to the moving target branch (fields: .Trunk, .Target, .Date, .Time, .BatchID; {{label \"ns\"}} gives the value of the ns/<value> required label; e.g. 'pre-{{.Trunk}}-{{.Date}}-{{.Time}}')")
+	fs.StringVar(&cfg.PromoteFrom, "promote_from", "", "Earlier promotion stage branch (e.g. pre-main): build the target from the PRs its history merged once its checks succeeded, instead of filtering by labels")
+	fs.StringVar(&promoteChecks, "promote_checks", "", "Check runs of the earlier stage tip that must succeed before promoting (comma separated, all reported checks when empty)")
+	fs.BoolVar(&cfg.MergeQueue, "merge_queue", false, "Build the target branch from exactly the PRs enqueued in the native merge queue of trunk, in queue order, instead of filtering by labels")
+	fs.StringVar(&labels, "labels", "", "Required PR labels (comma separated, quote labels containing commas); 'namespace/*' matches every label of a namespace, e.g. 'deploy/*' for deploy/staging and deploy/prod")
+	fs.StringVar(&labelNamespaces, "label_namespaces", "", "Label namespaces of which every PR must carry exactly one label (comma separated, e.g. 'deploy' for deploy/staging or deploy/prod)")
+	fs.StringVar(&excludePRs, "exclude_prs", "", "PR numbers left out of the batch (comma separated)")
+	fs.Var(&repeatedLabels, "label", "Required PR label (repeatable)")
+	fs.StringVar(&cfg.GitHubOutput, "github_output", "", "GitHub outputs file path (required by run and check-freshness)")
+	fs.StringVar(&cfg.StepSummary, "step_summary", "", "GitHub job summary file path receiving the batch diff summary (skipped when empty)")
+	fs.BoolVar(&cfg.PreviewBranches, "preview_branches", false, "Push a preview/pr-N branch per merged PR")
+	fs.BoolVar(&cfg.BatchPR, "batch_pr", false, "Keep a draft PR open from the target branch into trunk, its description listing the batch, to review the candidate in the PR UI; it is closed when the batch is empty")
+	fs.IntVar(&cfg.TrackingIssue, "tracking_issue", 0, "Issue number receiving the compare link comment")
+	fs.BoolVar(&cfg.CompareComment, "compare_comment", false, "Comment the compare link on every merged PR")
+	fs.BoolVar(&cfg.NotifyDedupe, "notify_dedupe", false, "Only comment on membership changes, new conflicts and new failures, collecting other rebuilds and repeated failures into a digest")
+	fs.DurationVar(&cfg.NotifyDigest, "notify_digest", 24*time.Hour, "Interval of the notification digest posted on the tracking issue with --notify_dedupe (0 drops the digest)")
+	fs.BoolVar(&cfg.RangeDiffComment, "range_diff_comment", false, "After publishing, comment on the tracking issue the 'git range-diff' between the previous candidate and the new one, mapping the commit of every PR")
+	fs.BoolVar(&cfg.NotifyDelta, "notify_delta", false, "Replace the full-batch compare comments by a delta of the PRs that entered, left or changed revision since the previously published candidate")
+	fs.StringVar(&cfg.MembershipLabel, "membership_label", "", "Label kept on exactly the PRs published in the target branch, e.g. 'in-pre-main' (disabled when empty)")
+	fs.BoolVar(&cfg.RebaseFallback, "rebase_fallback", false, "Retry conflicting PRs by rebasing them onto the target tip")
+	fs.StringVar(&buildTargets, "build_targets", "", "Target branches built concurrently in worktrees sharing one fetch, as 'branch[:labels]' entries separated by ';' (labels replace --labels)")
+	fs.StringVar(&cfg.VerifyCmd, "verify_cmd", "", "Shell command verifying the target branch in a sandbox checkout before it is pushed; the run fails when it fails")
+	fs.BoolVar(&cfg.VerifyFullCheckout, "verify_full_checkout", false, "Check out every path for verify_cmd instead of only the directories changed by the batch")
+	fs.BoolVar(&cfg.BisectOnFailure, "bisect_on_failure", false, "When verify_cmd fails, bisect the batch for the PRs failing it, exclude them and publish the rest")
+	fs.IntVar(&cfg.PreverifyParallelism, "preverify_parallelism", 0, "Before assembling the batch, run verify_cmd on every PR merged alone onto trunk, this many at a time in separate sandboxes, and exclude the PRs failing it (0 disables)")
+	fs.DurationVar(&cfg.HookLimits.Timeout, "hook_timeout", 0, "Wall-clock limit of hook commands such as verify_cmd; the command and its processes are killed past it (0 disables)")
+	fs.DurationVar(&cfg.HookLimits.CPU, "hook_cpu", 0, "CPU time limit of hook commands, applied to each of their processes as RLIMIT_CPU (0 disables)")
+	fs.StringVar(&hookMemory, "hook_memory", "", "Address space limit of hook commands, applied to each of their processes as RLIMIT_AS, e.g. 2G (empty disables)")
+	fs.BoolVar(&cfg.PrefetchedPRs, "prefetched_prs", false, "Reuse the local 'pr-N' branches fetched by a multi-target build")
+	fs.StringVar(&cfg.ConflictReport, "conflict_report", "", "Path of the JSON conflict report written on merge conflicts")
+	fs.StringVar(&cfg.ChangedPathsFile, "changed_paths_file", "", "Path of the file listing the paths changed by the batch against trunk, one per line, so CI on the target branch can skip unaffected suites")
+	fs.BoolVar(&cfg.ChangedPathsTrailers, "changed_paths_trailers", false, "Add a Changed-Path trailer per path changed by the batch to its bookkeeping commit (the batch commit in single commit mode); large batches list top-level directories")
+	fs.BoolVar(&cfg.ConflictPartners, "conflict_partners", false, "Bisect the merged PRs for the conflict partner of a conflicting PR and comment the pair on both PRs")
+	fs.StringVar(&cfg.ConflictStats, "conflict_stats", "", "Path of the file accumulating conflict statistics across runs")
+	fs.StringVar(&cfg.EligibilityCache, "eligibility_cache", "", "Path of the file caching filter verdicts per PR head, so unchanged PRs are not re-evaluated")
+	fs.IntVar(&cfg.StatsKeepRuns, "stats_keep_runs", 0, "Runs kept in the conflict statistics, older events are archived (0 keeps every run)")
+	fs.StringVar(&cfg.StatsArchive, "stats_archive", "", "Gzip JSON lines file receiving the conflict events of older runs (they are dropped when neither archive is set)")
+	fs.StringVar(&cfg.StatsArchiveBranch, "stats_archive_branch", "", "Branch on origin receiving the archive of older conflict events")
+	fs.StringVar(&cfg.ResultsBranch, "results_branch", "", "Branch on origin receiving the run report of every pushed candidate, pushed atomically with the target branch (e.g. mergebot/results)")
+	fs.StringVar(&cfg.StateDir, "state_dir", defaultStateDir(), "Directory for persistent state (relative state paths resolve here)")
+	fs.StringVar(&cfg.Storage, "storage", "file", "Storage of the conflict stats, eligibility cache and notification state: 'file' (state_dir), 'git:<branch>' (a branch of origin), 's3://<bucket>/<prefix>', 'gs://<bucket>/<prefix>' or 'sqlite:<path>' (relative to state_dir); state paths are keys within it")
+	fs.BoolVar(&cfg.IncidentIssues, "incident_issues", false, "Open an incident issue when a run fails, closing it on the next success")
+	fs.StringVar(&cfg.IncidentLabel, "incident_label", "feature-branching-incident", "Label applied to incident issues")
+	fs.StringVar(&assignees, "incident_assignees", "", "Maintainers assigned to incident issues (comma separated)")
+	fs.StringVar(&cfg.RecordDir, "record", "", "Record every GitHub API interaction as fixtures into this directory")
+	fs.StringVar(&cfg.ReplayDir, "replay", "", "Replay GitHub API responses from recorded fixtures instead of calling the API")
+	fs.StringVar(&chaosFaults, "chaos", "", "Developer mode injecting simulated failures to exercise alerting, rollback and retries, as comma separated fault=probability (faults: api_500, rate_limit, conflict, push_race; e.g. 'api_500=0.05,push_race=0.5')")
+	fs.Int64Var(&cfg.ChaosSeed, "chaos_seed", 0, "Seed of the chaos faults, replaying the same faults in the same order (0 picks one, printed in the header)")
+	fs.Int64Var(&cfg.MaxResponseBytes, "max_response_bytes", defaultMaxResponseBytes, "Largest GitHub API response body accepted, in bytes")
+	fs.IntVar(&cfg.APIRateLimit, "api_rate_limit", 0, "GitHub API requests per minute of this process, spaced evenly (0 disables; set per repository by concurrency groups)")
+	fs.StringVar(&cfg.PRsFile, "prs_file", "", "JSON/CSV list of PRs to batch instead of querying the API ('-' reads stdin)")
+	fs.StringVar(&cfg.PolicyFile, "policy_file", "", "JSON list of batching policies ({name, scope: pr|batch, expr, message}) whose CEL-like expressions over PR metadata and diff stats hold PRs back")
+	fs.StringVar(&cfg.EmptyBatch, "empty_batch", emptyBatchReset, "Policy when no PRs qualify: reset (mirror trunk), leave (untouched) or delete")
+	fs.StringVar(&cfg.ZeroMerges, "zero_merges", zeroMergesTrunk, "Policy when no candidate PR merges: trunk (mirror trunk), keep (previous branch) or fail")
+	fs.BoolVar(&cfg.DryRun, "dry_run", false, "Select the PRs and simulate their merges in memory with 'git merge-tree', reporting what would merge, be skipped or conflict, without rebuilding, committing or pushing the target branch (ignored paths and branch updates are not simulated)")
+	fs.StringVar(&cfg.CommitMode, "commit_mode", commitModePerPR, "Commits on the target branch: per-pr (one squash per PR), single (one squash for the batch) or merge (one merge commit per PR)")
+	fs.BoolVar(&cfg.GroupDeps, "group_deps", false, "Merge the dependency update PRs last and collapse them into a single combined commit listing them")
+	fs.StringVar(&depsAuthors, "deps_authors", "dependabot[bot],renovate[bot]", "Comma-separated authors whose PRs are dependency updates")
+	fs.StringVar(&depsLabels, "deps_labels", "dependencies", "Comma-separated labels marking PRs as dependency updates")
+	fs.BoolVar(&cfg.CommitBody, "commit_body", false, "Use the PR description as the body of the PR commit messages, without its 'mergebot:' directives block")
+	fs.StringVar(&cfg.CommitBodySection, "commit_body_section", "", "Only use the section of the PR description under this Markdown heading (e.g. 'Summary'); PRs without it get no body")
+	fs.IntVar(&cfg.CommitBodyMaxLines, "commit_body_max_lines", 50, "Lines of the PR description kept in a commit body, the rest is replaced with a pointer to the PR (0 keeps every line)")
+	fs.StringVar(&cfg.CommitBodyFormat, "commit_body_format", commitBodyPlain, "Format of the commit body: plain (Markdown converted to plain text) or markdown (as written)")
+	fs.StringVar(&cfg.Rulesets, "rulesets", rulesetsIgnore, "Rulesets of the target branch: ignore, adapt (sign commits and avoid merge commits as required, fail fast on rules blocking the bot) or fail (fail fast on any rule needing adaptation)")
+	fs.BoolVar(&cfg.ProtectTarget, "protect_target", false, "After publishing, create or update the ruleset 'mergebot: <target_branch>' so only the 'protect_bypass' actors may update, force push to or delete the target branch (needs administration:write)")
+	fs.StringVar(&protectBypass, "protect_bypass", "", "Comma separated actors of the target branch ruleset, which must include the bot: app (the app of app_id), app:<id>, team:<id>, role:<admin|maintain|write> or org_admin (defaults to app with App auth, role:admin otherwise)")
+	fs.StringVar(&protectChecks, "protect_checks", "", "Comma separated status checks the target branch ruleset requires from everyone but the 'protect_bypass' actors")
+	fs.StringVar(&cfg.SigningKey, "signing_key", "", "Key signing every commit of the run, as Git's user.signingkey (e.g. an SSH private key path)")
+	fs.StringVar(&cfg.SigningFormat, "signing_format", "ssh", "Format of 'signing_key': ssh, openpgp or x509")
+	fs.StringVar(&cfg.HistoryFormat, "history_format", "json", fmt.Sprintf("Format of the .ref-history file (%s)", strings.Join(validHistoryFormats(), ", ")))
+	fs.StringVar(&cfg.HistoryCommitMessage, "history_commit_message", refHistoryCommitMessage, "Template of the history commit message (fields: .BatchID, .TrunkBranch, .TargetBranch, .Count, .PRs)")
+	fs.BoolVar(&cfg.BlameIgnoreRevs, "blame_ignore_revs", false, "Append bot bookkeeping commits to .git-blame-ignore-revs on the target branch")
+	fs.StringVar(&cfg.UpdateBranches, "update_branches", "", "Update PRs behind trunk before merging: api (GitHub update-branch) or local (merge trunk locally)")
+	fs.StringVar(&updateLabels, "update_branch_labels", "", "Only update branches of PRs carrying one of these labels (all PRs when empty)")
+	fs.StringVar(&ignorePaths, "ignore_paths", "", "Path patterns (e.g. .github/workflows/**, vendor/) kept at their target branch version when merging PRs")
+	fs.StringVar(&cfg.BinaryConflicts, "binary_conflicts", binaryConflictFail, "Policy for conflicts on binary files: fail (abort the batch), ours (keep the target version), theirs (take the PR version) or skip (leave the PR out)")
+	fs.BoolVar(&cfg.MergeRefs, "merge_refs", false, "Use GitHub's refs/pull/N/merge: a missing ref fails the PR early, a current one is reused as-is")
+	fs.BoolVar(&cfg.ConventionalTitles, "conventional_titles", false, "Only batch PRs with conventional commit titles, commenting a suggested title otherwise")
+	fs.IntVar(&cfg.LintMaxLength, "lint_max_length", 0, "Longest squash commit subject in characters (0 disables the rule)")
+	fs.StringVar(&cfg.LintTicketPattern, "lint_ticket_pattern", "", "Regular expression of the ticket ID squash commit subjects must contain, e.g. '[A-Z]+-[0-9]+'")
+	fs.StringVar(&forbiddenWords, "lint_forbidden_words", "", "Words squash commit subjects must not contain (comma separated, case insensitive)")
+	fs.StringVar(&cfg.LintPolicy, "lint_policy", lintPolicyReject, "Handling of squash subjects failing the lint rules: reject leaves the PR out, fix rewrites the subject")
+	fs.StringVar(&cfg.LintFixTemplate, "lint_fix_template", defaultLintFixTemplate, "Template of subjects fixed with the ticket ID found in the PR body (fields: .Title, .Number, .Author, .Ticket)")
+	fs.StringVar(&textTemplates, "text_templates", "", "Directory of Go templates overriding the bot-authored texts, one '<name>.tmpl' file per text (compare_comment, delta_comment, range_diff_comment, title_suggestion, preview_comment, incident_title, incident_body, incident_resolved, approval_request, digest)")
+	fs.StringVar(&cfg.Project, "project", "", "Projects (v2) board the batched PRs are added to and moved across as they are queued, in the candidate, conflicted and released, as owner/number")
+	fs.StringVar(&cfg.ProjectField, "project_field", "Status", "Single select field of the project whose options are the columns")
+	fs.StringVar(&projectColumns, "project_columns", "", "Comma separated options of the project field replacing the default columns, as stage=option (stages: queued, candidate, conflicted, released; e.g. 'candidate=In progress')")
+	fs.BoolVar(&cfg.RiskScores, "risk_scores", false, "Score the risk of every PR (size, paths touched, recorded conflicts, check flakiness) and of the batch in the run report; implied by risk_order, max_risk and max_batch_risk")
+	fs.BoolVar(&cfg.RiskOrder, "risk_order", false, "Merge the PRs from the least risky instead of in discovery order")
+	fs.Float64Var(&cfg.MaxRisk, "max_risk", 0, "Hold back PRs whose risk score, from 0 to 100, exceeds this (0 disables)")
+	fs.Float64Var(&cfg.MaxBatchRisk, "max_batch_risk", 0, "Defer the PRs that would raise the batch risk score, from 0 to 100, above this (0 disables)")
+	fs.StringVar(&cfg.Locale, "locale", defaultLocale, "Locale of the console messages and bot-authored texts ("+strings.Join(supportedLocales(), ", ")+"); --text_templates overrides still apply")
+	fs.StringVar(&messagesFile, "messages_file", "", "JSON object overriding individual console messages of the locale by key, keeping their formatting verbs")
+	fs.StringVar(&directives, "pr_directives", "", "Directives PR authors may set in a fenced 'mergebot:' block of the description (comma separated: strategy, verify, order; none when empty)")
+	fs.BoolVar(&cfg.Semver, "semver", false, "Suggest the next semantic version from merged PR labels and titles")
+	fs.StringVar(&cfg.VersionFile, "version_file", "", "Commit the suggested version to this file (e.g. VERSION) on the target branch")
+	fs.BoolVar(&cfg.PlanOnly, "plan_only", false, "Build the branch and push it as a plan ref instead of publishing the target branch")
+	fs.StringVar(&cfg.PublishPlan, "publish_plan", "", "Force-push a plan built by --plan_only to the target branch")
+	fs.IntVar(&cfg.ApprovalIssue, "approval_issue", 0, "Issue where a maintainer must comment /publish before the target branch is pushed")
+	fs.DurationVar(&cfg.ApprovalTimeout, "approval_timeout", time.Hour, "Maximum wait for the /publish approval comment")
+	fs.DurationVar(&cfg.MaxRunDuration, "max_run_duration", 0, "Stop merging after this long and publish the PRs merged so far, deferring the rest (0 disables)")
+	fs.IntVar(&cfg.PushRetries, "push_retries", 3, "Retries of the target branch push when another writer moved it during the run, with exponential backoff")
+	fs.IntVar(&cfg.MaxPRs, "max_prs", 0, "Merge at most this many PRs per batch, deferring the rest to the next run (0 is unlimited)")
+	fs.IntVar(&cfg.MaxPRsPerAuthor, "max_prs_per_author", 0, "With max_prs, select at most this many PRs per author or team before sharing the room left round-robin (0 disables)")
+	fs.StringVar(&authorTeams, "author_teams", "", "Comma separated teams sharing max_prs_per_author, as team=login|login (e.g. 'web=alice|bob,api=carol')")
+	fs.StringVar(&labelQuotas, "label_quotas", "", "Comma separated label quotas of a batch, as label>=N or label<=N (e.g. 'qa-approved>=2,experimental<=1'); batches missing a minimum are deferred")
+	fs.BoolVar(&cfg.Reconcile, "reconcile", false, "Re-query merged PRs before pushing and rebuild the batch without the ones closed or merged meanwhile")
+	fs.BoolVar(&cfg.NoColor, "no_color", false, "Disable colored output when attached to a terminal")
+	fs.StringVar(&cfg.LogFormat, "log_format", logFormatText, "Format of the log records on stderr: text, or json to emit one JSON object per record with the run events included")
+	fs.StringVar(&cfg.LogLevel, "log_level", "info", "Minimum level of the log records: debug, info, warn or error")
+	fs.StringVar(&cfg.Report, "report", "", fmt.Sprintf("Per-PR outcome report format (%s)", strings.Join(validReportFormats(), ", ")))
+	fs.StringVar(&cfg.ReportFile, "report_file", "", "Per-PR outcome report path (stdout when empty or '-')")
+	fs.StringVar(&cfg.ReportDir, "report_dir", "", "Write all reports (JSON, JUnit, SARIF, TAP, conflicts) and an index.json manifest into this directory for artifact upload")
+	fs.StringVar(&cfg.EventLog, "event_log", "", "Directory receiving the event log of every run as '<batch_id>-<target>.jsonl', replayable with the 'replay' subcommand (relative to state_dir)")
+	if err := checkArgs(fs, args); err != nil {
+		return cfg, err
+	}
+	fs.Parse(args)
+	if err := applyEnvConfig(fs, os.Getenv); err != nil {
+		return cfg, err
+	}
+
+	// Config file and then tenant settings fill in the flags missing from the command line
+	// and the environment, and go through the same validation
+	if cfg.ConfigFile != "" {
+		settings, err := loadConfigFile(cfg.ConfigFile)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid parameter 'config': %w", err)
+		}
+		if err := applyConfigFile(fs, settings); err != nil {
+			return cfg, fmt.Errorf("config file '%s': %w", cfg.ConfigFile, err)
+		}
+	}
+	// The tenant config may be fetched through the API, and may then move the endpoints
+	var err error
+	if cfg.APIURL, cfg.GraphQLURL, err = resolveAPIURLs(apiURL, graphqlURL, os.Getenv); err != nil {
+		return cfg, err
+	}
+	cfg.TenantConfigSHA256 = parseLabels(tenantSHA256)
+	cfg.TenantConfigKeys = parseLabels(tenantKeys)
+	repoTargets, err := parseRepoTargets(parseLabels(repos))
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Repos = repoTargets
+	if cfg.TenantConfig != "" && cfg.Org == "" && len(cfg.Repos) == 0 {
+		tc, err := loadTenantConfig(cfg)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid parameter 'tenant_config': %w", err)
+		}
+		if err := applyTenantConfig(fs, tc, cfg.Owner, cfg.Repo); err != nil {
+			return cfg, fmt.Errorf("tenant config '%s': %w", cfg.TenantConfig, err)
+		}
+		if cfg.APIURL, cfg.GraphQLURL, err = resolveAPIURLs(apiURL, graphqlURL, os.Getenv); err != nil {
+			return cfg, err
+		}
+	}
+	cfg.WebURL = resolveWebURL(apiURL, cfg.APIURL, os.Getenv)
+
+	if cfg.StatsKeepRuns < 0 {
+		return cfg, fmt.Errorf("invalid parameter 'stats_keep_runs': %d (expected a non-negative count)", cfg.StatsKeepRuns)
+	}
+	if cfg.MaxPRs < 0 {
+		return cfg, fmt.Errorf("invalid parameter 'max_prs': %d (expected a non-negative count)", cfg.MaxPRs)
+	}
+	if cfg.MaxPRsPerAuthor < 0 {
+		return cfg, fmt.Errorf("invalid parameter 'max_prs_per_author': %d (expected a non-negative count)", cfg.MaxPRsPerAuthor)
+	}
+	if cfg.StatsArchiveBranch != "" {
+		if err := validateBranchName(cfg.StatsArchiveBranch); err != nil {
+			return cfg, fmt.Errorf("invalid parameter 'stats_archive_branch': %w", err)
+		}
+		if cfg.StatsArchiveBranch == cfg.TargetBranch || cfg.StatsArchiveBranch == cfg.TrunkBranch {
+			return cfg, fmt.Errorf("invalid parameter 'stats_archive_branch': '%s' is the trunk or target branch", cfg.StatsArchiveBranch)
+		}
+	}
+	if cfg.ResultsBranch != "" {
+		if err := validateBranchName(cfg.ResultsBranch); err != nil {
+			return cfg, fmt.Errorf("invalid parameter 'results_branch': %w", err)
+		}
+		if cfg.ResultsBranch == cfg.TargetBranch || cfg.ResultsBranch == cfg.TrunkBranch || cfg.ResultsBranch == cfg.StatsArchiveBranch {
+			return cfg, fmt.Errorf("invalid parameter 'results_branch': '%s' is the trunk, target or stats archive branch", cfg.ResultsBranch)
+		}
+	}
+	if cfg.PreverifyParallelism < 0 {
+		return cfg, fmt.Errorf("invalid parameter 'preverify_parallelism': %d (expected a non-negative count)", cfg.PreverifyParallelism)
+	}
+	if cfg.PreverifyParallelism > 0 && cfg.VerifyCmd == "" {
+		return cfg, fmt.Errorf("parameter 'preverify_parallelism' requires 'verify_cmd'")
+	}
+	if cfg.HookLimits.Timeout < 0 {
+		return cfg, fmt.Errorf("invalid parameter 'hook_timeout': %s (expected a non-negative duration)", cfg.HookLimits.Timeout)
+	}
+	if cfg.HookLimits.CPU < 0 {
+		return cfg, fmt.Errorf("invalid parameter 'hook_cpu': %s (expected a non-negative duration)", cfg.HookLimits.CPU)
+	}
+	if hookMemory != "" {
+		size, err := parseByteSize(hookMemory)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid parameter 'hook_memory': %w", err)
+		}
+		cfg.HookLimits.Memory = size
+	}
+	if cfg.APIRateLimit < 0 {
+		return cfg, fmt.Errorf("invalid parameter 'api_rate_limit': %d (expected a non-negative rate)", cfg.APIRateLimit)
+	}
+	if cfg.MaxResponseBytes <= 0 {
+		return cfg, fmt.Errorf("invalid parameter 'max_response_bytes': %d (expected a positive size)", cfg.MaxResponseBytes)
+	}
+	if cfg.RecordDir != "" && cfg.ReplayDir != "" {
+		return cfg, fmt.Errorf("parameters 'record' and 'replay' are mutually exclusive")
+	}
+	faults, err := parseChaos(parseLabels(chaosFaults))
+	if err != nil {
+		return cfg, fmt.Errorf("invalid parameter 'chaos': %w", err)
+	}
+	cfg.Chaos = faults
+	if len(cfg.Chaos) > 0 && cfg.ChaosSeed == 0 {
+		cfg.ChaosSeed = time.Now().UnixNano()
+	}
+	if cfg.AppID != 0 {
+		if cfg.GithubToken != "" {
+			return cfg, fmt.Errorf("parameters 'app_id' and 'github_token' are mutually exclusive")
+		}
+		if cfg.AppInstallationID <= 0 {
+			return cfg, fmt.Errorf("parameter 'app_id' requires 'app_installation_id'")
+		}
+		if cfg.AppPrivateKey == "" {
+			return cfg, fmt.Errorf("parameter 'app_id' requires 'app_private_key'")
+		}
+	}
+	if cfg.GithubToken == "" && cfg.AppID == 0 && cfg.ReplayDir == "" && cfg.PRsFile == "" {
 		return cfg, fmt.Errorf("missing required parameter: 'github_token'")
 	}
-	if cfg.Owner == "" {
-		return cfg, fmt.Errorf("missing required parameter: 'owner'")
+	if cfg.Org != "" && len(cfg.Repos) > 0 {
+		return cfg, fmt.Errorf("parameters 'org' and 'repos' are mutually exclusive")
 	}
-	if cfg.Repo == "" {
-		return cfg, fmt.Errorf("missing required parameter: 'repo'")
+	if len(cfg.Repos) > 0 {
+		if cfg.PRsFile != "" {
+			return cfg, fmt.Errorf("parameters 'repos' and 'prs_file' are mutually exclusive")
+		}
+		if cfg.OrgParallelism <= 0 {
+			return cfg, fmt.Errorf("invalid parameter 'org_parallelism': %d (expected a positive count)", cfg.OrgParallelism)
+		}
+	} else if cfg.Org != "" {
+		if cfg.PRsFile != "" {
+			return cfg, fmt.Errorf("parameters 'org' and 'prs_file' are mutually exclusive")
+		}
+		if _, err := path.Match(cfg.RepoPattern, ""); err != nil {
+			return cfg, fmt.Errorf("invalid parameter 'repo_pattern': %w", err)
+		}
+		if cfg.OrgParallelism <= 0 {
+			return cfg, fmt.Errorf("invalid parameter 'org_parallelism': %d (expected a positive count)", cfg.OrgParallelism)
+		}
+	} else {
+		if cfg.Owner == "" {
+			return cfg, fmt.Errorf("missing required parameter: 'owner'")
+		}
+		if cfg.Repo == "" {
+			return cfg, fmt.Errorf("missing required parameter: 'repo'")
+		}
 	}
-	if cfg.GitHubOutput == "" {
-		return cfg, fmt.Errorf("missing required parameter: 'github_output'")
+
+	switch cfg.EmptyBatch {
+	case emptyBatchReset, emptyBatchLeave, emptyBatchDelete:
+	default:
+		return cfg, fmt.Errorf("invalid parameter 'empty_batch': '%s' (expected reset, leave or delete)", cfg.EmptyBatch)
+	}
+	switch cfg.ZeroMerges {
+	case zeroMergesTrunk, zeroMergesKeep, zeroMergesFail:
+	default:
+		return cfg, fmt.Errorf("invalid parameter 'zero_merges': '%s' (expected trunk, keep or fail)", cfg.ZeroMerges)
+	}
+	switch cfg.BinaryConflicts {
+	case binaryConflictFail, binaryConflictOurs, binaryConflictTheirs, binaryConflictSkip:
+	default:
+		return cfg, fmt.Errorf("invalid parameter 'binary_conflicts': '%s' (expected fail, ours, theirs or skip)", cfg.BinaryConflicts)
+	}
+	switch cfg.CommitMode {
+	case commitModePerPR, commitModeSingle, commitModeMerge:
+	default:
+		return cfg, fmt.Errorf("invalid parameter 'commit_mode': '%s' (expected per-pr, single or merge)", cfg.CommitMode)
+	}
+	if cfg.DryRun {
+		if err := checkPlanSources(cfg, "parameter 'dry_run'"); err != nil {
+			return cfg, err
+		}
+	}
+	switch cfg.CommitBodyFormat {
+	case commitBodyPlain, commitBodyMarkdown:
+	default:
+		return cfg, fmt.Errorf("invalid parameter 'commit_body_format': '%s' (expected plain or markdown)", cfg.CommitBodyFormat)
+	}
+	switch cfg.LogFormat {
+	case logFormatText, logFormatJSON:
+	default:
+		return cfg, fmt.Errorf("invalid parameter 'log_format': '%s' (expected text or json)", cfg.LogFormat)
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		return cfg, fmt.Errorf("invalid parameter 'log_level': '%s' (expected debug, info, warn or error)", cfg.LogLevel)
+	}
+	if cfg.CommitBodyMaxLines < 0 {
+		return cfg, fmt.Errorf("invalid parameter 'commit_body_max_lines': %d (expected a non-negative count)", cfg.CommitBodyMaxLines)
+	}
+	switch cfg.Rulesets {
+	case rulesetsIgnore, rulesetsAdapt, rulesetsFail:
+	default:
+		return cfg, fmt.Errorf("invalid parameter 'rulesets': '%s' (expected ignore, adapt or fail)", cfg.Rulesets)
+	}
+	switch cfg.SigningFormat {
+	case "ssh", "openpgp", "x509":
+	default:
+		return cfg, fmt.Errorf("invalid parameter 'signing_format': '%s' (expected ssh, openpgp or x509)", cfg.SigningFormat)
+	}
+	if cfg.UpdateBranches != "" && cfg.UpdateBranches != updateBranchAPI && cfg.UpdateBranches != updateBranchLocal {
+		return cfg, fmt.Errorf("invalid parameter 'update_branches': '%s' (expected api or local)", cfg.UpdateBranches)
+	}
+	if cfg.PlanOnly && (cfg.PublishPlan != "" || cfg.ApprovalIssue > 0) {
+		return cfg, fmt.Errorf("parameter 'plan_only' cannot be combined with 'publish_plan' or 'approval_issue'")
+	}
+	if cfg.CommitMode == commitModeMerge && cfg.RebaseFallback {
+		return cfg, fmt.Errorf("parameter 'rebase_fallback' squashes PRs and cannot be used with 'commit_mode' merge")
+	}
+	if cfg.LintPolicy != lintPolicyReject && cfg.LintPolicy != lintPolicyFix {
+		return cfg, fmt.Errorf("invalid parameter 'lint_policy': '%s' (expected reject or fix)", cfg.LintPolicy)
+	}
+	if cfg.LintMaxLength < 0 {
+		return cfg, fmt.Errorf("invalid parameter 'lint_max_length': %d (expected a non-negative length)", cfg.LintMaxLength)
+	}
+	if _, err := regexp.Compile(cfg.LintTicketPattern); err != nil {
+		return cfg, fmt.Errorf("invalid parameter 'lint_ticket_pattern': %w", err)
+	}
+	if _, err := parseLintFixTemplate(cfg.LintFixTemplate); err != nil {
+		return cfg, fmt.Errorf("invalid parameter 'lint_fix_template': %w", err)
+	}
+	if _, err := parseHistoryCommitMessage(cfg.HistoryCommitMessage); err != nil {
+		return cfg, fmt.Errorf("invalid parameter 'history_commit_message': %w", err)
+	}
+	if cfg.PolicyFile != "" {
+		policies, err := loadPolicies(cfg.PolicyFile)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid parameter 'policy_file': %w", err)
+		}
+		cfg.Policies = policies
+	}
+	if cfg.MaxRisk < 0 || cfg.MaxRisk > 100 {
+		return cfg, fmt.Errorf("invalid parameter 'max_risk': %g (expected a score from 0 to 100)", cfg.MaxRisk)
+	}
+	if cfg.MaxBatchRisk < 0 || cfg.MaxBatchRisk > 100 {
+		return cfg, fmt.Errorf("invalid parameter 'max_batch_risk': %g (expected a score from 0 to 100)", cfg.MaxBatchRisk)
+	}
+	if cfg.RiskOrder || cfg.MaxRisk > 0 || cfg.MaxBatchRisk > 0 {
+		cfg.RiskScores = true
+	}
+	if cfg.Project != "" {
+		if _, _, err := parseProject(cfg.Project); err != nil {
+			return cfg, fmt.Errorf("invalid parameter 'project': %w", err)
+		}
+	}
+	columns, err := parseProjectColumns(parseLabels(projectColumns))
+	if err != nil {
+		return cfg, fmt.Errorf("invalid parameter 'project_columns': %w", err)
+	}
+	cfg.ProjectColumns = columns
+	if !slices.Contains(supportedLocales(), cfg.Locale) {
+		return cfg, fmt.Errorf("invalid parameter 'locale': '%s' (expected one of %s)", cfg.Locale, strings.Join(supportedLocales(), ", "))
+	}
+	messages, err := loadMessageCatalog(cfg.Locale, messagesFile)
+	if err != nil {
+		return cfg, fmt.Errorf("invalid parameter 'messages_file': %w", err)
+	}
+	cfg.Messages = messages
+	if textTemplates != "" {
+		overrides, err := loadTextTemplates(textTemplates)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid parameter 'text_templates': %w", err)
+		}
+		cfg.TextTemplates = overrides
+	}
+	if _, ok := historyCodecs[cfg.HistoryFormat]; !ok {
+		return cfg, fmt.Errorf("invalid parameter 'history_format': '%s' (expected one of %s)",
+			cfg.HistoryFormat, strings.Join(validHistoryFormats(), ", "))
+	}
+	if _, ok := reportEmitters[cfg.Report]; cfg.Report != "" && !ok {
+		return cfg, fmt.Errorf("invalid parameter 'report': '%s' (expected one of %s)",
+			cfg.Report, strings.Join(validReportFormats(), ", "))
+	}
+
+	if cfg.BatchID == "" {
+		cfg.BatchID = newBatchID()
 	}
 
 	// Set default target branch if not provided
 	if cfg.TargetBranch == "" {
 		cfg.TargetBranch = fmt.Sprintf("pre-%s", cfg.TrunkBranch)
 	}
+	// Parsed first, since the target template may read the values of their namespaces
+	cfg.RequiredLabels = dedupeLabels(append(parseLabels(labels), repeatedLabels...))
+	cfg.LabelNamespaces = parseLabels(labelNamespaces)
+	for _, namespace := range cfg.LabelNamespaces {
+		if namespace == "" || strings.HasPrefix(namespace, labelNamespaceSep) || strings.HasSuffix(namespace, labelNamespaceSep) || strings.Contains(namespace, "*") {
+			return cfg, fmt.Errorf("invalid parameter 'label_namespaces': '%s' (expected a namespace such as 'deploy' for deploy/<value> labels)", namespace)
+		}
+	}
+	if cfg.TargetTemplate != "" {
+		name, err := renderCandidateBranch(cfg, time.Now())
+		if err != nil {
+			return cfg, fmt.Errorf("invalid parameter 'target_template': %w", err)
+		}
+		cfg.CandidateBranch = name
+	}
+	if cfg.PromoteFrom != "" {
+		if err := validateBranchName(cfg.PromoteFrom); err != nil {
+			return cfg, fmt.Errorf("invalid parameter 'promote_from': %w", err)
+		}
+		if cfg.PromoteFrom == cfg.TargetBranch || cfg.PromoteFrom == cfg.TrunkBranch {
+			return cfg, fmt.Errorf("invalid parameter 'promote_from': '%s' is the trunk or target branch", cfg.PromoteFrom)
+		}
+		if cfg.PRsFile != "" {
+			return cfg, fmt.Errorf("parameters 'promote_from' and 'prs_file' are mutually exclusive")
+		}
+	}
+	if cfg.MergeQueue && (cfg.PromoteFrom != "" || cfg.PRsFile != "") {
+		return cfg, fmt.Errorf("parameter 'merge_queue' is mutually exclusive with 'promote_from' and 'prs_file'")
+	}
 
-	cfg.RequiredLabels = parseLabels(labels)
+	if _, err := openStorage(cfg.Storage, cfg.StateDir); err != nil {
+		return cfg, fmt.Errorf("invalid parameter 'storage': %w", err)
+	}
+	if isFileStorage(cfg.Storage) {
+		cfg.ConflictStats = resolveStatePath(cfg.StateDir, cfg.ConflictStats)
+		cfg.EligibilityCache = resolveStatePath(cfg.StateDir, cfg.EligibilityCache)
+	} else {
+		if err := validateStorageKey(cfg.ConflictStats); err != nil {
+			return cfg, fmt.Errorf("invalid parameter 'conflict_stats': %w", err)
+		}
+		if err := validateStorageKey(cfg.EligibilityCache); err != nil {
+			return cfg, fmt.Errorf("invalid parameter 'eligibility_cache': %w", err)
+		}
+	}
+	cfg.StatsArchive = resolveStatePath(cfg.StateDir, cfg.StatsArchive)
+	cfg.EventLog = resolveStatePath(cfg.StateDir, cfg.EventLog)
+	if cfg.ReportDir != "" && cfg.ConflictReport == "" {
+		cfg.ConflictReport = filepath.Join(cfg.ReportDir, reportConflictFile)
+	}
+	cfg.IncidentAssignees = parseLabels(assignees)
+	cfg.UpdateBranchLabels = parseLabels(updateLabels)
+	cfg.IgnorePaths = parseLabels(ignorePaths)
+	cfg.DepsAuthors = parseLabels(depsAuthors)
+	cfg.DepsLabels = parseLabels(depsLabels)
+	cfg.ProtectChecks = parseLabels(protectChecks)
+	bypass := parseLabels(protectBypass)
+	if len(bypass) > 0 && !cfg.ProtectTarget {
+		return cfg, fmt.Errorf("parameter 'protect_bypass' requires 'protect_target'")
+	}
+	if len(cfg.ProtectChecks) > 0 && !cfg.ProtectTarget {
+		return cfg, fmt.Errorf("parameter 'protect_checks' requires 'protect_target'")
+	}
+	if cfg.ProtectTarget && len(bypass) == 0 {
+		bypass = []string{"role:admin"}
+		if cfg.AppID != 0 {
+			bypass = []string{"app"}
+		}
+	}
+	if cfg.ProtectBypass, err = parseProtectBypass(bypass, cfg.AppID); err != nil {
+		return cfg, err
+	}
+	cfg.LintForbiddenWords = parseLabels(forbiddenWords)
+	cfg.PRDirectives = parseLabels(directives)
+	cfg.PromoteChecks = parseLabels(promoteChecks)
+	cfg.EventSinks = parseLabels(eventSinks)
+	for _, sink := range cfg.EventSinks {
+		if err := validateEventSink(sink); err != nil {
+			return cfg, fmt.Errorf("invalid parameter 'event_sinks': %w", err)
+		}
+	}
+	if len(cfg.EventSinks) > 0 && cfg.EventSecret == "" {
+		return cfg, fmt.Errorf("parameter 'event_sinks' requires 'event_secret', the events are signed")
+	}
+	teams, err := parseAuthorTeams(parseLabels(authorTeams))
+	if err != nil {
+		return cfg, err
+	}
+	cfg.AuthorTeams = teams
+	if cfg.LabelQuotas, err = parseLabelQuotas(parseLabels(labelQuotas)); err != nil {
+		return cfg, err
+	}
+	for _, q := range cfg.LabelQuotas {
+		if cfg.MaxPRs > 0 && q.Min > cfg.MaxPRs {
+			return cfg, fmt.Errorf("invalid parameter 'label_quotas': '%s' needs at least %d PR(s), above max_prs %d", q.Label, q.Min, cfg.MaxPRs)
+		}
+	}
+	groups, err := parseConcurrencyGroups(parseLabels(concurrencyGroups))
+	if err != nil {
+		return cfg, err
+	}
+	cfg.ConcurrencyGroups = groups
+	for _, key := range cfg.PRDirectives {
+		if _, ok := prDirectiveValues[key]; !ok {
+			return cfg, fmt.Errorf("invalid parameter 'pr_directives': unknown directive '%s' (expected strategy, verify or order)", key)
+		}
+	}
+	targets, err := parseBuildTargets(buildTargets)
+	if err != nil {
+		return cfg, fmt.Errorf("invalid parameter 'build_targets': %w", err)
+	}
+	cfg.BuildTargets = targets
+	for _, s := range parseLabels(excludePRs) {
+		n, err := strconv.Atoi(strings.TrimPrefix(s, "#"))
+		if err != nil || n <= 0 {
+			return cfg, fmt.Errorf("invalid parameter 'exclude_prs': '%s' is not a PR number", s)
+		}
+		cfg.ExcludePRs = append(cfg.ExcludePRs, n)
+	}
+	if cfg.MembershipLabel != "" && len(cfg.RequiredLabels) > 0 && hasAnyLabel([]string{cfg.MembershipLabel}, cfg.RequiredLabels) {
+		return cfg, fmt.Errorf("parameter 'membership_label' cannot be one of the required labels")
+	}
+	if err := validatePathPatterns(cfg.IgnorePaths); err != nil {
+		return cfg, fmt.Errorf("invalid parameter 'ignore_paths': %w", err)
+	}
 	return cfg, nil
 }
 
-// parseLabels converts comma-separated string to slice
+// labelList collects the values of a repeatable label flag
+type labelList []string
+
+func (l *labelList) String() string { return strings.Join(*l, ",") }
+
+func (l *labelList) Set(value string) error {
+	*l = append(*l, parseLabels(value)...)
+	return nil
+}
+
+// parseLabels converts a label list string to a slice of trimmed labels.
+// Labels are comma separated, so `needs qa` is a single label. Double or single
+// quotes opening a label keep commas inside it (`"qa, staging", wip`), while
+// apostrophes inside a label (`don't merge, wip`) are literal.
 func parseLabels(input string) []string {
-	if input == "" {
-		return make([]string, 0)
+	labels := make([]string, 0)
+	var current strings.Builder
+	var quote rune
+	flush := func() {
+		if l := strings.TrimSpace(current.String()); l != "" {
+			labels = append(labels, l)
+		}
+		current.Reset()
+	}
+	for _, r := range input {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\'') && strings.TrimSpace(current.String()) == "":
+			quote = r
+		case quote == 0 && r == ',':
+			flush()
+		default:
+			current.WriteRune(r)
+		}
 	}
-	return strings.Split(input, ",")
+	flush()
+	return labels
+}
+
+// dedupeLabels removes labels equal under Unicode case folding, keeping the first spelling
+func dedupeLabels(labels []string) []string {
+	out := make([]string, 0, len(labels))
+	for _, l := range labels {
+		if !slices.ContainsFunc(out, func(o string) bool { return strings.EqualFold(o, l) }) {
+			out = append(out, l)
+		}
+	}
+	return out
 }
 
 // mustSetupGitConfig configures Git with safe defaults
@@ -200,6 +1210,11 @@ func setupGitConfig() error {
 	}
 
 	for _, c := range configs {
+		// Set values are skipped, so concurrent bot processes do not contend for the config lock
+		current, _ := runGitCommandWithOutput("config", "--global", "--get-all", c.key)
+		if slices.Contains(strings.Split(strings.TrimSpace(current), "\n"), c.value) {
+			continue
+		}
 		if err := runGitCommand("config", "--global", c.key, c.value); err != nil {
 			return fmt.Errorf("git config error: %w", err)
 		}
@@ -208,122 +1223,68 @@ func setupGitConfig() error {
 }
 
 // mustFetchQualifiedPRs retrieves PRs meeting criteria
-func mustFetchQualifiedPRs(cfg Config) []GitHubPR {
-	prs, err := fetchQualifiedPRs(cfg)
+func mustFetchQualifiedPRs(client GitHubClient, cfg Config, report *RunReport) []GitHubPR {
+	prs, err := fetchQualifiedPRs(client, cfg, report)
 	if err != nil {
 		log.Fatal("error fetching PRs:", err)
 	}
 	return prs
 }
 
-// fetchQualifiedPRs retrieves all open PRs from GitHub API using pagination
-func fetchQualifiedPRs(cfg Config) ([]GitHubPR, error) {
-	var allPRs []GitHubPR
-	page := 1
-
-	for {
-		apiURL := fmt.Sprintf("%s/repos/%s/%s/pulls?state=open&base=%s&sort=created&direction=asc&per_page=100&page=%d",
-			githubAPI, cfg.Owner, cfg.Repo, cfg.TrunkBranch, page)
-
-		batch, err := fetchPRsPage(cfg, apiURL)
-		if err != nil {
-			return nil, err
-		}
-
-		allPRs = append(allPRs, batch...)
-
-		if len(batch) < 100 {
-			break
-		}
-		page++
-	}
-
-	return filterPRs(allPRs, cfg.RequiredLabels), nil
-}
-
-// fetchPRsPage retrieves a single page of PRs from the GitHub API
-func fetchPRsPage(cfg Config, apiURL string) ([]GitHubPR, error) {
-	req, err := http.NewRequest("GET", apiURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("request creation failed: %w", err)
-	}
-
-	req.Header.Set("Authorization", "token "+cfg.GithubToken)
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
-	req.Header.Set("User-Agent", userAgent)
-
-	client := &http.Client{Timeout: 15 * time.Second}
-	resp, err := client.Do(req)
+// fetchQualifiedPRs retrieves open PRs and keeps those passing every eligibility filter
+func fetchQualifiedPRs(client GitHubClient, cfg Config, report *RunReport) ([]GitHubPR, error) {
+	prs, err := client.ListOpenPRs(cfg.TrunkBranch)
 	if err != nil {
-		return nil, fmt.Errorf("request API failed: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("response API status %d", resp.StatusCode)
-	}
-
-	var rawPRs []struct {
-		Number    int    `json:"number"`
-		Title     string `json:"title"`
-		State     string `json:"state"`
-		CreatedAt string `json:"created_at"`
-		Base      struct {
-			Ref string `json:"ref"`
-		} `json:"base"`
-		Labels []struct {
-			Name string `json:"name"`
-		} `json:"labels"`
+	cache := loadEligibilityCache(cfg)
+	if cfg.ConventionalTitles {
+		commentTitleSuggestions(client, cfg, prs, cache)
 	}
+	qualified := qualifyPRs(cfg, prs, report, cache)
+	cache.save(prs)
+	return qualified, nil
+}
 
-	if err := json.NewDecoder(resp.Body).Decode(&rawPRs); err != nil {
-		return nil, fmt.Errorf("response API decoding failed: %w", err)
+// qualifyPRs keeps the PRs passing every eligibility filter, in merge order and within
+// the batch limits. It has no side effect besides the report, so plans share it.
+func qualifyPRs(cfg Config, prs []GitHubPR, report *RunReport, cache *EligibilityCache) []GitHubPR {
+	filtered := filterPRs(prs, cfg, report, cache)
+	applySubjectFixes(cfg, filtered)
+	orderByDirectives(cfg, filtered)
+	if len(cfg.LabelQuotas) > 0 {
+		return applyLabelQuotas(cfg, filtered, report)
 	}
-
-	prs := make([]GitHubPR, len(rawPRs))
-	for i, raw := range rawPRs {
-		labels := make([]string, len(raw.Labels))
-		for j, l := range raw.Labels {
-			labels[j] = l.Name
-		}
-		prs[i] = GitHubPR{
-			Number:    raw.Number,
-			Title:     raw.Title,
-			State:     raw.State,
-			CreatedAt: raw.CreatedAt,
-			Base:      raw.Base,
-			Labels:    labels,
-		}
-	}
-
-	return prs, nil
+	return limitBatch(cfg, filtered, report)
 }
 
-// filterPRs selects PRs with required labels
-func filterPRs(prs []GitHubPR, requiredLabels []string) []GitHubPR {
+// filterPRs selects PRs passing every eligibility filter, reporting the excluded ones
+func filterPRs(prs []GitHubPR, cfg Config, report *RunReport, cache *EligibilityCache) []GitHubPR {
+	report.discovered(prs)
 	var filtered []GitHubPR
 	for _, pr := range prs {
-		if hasAnyLabel(pr.Labels, requiredLabels) {
+		verdicts := cache.evaluate(cfg, pr)
+		if isEligible(verdicts) {
 			filtered = append(filtered, pr)
+			continue
 		}
+		report.add(pr, OutcomeFiltered, failedVerdicts(verdicts), 0)
 	}
 	return filtered
 }
 
-// hasAnyLabel checks for label matches
+// hasAnyLabel checks for label matches using Unicode case folding,
+// matching GitHub's case-insensitive label semantics
 func hasAnyLabel(prLabels []string, required []string) bool {
 	if len(required) == 0 {
 		return true
 	}
 
-	prLabelSet := make(map[string]struct{})
-	for _, l := range prLabels {
-		prLabelSet[strings.ToLower(l)] = struct{}{}
-	}
-
 	for _, req := range required {
-		if _, exists := prLabelSet[strings.ToLower(req)]; exists {
-			return true
+		for _, l := range prLabels {
+			if matchLabel(l, req) {
+				return true
+			}
 		}
 	}
 	return false
@@ -331,7 +1292,8 @@ func hasAnyLabel(prLabels []string, required []string) bool {
 
 // prepareTargetBranch resets target branch
 func prepareTargetBranch(cfg Config) {
-	if err := runGitCommand("checkout", cfg.TrunkBranch); err != nil {
+	// Detached, since trunk may be checked out in another worktree of a multi-target build
+	if err := runGitCommand("checkout", "--detach", cfg.TrunkBranch); err != nil {
 		log.Fatalf("checkout to trunk branch failed: %v", err)
 	}
 
@@ -346,6 +1308,11 @@ func prepareTargetBranch(cfg Config) {
 	}
 }
 
+// remoteBranchExists checks if a branch exists on origin
+func remoteBranchExists(branch string) bool {
+	return runOriginGit("ls-remote", "--exit-code", "--heads", "origin", branch) == nil
+}
+
 // branchExists checks if a Git branch exists
 func branchExists(branch string) bool {
 	return runGitCommand("show-ref", "--verify", fmt.Sprintf("refs/heads/%s", branch)) == nil
@@ -357,15 +1324,39 @@ func runGitCommandWithOutput(args ...string) (string, error) {
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return string(output), fmt.Errorf("'git %s' failed: %s\n%s",
-			strings.Join(args, " "), err, string(output))
+			strings.Join(args, " "), err, truncateOutput(string(output)))
 	}
 	return string(output), nil
 }
 
-// runGitCommand executes a Git command discarding its output
+// runGitCommand executes a Git command discarding its output, of which only a bounded
+// excerpt is kept for the error
 func runGitCommand(args ...string) error {
-	_, err := runGitCommandWithOutput(args...)
-	return err
+	output, err := runBounded(exec.Command("git", args...))
+	if err != nil {
+		return fmt.Errorf("'git %s' failed: %s\n%s", strings.Join(args, " "), err, output)
+	}
+	return nil
+}
+
+// runOriginGit runs a Git command fetching from or pushing to origin, authenticated with
+// the current installation token under App auth. The token is kept out of the error.
+func runOriginGit(args ...string) error {
+	output, err := runBounded(exec.Command("git", append(originAuthArgs(), args...)...))
+	if err != nil {
+		return fmt.Errorf("'git %s' failed: %s\n%s", strings.Join(args, " "), err, output)
+	}
+	return nil
+}
+
+// runOriginGitWithOutput is runOriginGit returning the command output
+func runOriginGitWithOutput(args ...string) (string, error) {
+	output, err := exec.Command("git", append(originAuthArgs(), args...)...).CombinedOutput()
+	if err != nil {
+		return string(output), fmt.Errorf("'git %s' failed: %s\n%s",
+			strings.Join(args, " "), err, truncateOutput(string(output)))
+	}
+	return string(output), nil
 }
 
 // getConflictingFiles returns files with unresolved merge conflicts in the index.
@@ -406,73 +1397,275 @@ func firstLine(s string) string {
 }
 
 // processPRs handles the PR merging pipeline with progress output.
-// Returns an error and aborts immediately if any PR fails to merge,
-// preserving the remote target branch in its previous conflict-free state.
-func processPRs(prs []GitHubPR, targetBranch string) ([]MergeRecord, error) {
+// Returns an error and aborts as soon as a PR fails to merge once another one merged,
+// preserving the remote target branch in its previous conflict-free state. When every
+// PR fails it returns no merge records, leaving the outcome to the zero merges policy.
+func processPRs(prs []GitHubPR, cfg Config, report *RunReport) ([]MergeRecord, error) {
+	targetBranch := cfg.TargetBranch
 	total := len(prs)
-	logPRsToMerge(prs, targetBranch)
+	logPRsToMerge(cfg, prs)
 
-	fmt.Printf("Merging into '%s':\n", targetBranch)
+	fmt.Println(message(cfg, "merge.merging", targetBranch))
 
+	con := newConsole(cfg)
 	var mergedPRs []MergeRecord
+	var batchErr error
+	abortedAt := 0
 	for i, pr := range prs {
-		fmt.Printf("  [%d/%d] #%d \"%s\" ... ", i+1, total, pr.Number, pr.Title)
-		if err := processSinglePR(pr); err != nil {
+		if cfg.MaxRunDuration > 0 && time.Since(report.StartedAt) >= cfg.MaxRunDuration {
+			deferPRs(cfg, report, prs[i:])
+			break
+		}
+		con.current(i, total, pr)
+		start := time.Now()
+		err := processSinglePR(pr, cfg)
+		rebased := false
+		var conflictErr *ConflictError
+		if errors.As(err, &conflictErr) && cfg.ConflictStats != "" {
+			recordConflict(cfg, pr, conflictErr)
+		}
+		if cfg.RebaseFallback && prCommitMode(cfg, pr) != commitModeMerge && errors.As(err, &conflictErr) {
+			// Keep the original conflict error when the rebase attempt fails too
+			runGitCommand("reset", "--hard", "HEAD")
+			if rebaseErr := rebaseSquashPR(pr, cfg); rebaseErr == nil || errors.Is(rebaseErr, ErrEmptyMerge) {
+				err, rebased = rebaseErr, true
+			}
+		}
+		if err != nil {
 			if errors.Is(err, ErrEmptyMerge) {
-				fmt.Println("SKIPPED (changes already in target branch)")
+				fmt.Println(con.warn(message(cfg, "merge.skipped")) + " (" + message(cfg, "merge.already_included") + ")" + con.progress(len(mergedPRs), i+1, total))
+				runGitCommand("reset", "--hard", "HEAD")
+				report.add(pr, OutcomeAlreadyIncluded, err.Error(), time.Since(start))
+				continue
+			}
+			if errors.Is(err, ErrBinaryConflict) {
+				fmt.Println(con.warn(message(cfg, "merge.skipped")) + " (" + err.Error() + ")" + con.progress(len(mergedPRs), i+1, total))
 				runGitCommand("reset", "--hard", "HEAD")
+				report.add(pr, OutcomeBinaryConflict, err.Error(), time.Since(start))
 				continue
 			}
-			var conflictErr *ConflictError
 			if errors.As(err, &conflictErr) {
-				fmt.Println("CONFLICT")
+				fmt.Println(con.fail(message(cfg, "merge.conflict")))
 				fmt.Print(strings.TrimRight(conflictErr.GitOutput, "\n"))
 				fmt.Println()
+				conflictErr.Pairing = pairConflict(cfg, pr, conflictErr, mergedPRs, prs)
+				if cfg.ConflictReport != "" {
+					writeConflictReport(cfg, pr, conflictErr, mergedPRs)
+				}
+				detail := fmt.Sprintf("%s: %s\n%s", err, strings.Join(conflictErr.Files, ", "), conflictErr.GitOutput)
+				if conflictErr.Pairing != nil {
+					detail += "\n" + conflictErr.Pairing.describe()
+				}
+				report.addConflict(pr, conflictErr, detail, time.Since(start))
 			} else {
-				fmt.Printf("FAILED\n         Reason: %s\n", firstLine(err.Error()))
+				fmt.Printf("%s\n         %s\n", con.fail(message(cfg, "merge.failed")), message(cfg, "merge.reason", firstLine(err.Error())))
+				report.add(pr, OutcomeFailed, err.Error(), time.Since(start))
 			}
-			fmt.Printf("\nMerge aborted: PR #%d could not be merged into '%s'.\n", pr.Number, targetBranch)
-			fmt.Printf("Target branch '%s' was not updated.\n", targetBranch)
 			runGitCommand("reset", "--hard", "HEAD")
-			return nil, fmt.Errorf("PR #%d could not be merged: %w", pr.Number, err)
+			err = fmt.Errorf("PR #%d could not be merged: %w", pr.Number, err)
+			// Until a PR merges there is no batch to preserve: keep going to tell whether any PR merges
+			if len(mergedPRs) == 0 {
+				if batchErr == nil {
+					batchErr, abortedAt = err, pr.Number
+				}
+				continue
+			}
+			return nil, abortBatch(cfg, report, prs[i+1:], pr.Number, err)
 		}
-		fmt.Println("OK")
 		mergedPRs = append(mergedPRs, createMergeRecord(pr))
+		if rebased {
+			fmt.Println(con.ok(message(cfg, "merge.ok")) + " (" + message(cfg, "merge.rebased") + ")" + con.progress(len(mergedPRs), i+1, total))
+		} else {
+			fmt.Println(con.ok(message(cfg, "merge.ok")) + con.progress(len(mergedPRs), i+1, total))
+		}
+		report.add(pr, OutcomeMerged, "", time.Since(start))
+		if batchErr != nil {
+			return nil, abortBatch(cfg, report, prs[i+1:], abortedAt, batchErr)
+		}
 	}
 
-	fmt.Printf("\n%d/%d PR(s) merged successfully.\n", len(mergedPRs), total)
+	fmt.Printf("\n%s\n", message(cfg, "merge.summary", len(mergedPRs), total))
 	return mergedPRs, nil
 }
 
+// abortBatch reports the batch aborted at PR #number, recording the PRs left unattempted
+func abortBatch(cfg Config, report *RunReport, rest []GitHubPR, number int, err error) error {
+	for _, pr := range rest {
+		report.add(pr, OutcomeNotAttempted, fmt.Sprintf("batch aborted at PR #%d", number), 0)
+	}
+	fmt.Printf("\n%s\n", message(cfg, "merge.aborted", number, cfg.TargetBranch))
+	fmt.Println(message(cfg, "merge.not_updated", cfg.TargetBranch))
+	return err
+}
+
+// deferPRs records the PRs left unmerged when the run deadline is reached
+func deferPRs(cfg Config, report *RunReport, rest []GitHubPR) {
+	deferred := make([]int, len(rest))
+	for i, pr := range rest {
+		deferred[i] = pr.Number
+	}
+	report.deadline(deferred)
+	detail := fmt.Sprintf("run deadline of %s reached", cfg.MaxRunDuration)
+	for _, pr := range rest {
+		report.add(pr, OutcomeDeferred, detail, 0)
+	}
+	fmt.Printf("\n%s\n", message(cfg, "merge.deadline", cfg.MaxRunDuration, len(rest)))
+}
+
+// buildBatch merges the PRs into the prepared target branch and commits the bookkeeping files.
+// It returns false when the zero merges policy keeps the published target branch.
+func buildBatch(client GitHubClient, cfg Config, prs []GitHubPR, report *RunReport) ([]MergeRecord, bool) {
+	if cfg.GroupDeps && cfg.CommitMode != commitModeSingle {
+		prs = orderDepsLast(cfg, prs)
+	}
+	mergedPRs, err := processPRs(prs, cfg, report)
+	if err != nil {
+		var conflictErr *ConflictError
+		if errors.As(err, &conflictErr) {
+			notifyConflictPair(client, cfg, conflictErr.Pairing)
+		}
+		syncProject(client, cfg, report, false)
+		reportIncident(client, cfg, fmt.Errorf("merge process aborted: %w", err))
+		writeRunReport(cfg, report)
+		log.Fatal(message(cfg, "merge.process_aborted", err))
+	}
+	if len(mergedPRs) == 0 {
+		if err := applyZeroMerges(cfg); err != nil {
+			reportIncident(client, cfg, err)
+			writeRunReport(cfg, report)
+			log.Fatalf("\n%v", err)
+		}
+		if cfg.ZeroMerges == zeroMergesKeep {
+			resolveIncident(client, cfg)
+			writeRunReport(cfg, report)
+			return nil, false
+		}
+	} else if cfg.CommitMode == commitModeSingle {
+		recordChangedPaths(cfg, mergedPRs, report)
+		mergedPRs = mustSquashBatch(cfg, prs, mergedPRs, report)
+	} else {
+		recordChangedPaths(cfg, mergedPRs, report)
+		if cfg.GroupDeps {
+			mergedPRs = mustGroupDeps(cfg, prs, mergedPRs, report)
+		}
+		updateMergeHistory(cfg, mergedPRs, report)
+		if cfg.Semver || cfg.VersionFile != "" {
+			suggestVersion(cfg, prs, mergedPRs)
+		}
+		if cfg.BlameIgnoreRevs {
+			mustUpdateBlameIgnoreRevs(cfg)
+		}
+	}
+	return mergedPRs, true
+}
+
 // logPRsToMerge prints a summary of the PRs queued for merging
-func logPRsToMerge(prs []GitHubPR, targetBranch string) {
-	fmt.Printf("\nFound %d qualifying PR(s) to merge into '%s':\n", len(prs), targetBranch)
+func logPRsToMerge(cfg Config, prs []GitHubPR) {
+	fmt.Printf("\n%s\n", message(cfg, "merge.found", len(prs), cfg.TargetBranch))
 	for i, pr := range prs {
 		labels := strings.Join(pr.Labels, ", ")
-		fmt.Printf("  [%d/%d] #%d  \"%s\"  [%s]\n", i+1, len(prs), pr.Number, pr.Title, labels)
+		pin := ""
+		if pr.SHA != "" {
+			pin = fmt.Sprintf("  @%s", shortSHA(pr.SHA))
+		}
+		fmt.Printf("  [%d/%d] #%d  \"%s\"  [%s]%s\n", i+1, len(prs), pr.Number, pr.Title, labels, pin)
 	}
 	fmt.Println()
 }
 
 // processSinglePR handles individual PR merging
-func processSinglePR(pr GitHubPR) error {
+func processSinglePR(pr GitHubPR, cfg Config) error {
+	if injectFault(cfg, faultConflict, fmt.Sprintf("PR #%d", pr.Number)) {
+		return &ConflictError{GitOutput: fmt.Sprintf("PR #%d conflict injected by --chaos", pr.Number)}
+	}
+	mode := prCommitMode(cfg, pr)
+	branch, err := fetchPRBranch(pr, cfg)
+	if err != nil {
+		return err
+	}
+	// Test-merge refs describe the current PR head, not a pinned revision
+	if cfg.MergeRefs && pr.SHA == "" {
+		mergeRef, ok, err := fetchTestMergeRef(pr)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return &ConflictError{GitOutput: fmt.Sprintf("GitHub published no test-merge ref: PR #%d conflicts with '%s'", pr.Number, cfg.TrunkBranch)}
+		}
+		localUpdate := cfg.UpdateBranches == updateBranchLocal && wantsBranchUpdate(cfg, pr)
+		// A reused test-merge tree would bring the ignored paths along
+		if mode != commitModeMerge && !localUpdate && len(cfg.IgnorePaths) == 0 {
+			if applied, err := commitTestMerge(pr, branch, mergeRef, prMessage(cfg, pr, pr.Title)); applied {
+				return err
+			}
+		}
+	}
+	if cfg.UpdateBranches == updateBranchLocal && wantsBranchUpdate(cfg, pr) {
+		// A PR that cannot absorb trunk is merged as-is and reports its own conflict
+		if updated, err := mergeTrunkLocally(pr, branch, cfg.TrunkBranch); err == nil {
+			branch = updated
+		}
+	}
+	if mode == commitModeMerge {
+		return mergeCommitPR(pr, branch, cfg)
+	}
+	return squashMergePR(pr, branch, cfg)
+}
+
+// fetchPRBranch fetches the PR head into a local 'pr-N' branch, unless a multi-target
+// build already fetched it. A pinned PR is moved back to its pinned revision, which must
+// be reachable on the remote.
+func fetchPRBranch(pr GitHubPR, cfg Config) (string, error) {
 	branch := fmt.Sprintf("pr-%d", pr.Number)
+	if !cfg.PrefetchedPRs || !branchExists(branch) {
+		if err := runOriginGit("fetch", "origin", fmt.Sprintf("+pull/%d/head:%s", pr.Number, branch)); err != nil {
+			return "", fmt.Errorf("fetch PR branch '%s' failed: %w", branch, err)
+		}
+	}
+	if pr.SHA == "" {
+		return branch, nil
+	}
 
-	if err := runGitCommand("fetch", "origin", fmt.Sprintf("pull/%d/head:%s", pr.Number, branch)); err != nil {
-		return fmt.Errorf("fetch PR branch '%s' failed: %w", branch, err)
+	// A SHA no longer reachable from the PR head (e.g. after a force-push) may still be fetched by ID
+	commit, err := revParse(pr.SHA + "^{commit}")
+	if err != nil {
+		runOriginGit("fetch", "origin", pr.SHA)
+		if commit, err = revParse(pr.SHA + "^{commit}"); err != nil {
+			return "", fmt.Errorf("pinned revision '%s' of PR #%d is unreachable", pr.SHA, pr.Number)
+		}
+	}
+	if err := runGitCommand("branch", "--force", branch, commit); err != nil {
+		return "", fmt.Errorf("pin PR branch '%s' failed: %w", branch, err)
 	}
+	return branch, nil
+}
 
+// squashMergePR squashes a fetched PR branch into the current branch as a single commit
+func squashMergePR(pr GitHubPR, branch string, cfg Config) error {
 	// Capture merge output separately so it can be shown to the user as-is
-	// without being embedded in the error chain.
-	mergeOutput, mergeErr := exec.Command("git", "merge", "--squash", branch).CombinedOutput()
+	// without being embedded in the error chain. It is bounded: a conflicting
+	// vendored change can print hundreds of megabytes.
+	mergeOutput, mergeErr := runBounded(exec.Command("git", "merge", "--squash", branch))
+	if len(cfg.IgnorePaths) > 0 {
+		files, err := restoreIgnoredPaths(cfg, getConflictingFiles())
+		if err != nil {
+			return err
+		}
+		if mergeErr != nil && len(files) == 0 && len(getConflictingFiles()) == 0 {
+			mergeErr = nil
+		}
+	}
 	if mergeErr != nil {
-		if files := getConflictingFiles(); len(files) > 0 {
-			return &ConflictError{Files: files, GitOutput: string(mergeOutput)}
+		files := getConflictingFiles()
+		if len(files) == 0 {
+			return fmt.Errorf("squash merge failed: %s", firstLine(mergeOutput))
+		}
+		if err := conflictError(cfg, files, mergeOutput); err != nil {
+			return err
 		}
-		return fmt.Errorf("squash merge failed: %s", firstLine(string(mergeOutput)))
 	}
 
-	if err := runGitCommand("commit", "-m", pr.Title); err != nil {
+	if err := runGitCommand("commit", "-m", prMessage(cfg, pr, pr.Title)); err != nil {
 		if strings.Contains(err.Error(), "nothing to commit") {
 			return ErrEmptyMerge
 		}
@@ -482,17 +1675,156 @@ func processSinglePR(pr GitHubPR) error {
 	return nil
 }
 
+// mergeCommitPR merges a fetched PR branch into the current branch with a merge commit,
+// so the first parent stays on the target branch and the PR commits are kept
+func mergeCommitPR(pr GitHubPR, branch string, cfg Config) error {
+	before, err := revParse("HEAD")
+	if err != nil {
+		return fmt.Errorf("resolve HEAD failed: %w", err)
+	}
+
+	message := prMessage(cfg, pr, fmt.Sprintf("Merge PR #%d: %s", pr.Number, pr.Title))
+	args := []string{"merge", "--no-ff", "--no-edit", "-m", message}
+	if len(cfg.IgnorePaths) > 0 {
+		// Stop before committing so ignored paths can be restored first
+		args = append(args, "--no-commit")
+	}
+	mergeOutput, mergeErr := runBounded(exec.Command("git", append(args, branch)...))
+	if len(cfg.IgnorePaths) > 0 && runGitCommand("rev-parse", "--quiet", "--verify", "MERGE_HEAD") == nil {
+		files, err := restoreIgnoredPaths(cfg, getConflictingFiles())
+		if err != nil {
+			runGitCommand("merge", "--abort")
+			return err
+		}
+		if mergeErr != nil && len(files) == 0 && len(getConflictingFiles()) == 0 {
+			mergeErr = nil
+		}
+		if mergeErr == nil && runGitCommand("diff", "--cached", "--quiet", "HEAD") == nil {
+			// Nothing but ignored paths changed
+			runGitCommand("merge", "--abort")
+			return ErrEmptyMerge
+		}
+		if mergeErr == nil {
+			if err := runGitCommand("commit", "--no-edit", "-m", message); err != nil {
+				runGitCommand("merge", "--abort")
+				return fmt.Errorf("create merge commit failed: %w", err)
+			}
+		}
+	}
+	if mergeErr != nil {
+		files := getConflictingFiles()
+		if len(files) == 0 {
+			return fmt.Errorf("merge failed: %s", firstLine(mergeOutput))
+		}
+		if err := conflictError(cfg, files, mergeOutput); err != nil {
+			runGitCommand("merge", "--abort")
+			return err
+		}
+		if err := runGitCommand("commit", "--no-edit", "-m", message); err != nil {
+			runGitCommand("merge", "--abort")
+			return fmt.Errorf("create merge commit failed: %w", err)
+		}
+	}
+
+	// "Already up to date" succeeds without creating a commit
+	if after, err := revParse("HEAD"); err == nil && after == before {
+		return ErrEmptyMerge
+	}
+	return nil
+}
+
 // updateMergeHistory persists merge records
-func updateMergeHistory(merges []MergeRecord) {
-	if err := updateRefHistory(merges); err != nil {
+func updateMergeHistory(cfg Config, merges []MergeRecord, report *RunReport) {
+	if err := updateRefHistory(cfg, merges, report); err != nil {
 		log.Fatal("error updating history:", err)
 	}
 }
 
-// updateRefHistory writes merge history to file
-func updateRefHistory(merges []MergeRecord) error {
-	history := RefHistory{Merges: merges}
-	data, err := json.MarshalIndent(history, "", "  ")
+// mustSquashBatch enforces the single commit collapse of the batch
+func mustSquashBatch(cfg Config, prs []GitHubPR, merges []MergeRecord, report *RunReport) []MergeRecord {
+	merges, err := squashBatch(cfg, prs, merges, report)
+	if err != nil {
+		log.Fatal("error squashing batch:", err)
+	}
+	return merges
+}
+
+// squashBatch collapses the per-PR commits and the merge history into a single
+// commit on top of trunk. The history file cannot reference the commit it lives in,
+// so its records carry no commit; the returned records point at the batch commit.
+func squashBatch(cfg Config, prs []GitHubPR, merges []MergeRecord, report *RunReport) ([]MergeRecord, error) {
+	titles := make(map[int]string, len(prs))
+	for _, pr := range prs {
+		titles[pr.Number] = pr.Title
+	}
+
+	records := make([]MergeRecord, len(merges))
+	sources := make([]trailers.Source, len(merges))
+	var body strings.Builder
+	for i, m := range merges {
+		records[i] = MergeRecord{PR: m.PR, Head: m.Head, Timestamp: m.Timestamp}
+		sources[i] = trailers.Source{PR: m.PR, HeadSHA: m.Head}
+		fmt.Fprintf(&body, "- #%d %s\n", m.PR, titles[m.PR])
+	}
+
+	if err := runGitCommand("reset", "--soft", cfg.TrunkBranch); err != nil {
+		return nil, fmt.Errorf("reset to trunk failed: %w", err)
+	}
+	if err := stageRefHistory(cfg, records, report); err != nil {
+		return nil, err
+	}
+
+	subject := fmt.Sprintf("Merge %d PR(s) into %s", len(merges), cfg.TargetBranch)
+	message := withChangedPathTrailers(cfg, report, prCommitMessage(cfg, strings.TrimRight(body.String(), "\n"), sources...))
+	if err := runGitCommand("commit", "-m", subject, "-m", message); err != nil {
+		return nil, fmt.Errorf("create batch commit failed: %w", err)
+	}
+
+	head, err := revParse("HEAD")
+	if err != nil {
+		head = "unknown"
+	}
+	for i := range merges {
+		records[i].Commit = head
+	}
+	return records, nil
+}
+
+// updateRefHistory writes merge history to file and commits it
+func updateRefHistory(cfg Config, merges []MergeRecord, report *RunReport) error {
+	// The batch ID and build stamp change every run, only new merges are worth a commit
+	if previous, err := loadRefHistoryAt("HEAD"); err == nil && sameMerges(previous.Merges, merges) {
+		return nil
+	}
+	if err := stageRefHistory(cfg, merges, report); err != nil {
+		return err
+	}
+	// Without a readable history at HEAD, an identical file still leaves nothing to commit
+	if runGitCommand("diff", "--cached", "--quiet", "--", refHistoryFile) == nil {
+		return nil
+	}
+	message, err := historyCommitMessage(cfg, merges)
+	if err != nil {
+		return fmt.Errorf("history commit message failed: %w", err)
+	}
+	return runGitCommand("commit", "-m", withChangedPathTrailers(cfg, report, prCommitMessage(cfg, message)))
+}
+
+// sameMerges reports whether two histories record the same merges, whenever they were made
+func sameMerges(a, b []MergeRecord) bool {
+	return slices.EqualFunc(a, b, func(x, y MergeRecord) bool {
+		return x.PR == y.PR && x.Commit == y.Commit && x.Head == y.Head
+	})
+}
+
+// stageRefHistory writes merge history to file and stages it, with the deadline cutoff
+// and the policy decisions of the run report
+func stageRefHistory(cfg Config, merges []MergeRecord, report *RunReport) error {
+	history := RefHistory{BatchID: cfg.BatchID, Cutoff: report.Cutoff, Policy: report.Policy, Merges: merges}
+	if trunk, err := revParse(cfg.TrunkBranch + "^{commit}"); err == nil {
+		history.Stamp = &BuildStamp{BuiltAt: time.Now().UTC(), Trunk: trunk}
+	}
+	data, err := historyCodecs[cfg.HistoryFormat].encode(history)
 	if err != nil {
 		return fmt.Errorf("history serialization failed: %w", err)
 	}
@@ -504,12 +1836,7 @@ func updateRefHistory(merges []MergeRecord) error {
 	if err := runGitCommand("add", refHistoryFile); err != nil {
 		return fmt.Errorf("staging history file failed: %w", err)
 	}
-	return runGitCommand("commit", "-m", "chore: update ref-history")
-}
-
-// pushChanges pushes to remote repository
-func pushChanges(cfg Config) error {
-	return runGitCommand("push", "origin", cfg.TargetBranch, "--force")
+	return nil
 }
 
 // createMergeRecord generates merge metadata
@@ -522,6 +1849,7 @@ func createMergeRecord(pr GitHubPR) MergeRecord {
 	return MergeRecord{
 		PR:        pr.Number,
 		Commit:    commit,
+		Head:      prSource(pr).HeadSHA,
 		Timestamp: time.Now().UTC(),
 	}
 }
@@ -529,14 +1857,17 @@ func createMergeRecord(pr GitHubPR) MergeRecord {
 // setOutput writes a key=value pair to the GitHub Actions output file.
 // Errors are logged as warnings since output failure should not abort the action.
 func setOutput(cfg Config, name, value string) {
+	if cfg.GitHubOutput == "" {
+		return
+	}
 	f, err := os.OpenFile(cfg.GitHubOutput, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		log.Printf("warning: failed to open output file: %v", err)
+		slog.Warn("failed to open output file", "error", err)
 		return
 	}
 	defer f.Close()
 
 	if _, err := fmt.Fprintf(f, "%s=%s\n", name, value); err != nil {
-		log.Printf("warning: failed to write output '%s': %v", name, err)
+		slog.Warn("failed to write output", "output", name, "error", err)
 	}
 }
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josedpiambav/feature/mergebottest"
+)
+
+// botEnv makes the test binary run the bot instead of the tests, so the end-to-end
+// tests drive runBatch through its flags, log.Fatal exits included
+const botEnv = "MERGEBOTTEST_RUN_BOT"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(botEnv) != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runBot runs the bot in dir against srv and returns its combined output and the
+// content of its GitHub outputs file
+func runBot(t *testing.T, repo *mergebottest.Repo, srv *mergebottest.Server, dir string, args ...string) (string, string, error) {
+	t.Helper()
+	output := filepath.Join(t.TempDir(), "github_output")
+	base := []string{"--github_token", "test", "--owner", "o", "--repo", "r", "--state_dir", t.TempDir(), "--github_output", output}
+	cmd := exec.Command(os.Args[0], append(base, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(repo.Env(), botEnv+"=1", "GITHUB_API_URL="+srv.URL, "GITHUB_WORKSPACE="+dir)
+	out, err := cmd.CombinedOutput()
+	outputs, _ := os.ReadFile(output)
+	return string(out), string(outputs), err
+}
+
+func TestRunBatchMergesLabeledPRs(t *testing.T) {
+	repo := mergebottest.NewRepo(t, "main")
+	srv := mergebottest.NewServer()
+	defer srv.Close()
+
+	repo.PullRequest(1, "feat: one", map[string]string{"one.txt": "one\n"})
+	repo.PullRequest(2, "feat: two", map[string]string{"two.txt": "two\n"})
+	repo.PullRequest(3, "feat: three", map[string]string{"three.txt": "three\n"})
+	srv.AddPR(mergebottest.PR{Number: 1, Title: "feat: one", Base: "main", Author: "alice", Labels: []string{"ready"}})
+	srv.AddPR(mergebottest.PR{Number: 2, Title: "feat: two", Base: "main", Author: "bob", Labels: []string{"ready"}})
+	srv.AddPR(mergebottest.PR{Number: 3, Title: "feat: three", Base: "main", Author: "carol", Labels: []string{"wip"}})
+
+	out, outputs, err := runBot(t, repo, srv, repo.Clone(), "--labels", "ready")
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, out)
+	}
+
+	files := strings.Fields(repo.Git(repo.Origin, "ls-tree", "--name-only", "pre-main"))
+	for _, want := range []string{"README.md", "one.txt", "two.txt"} {
+		if !slices.Contains(files, want) {
+			t.Errorf("pre-main is missing %s, has %v", want, files)
+		}
+	}
+	if slices.Contains(files, "three.txt") {
+		t.Errorf("pre-main has three.txt of the unlabeled PR #3")
+	}
+	for _, want := range []string{"target_branch=pre-main\n", "batch_id="} {
+		if !strings.Contains(outputs, want) {
+			t.Errorf("outputs missing %q:\n%s", want, outputs)
+		}
+	}
+}
+
+func TestRunBatchRequiresGitHubOutput(t *testing.T) {
+	repo := mergebottest.NewRepo(t, "main")
+	srv := mergebottest.NewServer()
+	defer srv.Close()
+
+	cmd := exec.Command(os.Args[0], "--github_token", "test", "--owner", "o", "--repo", "r", "--labels", "ready")
+	cmd.Dir = repo.Clone()
+	cmd.Env = append(repo.Env(), botEnv+"=1", "GITHUB_API_URL="+srv.URL)
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("run without github_output succeeded:\n%s", out)
+	}
+	if !strings.Contains(string(out), "missing required parameter: 'github_output'") {
+		t.Errorf("unexpected error:\n%s", out)
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	for input, want := range map[string][]string{
+		"":                   {},
+		"needs qa":           {"needs qa"},
+		"ready, needs qa":    {"ready", "needs qa"},
+		`"qa, staging", wip`: {"qa, staging", "wip"},
+		"don't merge, wip":   {"don't merge", "wip"},
+		"In progress":        {"In progress"},
+	} {
+		if got := parseLabels(input); !slices.Equal(got, want) {
+			t.Errorf("parseLabels(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestRunBatchZeroMerges(t *testing.T) {
+	for _, tc := range []struct {
+		policy  string
+		wantErr string
+	}{
+		{policy: "trunk"},
+		{policy: "fail", wantErr: "no PR could be merged"},
+	} {
+		t.Run(tc.policy, func(t *testing.T) {
+			repo := mergebottest.NewRepo(t, "main")
+			srv := mergebottest.NewServer()
+			defer srv.Close()
+
+			repo.PullRequest(1, "docs: one", map[string]string{"README.md": "one\n"})
+			repo.PullRequest(2, "docs: two", map[string]string{"README.md": "two\n"})
+			trunk := repo.Commit("main", "docs: trunk", map[string]string{"README.md": "trunk\n"})
+			srv.AddPR(mergebottest.PR{Number: 1, Title: "docs: one", Base: "main", Author: "alice", Labels: []string{"ready"}})
+			srv.AddPR(mergebottest.PR{Number: 2, Title: "docs: two", Base: "main", Author: "bob", Labels: []string{"ready"}})
+
+			out, _, err := runBot(t, repo, srv, repo.Clone(), "--labels", "ready", "--zero_merges", tc.policy)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(out, tc.wantErr) {
+					t.Fatalf("run error = %v, want %q:\n%s", err, tc.wantErr, out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("run failed: %v\n%s", err, out)
+			}
+			if got := repo.Show("pre-main:README.md"); got != "trunk\n" {
+				t.Errorf("pre-main README.md = %q, want the trunk one (candidate %s)", got, trunk)
+			}
+		})
+	}
+}
+
+func TestRunBatchAbortsOnConflictAfterMerge(t *testing.T) {
+	repo := mergebottest.NewRepo(t, "main")
+	srv := mergebottest.NewServer()
+	defer srv.Close()
+
+	repo.PullRequest(1, "docs: one", map[string]string{"README.md": "one\n"})
+	repo.PullRequest(2, "feat: two", map[string]string{"two.txt": "two\n"})
+	repo.Commit("main", "docs: trunk", map[string]string{"README.md": "trunk\n"})
+	srv.AddPR(mergebottest.PR{Number: 1, Title: "docs: one", Base: "main", Author: "alice", Labels: []string{"ready"}})
+	srv.AddPR(mergebottest.PR{Number: 2, Title: "feat: two", Base: "main", Author: "bob", Labels: []string{"ready"}})
+
+	out, _, err := runBot(t, repo, srv, repo.Clone(), "--labels", "ready")
+	if err == nil || !strings.Contains(out, "PR #1 could not be merged") {
+		t.Fatalf("run error = %v, want the conflict of PR #1:\n%s", err, out)
+	}
+	if strings.Contains(repo.Git(repo.Origin, "branch", "--list", "pre-main"), "pre-main") {
+		t.Errorf("pre-main was published by an aborted batch")
+	}
+}
+
+func TestUpdateRefHistorySkipsUnchangedMerges(t *testing.T) {
+	repo := mergebottest.NewRepo(t, "main")
+	for _, kv := range repo.GitEnv() {
+		name, value, _ := strings.Cut(kv, "=")
+		t.Setenv(name, value)
+	}
+	t.Chdir(repo.Clone())
+	cfg, err := parseConfig(flag.NewFlagSet("run", flag.ContinueOnError), []string{"--github_token", "test", "--owner", "o", "--repo", "r"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	merges := []MergeRecord{{PR: 1, Commit: strings.Repeat("a", 40), Head: strings.Repeat("b", 40), Timestamp: time.Now().UTC()}}
+	if err := updateRefHistory(cfg, merges, &RunReport{}); err != nil {
+		t.Fatal(err)
+	}
+	head, _ := revParse("HEAD")
+
+	// A later run records the same merges at another time, under another batch ID
+	cfg.BatchID = newBatchID()
+	merges[0].Timestamp = merges[0].Timestamp.Add(time.Hour)
+	if err := updateRefHistory(cfg, merges, &RunReport{}); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := revParse("HEAD"); again != head {
+		t.Errorf("unchanged merges committed %s on top of %s", again, head)
+	}
+
+	merges = append(merges, MergeRecord{PR: 2, Commit: strings.Repeat("c", 40), Timestamp: time.Now().UTC()})
+	if err := updateRefHistory(cfg, merges, &RunReport{}); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := revParse("HEAD"); again == head {
+		t.Error("new merge record not committed")
+	}
+}
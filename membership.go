@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+)
+
+// syncMembershipLabel keeps the membership label on exactly the PRs published in the
+// target branch, so GitHub PR filters show the batch live. Labels are added before
+// stale ones are removed. Errors are logged as warnings since the branch is published.
+func syncMembershipLabel(client GitHubClient, cfg Config, merged []MergeRecord) {
+	labeled, err := client.ListLabeledPRs(cfg.MembershipLabel)
+	if err != nil {
+		slog.Warn("failed to list labeled PRs", "label", cfg.MembershipLabel, "error", err)
+		return
+	}
+
+	members := make([]int, len(merged))
+	for i, m := range merged {
+		members[i] = m.PR
+	}
+	added, removed := 0, 0
+	for _, n := range members {
+		if slices.Contains(labeled, n) {
+			continue
+		}
+		if err := client.AddLabel(n, cfg.MembershipLabel); err != nil {
+			slog.Warn("failed to label PR", "pr_number", n, "label", cfg.MembershipLabel, "error", err)
+			continue
+		}
+		added++
+	}
+	for _, n := range labeled {
+		if slices.Contains(members, n) {
+			continue
+		}
+		if err := client.RemoveLabel(n, cfg.MembershipLabel); err != nil {
+			slog.Warn("failed to remove label from PR", "label", cfg.MembershipLabel, "pr_number", n, "error", err)
+			continue
+		}
+		removed++
+	}
+	fmt.Printf("Membership label '%s': %d PR(s) in the batch, %d added, %d removed.\n",
+		cfg.MembershipLabel, len(members), added, removed)
+}
@@ -0,0 +1,67 @@
+package mergebottest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRepoPullRequest(t *testing.T) {
+	repo := NewRepo(t, "main")
+	head := repo.PullRequest(1, "feat: one", map[string]string{"one.txt": "one\n"})
+
+	if got := strings.TrimSpace(repo.Git(repo.Origin, "rev-parse", "refs/pull/1/head")); got != head {
+		t.Errorf("refs/pull/1/head = %s, want %s", got, head)
+	}
+	if got := repo.Show("refs/pull/1/head:one.txt"); got != "one\n" {
+		t.Errorf("one.txt = %q, want %q", got, "one\n")
+	}
+	if got := repo.Log("main"); len(got) != 1 || got[0] != "initial commit" {
+		t.Errorf("main log = %v, want the initial commit only", got)
+	}
+
+	merge := repo.TestMerge(1)
+	if got := strings.TrimSpace(repo.Git(repo.Origin, "rev-parse", "refs/pull/1/merge^2")); got != head {
+		t.Errorf("refs/pull/1/merge %s does not merge the head %s", merge, head)
+	}
+	if got := repo.Show(repo.Trunk + ":README.md"); got != "# test repository\n" {
+		t.Errorf("README.md = %q", got)
+	}
+}
+
+func TestServerListPulls(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.AddPR(PR{Number: 1, Title: "feat: one", Base: "main", Author: "alice", Labels: []string{"ready"}})
+	srv.AddPR(PR{Number: 2, Title: "closed", Base: "main", State: "closed"})
+
+	resp, err := http.Get(srv.URL + "/repos/o/r/pulls?state=open&base=main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	var pulls []struct {
+		Number int `json:"number"`
+		Head   struct {
+			Ref string `json:"ref"`
+		} `json:"head"`
+		Labels []struct {
+			Name string `json:"name"`
+		} `json:"labels"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&pulls); err != nil {
+		t.Fatal(err)
+	}
+	if len(pulls) != 1 || pulls[0].Number != 1 || pulls[0].Head.Ref != "pr-1" || len(pulls[0].Labels) != 1 || pulls[0].Labels[0].Name != "ready" {
+		t.Errorf("open pulls = %+v, want only #1 on pr-1 labeled ready", pulls)
+	}
+
+	requests := srv.Requests()
+	if len(requests) != 1 || requests[0].Method != http.MethodGet || requests[0].Path != "/repos/o/r/pulls?state=open&base=main" {
+		t.Errorf("requests = %+v", requests)
+	}
+}
@@ -0,0 +1,184 @@
+package mergebottest
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Repo is a temporary git repository pair: a bare origin holding trunk and
+// refs/pull/N/head refs, and a scratch working copy used to author commits.
+type Repo struct {
+	// Origin is the path of the bare repository acting as the GitHub remote
+	Origin string
+	// Trunk is the name of the base branch
+	Trunk string
+
+	t       testing.TB
+	root    string
+	scratch string
+}
+
+// NewRepo creates an origin whose trunk branch holds a single initial commit.
+// All directories are removed when the test finishes.
+func NewRepo(t testing.TB, trunk string) *Repo {
+	t.Helper()
+	root := t.TempDir()
+	r := &Repo{
+		Origin:  filepath.Join(root, "origin.git"),
+		Trunk:   trunk,
+		t:       t,
+		root:    root,
+		scratch: filepath.Join(root, "scratch"),
+	}
+
+	r.git(root, "init", "--bare", "--initial-branch", trunk, r.Origin)
+	r.git(root, "clone", r.Origin, r.scratch)
+	r.git(r.scratch, "checkout", "-B", trunk)
+	r.Commit(trunk, "initial commit", map[string]string{"README.md": "# test repository\n"})
+	return r
+}
+
+// Env returns environment variables isolating git from the user's configuration.
+// Pass them to the bot process so its global git config writes stay in the sandbox.
+func (r *Repo) Env() []string {
+	return append(os.Environ(), r.GitEnv()...)
+}
+
+// GitEnv returns only the variables Env adds to the environment, for tests running
+// git in-process through t.Setenv
+func (r *Repo) GitEnv() []string {
+	return []string{
+		"GIT_CONFIG_GLOBAL=" + filepath.Join(r.root, "gitconfig"),
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=mergebottest",
+		"GIT_AUTHOR_EMAIL=mergebottest@example.com",
+		"GIT_COMMITTER_NAME=mergebottest",
+		"GIT_COMMITTER_EMAIL=mergebottest@example.com",
+	}
+}
+
+// Commit writes files on top of branch (created from trunk if missing) and pushes it to origin.
+// A file mapped to the empty string is deleted. Returns the new commit SHA.
+func (r *Repo) Commit(branch, message string, files map[string]string) string {
+	r.t.Helper()
+	if r.refExists("refs/remotes/origin/" + branch) {
+		r.git(r.scratch, "checkout", "-B", branch, "origin/"+branch)
+	} else if branch != r.Trunk {
+		r.git(r.scratch, "checkout", "-B", branch, "origin/"+r.Trunk)
+	}
+
+	r.writeFiles(files)
+	r.git(r.scratch, "commit", "--allow-empty", "-m", message)
+	r.git(r.scratch, "push", "--force", "origin", "HEAD:refs/heads/"+branch)
+	r.git(r.scratch, "fetch", "origin")
+	return r.Head()
+}
+
+// PullRequest commits files on a branch based on trunk and publishes it as
+// refs/pull/N/head, the ref GitHub exposes for pull request heads.
+// Returns the PR head SHA.
+func (r *Repo) PullRequest(number int, message string, files map[string]string) string {
+	r.t.Helper()
+	branch := fmt.Sprintf("feature-%d", number)
+	sha := r.Commit(branch, message, files)
+	r.git(r.scratch, "push", "--force", "origin", fmt.Sprintf("%s:refs/pull/%d/head", sha, number))
+	return sha
+}
+
+// TestMerge publishes refs/pull/N/merge, the merge of trunk and the PR head that
+// GitHub precomputes for PRs without conflicts. Returns the merge commit SHA.
+func (r *Repo) TestMerge(number int) string {
+	r.t.Helper()
+	r.git(r.scratch, "fetch", "origin", fmt.Sprintf("refs/pull/%d/head", number))
+	r.git(r.scratch, "checkout", "--detach", "origin/"+r.Trunk)
+	r.git(r.scratch, "merge", "--no-ff", "--no-edit", "FETCH_HEAD")
+	r.git(r.scratch, "push", "--force", "origin", fmt.Sprintf("HEAD:refs/pull/%d/merge", number))
+	return r.Head()
+}
+
+// Clone returns a fresh working copy of origin with trunk checked out,
+// equivalent to what actions/checkout provides to the bot.
+func (r *Repo) Clone() string {
+	r.t.Helper()
+	dir, err := os.MkdirTemp(r.root, "clone-")
+	if err != nil {
+		r.t.Fatalf("create clone dir: %v", err)
+	}
+	r.git(r.root, "clone", "--branch", r.Trunk, r.Origin, dir)
+	return dir
+}
+
+// Head returns the commit SHA checked out in the scratch working copy
+func (r *Repo) Head() string {
+	return strings.TrimSpace(r.git(r.scratch, "rev-parse", "HEAD"))
+}
+
+// Show returns the content of path at rev in origin (e.g. "pre-main:.ref-history")
+func (r *Repo) Show(rev string) string {
+	r.t.Helper()
+	return r.git(r.Origin, "show", rev)
+}
+
+// Log returns the subjects of the commits reachable from rev in origin, newest first
+func (r *Repo) Log(rev string) []string {
+	r.t.Helper()
+	out := strings.TrimSpace(r.git(r.Origin, "log", "--format=%s", rev))
+	if out == "" {
+		return nil
+	}
+	return strings.Split(out, "\n")
+}
+
+// Git runs a git command inside dir with the isolated environment and returns its output
+func (r *Repo) Git(dir string, args ...string) string {
+	r.t.Helper()
+	return r.git(dir, args...)
+}
+
+func (r *Repo) git(dir string, args ...string) string {
+	r.t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = r.Env()
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		r.t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+func (r *Repo) refExists(ref string) bool {
+	cmd := exec.Command("git", "show-ref", "--verify", "--quiet", ref)
+	cmd.Dir = r.scratch
+	cmd.Env = r.Env()
+	return cmd.Run() == nil
+}
+
+func (r *Repo) writeFiles(files map[string]string) {
+	r.t.Helper()
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		full := filepath.Join(r.scratch, p)
+		if files[p] == "" {
+			r.git(r.scratch, "rm", "-q", "--ignore-unmatch", p)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			r.t.Fatalf("create dir for %s: %v", p, err)
+		}
+		if err := os.WriteFile(full, []byte(files[p]), 0644); err != nil {
+			r.t.Fatalf("write %s: %v", p, err)
+		}
+		r.git(r.scratch, "add", p)
+	}
+}
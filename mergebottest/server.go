@@ -0,0 +1,1344 @@
+// Package mergebottest provides hermetic fixtures for exercising the feature
+// branching pipeline: a fake GitHub API server and a temporary git repository
+// builder exposing pull request refs the same way GitHub does.
+//
+// Point the bot at the fake server through the GITHUB_API_URL environment
+// variable and run it inside a clone returned by Repo.Clone.
+package mergebottest
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PR is a pull request served by the fake API
+type PR struct {
+	Number    int       // PR number
+	Title     string    // PR title
+	State     string    // PR state, defaults to "open"
+	Base      string    // Base branch reference
+	Head      string    // Head branch name, defaults to pr-N as pushed by Repo.PullRequest
+	Draft     bool      // Draft PRs cannot be merged
+	Author    string    // Author login
+	Labels    []string  // Label names
+	Body      string    // Description
+	HeadSHA   string    // Head commit, reported as head.sha when set
+	CreatedAt time.Time // Creation time, defaults to the insertion time
+}
+
+// Repository is an organization repository served by the fake API
+type Repository struct {
+	Owner         string   // Organization login
+	Name          string   // Repository name
+	CloneURL      string   // Clone URL, usually a Repo.Origin path
+	DefaultBranch string   // Default branch, defaults to main
+	Topics        []string // Repository topics
+	Archived      bool     // Archived repositories are read-only
+}
+
+// Comment is an issue or pull request comment stored by the fake API
+type Comment struct {
+	ID     int64  // Comment ID
+	Number int    // Issue or PR number the comment belongs to
+	Body   string // Comment body
+	// AuthorAssociation is the commenter's role (OWNER, MEMBER, ...); empty for API-created comments
+	AuthorAssociation string
+}
+
+// Issue is an issue stored by the fake API
+type Issue struct {
+	Number    int      // Issue number
+	Title     string   // Issue title
+	Body      string   // Issue body
+	State     string   // Issue state (open/closed)
+	Labels    []string // Label names
+	Assignees []string // Assignee logins
+}
+
+// CheckRun is a check run of a commit stored by the fake API
+type CheckRun struct {
+	Name       string // Check name
+	Status     string // queued, in_progress or completed, defaults to completed
+	Conclusion string // Outcome of a completed run
+}
+
+// QueueEntry is a merge queue entry served by the fake GraphQL API
+type QueueEntry struct {
+	Number  int    // PR number
+	HeadSHA string // Head commit the queue merges
+	State   string // Entry state, defaults to QUEUED
+}
+
+// Ruleset is a repository ruleset served by the fake API
+type Ruleset struct {
+	ID       int64    // Ruleset ID
+	Name     string   // Ruleset name
+	Branches []string // Branches the ruleset applies to
+	Rules    []string // Rule types (required_signatures, non_fast_forward, ...)
+	Bypass   string   // current_user_can_bypass, defaults to never
+	Actors   []string // Bypass actors as type:id, of the rulesets created through the API
+	Checks   []string // Required status check contexts, of the rulesets created through the API
+}
+
+// Installation is a GitHub App installation minting tokens through the fake API
+type Installation struct {
+	ID           int64             // Installation ID
+	AppID        int64             // App the installation belongs to
+	Key          *rsa.PublicKey    // Verifies the signature of the app JWT when set
+	Permissions  map[string]string // Permissions of the app, the most a token may request
+	Repositories []string          // Repositories of the installation
+	TokenTTL     time.Duration     // Lifetime of the minted tokens, defaults to an hour
+}
+
+// Project is a Projects (v2) board served by the fake GraphQL API
+type Project struct {
+	Owner   string   // User or organization login
+	Number  int      // Project number
+	Title   string   // Project title
+	Field   string   // Single select field name, defaults to Status
+	Options []string // Options of the field
+}
+
+// project is a registered board with its items, by item ID
+type project struct {
+	Project
+	items  map[string]int    // PR number of every item
+	repos  map[string]string // Repository of every item, as owner/name
+	values map[string]string // Option of every item
+}
+
+// Fault makes the fake API fail matching requests, e.g. to rehearse GitHub outages
+type Fault struct {
+	Method string // HTTP method matched, any when empty
+	Path   string // Path prefix matched, such as /repos/o/r/pulls, any when empty
+	Status int    // Response status; 403 and 429 answer as an exhausted rate limit
+	Times  int    // Matching requests failed before the fault clears, all of them when 0
+}
+
+// Request records a call received by the fake API
+type Request struct {
+	Method string // HTTP method
+	Path   string // Request path including the query string
+	Body   string // Raw request body
+}
+
+// Server is a fake GitHub REST API backed by in-memory fixtures
+type Server struct {
+	*httptest.Server
+
+	// OnUpdateBranch, when set, is called for every accepted update-branch request,
+	// typically to push the updated head through Repo.PullRequest
+	OnUpdateBranch func(number int)
+	// OnCreatePull, when set, is called for every PR opened through the API, typically
+	// to publish its head as refs/pull/N/head the way GitHub does
+	OnCreatePull func(pr PR)
+
+	mu       sync.Mutex
+	prs      map[int]PR
+	repos    []Repository
+	issues   map[int]*Issue
+	comments []*Comment
+	perms    map[string]string
+	checks   map[string][]CheckRun
+	queues   map[string][]QueueEntry
+	rulesets []Ruleset
+	installs []Installation
+	projects []*project
+	nextID   int64
+	requests []Request
+	faults   []*Fault
+}
+
+// NewServer starts a fake GitHub API server. Call Close when done.
+func NewServer() *Server {
+	s := &Server{
+		prs:    make(map[int]PR),
+		issues: make(map[int]*Issue),
+		perms:  make(map[string]string),
+		checks: make(map[string][]CheckRun),
+		queues: make(map[string][]QueueEntry),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /orgs/{org}/repos", s.listOrgRepos)
+	mux.HandleFunc("GET /repos/{owner}/{repo}", s.getRepository)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/pulls", s.listPulls)
+	mux.HandleFunc("POST /repos/{owner}/{repo}/pulls", s.createPull)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/pulls/{number}", s.getPull)
+	mux.HandleFunc("PATCH /repos/{owner}/{repo}/pulls/{number}", s.updatePull)
+	mux.HandleFunc("PUT /repos/{owner}/{repo}/pulls/{number}/update-branch", s.updateBranch)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/issues", s.listIssues)
+	mux.HandleFunc("POST /repos/{owner}/{repo}/issues", s.createIssue)
+	mux.HandleFunc("PATCH /repos/{owner}/{repo}/issues/{number}", s.updateIssue)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/issues/{number}/comments", s.listComments)
+	mux.HandleFunc("POST /repos/{owner}/{repo}/issues/{number}/comments", s.createComment)
+	mux.HandleFunc("PATCH /repos/{owner}/{repo}/issues/comments/{id}", s.updateComment)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/collaborators/{user}/permission", s.getPermission)
+	mux.HandleFunc("POST /repos/{owner}/{repo}/issues/{number}/labels", s.addLabels)
+	mux.HandleFunc("DELETE /repos/{owner}/{repo}/issues/{number}/labels/{name}", s.removeLabel)
+	mux.HandleFunc("DELETE /repos/{owner}/{repo}/labels/{name}", s.deleteLabel)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/commits/{ref}/check-runs", s.listCheckRuns)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/rules/branches/{branch...}", s.listBranchRules)
+	mux.HandleFunc("POST /app/installations/{id}/access_tokens", s.createInstallationToken)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/rulesets", s.listRulesets)
+	mux.HandleFunc("POST /repos/{owner}/{repo}/rulesets", s.createRuleset)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/rulesets/{id}", s.getRuleset)
+	mux.HandleFunc("PUT /repos/{owner}/{repo}/rulesets/{id}", s.updateRuleset)
+	mux.HandleFunc("POST /graphql", s.graphql)
+
+	s.Server = httptest.NewServer(s.record(mux))
+	return s
+}
+
+// AddPR registers a pull request fixture
+func (s *Server) AddPR(pr PR) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if pr.State == "" {
+		pr.State = "open"
+	}
+	if pr.CreatedAt.IsZero() {
+		pr.CreatedAt = time.Now().UTC().Add(time.Duration(len(s.prs)) * time.Second)
+	}
+	s.prs[pr.Number] = pr
+}
+
+// AddRepository registers an organization repository fixture
+func (s *Server) AddRepository(repo Repository) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.repos = append(s.repos, repo)
+}
+
+// AddCheckRun records a check run on a commit SHA
+func (s *Server) AddCheckRun(sha string, run CheckRun) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if run.Status == "" {
+		run.Status = "completed"
+	}
+	s.checks[sha] = append(s.checks[sha], run)
+}
+
+// Enqueue appends a PR to the merge queue of branch
+func (s *Server) Enqueue(branch string, entry QueueEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry.State == "" {
+		entry.State = "QUEUED"
+	}
+	s.queues[branch] = append(s.queues[branch], entry)
+}
+
+// AddRuleset registers an active ruleset
+func (s *Server) AddRuleset(ruleset Ruleset) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ruleset.Bypass == "" {
+		ruleset.Bypass = "never"
+	}
+	s.rulesets = append(s.rulesets, ruleset)
+}
+
+// AddProject registers a Projects (v2) board
+func (s *Server) AddProject(p Project) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p.Field == "" {
+		p.Field = "Status"
+	}
+	s.projects = append(s.projects, &project{Project: p, items: make(map[string]int), repos: make(map[string]string), values: make(map[string]string)})
+}
+
+// ProjectColumns returns the option of every PR item of a project, empty when unset
+func (s *Server) ProjectColumns(owner string, number int) map[int]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[int]string)
+	for _, p := range s.projects {
+		if p.Owner == owner && p.Number == number {
+			for id, pr := range p.items {
+				out[pr] = p.values[id]
+			}
+		}
+	}
+	return out
+}
+
+// AddInstallation registers a GitHub App installation the bot may mint tokens from
+func (s *Server) AddInstallation(installation Installation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.installs = append(s.installs, installation)
+}
+
+// SetPermission grants a user a repository role (admin, maintain, write, triage or read).
+// Users without a role have no permission.
+func (s *Server) SetPermission(user, role string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.perms[user] = role
+}
+
+// AddComment posts a comment as another user, e.g. a maintainer approving a plan.
+// The comment ID is assigned by the server and returned.
+func (s *Server) AddComment(c Comment) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	c.ID = s.nextID
+	s.comments = append(s.comments, &c)
+	return c.ID
+}
+
+// Comments returns the comments posted on an issue or PR
+func (s *Server) Comments(number int) []Comment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Comment
+	for _, c := range s.comments {
+		if c.Number == number {
+			out = append(out, *c)
+		}
+	}
+	return out
+}
+
+// PRs returns all pull requests, ordered by number
+func (s *Server) PRs() []PR {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]PR, 0, len(s.prs))
+	for _, pr := range s.prs {
+		out = append(out, pr)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Number < out[j].Number })
+	return out
+}
+
+// Issues returns all issues created through the API, ordered by number
+func (s *Server) Issues() []Issue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Issue, 0, len(s.issues))
+	for _, issue := range s.issues {
+		out = append(out, *issue)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Number < out[j].Number })
+	return out
+}
+
+// Rulesets returns the registered rulesets and the ones created through the API
+func (s *Server) Rulesets() []Ruleset {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Ruleset(nil), s.rulesets...)
+}
+
+// Requests returns every call received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// InjectFault fails the requests matching the fault until it clears
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// fault returns the status of the first fault matching a request, consuming one of its
+// failures, or 0 when the request goes through
+func (s *Server) fault(r *http.Request) int {
+	for i, f := range s.faults {
+		if (f.Method != "" && f.Method != r.Method) || !strings.HasPrefix(r.URL.Path, f.Path) {
+			continue
+		}
+		if f.Times > 0 {
+			if f.Times--; f.Times == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		return f.Status
+	}
+	return 0
+}
+
+// record wraps a handler to log every received request and to answer the injected faults
+func (s *Server) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		s.mu.Lock()
+		s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.RequestURI(), Body: string(body)})
+		status := s.fault(r)
+		s.mu.Unlock()
+		switch status {
+		case 0:
+			next.ServeHTTP(w, r)
+		case http.StatusForbidden, http.StatusTooManyRequests:
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+			w.Header().Set("Retry-After", "60")
+			writeJSON(w, status, map[string]string{"message": "API rate limit exceeded"})
+		default:
+			writeJSON(w, status, map[string]string{"message": http.StatusText(status)})
+		}
+	})
+}
+
+func (s *Server) listOrgRepos(w http.ResponseWriter, r *http.Request) {
+	org := r.PathValue("org")
+	s.mu.Lock()
+	var repos []Repository
+	for _, repo := range s.repos {
+		if strings.EqualFold(repo.Owner, org) {
+			repos = append(repos, repo)
+		}
+	}
+	s.mu.Unlock()
+
+	payload := make([]map[string]any, 0, len(repos))
+	for _, repo := range paginate(repos, r.URL.Query()) {
+		topics := repo.Topics
+		if topics == nil {
+			topics = []string{}
+		}
+		payload = append(payload, map[string]any{
+			"name":      repo.Name,
+			"full_name": repo.Owner + "/" + repo.Name,
+			"clone_url": repo.CloneURL,
+			"topics":    topics,
+			"archived":  repo.Archived,
+		})
+	}
+	writeJSON(w, http.StatusOK, payload)
+}
+
+func (s *Server) getRepository(w http.ResponseWriter, r *http.Request) {
+	owner, name := r.PathValue("owner"), r.PathValue("repo")
+	s.mu.Lock()
+	i := slices.IndexFunc(s.repos, func(repo Repository) bool {
+		return strings.EqualFold(repo.Owner, owner) && strings.EqualFold(repo.Name, name)
+	})
+	var repo Repository
+	if i >= 0 {
+		repo = s.repos[i]
+	}
+	s.mu.Unlock()
+
+	if i < 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return
+	}
+	if repo.DefaultBranch == "" {
+		repo.DefaultBranch = "main"
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"name":           repo.Name,
+		"full_name":      repo.Owner + "/" + repo.Name,
+		"clone_url":      repo.CloneURL,
+		"default_branch": repo.DefaultBranch,
+		"archived":       repo.Archived,
+	})
+}
+
+func (s *Server) createPull(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Title string `json:"title"`
+		Head  string `json:"head"`
+		Base  string `json:"base"`
+		Body  string `json:"body"`
+		Draft bool   `json:"draft"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+	if in.Title == "" || in.Head == "" || in.Base == "" {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "Validation Failed"})
+		return
+	}
+
+	s.mu.Lock()
+	pr := PR{
+		Number:    s.nextNumber(),
+		Title:     in.Title,
+		State:     "open",
+		Base:      in.Base,
+		Head:      in.Head,
+		Draft:     in.Draft,
+		Author:    "mergebottest",
+		Body:      in.Body,
+		CreatedAt: time.Now().UTC().Add(time.Duration(len(s.prs)) * time.Second),
+	}
+	s.prs[pr.Number] = pr
+	s.mu.Unlock()
+
+	if s.OnCreatePull != nil {
+		s.OnCreatePull(pr)
+	}
+	writeJSON(w, http.StatusCreated, pullPayload(pr))
+}
+
+func (s *Server) listPulls(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	state := q.Get("state")
+	if state == "" {
+		state = "open"
+	}
+	base := q.Get("base")
+
+	s.mu.Lock()
+	var prs []PR
+	for _, pr := range s.prs {
+		if (state == "all" || pr.State == state) && (base == "" || pr.Base == base) {
+			prs = append(prs, pr)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(prs, func(i, j int) bool { return prs[i].CreatedAt.Before(prs[j].CreatedAt) })
+	if q.Get("direction") == "desc" {
+		for i, j := 0, len(prs)-1; i < j; i, j = i+1, j-1 {
+			prs[i], prs[j] = prs[j], prs[i]
+		}
+	}
+
+	payload := make([]map[string]any, 0, len(prs))
+	for _, pr := range paginate(prs, q) {
+		payload = append(payload, pullPayload(pr))
+	}
+	writeJSON(w, http.StatusOK, payload)
+}
+
+func (s *Server) updatePull(w http.ResponseWriter, r *http.Request) {
+	number, _ := strconv.Atoi(r.PathValue("number"))
+	var in struct {
+		Title *string `json:"title"`
+		Body  *string `json:"body"`
+		State *string `json:"state"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	pr, ok := s.prs[number]
+	if ok {
+		if in.Title != nil {
+			pr.Title = *in.Title
+		}
+		if in.Body != nil {
+			pr.Body = *in.Body
+		}
+		if in.State != nil {
+			pr.State = *in.State
+		}
+		s.prs[number] = pr
+	}
+	s.mu.Unlock()
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, pullPayload(pr))
+}
+
+func (s *Server) getPull(w http.ResponseWriter, r *http.Request) {
+	number, _ := strconv.Atoi(r.PathValue("number"))
+	s.mu.Lock()
+	pr, ok := s.prs[number]
+	s.mu.Unlock()
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, pullPayload(pr))
+}
+
+func (s *Server) updateBranch(w http.ResponseWriter, r *http.Request) {
+	number, _ := strconv.Atoi(r.PathValue("number"))
+	s.mu.Lock()
+	_, ok := s.prs[number]
+	s.mu.Unlock()
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return
+	}
+	if s.OnUpdateBranch != nil {
+		s.OnUpdateBranch(number)
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"message": "Updating pull request branch."})
+}
+
+func (s *Server) getPermission(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	role, ok := s.perms[r.PathValue("user")]
+	s.mu.Unlock()
+	if !ok {
+		role = "none"
+	}
+	// Like GitHub, permission folds maintain into write and triage into read
+	permission := role
+	switch role {
+	case "maintain":
+		permission = "write"
+	case "triage":
+		permission = "read"
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"permission": permission, "role_name": role})
+}
+
+// graphqlRequest is a GraphQL query with the variables of every query the bot sends
+type graphqlRequest struct {
+	Query     string `json:"query"`
+	Variables struct {
+		Branch  string  `json:"branch"`
+		Owner   string  `json:"owner"`
+		Repo    string  `json:"repo"`
+		Number  int     `json:"number"`
+		Field   string  `json:"field"`
+		Project string  `json:"project"`
+		Content string  `json:"content"`
+		Item    string  `json:"item"`
+		Option  string  `json:"option"`
+		After   *string `json:"after"`
+	} `json:"variables"`
+}
+
+// graphql answers the merge queue and project queries the bot sends, told apart by their query
+func (s *Server) graphql(w http.ResponseWriter, r *http.Request) {
+	var req graphqlRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": "invalid body"})
+		return
+	}
+	if !strings.Contains(req.Query, "mergeQueue") {
+		s.projectGraphQL(w, req)
+		return
+	}
+	s.mu.Lock()
+	entries := s.queues[req.Variables.Branch]
+	s.mu.Unlock()
+	nodes := make([]map[string]any, 0, len(entries))
+	for i, e := range entries {
+		nodes = append(nodes, map[string]any{
+			"position":    i + 1,
+			"state":       e.State,
+			"pullRequest": map[string]any{"number": e.Number, "headRefOid": e.HeadSHA},
+		})
+	}
+	queue := map[string]any{"entries": map[string]any{
+		"nodes":    nodes,
+		"pageInfo": map[string]any{"hasNextPage": false, "endCursor": nil},
+	}}
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"repository": map[string]any{"mergeQueue": queue}}})
+}
+
+// projectGraphQL answers the project queries and mutations, identified by their root field
+func (s *Server) projectGraphQL(w http.ResponseWriter, req graphqlRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := req.Variables
+	var data any
+	switch {
+	case strings.Contains(req.Query, "projectV2(number"):
+		var node any
+		for _, p := range s.projects {
+			if p.Owner != v.Owner || p.Number != v.Number {
+				continue
+			}
+			field := map[string]any{}
+			if p.Field == v.Field {
+				options := make([]map[string]string, len(p.Options))
+				for i, o := range p.Options {
+					options[i] = map[string]string{"id": projectOptionID(p, o), "name": o}
+				}
+				field = map[string]any{"id": projectNodeID(p) + "_field", "options": options}
+			}
+			node = map[string]any{"id": projectNodeID(p), "title": p.Title, "field": field}
+		}
+		data = map[string]any{"repositoryOwner": map[string]any{"projectV2": node}}
+	case strings.Contains(req.Query, "items(first"):
+		p := s.projectByID(v.Project)
+		var nodes []map[string]any
+		if p != nil {
+			for _, id := range slices.Sorted(maps.Keys(p.items)) {
+				number := p.items[id]
+				state := "OPEN"
+				switch s.prs[number].State {
+				case "closed":
+					state = "CLOSED"
+				case "merged":
+					state = "MERGED"
+				}
+				var value any
+				if o := p.values[id]; o != "" {
+					value = map[string]string{"name": o}
+				}
+				nodes = append(nodes, map[string]any{
+					"id":               id,
+					"fieldValueByName": value,
+					"content":          map[string]any{"number": number, "state": state, "repository": map[string]string{"nameWithOwner": p.repos[id]}},
+				})
+			}
+		}
+		data = map[string]any{"node": map[string]any{"items": map[string]any{
+			"nodes":    nodes,
+			"pageInfo": map[string]any{"hasNextPage": false, "endCursor": nil},
+		}}}
+	case strings.Contains(req.Query, "pullRequest(number"):
+		var pr any
+		if _, ok := s.prs[v.Number]; ok {
+			pr = map[string]string{"id": fmt.Sprintf("PR_%s/%s_%d", v.Owner, v.Repo, v.Number)}
+		}
+		data = map[string]any{"repository": map[string]any{"pullRequest": pr}}
+	case strings.Contains(req.Query, "addProjectV2ItemById"):
+		p := s.projectByID(v.Project)
+		content := strings.TrimPrefix(v.Content, "PR_")
+		i := strings.LastIndex(content, "_")
+		number, err := strconv.Atoi(content[i+1:])
+		repo := content[:max(i, 0)]
+		if p == nil || err != nil {
+			writeJSON(w, http.StatusOK, map[string]any{"errors": []map[string]string{{"message": "could not resolve to a node"}}})
+			return
+		}
+		id := fmt.Sprintf("%s_item_%d", projectNodeID(p), number)
+		p.items[id], p.repos[id] = number, repo
+		data = map[string]any{"addProjectV2ItemById": map[string]any{"item": map[string]string{"id": id}}}
+	case strings.Contains(req.Query, "updateProjectV2ItemFieldValue"):
+		p := s.projectByID(v.Project)
+		if p == nil || p.items[v.Item] == 0 {
+			writeJSON(w, http.StatusOK, map[string]any{"errors": []map[string]string{{"message": "could not resolve to a node"}}})
+			return
+		}
+		for _, o := range p.Options {
+			if projectOptionID(p, o) == v.Option {
+				p.values[v.Item] = o
+			}
+		}
+		data = map[string]any{"updateProjectV2ItemFieldValue": map[string]any{"projectV2Item": map[string]string{"id": v.Item}}}
+	default:
+		writeJSON(w, http.StatusOK, map[string]any{"errors": []map[string]string{{"message": "unsupported query"}}})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"data": data})
+}
+
+// projectByID returns the project of a node ID, nil when unknown
+func (s *Server) projectByID(id string) *project {
+	for _, p := range s.projects {
+		if projectNodeID(p) == id {
+			return p
+		}
+	}
+	return nil
+}
+
+func projectNodeID(p *project) string { return fmt.Sprintf("PVT_%s_%d", p.Owner, p.Number) }
+
+func projectOptionID(p *project, option string) string {
+	return fmt.Sprintf("%s_option_%d", projectNodeID(p), slices.Index(p.Options, option))
+}
+
+func (s *Server) listCheckRuns(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	runs := s.checks[r.PathValue("ref")]
+	s.mu.Unlock()
+	out := make([]map[string]any, 0, len(runs))
+	for _, run := range runs {
+		out = append(out, map[string]any{"name": run.Name, "status": run.Status, "conclusion": run.Conclusion})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"total_count": len(out), "check_runs": out})
+}
+
+func (s *Server) listBranchRules(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	branch := r.PathValue("branch")
+	source := r.PathValue("owner") + "/" + r.PathValue("repo")
+	var rules []map[string]any
+	for _, ruleset := range s.rulesets {
+		if !slices.Contains(ruleset.Branches, branch) {
+			continue
+		}
+		for _, rule := range ruleset.Rules {
+			rules = append(rules, map[string]any{
+				"type": rule, "ruleset_source_type": "Repository", "ruleset_source": source, "ruleset_id": ruleset.ID,
+			})
+		}
+	}
+	writeJSON(w, http.StatusOK, paginate(rules, r.URL.Query()))
+}
+
+// createInstallationToken mints a token like GitHub does: the app JWT must be valid and the
+// requested permissions within the ones of the app, a write grant covering a read request
+func (s *Server) createInstallationToken(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	var body struct {
+		Repositories []string          `json:"repositories"`
+		Permissions  map[string]string `json:"permissions"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx := slices.IndexFunc(s.installs, func(i Installation) bool { return i.ID == id })
+	if idx < 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return
+	}
+	installation := s.installs[idx]
+	jwt, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || verifyAppJWT(jwt, installation) != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"message": "A JSON web token could not be decoded"})
+		return
+	}
+
+	permissions := body.Permissions
+	if permissions == nil {
+		permissions = installation.Permissions
+	}
+	for name, level := range permissions {
+		granted := installation.Permissions[name]
+		if granted == "" || (level == "write" && granted != "write") {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{
+				"message": fmt.Sprintf("The permissions requested are not granted to this installation: %s:%s", name, level),
+			})
+			return
+		}
+	}
+	repositories := body.Repositories
+	if repositories == nil {
+		repositories = installation.Repositories
+	}
+	var repos []map[string]any
+	for _, name := range repositories {
+		if !slices.Contains(installation.Repositories, name) {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "There is at least one repository that does not exist or is not accessible"})
+			return
+		}
+		repos = append(repos, map[string]any{"name": name})
+	}
+	ttl := installation.TokenTTL
+	if ttl == 0 {
+		ttl = time.Hour
+	}
+	s.nextID++
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"token":        fmt.Sprintf("ghs_fake%d", s.nextID),
+		"expires_at":   time.Now().Add(ttl).UTC().Format(time.RFC3339),
+		"permissions":  permissions,
+		"repositories": repos,
+	})
+}
+
+// verifyAppJWT checks the issuer and expiry of an app JWT, and its signature when the
+// installation has a key
+func verifyAppJWT(jwt string, installation Installation) error {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed JWT")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return err
+	}
+	var claims struct {
+		Issuer    string `json:"iss"`
+		ExpiresAt int64  `json:"exp"`
+	}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return err
+	}
+	if claims.Issuer != strconv.FormatInt(installation.AppID, 10) || time.Now().Unix() >= claims.ExpiresAt {
+		return fmt.Errorf("invalid claims")
+	}
+	if installation.Key == nil {
+		return nil
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	return rsa.VerifyPKCS1v15(installation.Key, crypto.SHA256, digest[:], signature)
+}
+
+func (s *Server) getRuleset(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ruleset := range s.rulesets {
+		if ruleset.ID == id {
+			writeJSON(w, http.StatusOK, map[string]any{
+				"id": ruleset.ID, "name": ruleset.Name, "enforcement": "active", "current_user_can_bypass": ruleset.Bypass,
+			})
+			return
+		}
+	}
+	writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+}
+
+func (s *Server) listRulesets(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []map[string]any
+	for _, ruleset := range s.rulesets {
+		out = append(out, map[string]any{"id": ruleset.ID, "name": ruleset.Name, "target": "branch", "enforcement": "active"})
+	}
+	writeJSON(w, http.StatusOK, paginate(out, r.URL.Query()))
+}
+
+// decodeRuleset reads a ruleset definition. The token is taken as one of its bypass
+// actors, which any actor means.
+func decodeRuleset(r *http.Request) (Ruleset, error) {
+	var in struct {
+		Name         string `json:"name"`
+		BypassActors []struct {
+			ActorID   int64  `json:"actor_id"`
+			ActorType string `json:"actor_type"`
+		} `json:"bypass_actors"`
+		Conditions struct {
+			RefName struct {
+				Include []string `json:"include"`
+			} `json:"ref_name"`
+		} `json:"conditions"`
+		Rules []struct {
+			Type       string `json:"type"`
+			Parameters struct {
+				RequiredStatusChecks []struct {
+					Context string `json:"context"`
+				} `json:"required_status_checks"`
+			} `json:"parameters"`
+		} `json:"rules"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		return Ruleset{}, err
+	}
+	ruleset := Ruleset{Name: in.Name, Bypass: "never"}
+	for _, ref := range in.Conditions.RefName.Include {
+		ruleset.Branches = append(ruleset.Branches, strings.TrimPrefix(ref, "refs/heads/"))
+	}
+	for _, rule := range in.Rules {
+		ruleset.Rules = append(ruleset.Rules, rule.Type)
+		for _, check := range rule.Parameters.RequiredStatusChecks {
+			ruleset.Checks = append(ruleset.Checks, check.Context)
+		}
+	}
+	for _, actor := range in.BypassActors {
+		ruleset.Actors = append(ruleset.Actors, fmt.Sprintf("%s:%d", actor.ActorType, actor.ActorID))
+		ruleset.Bypass = "always"
+	}
+	return ruleset, nil
+}
+
+func (s *Server) createRuleset(w http.ResponseWriter, r *http.Request) {
+	ruleset, err := decodeRuleset(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+	s.mu.Lock()
+	s.nextID++
+	ruleset.ID = s.nextID
+	s.rulesets = append(s.rulesets, ruleset)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusCreated, map[string]any{"id": ruleset.ID, "name": ruleset.Name})
+}
+
+func (s *Server) updateRuleset(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	ruleset, err := decodeRuleset(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.rulesets {
+		if s.rulesets[i].ID == id {
+			ruleset.ID = id
+			s.rulesets[i] = ruleset
+			writeJSON(w, http.StatusOK, map[string]any{"id": ruleset.ID, "name": ruleset.Name})
+			return
+		}
+	}
+	writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+}
+
+func (s *Server) listIssues(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	state := q.Get("state")
+	if state == "" {
+		state = "open"
+	}
+	labels := q.Get("labels")
+
+	var payload []map[string]any
+	for _, issue := range s.Issues() {
+		if state != "all" && issue.State != state {
+			continue
+		}
+		if labels != "" && !containsAll(issue.Labels, strings.Split(labels, ",")) {
+			continue
+		}
+		payload = append(payload, issuePayload(issue))
+	}
+	// Like GitHub, the issues endpoint also lists pull requests
+	for _, pr := range s.PRs() {
+		if state != "all" && pr.State != state {
+			continue
+		}
+		if labels != "" && !containsAll(pr.Labels, strings.Split(labels, ",")) {
+			continue
+		}
+		item := pullPayload(pr)
+		item["pull_request"] = map[string]string{}
+		payload = append(payload, item)
+	}
+	writeJSON(w, http.StatusOK, paginate(payload, q))
+}
+
+func (s *Server) addLabels(w http.ResponseWriter, r *http.Request) {
+	number, _ := strconv.Atoi(r.PathValue("number"))
+	var in struct {
+		Labels []string `json:"labels"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	labels, ok := s.labelsOf(number)
+	if ok {
+		for _, l := range in.Labels {
+			if !slices.Contains(labels, l) {
+				labels = append(labels, l)
+			}
+		}
+		s.setLabels(number, labels)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, labelsPayload(labels))
+}
+
+func (s *Server) removeLabel(w http.ResponseWriter, r *http.Request) {
+	number, _ := strconv.Atoi(r.PathValue("number"))
+	name := r.PathValue("name")
+	s.mu.Lock()
+	labels, ok := s.labelsOf(number)
+	found := ok && slices.Contains(labels, name)
+	if found {
+		labels = slices.DeleteFunc(labels, func(l string) bool { return l == name })
+		s.setLabels(number, labels)
+	}
+	s.mu.Unlock()
+
+	if !found {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Label does not exist"})
+		return
+	}
+	writeJSON(w, http.StatusOK, labelsPayload(labels))
+}
+
+func (s *Server) deleteLabel(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	s.mu.Lock()
+	found := false
+	for _, number := range slices.Sorted(maps.Keys(s.prs)) {
+		if labels, _ := s.labelsOf(number); slices.Contains(labels, name) {
+			s.setLabels(number, slices.DeleteFunc(labels, func(l string) bool { return l == name }))
+			found = true
+		}
+	}
+	for number, issue := range s.issues {
+		if slices.Contains(issue.Labels, name) {
+			s.setLabels(number, slices.DeleteFunc(slices.Clone(issue.Labels), func(l string) bool { return l == name }))
+			found = true
+		}
+	}
+	s.mu.Unlock()
+
+	if !found {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// labelsOf returns a copy of the labels of an issue or PR; the caller holds s.mu
+func (s *Server) labelsOf(number int) ([]string, bool) {
+	if issue, ok := s.issues[number]; ok {
+		return slices.Clone(issue.Labels), true
+	}
+	if pr, ok := s.prs[number]; ok {
+		return slices.Clone(pr.Labels), true
+	}
+	return nil, false
+}
+
+// setLabels replaces the labels of an issue or PR; the caller holds s.mu
+func (s *Server) setLabels(number int, labels []string) {
+	if issue, ok := s.issues[number]; ok {
+		issue.Labels = labels
+		return
+	}
+	pr := s.prs[number]
+	pr.Labels = labels
+	s.prs[number] = pr
+}
+
+func (s *Server) createIssue(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Title     string   `json:"title"`
+		Body      string   `json:"body"`
+		Labels    []string `json:"labels"`
+		Assignees []string `json:"assignees"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	number := s.nextNumber()
+	issue := &Issue{Number: number, Title: in.Title, Body: in.Body, State: "open", Labels: in.Labels, Assignees: in.Assignees}
+	s.issues[number] = issue
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, issuePayload(*issue))
+}
+
+func (s *Server) updateIssue(w http.ResponseWriter, r *http.Request) {
+	number, _ := strconv.Atoi(r.PathValue("number"))
+	var in struct {
+		Title *string `json:"title"`
+		Body  *string `json:"body"`
+		State *string `json:"state"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	issue, ok := s.issues[number]
+	if pr, isPR := s.prs[number]; !ok && isPR {
+		// PRs are issues too, PATCHing one as an issue edits the PR
+		if in.Title != nil {
+			pr.Title = *in.Title
+		}
+		if in.Body != nil {
+			pr.Body = *in.Body
+		}
+		if in.State != nil {
+			pr.State = *in.State
+		}
+		s.prs[number] = pr
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, issuePayload(Issue{Number: pr.Number, Title: pr.Title, Body: pr.Body, State: pr.State, Labels: pr.Labels}))
+		return
+	}
+	if ok {
+		if in.Title != nil {
+			issue.Title = *in.Title
+		}
+		if in.Body != nil {
+			issue.Body = *in.Body
+		}
+		if in.State != nil {
+			issue.State = *in.State
+		}
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, issuePayload(*issue))
+}
+
+func (s *Server) listComments(w http.ResponseWriter, r *http.Request) {
+	number, _ := strconv.Atoi(r.PathValue("number"))
+	comments := s.Comments(number)
+	payload := make([]map[string]any, 0, len(comments))
+	for _, c := range paginate(comments, r.URL.Query()) {
+		association := c.AuthorAssociation
+		if association == "" {
+			association = "NONE"
+		}
+		payload = append(payload, map[string]any{"id": c.ID, "body": c.Body, "author_association": association})
+	}
+	writeJSON(w, http.StatusOK, payload)
+}
+
+func (s *Server) createComment(w http.ResponseWriter, r *http.Request) {
+	number, _ := strconv.Atoi(r.PathValue("number"))
+	var in struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	s.nextID++
+	c := &Comment{ID: s.nextID, Number: number, Body: in.Body}
+	s.comments = append(s.comments, c)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, map[string]any{"id": c.ID, "body": c.Body})
+}
+
+func (s *Server) updateComment(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	var in struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	var found *Comment
+	for _, c := range s.comments {
+		if c.ID == id {
+			c.Body = in.Body
+			found = c
+		}
+	}
+	s.mu.Unlock()
+
+	if found == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"id": found.ID, "body": found.Body})
+}
+
+// nextNumber returns the next free issue/PR number. Callers must hold s.mu.
+func (s *Server) nextNumber() int {
+	n := 1
+	for number := range s.prs {
+		n = max(n, number+1)
+	}
+	for number := range s.issues {
+		n = max(n, number+1)
+	}
+	return n
+}
+
+// pullPayload renders a PR the way the GitHub REST API does
+func pullPayload(pr PR) map[string]any {
+	head := pr.Head
+	if head == "" {
+		head = fmt.Sprintf("pr-%d", pr.Number)
+	}
+	return map[string]any{
+		"number":     pr.Number,
+		"title":      pr.Title,
+		"state":      pr.State,
+		"created_at": pr.CreatedAt.Format(time.RFC3339),
+		"user":       map[string]string{"login": pr.Author},
+		"base":       map[string]string{"ref": pr.Base},
+		"head":       map[string]string{"ref": head, "sha": pr.HeadSHA},
+		"draft":      pr.Draft,
+		"labels":     labelsPayload(pr.Labels),
+		"body":       pr.Body,
+	}
+}
+
+// issuePayload renders an issue the way the GitHub REST API does
+func issuePayload(issue Issue) map[string]any {
+	assignees := make([]map[string]string, len(issue.Assignees))
+	for i, a := range issue.Assignees {
+		assignees[i] = map[string]string{"login": a}
+	}
+	return map[string]any{
+		"number":    issue.Number,
+		"title":     issue.Title,
+		"body":      issue.Body,
+		"state":     issue.State,
+		"labels":    labelsPayload(issue.Labels),
+		"assignees": assignees,
+	}
+}
+
+func labelsPayload(labels []string) []map[string]string {
+	out := make([]map[string]string, len(labels))
+	for i, l := range labels {
+		out[i] = map[string]string{"name": l}
+	}
+	return out
+}
+
+// paginate applies the page and per_page query parameters
+func paginate[T any](items []T, q map[string][]string) []T {
+	perPage, page := 30, 1
+	if v, err := strconv.Atoi(first(q["per_page"])); err == nil && v > 0 {
+		perPage = v
+	}
+	if v, err := strconv.Atoi(first(q["page"])); err == nil && v > 0 {
+		page = v
+	}
+	start := (page - 1) * perPage
+	if start >= len(items) {
+		return nil
+	}
+	return items[start:min(start+perPage, len(items))]
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func containsAll(have, want []string) bool {
+	set := make(map[string]struct{}, len(have))
+	for _, h := range have {
+		set[strings.ToLower(h)] = struct{}{}
+	}
+	for _, w := range want {
+		if _, ok := set[strings.ToLower(strings.TrimSpace(w))]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
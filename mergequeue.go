@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// mustFetchQueuedPRs enforces selecting the PRs enqueued in the trunk merge queue
+func mustFetchQueuedPRs(client GitHubClient, cfg Config, report *RunReport) []GitHubPR {
+	prs, err := fetchQueuedPRs(client, cfg, report)
+	if err != nil {
+		log.Fatal("error reading merge queue:", err)
+	}
+	return prs
+}
+
+// fetchQueuedPRs selects the PRs of the native merge queue of trunk, in queue order and
+// pinned at the head the queue merges, so the target branch holds exactly what GitHub
+// is about to merge. Label filters do not apply: the queue decides the membership.
+func fetchQueuedPRs(client GitHubClient, cfg Config, report *RunReport) ([]GitHubPR, error) {
+	entries, err := client.ListMergeQueue(cfg.TrunkBranch)
+	if err != nil {
+		return nil, err
+	}
+	open, err := client.ListOpenPRs(cfg.TrunkBranch)
+	if err != nil {
+		return nil, err
+	}
+	byNumber := make(map[int]GitHubPR, len(open))
+	for _, pr := range open {
+		byNumber[pr.Number] = pr
+	}
+
+	fmt.Printf("Merge queue of '%s' holds %d PR(s).\n", cfg.TrunkBranch, len(entries))
+	var prs []GitHubPR
+	for _, entry := range entries {
+		pr, ok := byNumber[entry.Number]
+		if !ok {
+			report.add(GitHubPR{Number: entry.Number}, OutcomeClosed, "PR left the open PRs while enqueued", 0)
+			continue
+		}
+		report.discovered([]GitHubPR{pr})
+		if entry.State == "UNMERGEABLE" {
+			report.add(pr, OutcomeFiltered, fmt.Sprintf("merge queue entry #%d is unmergeable", entry.Position), 0)
+			continue
+		}
+		if entry.HeadSHA != "" {
+			pr.SHA = entry.HeadSHA
+		}
+		prs = append(prs, pr)
+	}
+	return prs, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// fetchTestMergeRef fetches refs/pull/N/merge, GitHub's precomputed merge of a PR into its base.
+// It returns false when GitHub published no merge ref, which it omits for conflicting PRs.
+func fetchTestMergeRef(pr GitHubPR) (string, bool, error) {
+	err := runOriginGit("fetch", "origin", fmt.Sprintf("pull/%d/merge", pr.Number))
+	if err != nil {
+		if strings.Contains(err.Error(), "couldn't find remote ref") {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("fetch test-merge ref failed: %w", err)
+	}
+	sha, err := revParse("FETCH_HEAD")
+	if err != nil {
+		return "", false, fmt.Errorf("resolve test-merge ref failed: %w", err)
+	}
+	return sha, true, nil
+}
+
+// commitTestMerge squashes a PR by reusing the tree of its test-merge ref, skipping the local merge.
+// This only applies while the merge ref joins the current HEAD with the fetched PR head,
+// i.e. for the PRs merged while the target branch still matches trunk; false means not applied.
+func commitTestMerge(pr GitHubPR, branch, mergeRef, message string) (bool, error) {
+	head, err := revParse("HEAD")
+	if err != nil {
+		return false, nil
+	}
+	base, errBase := revParse(mergeRef + "^1")
+	prHead, errHead := revParse(mergeRef + "^2")
+	branchHead, errBranch := revParse(branch)
+	if errBase != nil || errHead != nil || errBranch != nil || base != head || prHead != branchHead {
+		return false, nil
+	}
+
+	tree, err := revParse(mergeRef + "^{tree}")
+	if err != nil {
+		return false, nil
+	}
+	if headTree, err := revParse("HEAD^{tree}"); err == nil && headTree == tree {
+		return true, ErrEmptyMerge
+	}
+
+	output, err := runGitCommandWithOutput("commit-tree", tree, "-p", head, "-m", message)
+	if err != nil {
+		return true, fmt.Errorf("create commit failed: %w", err)
+	}
+	if err := runGitCommand("merge", "--ff-only", strings.TrimSpace(output)); err != nil {
+		return true, fmt.Errorf("advance target branch failed: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// defaultLocale is the locale of the compiled-in messages and text templates
+const defaultLocale = "en-US"
+
+// localeCatalogs holds the message catalog of every supported locale, named after the
+// locale; texts/<locale>/ holds the translated text templates
+//
+//go:embed messages/*.json
+var localeCatalogs embed.FS
+
+// messageVerb matches the formatting verbs of a message, argument indexes included
+var messageVerb = regexp.MustCompile(`%(\[\d+\])?[-+# 0]*\d*(\.\d+)?[a-zA-Z]`)
+
+// messageCatalog maps message keys to their fmt format in the configured locale
+type messageCatalog map[string]string
+
+// readCatalog parses the compiled-in catalog of a locale
+func readCatalog(locale string) (messageCatalog, error) {
+	data, err := localeCatalogs.ReadFile("messages/" + locale + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("unsupported locale '%s'", locale)
+	}
+	var catalog messageCatalog
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, fmt.Errorf("catalog of '%s': %w", locale, err)
+	}
+	return catalog, nil
+}
+
+// supportedLocales lists the locales with a compiled-in catalog
+func supportedLocales() []string {
+	entries, _ := localeCatalogs.ReadDir("messages")
+	var locales []string
+	for _, e := range entries {
+		locales = append(locales, strings.TrimSuffix(e.Name(), ".json"))
+	}
+	return locales
+}
+
+// loadMessageCatalog builds the catalog of a locale: the default messages, overlaid with
+// the translations of the locale and then with the overrides of a --messages_file, if any.
+// Overrides must name known messages and keep their formatting verbs.
+func loadMessageCatalog(locale, overridesPath string) (messageCatalog, error) {
+	catalog, err := readCatalog(defaultLocale)
+	if err != nil {
+		return nil, err
+	}
+	if locale != defaultLocale {
+		translated, err := readCatalog(locale)
+		if err != nil {
+			return nil, err
+		}
+		if err := catalog.overlay(translated); err != nil {
+			return nil, fmt.Errorf("catalog of '%s': %w", locale, err)
+		}
+	}
+	if overridesPath == "" {
+		return catalog, nil
+	}
+	data, err := os.ReadFile(overridesPath)
+	if err != nil {
+		return nil, fmt.Errorf("file read failed: %w", err)
+	}
+	var overrides messageCatalog
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("parse failed: %w", err)
+	}
+	if err := catalog.overlay(overrides); err != nil {
+		return nil, err
+	}
+	return catalog, nil
+}
+
+// overlay replaces messages of the catalog, checking each replacement formats the same
+// arguments; translations may reorder them with explicit argument indexes
+func (c messageCatalog) overlay(messages messageCatalog) error {
+	for _, key := range slices.Sorted(maps.Keys(messages)) {
+		format, ok := c[key]
+		if !ok {
+			return fmt.Errorf("unknown message '%s'", key)
+		}
+		if want, got := len(messageVerb.FindAllString(format, -1)), len(messageVerb.FindAllString(messages[key], -1)); want != got {
+			return fmt.Errorf("message '%s' formats %d argument(s), expected %d as in %q", key, got, want, format)
+		}
+		c[key] = messages[key]
+	}
+	return nil
+}
+
+// message formats a console message in the configured locale. Runs without a loaded
+// catalog, such as the subcommands, print the default messages.
+func message(cfg Config, key string, args ...any) string {
+	format, ok := cfg.Messages[key]
+	if !ok {
+		catalog, _ := readCatalog(defaultLocale)
+		format = catalog[key]
+	}
+	return fmt.Sprintf(format, args...)
+}
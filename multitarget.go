@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// prefetchChunk is the number of PR refspecs fetched per 'git fetch' call
+const prefetchChunk = 100
+
+// BuildTarget is a target branch of a multi-target build
+type BuildTarget struct {
+	Branch string   `json:"branch"` // Target branch
+	Labels []string `json:"labels"` // Labels selecting its PRs, the configured labels when empty
+}
+
+// parseBuildTargets parses 'branch[:labels]' entries separated by semicolons or newlines,
+// e.g. "pre-main; qa-main:ready,qa"
+func parseBuildTargets(value string) ([]BuildTarget, error) {
+	var targets []BuildTarget
+	for _, entry := range strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == '\n' }) {
+		branch, labels, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		branch = strings.TrimSpace(branch)
+		if branch == "" {
+			continue
+		}
+		if err := validateBranchName(branch); err != nil {
+			return nil, fmt.Errorf("target '%s': %w", branch, err)
+		}
+		if slices.ContainsFunc(targets, func(t BuildTarget) bool { return t.Branch == branch }) {
+			return nil, fmt.Errorf("target '%s' is listed twice", branch)
+		}
+		targets = append(targets, BuildTarget{Branch: branch, Labels: parseLabels(labels)})
+	}
+	return targets, nil
+}
+
+// runBuildTargets builds every configured target branch concurrently. The PR heads are
+// fetched once into the shared object store, then every target runs its own bot process in
+// a separate worktree of the clone, so per-branch pipelines never share an index or HEAD.
+func runBuildTargets(cfg Config, args []string) {
+	mustSetupGitConfig()
+	client := mustNewGitHubClient(cfg)
+	prs, err := client.ListOpenPRs(cfg.TrunkBranch)
+	if err != nil {
+		log.Fatal("error fetching PRs:", err)
+	}
+	fmt.Printf("Fetching %d open PR(s) for %d target branch(es)...", len(prs), len(cfg.BuildTargets))
+	if err := prefetchPRBranches(prs); err != nil {
+		log.Fatal("\nerror fetching PR branches:", err)
+	}
+	fmt.Println(" done.")
+
+	workdir, err := os.MkdirTemp("", "feature-branching-targets-")
+	if err != nil {
+		log.Fatal("error creating worktree dir:", err)
+	}
+	defer os.RemoveAll(workdir)
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed []string
+	)
+	for i, target := range cfg.BuildTargets {
+		dir := filepath.Join(workdir, fmt.Sprintf("target-%d", i+1))
+		if err := runGitCommand("worktree", "add", "--detach", dir, cfg.TrunkBranch); err != nil {
+			log.Fatalf("error creating worktree for '%s': %v", target.Branch, err)
+		}
+		defer runGitCommand("worktree", "remove", "--force", dir)
+		// Registered up front, so the bot processes find their worktree already trusted
+		if err := runGitCommand("config", "--global", "--add", "safe.directory", dir); err != nil {
+			log.Fatalf("error trusting worktree for '%s': %v", target.Branch, err)
+		}
+		defer runGitCommand("config", "--global", "--unset", "safe.directory", "^"+regexp.QuoteMeta(dir)+"$")
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var out bytes.Buffer
+			err := runBotWithOutput(dir, buildTargetArgs(cfg, args, target), &out)
+
+			mu.Lock()
+			defer mu.Unlock()
+			fmt.Printf("\n=== %s ===\n%s", target.Branch, out.String())
+			if err != nil {
+				fmt.Printf("Target '%s' FAILED: %v\n", target.Branch, err)
+				failed = append(failed, target.Branch)
+			}
+		}()
+	}
+	wg.Wait()
+
+	fmt.Printf("\n%d/%d target branches built successfully.\n", len(cfg.BuildTargets)-len(failed), len(cfg.BuildTargets))
+	if len(failed) > 0 {
+		slices.Sort(failed)
+		log.Fatalf("build failed for: %s", strings.Join(failed, ", "))
+	}
+}
+
+// buildTargetArgs selects a target on top of the original arguments; flags are last-wins.
+// Target labels replace --labels, while repeated --label flags still apply to every target.
+func buildTargetArgs(cfg Config, args []string, target BuildTarget) []string {
+	targetArgs := append(slices.Clone(args), "--build_targets=", "--prefetched_prs",
+		"--target_branch", target.Branch, "--batch_id", cfg.BatchID)
+	if len(target.Labels) > 0 {
+		targetArgs = append(targetArgs, "--labels", strings.Join(target.Labels, ","))
+	}
+	if cfg.ReportDir != "" {
+		// Targets run in their worktree, so the report directory must not be relative
+		dir, err := filepath.Abs(filepath.Join(cfg.ReportDir, target.Branch))
+		if err == nil {
+			targetArgs = append(targetArgs, "--report_dir", dir)
+		}
+	}
+	return targetArgs
+}
+
+// prefetchPRBranches fetches the heads of the PRs into their local 'pr-N' branches
+func prefetchPRBranches(prs []GitHubPR) error {
+	for start := 0; start < len(prs); start += prefetchChunk {
+		fetch := []string{"fetch", "origin"}
+		for _, pr := range prs[start:min(start+prefetchChunk, len(prs))] {
+			fetch = append(fetch, fmt.Sprintf("+pull/%d/head:pr-%d", pr.Number, pr.Number))
+		}
+		if err := runOriginGit(fetch...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"time"
+)
+
+// Constants for notification deduplication
+const (
+	notifyStateDir   = "notifications"                     // State subdirectory holding one file per target branch
+	notifyDigestMax  = 50                                  // Routine events kept for the next digest
+	notifyDigestMark = "<!-- feature-branching:digest -->" // Marker of digest comments
+)
+
+// NotifyState remembers what was last notified for a target branch, so frequent
+// rebuilds only notify on membership changes, new conflicts and new failures.
+// Everything else is collected into a periodic digest on the tracking issue.
+type NotifyState struct {
+	Members   []int     `json:"members"`           // PRs of the last notified candidate
+	Conflicts []int     `json:"conflicts"`         // PRs conflicting in the last run
+	Failure   string    `json:"failure,omitempty"` // Last notified failure, cleared by a successful run
+	Digest    []string  `json:"digest,omitempty"`  // Routine events not notified yet
+	DigestAt  time.Time `json:"digest_at"`         // When the last digest was posted
+
+	store Storage // Storage of the state
+	key   string  // Storage key of the state
+}
+
+// loadNotifyState reads the notification state of the target branch, returning nil
+// when deduplication is disabled; a nil state notifies every event
+func loadNotifyState(cfg Config) *NotifyState {
+	if !cfg.NotifyDedupe {
+		return nil
+	}
+	state := &NotifyState{store: stateStorage(cfg), key: path.Join(notifyStateDir, url.PathEscape(cfg.TargetBranch)+".json")}
+	data, err := state.store.Load(state.key)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("failed to read notification state", "error", err)
+	} else if err == nil {
+		if err := json.Unmarshal(data, state); err != nil {
+			slog.Warn("ignoring corrupt notification state", "error", err)
+		}
+	}
+	if state.DigestAt.IsZero() {
+		state.DigestAt = time.Now().UTC()
+	}
+	return state
+}
+
+// candidate reports whether the published candidate warrants a notification: its PRs
+// changed or a PR conflicts that did not before. Other rebuilds go to the digest.
+func (s *NotifyState) candidate(cfg Config, report *RunReport, merged []MergeRecord) bool {
+	if s == nil {
+		return true
+	}
+	var members, conflicts []int
+	for _, m := range merged {
+		members = append(members, m.PR)
+	}
+	for _, r := range report.Results {
+		if r.Outcome == OutcomeConflict || r.Outcome == OutcomeBinaryConflict {
+			conflicts = append(conflicts, r.Number)
+		}
+	}
+	slices.Sort(members)
+	slices.Sort(conflicts)
+	newConflict := slices.ContainsFunc(conflicts, func(n int) bool { return !slices.Contains(s.Conflicts, n) })
+	changed := !slices.Equal(members, s.Members) || newConflict
+	s.Members, s.Conflicts, s.Failure = members, conflicts, ""
+	if changed {
+		return true
+	}
+	s.record(cfg, fmt.Sprintf("batch `%s` rebuilt `%s` with the same %d PR(s)", cfg.BatchID, cfg.TargetBranch, len(members)))
+	return false
+}
+
+// failure reports whether a failure differs from the last notified one; repeated
+// failures go to the digest
+func (s *NotifyState) failure(cfg Config, cause error) bool {
+	if s == nil {
+		return true
+	}
+	text := firstLine(cause.Error())
+	if text != s.Failure {
+		s.Failure = text
+		return true
+	}
+	s.record(cfg, fmt.Sprintf("batch `%s` failed again: %s", cfg.BatchID, text))
+	return false
+}
+
+// record queues a routine event for the digest, which needs a tracking issue to go to
+func (s *NotifyState) record(cfg Config, event string) {
+	if cfg.TrackingIssue == 0 {
+		return
+	}
+	s.Digest = append(s.Digest, fmt.Sprintf("%s %s", time.Now().UTC().Format(time.RFC3339), event))
+	if len(s.Digest) > notifyDigestMax {
+		s.Digest = s.Digest[len(s.Digest)-notifyDigestMax:]
+	}
+}
+
+// publishDigest comments the queued routine events on the tracking issue once the digest
+// interval elapsed. Errors are logged as warnings and the events kept for the next digest.
+func (s *NotifyState) publishDigest(client GitHubClient, cfg Config) {
+	if s == nil || len(s.Digest) == 0 || cfg.NotifyDigest <= 0 || time.Since(s.DigestAt) < cfg.NotifyDigest {
+		return
+	}
+	body, err := renderText(cfg, "digest", digestData{
+		Target: cfg.TargetBranch,
+		Since:  s.DigestAt.Format(time.RFC3339),
+		Events: s.Digest,
+	})
+	if err != nil {
+		slog.Warn("failed to build notification digest", "error", err)
+		return
+	}
+	if err := client.CreateIssueComment(cfg.TrackingIssue, notifyDigestMark+"\n"+body); err != nil {
+		slog.Warn("failed to post notification digest on tracking issue", "issue_number", cfg.TrackingIssue, "error", err)
+		return
+	}
+	s.Digest, s.DigestAt = nil, time.Now().UTC()
+}
+
+// save writes the notification state. Errors are logged as warnings, since losing
+// the state only causes duplicate notifications.
+func (s *NotifyState) save() {
+	if s == nil {
+		return
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err == nil {
+		err = s.store.Save(s.key, data)
+	}
+	if err != nil {
+		slog.Warn("failed to write notification state", "error", err)
+	}
+}
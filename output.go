@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// Bounds of the command output kept in memory
+const (
+	outputHeadBytes = 32 * 1024 // Leading bytes kept
+	outputTailBytes = 32 * 1024 // Trailing bytes kept
+)
+
+// boundedOutput captures command output keeping only its head and tail in memory, so a
+// merge of a huge vendored change cannot blow up error messages. Once the output
+// exceeds the bounds, all of it is spilled to a temporary file the truncation marker
+// names, left in place for inspection.
+type boundedOutput struct {
+	head   []byte   // First outputHeadBytes bytes
+	tail   []byte   // Last bytes written after the head, at most outputTailBytes once trimmed
+	total  int64    // Bytes written
+	spill  *os.File // Full output once the bounds are exceeded, nil before
+	failed bool     // Spill file could not be created
+}
+
+// Write implements io.Writer; it never fails, a spill file error only loses the full output
+func (b *boundedOutput) Write(p []byte) (int, error) {
+	n := len(p)
+	b.total += int64(n)
+	switch {
+	case b.spill != nil:
+		b.spill.Write(p)
+	case !b.failed && b.total > outputHeadBytes+outputTailBytes:
+		// Nothing was dropped yet: head and tail hold everything before p
+		f, err := os.CreateTemp("", "feature-branching-output-*.log")
+		if err != nil {
+			b.failed = true
+			break
+		}
+		f.Write(b.head)
+		f.Write(b.tail)
+		f.Write(p)
+		b.spill = f
+	}
+
+	if room := outputHeadBytes - len(b.head); room > 0 {
+		take := min(room, len(p))
+		b.head = append(b.head, p[:take]...)
+		p = p[take:]
+	}
+	if len(p) > outputTailBytes {
+		p = p[len(p)-outputTailBytes:]
+	}
+	b.tail = append(b.tail, p...)
+	if len(b.tail) > 2*outputTailBytes {
+		b.tail = append(b.tail[:0], b.tail[len(b.tail)-outputTailBytes:]...)
+	}
+	return n, nil
+}
+
+// String returns the captured output, with a truncation marker in place of the bytes
+// dropped between the head and the tail
+func (b *boundedOutput) String() string {
+	tail := b.tail
+	if len(tail) > outputTailBytes {
+		tail = tail[len(tail)-outputTailBytes:]
+	}
+	dropped := b.total - int64(len(b.head)) - int64(len(tail))
+	if dropped <= 0 {
+		return string(b.head) + string(tail)
+	}
+	marker := fmt.Sprintf("\n[... %d bytes truncated ...]\n", dropped)
+	if b.spill != nil {
+		marker = fmt.Sprintf("\n[... %d bytes truncated, full output in %s ...]\n", dropped, b.spill.Name())
+	}
+	return string(b.head) + marker + string(tail)
+}
+
+// Close closes the spill file, if any
+func (b *boundedOutput) Close() error {
+	if b.spill == nil {
+		return nil
+	}
+	return b.spill.Close()
+}
+
+// runBounded runs a command capturing its combined output within the bounds. Use it
+// for diagnostic output; commands whose output is parsed need all of it.
+func runBounded(cmd *exec.Cmd) (string, error) {
+	output := &boundedOutput{}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	err := cmd.Run()
+	output.Close()
+	return output.String(), err
+}
+
+// truncateOutput bounds output already held in memory before it is embedded in an error
+func truncateOutput(s string) string {
+	if len(s) <= outputHeadBytes+outputTailBytes {
+		return s
+	}
+	dropped := len(s) - outputHeadBytes - outputTailBytes
+	return s[:outputHeadBytes] + fmt.Sprintf("\n[... %d bytes truncated ...]\n", dropped) + s[len(s)-outputTailBytes:]
+}
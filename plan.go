@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// runPlan implements the 'plan' subcommand: it selects the PRs of the next run with the
+// filters, ordering and limits of 'run', and prints them together with the PRs left
+// out. Nothing is written: no branch, comment, label or state file.
+func runPlan(args []string) {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	cfg := mustParseConfig(fs, args)
+	if err := checkPlanSources(cfg, "subcommand 'plan'"); err != nil {
+		log.Fatal("invalid configuration:", err)
+	}
+	cfg, _ = mustMintAppToken(cfg)
+	client := mustNewGitHubClient(cfg)
+
+	// The report is not persisted, it only collects why PRs are left out
+	report := &RunReport{}
+	prs := mustPlanPRs(client, cfg, report)
+
+	if len(prs) == 0 {
+		fmt.Printf("\n%s\n", message(cfg, "run.no_prs", strings.Join(cfg.RequiredLabels, ", ")))
+	} else {
+		logPRsToMerge(cfg, prs)
+	}
+	if len(report.Results) > 0 {
+		fmt.Printf("Left out of '%s':\n", cfg.TargetBranch)
+		for _, r := range report.Results {
+			fmt.Printf("  #%d  \"%s\"  %s: %s\n", r.Number, r.Title, r.Outcome, r.Detail)
+		}
+		fmt.Println()
+	}
+	fmt.Printf("Plan of %d PR(s) for '%s'; nothing was merged or pushed.\n", len(prs), cfg.TargetBranch)
+}
+
+// checkPlanSources rejects the PR sources a plan cannot select from without side effects
+func checkPlanSources(cfg Config, mode string) error {
+	switch {
+	case cfg.MergeQueue:
+		return fmt.Errorf("%s does not support 'merge_queue'", mode)
+	case cfg.PromoteFrom != "":
+		return fmt.Errorf("%s does not support 'promote_from'", mode)
+	}
+	return nil
+}
+
+// mustPlanPRs selects the PRs of the next run as 'run' does, from the PRs file or the
+// open PRs, without commenting title suggestions or updating the eligibility cache
+func mustPlanPRs(client GitHubClient, cfg Config, report *RunReport) []GitHubPR {
+	var prs []GitHubPR
+	if cfg.PRsFile != "" {
+		prs = mustLoadPRsFile(cfg)
+		report.discovered(prs)
+	} else {
+		open, err := client.ListOpenPRs(cfg.TrunkBranch)
+		if err != nil {
+			log.Fatal("error fetching PRs:", err)
+		}
+		prs = qualifyPRs(cfg, open, report, nil)
+	}
+	prs, _ = gateDependencies(cfg, prs, report)
+	return prs
+}
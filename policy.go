@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Policy scopes
+const (
+	policyScopePR    = "pr"    // Evaluated on every PR alone
+	policyScopeBatch = "batch" // Evaluated on the batch with every PR added in turn
+)
+
+// Policy is a batching rule of the policy file: a PR is held back from the batch when
+// the expression evaluates to false, or fails to evaluate
+type Policy struct {
+	Name    string `json:"name"`              // Policy name, recorded with its decisions
+	Scope   string `json:"scope"`             // pr or batch
+	Expr    string `json:"expr"`              // Policy expression, true when the PR may be batched
+	Message string `json:"message,omitempty"` // Explanation reported for held back PRs
+}
+
+// PolicyDecision records the outcome of a policy for a run in the ref history
+type PolicyDecision struct {
+	Policy string `json:"policy"` // Policy name
+	Scope  string `json:"scope"`  // pr or batch
+	Expr   string `json:"expr"`   // Expression evaluated
+	Denied []int  `json:"denied"` // PRs the policy held back, empty when it allowed every PR
+}
+
+// prDiffStat is the change of a PR against its merge base with trunk
+type prDiffStat struct {
+	insertions int64
+	deletions  int64
+	files      []string
+}
+
+// loadPolicies reads and compiles the policy file, so invalid expressions fail the run
+// before anything is built
+func loadPolicies(path string) ([]Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("file read failed: %w", err)
+	}
+	var policies []Policy
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return nil, fmt.Errorf("parse failed: %w", err)
+	}
+	seen := make(map[string]bool, len(policies))
+	for i, p := range policies {
+		if p.Name == "" {
+			return nil, fmt.Errorf("policy %d has no name", i+1)
+		}
+		if seen[p.Name] {
+			return nil, fmt.Errorf("duplicate policy '%s'", p.Name)
+		}
+		seen[p.Name] = true
+		if p.Scope != policyScopePR && p.Scope != policyScopeBatch {
+			return nil, fmt.Errorf("policy '%s': invalid scope '%s' (expected %s or %s)", p.Name, p.Scope, policyScopePR, policyScopeBatch)
+		}
+		expr, err := compilePolicyExpr(p.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("policy '%s': %w", p.Name, err)
+		}
+		// An empty PR and batch catch unknown variables and mistyped operators early
+		if _, err := evalPolicyBool(expr, policyEnvOf(p.Scope, GitHubPR{}, prDiffStat{}, batchTotals{})); err != nil {
+			return nil, fmt.Errorf("policy '%s': %w", p.Name, err)
+		}
+	}
+	return policies, nil
+}
+
+// batchTotals accumulates the PRs kept in the batch
+type batchTotals struct {
+	prs        int64
+	insertions int64
+	deletions  int64
+	files      []string // Distinct paths, sorted
+}
+
+// add returns the totals with one more PR
+func (t batchTotals) add(stat prDiffStat) batchTotals {
+	files := slices.Clone(t.files)
+	for _, f := range stat.files {
+		if i, found := slices.BinarySearch(files, f); !found {
+			files = slices.Insert(files, i, f)
+		}
+	}
+	return batchTotals{prs: t.prs + 1, insertions: t.insertions + stat.insertions, deletions: t.deletions + stat.deletions, files: files}
+}
+
+// policyEnvOf binds the variables of a scope: pr alone, and batch with the PR added for
+// batch policies
+func policyEnvOf(scope string, pr GitHubPR, stat prDiffStat, batch batchTotals) policyEnv {
+	env := policyEnv{"pr": map[string]any{
+		"number":     int64(pr.Number),
+		"title":      pr.Title,
+		"author":     pr.Author,
+		"body":       pr.Body,
+		"labels":     stringList(pr.Labels),
+		"files":      stringList(stat.files),
+		"insertions": stat.insertions,
+		"deletions":  stat.deletions,
+		"changes":    stat.insertions + stat.deletions,
+	}}
+	if scope == policyScopeBatch {
+		env["batch"] = map[string]any{
+			"prs":        batch.prs,
+			"files":      stringList(batch.files),
+			"insertions": batch.insertions,
+			"deletions":  batch.deletions,
+			"changes":    batch.insertions + batch.deletions,
+		}
+	}
+	return env
+}
+
+func stringList(items []string) []any {
+	list := make([]any, len(items))
+	for i, s := range items {
+		list[i] = s
+	}
+	return list
+}
+
+// applyPolicies holds back the PRs the policies deny, in PR order: a PR must satisfy
+// every pr policy, then every batch policy over the PRs kept so far plus itself. The
+// decisions are recorded in the run report, which carries them to the ref history.
+// PR branches are fetched for their diff stats, which are taken against trunk.
+func applyPolicies(cfg Config, prs []GitHubPR, report *RunReport) []GitHubPR {
+	if len(cfg.Policies) == 0 {
+		return prs
+	}
+	exprs := make([]policyExpr, len(cfg.Policies))
+	decisions := make([]PolicyDecision, len(cfg.Policies))
+	for i, p := range cfg.Policies {
+		// Compiled when the configuration was loaded already
+		exprs[i], _ = compilePolicyExpr(p.Expr)
+		decisions[i] = PolicyDecision{Policy: p.Name, Scope: p.Scope, Expr: p.Expr, Denied: []int{}}
+	}
+
+	fmt.Printf("Evaluating %d policy(ies) on %d PR(s):\n", len(cfg.Policies), len(prs))
+	var kept []GitHubPR
+	var batch batchTotals
+	for _, pr := range prs {
+		stat, err := policyDiffStat(cfg, pr)
+		if err != nil {
+			// The merge reports the fetch failure of the PR
+			kept = append(kept, pr)
+			continue
+		}
+		next := batch.add(stat)
+		var denial string
+		for i, p := range cfg.Policies {
+			env := policyEnvOf(p.Scope, pr, stat, next)
+			allowed, err := evalPolicyBool(exprs[i], env)
+			if allowed {
+				continue
+			}
+			denial = fmt.Sprintf("denied by policy '%s'", p.Name)
+			switch {
+			case err != nil:
+				denial += fmt.Sprintf(" (evaluation failed: %v)", err)
+			case p.Message != "":
+				denial += ": " + p.Message
+			}
+			decisions[i].Denied = append(decisions[i].Denied, pr.Number)
+			break
+		}
+		if denial != "" {
+			fmt.Printf("  #%d %s\n", pr.Number, denial)
+			report.add(pr, OutcomeBlocked, denial, 0)
+			continue
+		}
+		kept = append(kept, pr)
+		batch = next
+	}
+	fmt.Printf("%d/%d PR(s) allowed by the policies.\n\n", len(kept), len(prs))
+	report.policiesEvaluated(decisions)
+	return kept
+}
+
+// policyDiffStat fetches a PR branch and summarizes its change against trunk
+func policyDiffStat(cfg Config, pr GitHubPR) (prDiffStat, error) {
+	branch, err := fetchPRBranch(pr, cfg)
+	if err != nil {
+		return prDiffStat{}, err
+	}
+	output, err := runGitCommandWithOutput("diff", "--numstat", "--no-renames", cfg.TrunkBranch+"..."+branch)
+	if err != nil {
+		return prDiffStat{}, err
+	}
+	var stat prDiffStat
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		// Binary files count no lines
+		added, _ := strconv.ParseInt(fields[0], 10, 64)
+		deleted, _ := strconv.ParseInt(fields[1], 10, 64)
+		stat.insertions += added
+		stat.deletions += deleted
+		stat.files = append(stat.files, fields[2])
+	}
+	return stat, nil
+}
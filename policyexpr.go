@@ -0,0 +1,625 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Policy expressions are a subset of CEL over the variables of a policy scope: integer,
+// string, bool and list values, the operators || && ! == != < <= > >= + - * / % and in,
+// size(), the string methods startsWith, endsWith, contains and matches, and the list
+// macros exists and all, e.g. pr.files.exists(f, f.startsWith("db/")).
+
+// policyExpr is a compiled policy expression
+type policyExpr interface {
+	eval(env policyEnv) (any, error)
+}
+
+// policyEnv binds the variables of a policy scope; values are int64, string, bool,
+// []any or nested map[string]any
+type policyEnv map[string]any
+
+// with returns the environment with one more variable, leaving the original untouched
+func (env policyEnv) with(name string, value any) policyEnv {
+	next := make(policyEnv, len(env)+1)
+	for k, v := range env {
+		next[k] = v
+	}
+	next[name] = value
+	return next
+}
+
+// compilePolicyExpr parses a policy expression
+func compilePolicyExpr(src string) (policyExpr, error) {
+	tokens, err := lexPolicyExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &policyParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %s at offset %d", tok, tok.pos)
+	}
+	return expr, nil
+}
+
+// evalPolicyBool evaluates an expression that must yield a bool
+func evalPolicyBool(expr policyExpr, env policyEnv) (bool, error) {
+	v, err := expr.eval(env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression yields %s, not bool", typeName(v))
+	}
+	return b, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokInt
+	tokString
+	tokOp
+)
+
+type policyToken struct {
+	kind tokenKind
+	text string // Identifier, operator or unquoted string
+	num  int64
+	pos  int
+}
+
+func (t policyToken) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return "'" + t.text + "'"
+}
+
+// policyOperators lists the operators, two-character ones first so they win
+var policyOperators = []string{"||", "&&", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", "[", "]", ",", "."}
+
+func lexPolicyExpr(src string) ([]policyToken, error) {
+	var tokens []policyToken
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(src) && (src[i] == '_' || unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i]))) {
+				i++
+			}
+			tokens = append(tokens, policyToken{kind: tokIdent, text: src[start:i], pos: start})
+		case unicode.IsDigit(c):
+			start := i
+			for i < len(src) && unicode.IsDigit(rune(src[i])) {
+				i++
+			}
+			n, err := strconv.ParseInt(src[start:i], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number at offset %d: %w", start, err)
+			}
+			tokens = append(tokens, policyToken{kind: tokInt, num: n, text: src[start:i], pos: start})
+		case c == '"' || c == '\'':
+			start := i
+			for i++; i < len(src) && rune(src[i]) != c; i++ {
+				if src[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(src) {
+				return nil, fmt.Errorf("unterminated string at offset %d", start)
+			}
+			i++
+			quoted := src[start:i]
+			if c == '\'' {
+				quoted = `"` + strings.ReplaceAll(quoted[1:len(quoted)-1], `"`, `\"`) + `"`
+			}
+			s, err := strconv.Unquote(quoted)
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at offset %d", start)
+			}
+			tokens = append(tokens, policyToken{kind: tokString, text: s, pos: start})
+		default:
+			op := ""
+			for _, candidate := range policyOperators {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at offset %d", c, i)
+			}
+			tokens = append(tokens, policyToken{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, policyToken{kind: tokEOF, pos: len(src)}), nil
+}
+
+type policyParser struct {
+	tokens []policyToken
+	pos    int
+}
+
+func (p *policyParser) peek() policyToken {
+	return p.tokens[p.pos]
+}
+
+func (p *policyParser) next() policyToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the operator or keyword when it comes next
+func (p *policyParser) accept(text string) bool {
+	if tok := p.peek(); (tok.kind == tokOp || tok.kind == tokIdent) && tok.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *policyParser) expect(text string) error {
+	if !p.accept(text) {
+		tok := p.peek()
+		return fmt.Errorf("expected '%s', found %s at offset %d", text, tok, tok.pos)
+	}
+	return nil
+}
+
+func (p *policyParser) parseOr() (policyExpr, error) {
+	return p.parseBinary([]string{"||"}, p.parseAnd)
+}
+
+func (p *policyParser) parseAnd() (policyExpr, error) {
+	return p.parseBinary([]string{"&&"}, p.parseComparison)
+}
+
+func (p *policyParser) parseComparison() (policyExpr, error) {
+	return p.parseBinary([]string{"==", "!=", "<=", ">=", "<", ">", "in"}, p.parseSum)
+}
+
+func (p *policyParser) parseSum() (policyExpr, error) {
+	return p.parseBinary([]string{"+", "-"}, p.parseProduct)
+}
+
+func (p *policyParser) parseProduct() (policyExpr, error) {
+	return p.parseBinary([]string{"*", "/", "%"}, p.parseUnary)
+}
+
+// parseBinary parses left-associative operators of one precedence level
+func (p *policyParser) parseBinary(ops []string, operand func() (policyExpr, error)) (policyExpr, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		for _, candidate := range ops {
+			if p.accept(candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return left, nil
+		}
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+}
+
+func (p *policyParser) parseUnary() (policyExpr, error) {
+	if p.accept("!") {
+		operand, err := p.parseUnary()
+		return &notExpr{operand: operand}, err
+	}
+	if p.accept("-") {
+		operand, err := p.parseUnary()
+		return &binaryExpr{op: "-", left: literalExpr{int64(0)}, right: operand}, err
+	}
+	return p.parsePostfix()
+}
+
+func (p *policyParser) parsePostfix() (policyExpr, error) {
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(".") {
+		tok := p.next()
+		if tok.kind != tokIdent {
+			return nil, fmt.Errorf("expected a field or method name, found %s at offset %d", tok, tok.pos)
+		}
+		if !p.accept("(") {
+			expr = &fieldExpr{target: expr, name: tok.text}
+			continue
+		}
+		if tok.text == "exists" || tok.text == "all" {
+			v := p.next()
+			if v.kind != tokIdent {
+				return nil, fmt.Errorf("expected a variable name, found %s at offset %d", v, v.pos)
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+			body, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			expr = &macroExpr{kind: tok.text, list: expr, variable: v.text, body: body}
+			continue
+		}
+		args, err := p.parseArgs()
+		if err != nil {
+			return nil, err
+		}
+		expr = &callExpr{name: tok.text, args: append([]policyExpr{expr}, args...), method: true}
+	}
+	return expr, nil
+}
+
+// parseArgs parses call arguments after the opening parenthesis
+func (p *policyParser) parseArgs() ([]policyExpr, error) {
+	var args []policyExpr
+	if p.accept(")") {
+		return args, nil
+	}
+	for {
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.accept(")") {
+			return args, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *policyParser) parsePrimary() (policyExpr, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokInt:
+		return literalExpr{tok.num}, nil
+	case tokString:
+		return literalExpr{tok.text}, nil
+	case tokIdent:
+		switch tok.text {
+		case "true":
+			return literalExpr{true}, nil
+		case "false":
+			return literalExpr{false}, nil
+		}
+		if p.accept("(") {
+			args, err := p.parseArgs()
+			return &callExpr{name: tok.text, args: args}, err
+		}
+		return identExpr(tok.text), nil
+	case tokOp:
+		switch tok.text {
+		case "(":
+			expr, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return expr, p.expect(")")
+		case "[":
+			list := &listExpr{}
+			if p.accept("]") {
+				return list, nil
+			}
+			for {
+				item, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				list.items = append(list.items, item)
+				if p.accept("]") {
+					return list, nil
+				}
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("unexpected %s at offset %d", tok, tok.pos)
+}
+
+type literalExpr struct{ value any }
+
+func (e literalExpr) eval(policyEnv) (any, error) { return e.value, nil }
+
+type identExpr string
+
+func (e identExpr) eval(env policyEnv) (any, error) {
+	v, ok := env[string(e)]
+	if !ok {
+		return nil, fmt.Errorf("undeclared variable '%s'", string(e))
+	}
+	return v, nil
+}
+
+type fieldExpr struct {
+	target policyExpr
+	name   string
+}
+
+func (e *fieldExpr) eval(env policyEnv) (any, error) {
+	v, err := e.target.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	fields, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s has no field '%s'", typeName(v), e.name)
+	}
+	field, ok := fields[e.name]
+	if !ok {
+		return nil, fmt.Errorf("no such field '%s'", e.name)
+	}
+	return field, nil
+}
+
+type listExpr struct{ items []policyExpr }
+
+func (e *listExpr) eval(env policyEnv) (any, error) {
+	list := make([]any, len(e.items))
+	for i, item := range e.items {
+		v, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = v
+	}
+	return list, nil
+}
+
+type notExpr struct{ operand policyExpr }
+
+func (e *notExpr) eval(env policyEnv) (any, error) {
+	b, err := evalPolicyBool(e.operand, env)
+	return !b, err
+}
+
+type binaryExpr struct {
+	op          string
+	left, right policyExpr
+}
+
+func (e *binaryExpr) eval(env policyEnv) (any, error) {
+	// || and && short-circuit, so guards such as size(l) > 0 && l[0] hold
+	if e.op == "||" || e.op == "&&" {
+		left, err := evalPolicyBool(e.left, env)
+		if err != nil || left == (e.op == "||") {
+			return left, err
+		}
+		return evalPolicyBool(e.right, env)
+	}
+	left, err := e.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "==":
+		return policyEqual(left, right), nil
+	case "!=":
+		return !policyEqual(left, right), nil
+	case "in":
+		list, ok := right.([]any)
+		if !ok {
+			return nil, fmt.Errorf("'in' needs a list, not %s", typeName(right))
+		}
+		for _, item := range list {
+			if policyEqual(left, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	if l, ok := left.(string); ok {
+		r, ok := right.(string)
+		if !ok {
+			return nil, fmt.Errorf("'%s' of string and %s", e.op, typeName(right))
+		}
+		switch e.op {
+		case "+":
+			return l + r, nil
+		case "<":
+			return l < r, nil
+		case "<=":
+			return l <= r, nil
+		case ">":
+			return l > r, nil
+		case ">=":
+			return l >= r, nil
+		}
+		return nil, fmt.Errorf("'%s' is not defined on strings", e.op)
+	}
+	l, lok := left.(int64)
+	r, rok := right.(int64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("'%s' of %s and %s", e.op, typeName(left), typeName(right))
+	}
+	switch e.op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/", "%":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		if e.op == "/" {
+			return l / r, nil
+		}
+		return l % r, nil
+	case "<":
+		return l < r, nil
+	case "<=":
+		return l <= r, nil
+	case ">":
+		return l > r, nil
+	case ">=":
+		return l >= r, nil
+	}
+	return nil, fmt.Errorf("unknown operator '%s'", e.op)
+}
+
+type callExpr struct {
+	name   string
+	args   []policyExpr // Receiver first for methods
+	method bool
+}
+
+func (e *callExpr) eval(env policyEnv) (any, error) {
+	args := make([]any, len(e.args))
+	for i, arg := range e.args {
+		v, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	if e.name == "size" {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("size() takes one argument")
+		}
+		switch v := args[0].(type) {
+		case string:
+			return int64(len(v)), nil
+		case []any:
+			return int64(len(v)), nil
+		}
+		return nil, fmt.Errorf("size() of %s", typeName(args[0]))
+	}
+	if !e.method {
+		return nil, fmt.Errorf("unknown function '%s'", e.name)
+	}
+
+	s, ok := args[0].(string)
+	if !ok || len(args) != 2 {
+		return nil, fmt.Errorf("unknown method '%s' of %s", e.name, typeName(args[0]))
+	}
+	arg, ok := args[1].(string)
+	if !ok {
+		return nil, fmt.Errorf("%s() needs a string argument, not %s", e.name, typeName(args[1]))
+	}
+	switch e.name {
+	case "startsWith":
+		return strings.HasPrefix(s, arg), nil
+	case "endsWith":
+		return strings.HasSuffix(s, arg), nil
+	case "contains":
+		return strings.Contains(s, arg), nil
+	case "matches":
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, fmt.Errorf("matches(): %w", err)
+		}
+		return re.MatchString(s), nil
+	}
+	return nil, fmt.Errorf("unknown method '%s' of string", e.name)
+}
+
+// macroExpr is the exists or all macro binding each item of a list to a variable
+type macroExpr struct {
+	kind     string
+	list     policyExpr
+	variable string
+	body     policyExpr
+}
+
+func (e *macroExpr) eval(env policyEnv) (any, error) {
+	v, err := e.list.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s() of %s", e.kind, typeName(v))
+	}
+	for _, item := range list {
+		b, err := evalPolicyBool(e.body, env.with(e.variable, item))
+		if err != nil {
+			return nil, err
+		}
+		if b == (e.kind == "exists") {
+			return b, nil
+		}
+	}
+	return e.kind == "all", nil
+}
+
+func policyEqual(a, b any) bool {
+	la, aok := a.([]any)
+	lb, bok := b.([]any)
+	if aok || bok {
+		if !aok || !bok || len(la) != len(lb) {
+			return false
+		}
+		for i := range la {
+			if !policyEqual(la[i], lb[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if _, ok := a.(map[string]any); ok {
+		return false
+	}
+	return a == b
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case int64:
+		return "int"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case []any:
+		return "list"
+	case map[string]any:
+		return "map"
+	}
+	return fmt.Sprintf("%T", v)
+}
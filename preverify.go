@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// preverification is the standalone verification of a PR, or of trunk alone
+type preverification struct {
+	pr     GitHubPR
+	rev    string   // Commit verified, trunk with the PR merged onto it
+	run    *HookRun // Verification run, nil when the sandbox could not be set up
+	err    error
+	output bytes.Buffer // Progress and command output, printed once the verification ends
+}
+
+// preverifyPRs implements --preverify_parallelism, verifying every PR merged alone onto trunk.
+// Nothing is excluded when trunk alone fails the verification.
+func preverifyPRs(client GitHubClient, cfg Config, prs []GitHubPR, report *RunReport) []GitHubPR {
+	trunk, err := revParse(cfg.TrunkBranch)
+	if err != nil {
+		log.Fatal("error reading trunk branch:", err)
+	}
+	fmt.Printf("\nVerifying %d PR(s) merged alone onto '%s', %d at a time...\n", len(prs), cfg.TrunkBranch, cfg.PreverifyParallelism)
+
+	// The PR branches are fetched and merged sequentially, only the verifications run concurrently
+	checks := []*preverification{{rev: trunk}}
+	for _, pr := range prs {
+		branch, err := fetchPRBranch(pr, cfg)
+		if err != nil {
+			slog.Warn("PR not verified alone", "pr_number", pr.Number, "error", err)
+			continue
+		}
+		rev, conflicts, err := mergeInMemory(trunk, branch)
+		switch {
+		case err != nil:
+			slog.Warn("PR not verified alone", "pr_number", pr.Number, "error", err)
+		case len(conflicts) > 0:
+			fmt.Printf("PR #%d does not merge cleanly onto '%s' (%s), left to the assembly.\n", pr.Number, cfg.TrunkBranch, strings.Join(conflicts, ", "))
+		default:
+			checks = append(checks, &preverification{pr: pr, rev: rev})
+		}
+	}
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		slots = make(chan struct{}, cfg.PreverifyParallelism)
+	)
+	for _, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			c.run, c.err = verifyRevisionTo(cfg, c.rev, "preverify", &c.output, &c.output)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if c.pr.Number > 0 {
+				fmt.Printf("\n=== PR #%d ===\n%s", c.pr.Number, c.output.String())
+			} else {
+				fmt.Printf("\n=== %s ===\n%s", cfg.TrunkBranch, c.output.String())
+			}
+			if c.run != nil {
+				fmt.Println(c.run.describe() + ".")
+			} else {
+				fmt.Printf("Verification not run: %v\n", c.err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The runs are recorded in PR order, whatever order they ended in
+	for _, c := range checks {
+		if c.run != nil {
+			c.run.PR = c.pr.Number
+			report.hookRan(*c.run)
+		}
+	}
+	if checks[0].err != nil {
+		fmt.Printf("\nThe verification of '%s' alone failed (%v), no PR is excluded before the assembly.\n", cfg.TrunkBranch, checks[0].err)
+		return prs
+	}
+	failed := make(map[int]*preverification)
+	for _, c := range checks[1:] {
+		if c.run != nil && c.err != nil {
+			failed[c.pr.Number] = c
+		}
+	}
+	var kept []GitHubPR
+	var excluded []string
+	for _, pr := range prs {
+		c, ok := failed[pr.Number]
+		if !ok {
+			kept = append(kept, pr)
+			continue
+		}
+		excluded = append(excluded, fmt.Sprintf("#%d", pr.Number))
+		report.add(pr, OutcomeCulprit, fmt.Sprintf("verification '%s' fails with the PR merged alone onto '%s'", cfg.VerifyCmd, cfg.TrunkBranch), c.run.Duration)
+		notifyVerifyCulprit(client, cfg, pr, c.run.Output, true)
+	}
+	if len(excluded) > 0 {
+		fmt.Printf("\n%d PR(s) fail the verification alone and are excluded: %s\n", len(excluded), strings.Join(excluded, ", "))
+	} else {
+		fmt.Printf("\nEvery verified PR passes the verification alone.\n")
+	}
+	return kept
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// Constants for preview branch publishing
+const (
+	previewBranchPrefix = "preview/"                           // Prefix of per-PR preview branches
+	previewMarker       = "<!-- feature-branching:preview -->" // Identifies the preview comment on a PR
+)
+
+// previewBranchName returns the preview branch name for a PR
+func previewBranchName(pr GitHubPR) string {
+	return fmt.Sprintf("%spr-%d", previewBranchPrefix, pr.Number)
+}
+
+// publishPreviewBranches pushes a trunk + single PR branch for every merged PR
+// and comments the branch name on the PR. Failures are reported per PR and
+// never abort the run, since the combined branch has already been published.
+func publishPreviewBranches(client GitHubClient, cfg Config, prs []GitHubPR, merged []MergeRecord) {
+	mergedSet := make(map[int]struct{}, len(merged))
+	for _, m := range merged {
+		mergedSet[m.PR] = struct{}{}
+	}
+
+	fmt.Printf("\nPublishing preview branches from '%s':\n", cfg.TrunkBranch)
+	for _, pr := range prs {
+		if _, ok := mergedSet[pr.Number]; !ok {
+			continue
+		}
+		branch := previewBranchName(pr)
+		fmt.Printf("  #%d -> '%s' ... ", pr.Number, branch)
+		if err := publishPreviewBranch(cfg, pr, branch); err != nil {
+			fmt.Printf("FAILED\n         Reason: %s\n", firstLine(err.Error()))
+			runGitCommand("reset", "--hard", "HEAD")
+			continue
+		}
+		fmt.Println("OK")
+
+		body, err := renderText(cfg, "preview_comment", previewCommentData{
+			WebURL: cfg.WebURL,
+			Owner:  cfg.Owner,
+			Repo:   cfg.Repo,
+			Trunk:  cfg.TrunkBranch,
+			Branch: branch,
+			Number: pr.Number,
+		})
+		if err != nil {
+			slog.Warn("failed to build preview comment for PR", "pr_number", pr.Number, "error", err)
+			continue
+		}
+		if err := upsertComment(client, pr.Number, previewMarker, body); err != nil {
+			slog.Warn("failed to comment preview branch on PR", "pr_number", pr.Number, "error", err)
+		}
+	}
+
+	if err := runGitCommand("checkout", cfg.TargetBranch); err != nil {
+		slog.Warn("failed to return to target branch", "error", err)
+	}
+}
+
+// publishPreviewBranch recreates a preview branch from trunk and squashes the PR into it
+func publishPreviewBranch(cfg Config, pr GitHubPR, branch string) error {
+	if err := runGitCommand("checkout", "-B", branch, cfg.TrunkBranch); err != nil {
+		return fmt.Errorf("create preview branch failed: %w", err)
+	}
+
+	err := squashMergePR(pr, fmt.Sprintf("pr-%d", pr.Number), cfg)
+	if err != nil && !errors.Is(err, ErrEmptyMerge) {
+		return err
+	}
+
+	return runOriginGit("push", "origin", branch, "--force")
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Project stages of the batched PRs, in board order
+const (
+	projectQueued     = "queued"     // Qualifying PR not in the published candidate
+	projectCandidate  = "candidate"  // PR merged into the published candidate
+	projectConflicted = "conflicted" // PR conflicting with the batch
+	projectReleased   = "released"   // PR merged to trunk
+)
+
+// defaultProjectColumns are the field options of the stages unless --project_columns renames them
+var defaultProjectColumns = map[string]string{
+	projectQueued:     "Queued",
+	projectCandidate:  "In candidate",
+	projectConflicted: "Conflicted",
+	projectReleased:   "Released",
+}
+
+// parseProject parses a project as owner/number
+func parseProject(value string) (string, int, error) {
+	owner, number, ok := strings.Cut(value, "/")
+	n, err := strconv.Atoi(number)
+	if !ok || owner == "" || err != nil || n <= 0 {
+		return "", 0, fmt.Errorf("'%s' (expected owner/number, e.g. my-org/5)", value)
+	}
+	return owner, n, nil
+}
+
+// parseProjectColumns parses the project_columns entries "stage=option" over the default options
+func parseProjectColumns(entries []string) (map[string]string, error) {
+	columns := maps.Clone(defaultProjectColumns)
+	for _, entry := range entries {
+		stage, option, ok := strings.Cut(entry, "=")
+		stage, option = strings.TrimSpace(stage), strings.TrimSpace(option)
+		if _, known := defaultProjectColumns[stage]; !ok || !known || option == "" {
+			return nil, fmt.Errorf("'%s' (expected stage=option with stage one of %s, %s, %s or %s)",
+				entry, projectQueued, projectCandidate, projectConflicted, projectReleased)
+		}
+		columns[stage] = option
+	}
+	return columns, nil
+}
+
+// projectStage returns the stage of a PR outcome, empty for PRs the run did not batch.
+// Merged PRs are in the candidate only once it is published.
+func projectStage(outcome PROutcome, published bool) string {
+	switch outcome {
+	case OutcomeMerged, OutcomeAlreadyIncluded:
+		if published {
+			return projectCandidate
+		}
+		return projectQueued
+	case OutcomeConflict, OutcomeBinaryConflict:
+		return projectConflicted
+	case OutcomeNotAttempted, OutcomeDeferred, OutcomeBlocked, OutcomeFailed, OutcomeCulprit:
+		return projectQueued
+	}
+	return ""
+}
+
+// syncProject keeps the project board in line with the run: the batched PRs are added to
+// the project and moved to the column of their outcome, and the PRs of the repository
+// merged to trunk since are moved to the released column. Failures are logged as
+// warnings, the board never fails a run.
+func syncProject(client GitHubClient, cfg Config, report *RunReport, published bool) {
+	if cfg.Project == "" {
+		return
+	}
+	owner, number, _ := parseProject(cfg.Project)
+	project, err := client.GetProject(owner, number, cfg.ProjectField)
+	if err != nil {
+		slog.Warn("failed to load project", "project", cfg.Project, "error", err)
+		return
+	}
+	options := make(map[string]string, len(cfg.ProjectColumns))
+	for stage, name := range cfg.ProjectColumns {
+		id, ok := project.Options[name]
+		if !ok {
+			slog.Warn("project field has no option for a column", "project", cfg.Project, "field", cfg.ProjectField, "option", name)
+			return
+		}
+		options[stage] = id
+	}
+	items, err := client.ListProjectItems(project.ID, cfg.ProjectField)
+	if err != nil {
+		slog.Warn("failed to list the items of project", "project", cfg.Project, "error", err)
+		return
+	}
+	repo := cfg.Owner + "/" + cfg.Repo
+	current := make(map[int]ProjectItem)
+	for _, item := range items {
+		if strings.EqualFold(item.Repo, repo) {
+			current[item.Number] = item
+		}
+	}
+
+	// The last outcome of a PR wins, e.g. after a rebuild
+	stages := make(map[int]string)
+	for _, r := range report.Results {
+		if stage := projectStage(r.Outcome, published); stage != "" {
+			stages[r.Number] = stage
+		}
+	}
+	for n, item := range current {
+		if _, batched := stages[n]; !batched && item.State == "MERGED" {
+			stages[n] = projectReleased
+		}
+	}
+
+	moved := 0
+	for _, n := range slices.Sorted(maps.Keys(stages)) {
+		stage := stages[n]
+		item, ok := current[n]
+		if ok && item.Option == cfg.ProjectColumns[stage] {
+			continue
+		}
+		if !ok {
+			id, err := client.AddProjectItem(project.ID, n)
+			if err != nil {
+				slog.Warn("failed to add PR to project", "pr_number", n, "project", cfg.Project, "error", err)
+				continue
+			}
+			item = ProjectItem{ID: id, Number: n}
+		}
+		if err := client.SetProjectItemOption(project.ID, item.ID, project.FieldID, options[stage]); err != nil {
+			slog.Warn("failed to move PR in project", "pr_number", n, "project", cfg.Project, "column", cfg.ProjectColumns[stage], "error", err)
+			continue
+		}
+		moved++
+	}
+	fmt.Printf("Project '%s': %d PR(s) moved.\n", project.Title, moved)
+}
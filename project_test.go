@@ -0,0 +1,28 @@
+package main
+
+import (
+	"flag"
+	"maps"
+	"testing"
+)
+
+func TestProjectColumnsFlag(t *testing.T) {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	cfg, err := parseConfig(fs, []string{"--github_token", "test", "--owner", "o", "--repo", "r",
+		"--project", "o/1", "--project_columns", "candidate=In progress, released=Shipped to prod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := maps.Clone(defaultProjectColumns)
+	want[projectCandidate] = "In progress"
+	want[projectReleased] = "Shipped to prod"
+	if !maps.Equal(cfg.ProjectColumns, want) {
+		t.Errorf("project columns = %v, want %v", cfg.ProjectColumns, want)
+	}
+}
+
+func TestParseProjectColumnsRejectsUnknownStage(t *testing.T) {
+	if _, err := parseProjectColumns([]string{"review=In review"}); err == nil {
+		t.Error("unknown stage 'review' accepted")
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// passingConclusions lists the check run conclusions that let a stage be promoted
+var passingConclusions = []string{"success", "neutral", "skipped"}
+
+// mustFetchPromotedPRs enforces selecting the PRs promoted from the earlier stage. It
+// returns false when the stage cannot be promoted yet, leaving the target branch untouched.
+func mustFetchPromotedPRs(client GitHubClient, cfg Config, report *RunReport) ([]GitHubPR, bool) {
+	prs, ok, err := fetchPromotedPRs(client, cfg, report)
+	if err != nil {
+		log.Fatal("error reading promotion stage:", err)
+	}
+	return prs, ok
+}
+
+// fetchPromotedPRs selects the open PRs the history of the earlier stage branch merged,
+// pinned at the revision that stage merged, once the checks of the stage tip succeeded.
+// Later stages are thus built from exactly what the earlier stage tested, instead of
+// re-filtering PRs by labels that may have changed meanwhile.
+func fetchPromotedPRs(client GitHubClient, cfg Config, report *RunReport) ([]GitHubPR, bool, error) {
+	from := cfg.PromoteFrom
+	if err := runOriginGit("fetch", "origin", from); err != nil {
+		return nil, false, fmt.Errorf("fetch '%s' failed: %w", from, err)
+	}
+	tip, err := revParse("origin/" + from)
+	if err != nil {
+		return nil, false, err
+	}
+	history, err := loadRefHistoryAt("origin/" + from)
+	if err != nil {
+		return nil, false, fmt.Errorf("read '%s' history failed: %w", from, err)
+	}
+	open, err := client.ListOpenPRs(cfg.TrunkBranch)
+	if err != nil {
+		return nil, false, err
+	}
+	byNumber := make(map[int]GitHubPR, len(open))
+	for _, pr := range open {
+		byNumber[pr.Number] = pr
+	}
+	for _, m := range history.Merges {
+		if pr, ok := byNumber[m.PR]; ok {
+			report.discovered([]GitHubPR{pr})
+		}
+	}
+
+	runs, err := client.ListCheckRuns(tip)
+	if err != nil {
+		return nil, false, fmt.Errorf("read '%s' checks failed: %w", from, err)
+	}
+	if problem := stageCheckProblem(cfg, runs); problem != "" {
+		detail := fmt.Sprintf("stage '%s' at %s is not promotable: %s", from, shortSHA(tip), problem)
+		fmt.Printf("\nNot promoting: %s.\nTarget branch '%s' was not updated.\n", detail, cfg.TargetBranch)
+		for _, m := range history.Merges {
+			if pr, ok := byNumber[m.PR]; ok {
+				report.add(pr, OutcomeBlocked, detail, 0)
+			}
+		}
+		setOutput(cfg, "promoted", "false")
+		return nil, false, nil
+	}
+
+	fmt.Printf("Promoting %d PR(s) from '%s' at %s (checks passed).\n", len(history.Merges), from, shortSHA(tip))
+	var prs []GitHubPR
+	for _, m := range history.Merges {
+		pr, ok := byNumber[m.PR]
+		if !ok {
+			report.add(GitHubPR{Number: m.PR}, OutcomeClosed, fmt.Sprintf("PR is no longer open since '%s' merged it", from), 0)
+			continue
+		}
+		if slices.Contains(cfg.ExcludePRs, pr.Number) {
+			report.add(pr, OutcomeFiltered, "excluded from the batch", 0)
+			continue
+		}
+		if pr.SHA == "" {
+			if m.Head == "" {
+				slog.Warn("branch did not record the revision of PR, promoting its current head", "branch", from, "pr_number", pr.Number)
+			}
+			pr.SHA = m.Head
+		}
+		prs = append(prs, pr)
+	}
+	setOutput(cfg, "promoted", "true")
+	return prs, true, nil
+}
+
+// stageCheckProblem describes why the check runs of a stage tip block its promotion,
+// empty when every required check (every check without --promote_checks) passed
+func stageCheckProblem(cfg Config, runs []CheckRun) string {
+	if len(runs) == 0 {
+		return "no check runs reported yet"
+	}
+	required := cfg.PromoteChecks
+	if len(required) == 0 {
+		for _, run := range runs {
+			required = append(required, run.Name)
+		}
+		slices.Sort(required)
+		required = slices.Compact(required)
+	}
+	var problems []string
+	for _, name := range required {
+		// The API lists the latest run of every check first
+		i := slices.IndexFunc(runs, func(run CheckRun) bool { return run.Name == name })
+		switch {
+		case i < 0:
+			problems = append(problems, fmt.Sprintf("check '%s' missing", name))
+		case runs[i].Status != "completed":
+			problems = append(problems, fmt.Sprintf("check '%s' is %s", name, strings.ReplaceAll(runs[i].Status, "_", " ")))
+		case !slices.Contains(passingConclusions, runs[i].Conclusion):
+			problems = append(problems, fmt.Sprintf("check '%s' concluded %s", name, runs[i].Conclusion))
+		}
+	}
+	return strings.Join(problems, ", ")
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// protectRulesetName is the name of the ruleset --protect_target keeps on the target branch
+const protectRulesetName = "mergebot: %s"
+
+// rulesetRoles are the repository role IDs of the --protect_bypass 'role:<name>' entries
+var rulesetRoles = map[string]int64{"maintain": 2, "write": 4, "admin": 5}
+
+// parseProtectBypass parses the --protect_bypass entries into ruleset bypass actors: 'app'
+// for the GitHub App of app_id, 'app:<id>', 'team:<id>', 'role:<admin|maintain|write>' or
+// 'org_admin'
+func parseProtectBypass(entries []string, appID int64) ([]RulesetBypass, error) {
+	var actors []RulesetBypass
+	for _, entry := range entries {
+		kind, value, _ := strings.Cut(entry, ":")
+		actor := RulesetBypass{BypassMode: "always"}
+		switch kind {
+		case "app", "team":
+			actor.ActorType = "Integration"
+			if kind == "team" {
+				actor.ActorType = "Team"
+			}
+			if kind == "app" && value == "" {
+				if appID == 0 {
+					return nil, fmt.Errorf("invalid parameter 'protect_bypass': 'app' requires 'app_id'")
+				}
+				actor.ActorID = appID
+				break
+			}
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || id <= 0 {
+				return nil, fmt.Errorf("invalid parameter 'protect_bypass': '%s' (expected a positive %s ID)", entry, kind)
+			}
+			actor.ActorID = id
+		case "role":
+			id, ok := rulesetRoles[value]
+			if !ok {
+				return nil, fmt.Errorf("invalid parameter 'protect_bypass': '%s' (expected role:admin, role:maintain or role:write)", entry)
+			}
+			actor.ActorType, actor.ActorID = "RepositoryRole", id
+		case "org_admin":
+			actor.ActorType, actor.ActorID = "OrganizationAdmin", 1
+		default:
+			return nil, fmt.Errorf("invalid parameter 'protect_bypass': '%s' (expected app, app:<id>, team:<id>, role:<name> or org_admin)", entry)
+		}
+		actors = append(actors, actor)
+	}
+	return actors, nil
+}
+
+// targetRulesetSpec builds the ruleset of the target branch: only the bypass actors may
+// update it, force push to it or delete it, and the --protect_checks must pass on the
+// changes of everyone else. Creating the branch is left free, as is deleting it when
+// 'empty_batch' delete removes it between batches.
+func targetRulesetSpec(cfg Config) RulesetSpec {
+	spec := RulesetSpec{
+		Name:         fmt.Sprintf(protectRulesetName, cfg.TargetBranch),
+		Target:       "branch",
+		Enforcement:  "active",
+		BypassActors: cfg.ProtectBypass,
+		Rules:        []RulesetRule{{Type: "update"}, {Type: "non_fast_forward"}},
+	}
+	spec.Conditions.RefName.Include = []string{"refs/heads/" + cfg.TargetBranch}
+	spec.Conditions.RefName.Exclude = []string{}
+	if cfg.EmptyBatch != emptyBatchDelete {
+		spec.Rules = append(spec.Rules, RulesetRule{Type: "deletion"})
+	}
+	if len(cfg.ProtectChecks) > 0 {
+		var checks []map[string]string
+		for _, check := range cfg.ProtectChecks {
+			checks = append(checks, map[string]string{"context": check})
+		}
+		spec.Rules = append(spec.Rules, RulesetRule{Type: "required_status_checks", Parameters: map[string]any{
+			"required_status_checks":               checks,
+			"strict_required_status_checks_policy": false,
+		}})
+	}
+	return spec
+}
+
+// protectTargetBranch implements --protect_target once the target branch is published. A
+// failure is only a warning, the candidate is already pushed.
+func protectTargetBranch(client GitHubClient, cfg Config) {
+	if err := protectTarget(client, cfg); err != nil {
+		slog.Warn("failed to protect the target branch", "branch", cfg.TargetBranch, "error", err)
+	}
+}
+
+// protectTarget creates the ruleset of the target branch, or brings the one of a previous
+// run back to the configuration, so humans cannot commit to a branch every run rewrites.
+// It warns when the token itself cannot bypass the ruleset, as the next push would fail.
+func protectTarget(client GitHubClient, cfg Config) error {
+	spec := targetRulesetSpec(cfg)
+	rulesets, err := client.ListRulesets()
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+		return fmt.Errorf("rulesets are not available for this repository")
+	}
+	if err != nil {
+		return fmt.Errorf("list rulesets failed: %w", err)
+	}
+
+	var id int64
+	for _, ruleset := range rulesets {
+		if ruleset.Name == spec.Name {
+			id = ruleset.ID
+			break
+		}
+	}
+	action := "Updated"
+	if id == 0 {
+		if id, err = client.CreateRuleset(spec); err != nil {
+			return fmt.Errorf("create ruleset '%s' failed: %w", spec.Name, err)
+		}
+		action = "Created"
+	} else if err := client.UpdateRuleset(id, spec); err != nil {
+		return fmt.Errorf("update ruleset '%s' (#%d) failed: %w", spec.Name, id, err)
+	}
+	rules := make([]string, len(spec.Rules))
+	for i, rule := range spec.Rules {
+		rules[i] = rule.Type
+	}
+	fmt.Printf("%s ruleset '%s' (#%d) protecting '%s': %s.\n", action, spec.Name, id, cfg.TargetBranch, strings.Join(rules, ", "))
+
+	ruleset, err := client.GetRuleset(id)
+	if err != nil {
+		return fmt.Errorf("get ruleset %d failed: %w", id, err)
+	}
+	if ruleset.Bypass != "always" {
+		slog.Warn("the token cannot bypass the ruleset protecting the target branch, the next push will be rejected; add the bot to 'protect_bypass'",
+			"branch", cfg.TargetBranch, "ruleset", spec.Name)
+	}
+	return nil
+}
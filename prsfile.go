@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// mustLoadPRsFile enforces a readable candidate PR list
+func mustLoadPRsFile(cfg Config) []GitHubPR {
+	prs, err := loadPRsFile(cfg)
+	if err != nil {
+		log.Fatal("error loading PRs file:", err)
+	}
+	return prs
+}
+
+// loadPRsFile reads the candidate PRs from a file, or stdin when the path is "-".
+// Listed PRs bypass the API and the eligibility filters: they are batched as-is, in file order.
+func loadPRsFile(cfg Config) ([]GitHubPR, error) {
+	var data []byte
+	var err error
+	if cfg.PRsFile == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(cfg.PRsFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("file read failed: %w", err)
+	}
+
+	var prs []GitHubPR
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		prs, err = parsePRsJSON(trimmed)
+	} else {
+		prs, err = parsePRsCSV(trimmed)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int]struct{}, len(prs))
+	for i := range prs {
+		pr := &prs[i]
+		if pr.Number <= 0 {
+			return nil, fmt.Errorf("invalid PR number %d at position %d", pr.Number, i+1)
+		}
+		if _, dup := seen[pr.Number]; dup {
+			return nil, fmt.Errorf("PR #%d is listed more than once", pr.Number)
+		}
+		seen[pr.Number] = struct{}{}
+
+		if pr.Title == "" {
+			pr.Title = fmt.Sprintf("PR #%d", pr.Number)
+		}
+		if pr.State == "" {
+			pr.State = "open"
+		}
+		if pr.Base.Ref == "" {
+			pr.Base.Ref = cfg.TrunkBranch
+		}
+	}
+	return prs, nil
+}
+
+// parsePRsJSON accepts either an array of PR numbers or an array of PR objects.
+// Objects may name the PR "number" or "pr" and pin it with "sha".
+func parsePRsJSON(data []byte) ([]GitHubPR, error) {
+	var numbers []int
+	if err := json.Unmarshal(data, &numbers); err == nil {
+		prs := make([]GitHubPR, len(numbers))
+		for i, n := range numbers {
+			prs[i].Number = n
+		}
+		return prs, nil
+	}
+
+	var entries []struct {
+		GitHubPR
+		PR int `json:"pr"` // Alias of number
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("JSON decoding failed: %w", err)
+	}
+	prs := make([]GitHubPR, len(entries))
+	for i, e := range entries {
+		prs[i] = e.GitHubPR
+		if prs[i].Number == 0 {
+			prs[i].Number = e.PR
+		}
+	}
+	return prs, nil
+}
+
+// parsePRsCSV accepts rows of "number[,title[,sha]]", with an optional header row.
+// A single line of comma or whitespace separated numbers is also accepted.
+func parsePRsCSV(data []byte) ([]GitHubPR, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("CSV decoding failed: %w", err)
+	}
+
+	var prs []GitHubPR
+	for i, record := range records {
+		if len(record) == 0 {
+			continue
+		}
+		// "12, 15, 18" and "12 15 18" list numbers instead of number,title rows
+		if numbers, ok := parseNumberList(record); ok {
+			for _, n := range numbers {
+				prs = append(prs, GitHubPR{Number: n})
+			}
+			continue
+		}
+
+		first := strings.TrimPrefix(strings.TrimSpace(record[0]), "#")
+		number, err := strconv.Atoi(first)
+		if err != nil {
+			if i == 0 {
+				continue // header row
+			}
+			return nil, fmt.Errorf("invalid PR number %q on line %d", record[0], i+1)
+		}
+
+		pr := GitHubPR{Number: number}
+		if len(record) > 1 {
+			pr.Title = strings.TrimSpace(record[1])
+		}
+		if len(record) > 2 {
+			pr.SHA = strings.TrimSpace(record[2])
+		}
+		prs = append(prs, pr)
+	}
+	return prs, nil
+}
+
+// parseNumberList parses a record whose fields are all whitespace separated PR numbers
+func parseNumberList(record []string) ([]int, bool) {
+	var numbers []int
+	for _, field := range record {
+		for _, token := range strings.Fields(field) {
+			n, err := strconv.Atoi(strings.TrimPrefix(token, "#"))
+			if err != nil {
+				return nil, false
+			}
+			numbers = append(numbers, n)
+		}
+	}
+	return numbers, len(numbers) > 1 || (len(record) == 1 && len(numbers) == 1)
+}
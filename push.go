@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// pushRetryBackoff is the delay before the first push retry; it doubles on every retry
+const pushRetryBackoff = 2 * time.Second
+
+// pushRaceMarkers identify push failures caused by another writer moving the branch:
+// a lease mismatch, or the ref changing between the ref advertisement and the update
+var pushRaceMarkers = []string{"stale info", "[rejected]", "cannot lock ref", "failed to update ref"}
+
+// pushLease is the state the target branch push is validated against
+type pushLease struct {
+	Target string // Remote target SHA when the batch started, empty when the branch is missing
+	Trunk  string // Trunk SHA the batch was built on
+}
+
+// mustCapturePushLease enforces reading the lease of the target branch push
+func mustCapturePushLease(cfg Config) pushLease {
+	lease, err := capturePushLease(cfg)
+	if err != nil {
+		log.Fatal("error reading remote target branch:", err)
+	}
+	return lease
+}
+
+// capturePushLease records the remote target and the trunk the batch starts from
+func capturePushLease(cfg Config) (pushLease, error) {
+	target, err := remoteBranchSHA(cfg.TargetBranch)
+	if err != nil {
+		return pushLease{}, err
+	}
+	trunk, err := revParse(cfg.TrunkBranch)
+	if err != nil {
+		return pushLease{}, err
+	}
+	return pushLease{Target: target, Trunk: trunk}, nil
+}
+
+// remoteBranchSHA returns the commit of a branch on origin, empty when it does not exist
+func remoteBranchSHA(branch string) (string, error) {
+	output, err := runOriginGitWithOutput("ls-remote", "--heads", "origin", "refs/heads/"+branch)
+	if err != nil {
+		return "", fmt.Errorf("read remote branch '%s' failed: %w", branch, err)
+	}
+	sha, _, _ := strings.Cut(strings.TrimSpace(output), "\t")
+	return sha, nil
+}
+
+// pushChanges force-pushes the target branch with a lease on its state at the start of
+// the batch. When another writer moved the branch meanwhile, the push is retried with
+// backoff as long as trunk did not move, since the batch is still current in that case.
+// With a results branch the run report is pushed in the same atomic push, so the report
+// of a candidate is published if and only if the candidate is.
+func pushChanges(cfg Config, lease pushLease, report *RunReport) error {
+	for attempt := 0; ; attempt++ {
+		args := []string{"push", "origin", cfg.TargetBranch,
+			fmt.Sprintf("--force-with-lease=refs/heads/%s:%s", cfg.TargetBranch, lease.Target)}
+		if cfg.ResultsBranch != "" && report != nil {
+			// Rebuilt on every attempt, since a concurrent run may have moved the results branch
+			results, err := resultsRefspecs(cfg, report)
+			if err != nil {
+				return err
+			}
+			args = append(args, results...)
+		}
+		output, err := pushOrInjectRace(cfg, args)
+		if err == nil {
+			if report != nil {
+				candidate, _ := revParse(cfg.TargetBranch)
+				report.published(candidate)
+			}
+			return nil
+		}
+		if !isPushRace(output) {
+			return err
+		}
+		if attempt >= cfg.PushRetries {
+			return fmt.Errorf("remote '%s' kept moving after %d retries: %w", cfg.TargetBranch, attempt, err)
+		}
+
+		current, err := remoteBranchSHA(cfg.TargetBranch)
+		if err != nil {
+			return err
+		}
+		trunk, err := remoteBranchSHA(cfg.TrunkBranch)
+		if err != nil {
+			return err
+		}
+		if trunk != lease.Trunk {
+			return fmt.Errorf("remote '%s' moved to %s during the run; the batch built on %s is stale",
+				cfg.TrunkBranch, shortSHA(trunk), shortSHA(lease.Trunk))
+		}
+
+		delay := pushRetryBackoff << attempt
+		fmt.Printf(" remote moved to %s, retrying in %s...", shortSHA(current), delay)
+		time.Sleep(delay)
+		lease.Target = current
+	}
+}
+
+// isPushRace reports whether a failed push lost a race against another writer
+func isPushRace(output string) bool {
+	for _, marker := range pushRaceMarkers {
+		if strings.Contains(output, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// pushOrInjectRace pushes, unless --chaos rejects the push the way git reports a lost race
+func pushOrInjectRace(cfg Config, args []string) (string, error) {
+	if injectFault(cfg, faultPushRace, "push of "+cfg.TargetBranch) {
+		output := fmt.Sprintf(" ! [rejected]        %s -> %s (stale info, injected by --chaos)", cfg.TargetBranch, cfg.TargetBranch)
+		return output, fmt.Errorf("'git %s' failed: exit status 1\n%s", strings.Join(args, " "), output)
+	}
+	return runOriginGitWithOutput(args...)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// LabelQuota bounds the number of PRs carrying a label in a batch
+type LabelQuota struct {
+	Label string `json:"label"`         // Label counted, matched case-insensitively
+	Min   int    `json:"min,omitempty"` // Fewest PRs with the label a batch is published with
+	Max   int    `json:"max,omitempty"` // Most PRs with the label in a batch, -1 when unbounded
+}
+
+// describe renders the quota as in the label_quotas entries
+func (q LabelQuota) describe() string {
+	var bounds []string
+	if q.Min > 0 {
+		bounds = append(bounds, fmt.Sprintf("at least %d", q.Min))
+	}
+	if q.Max >= 0 {
+		bounds = append(bounds, fmt.Sprintf("at most %d", q.Max))
+	}
+	return fmt.Sprintf("%s PR(s) labeled '%s'", strings.Join(bounds, " and "), q.Label)
+}
+
+// parseLabelQuotas parses the label_quotas entries "label>=N" and "label<=N". Bounds of
+// the same label combine into one quota, e.g. 'qa-approved>=2,experimental<=1'.
+func parseLabelQuotas(entries []string) ([]LabelQuota, error) {
+	var quotas []LabelQuota
+	for _, entry := range entries {
+		i := max(strings.LastIndex(entry, ">="), strings.LastIndex(entry, "<="))
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid parameter 'label_quotas': '%s' (expected label>=N or label<=N)", entry)
+		}
+		label := strings.TrimSpace(entry[:i])
+		n, err := strconv.Atoi(strings.TrimSpace(entry[i+2:]))
+		if label == "" || err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid parameter 'label_quotas': '%s' (expected label>=N or label<=N)", entry)
+		}
+		j := slices.IndexFunc(quotas, func(q LabelQuota) bool { return strings.EqualFold(q.Label, label) })
+		if j < 0 {
+			quotas = append(quotas, LabelQuota{Label: label, Max: -1})
+			j = len(quotas) - 1
+		}
+		if entry[i] == '>' {
+			quotas[j].Min = n
+		} else {
+			quotas[j].Max = n
+		}
+	}
+	for _, q := range quotas {
+		if q.Max >= 0 && q.Min > q.Max {
+			return nil, fmt.Errorf("invalid parameter 'label_quotas': '%s' needs at least %d and at most %d PR(s)", q.Label, q.Min, q.Max)
+		}
+	}
+	return quotas, nil
+}
+
+// applyLabelQuotas selects the PRs of the batch under the label quotas. PRs filling the
+// minimum quotas are picked first, then the others, both in queue order so the first
+// PRs queued win ties; a PR that would exceed a maximum quota is deferred to the next
+// run. The max_prs cap applies after, considering the PRs picked for the minimum quotas
+// first. When a minimum quota cannot be met within the cap the whole batch is deferred,
+// rather than built short of it; PRs dropped later, e.g. by conflicts, are not replaced.
+// The selected PRs keep their queue order.
+func applyLabelQuotas(cfg Config, prs []GitHubPR, report *RunReport) []GitHubPR {
+	counts := make([]int, len(cfg.LabelQuotas))
+	matches := func(pr GitHubPR, q LabelQuota) bool { return hasAnyLabel(pr.Labels, []string{q.Label}) }
+	fits := func(pr GitHubPR) bool {
+		for i, q := range cfg.LabelQuotas {
+			if q.Max >= 0 && matches(pr, q) && counts[i] >= q.Max {
+				return false
+			}
+		}
+		return true
+	}
+	take := func(pr GitHubPR) {
+		for i, q := range cfg.LabelQuotas {
+			if matches(pr, q) {
+				counts[i]++
+			}
+		}
+	}
+
+	picked := make([]bool, len(prs))
+	var first, rest []GitHubPR
+	for i, pr := range prs {
+		if cfg.MaxPRs > 0 && len(first) == cfg.MaxPRs {
+			break
+		}
+		needed := false
+		for j, q := range cfg.LabelQuotas {
+			if counts[j] < q.Min && matches(pr, q) {
+				needed = true
+			}
+		}
+		if needed && fits(pr) {
+			take(pr)
+			picked[i] = true
+			first = append(first, pr)
+		}
+	}
+	for j, q := range cfg.LabelQuotas {
+		if counts[j] < q.Min {
+			detail := fmt.Sprintf("label quota not met: the batch needs %s, %d qualify", q.describe(), counts[j])
+			fmt.Printf("Label quota not met: the batch needs %s, %d qualify. Deferring %d PR(s) to the next run.\n", q.describe(), counts[j], len(prs))
+			for _, pr := range prs {
+				report.add(pr, OutcomeDeferred, detail, 0)
+			}
+			return nil
+		}
+	}
+
+	deferred := 0
+	for i, pr := range prs {
+		if picked[i] {
+			continue
+		}
+		if !fits(pr) {
+			detail := "label quota reached"
+			for j, q := range cfg.LabelQuotas {
+				if q.Max >= 0 && matches(pr, q) && counts[j] >= q.Max {
+					detail = fmt.Sprintf("label quota reached: the batch takes %s", q.describe())
+					break
+				}
+			}
+			report.add(pr, OutcomeDeferred, detail, 0)
+			deferred++
+			continue
+		}
+		take(pr)
+		rest = append(rest, pr)
+	}
+	if deferred > 0 {
+		fmt.Printf("Label quotas reached: deferring %d PR(s) to the next run.\n", deferred)
+	}
+
+	// The cap keeps the PRs listed first, then the batch returns to queue order
+	batch := limitBatch(cfg, append(first, rest...), report)
+	order := make(map[int]int, len(prs))
+	for i, pr := range prs {
+		order[pr.Number] = i
+	}
+	slices.SortFunc(batch, func(a, b GitHubPR) int { return order[a.Number] - order[b.Number] })
+	return batch
+}
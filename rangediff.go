@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Constants for the range-diff comments
+const (
+	rangeDiffMarker   = "<!-- feature-branching:range-diff -->" // Marker of range-diff comments
+	rangeDiffMaxBytes = 50000                                   // Range-diff excerpt of a comment, within the comment size limit of GitHub
+)
+
+// Change of a commit between two candidates, from the range-diff pair markers
+const (
+	rangeDiffUnchanged = "unchanged" // Same patch in both candidates ('=')
+	rangeDiffChanged   = "changed"   // Patch changed between the candidates ('!')
+	rangeDiffRemoved   = "removed"   // Commit of the previous candidate only ('<')
+	rangeDiffAdded     = "added"     // Commit of the new candidate only ('>')
+)
+
+// rangeDiffPair matches a commit pair line of 'git range-diff', such as
+// "1:  1a2b3c4 ! 1:  5d6e7f8 feat: one (#1)"
+var rangeDiffPair = regexp.MustCompile(`^\s*(?:\d+|-+):\s+([0-9a-f]+|-+)\s+([=!<>])\s+(?:\d+|-+):\s+([0-9a-f]+|-+)\s+(.*)$`)
+
+// rangeDiffEntry maps a commit of the previous candidate to the new one
+type rangeDiffEntry struct {
+	PR      int    // PR the commit merges, 0 for bookkeeping commits such as the history
+	Status  string // rangeDiffUnchanged, rangeDiffChanged, rangeDiffRemoved or rangeDiffAdded
+	Old     string // Abbreviated commit in the previous candidate, empty when added
+	New     string // Abbreviated commit in the new candidate, empty when removed
+	Subject string // Commit subject
+}
+
+// parseRangeDiff extracts the commit pairs of a 'git range-diff' output, attributing
+// them to the PRs of the previous and new merges
+func parseRangeDiff(output string, previous, merged []MergeRecord) []rangeDiffEntry {
+	statuses := map[string]string{"=": rangeDiffUnchanged, "!": rangeDiffChanged, "<": rangeDiffRemoved, ">": rangeDiffAdded}
+	var entries []rangeDiffEntry
+	for _, line := range strings.Split(output, "\n") {
+		m := rangeDiffPair.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		e := rangeDiffEntry{Status: statuses[m[2]], Subject: m[4]}
+		if strings.Trim(m[1], "-") != "" {
+			e.Old = m[1]
+			e.PR = mergedPR(previous, e.Old)
+		}
+		if strings.Trim(m[3], "-") != "" {
+			e.New = m[3]
+			if pr := mergedPR(merged, e.New); pr != 0 {
+				e.PR = pr
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// mergedPR returns the PR whose merge commit an abbreviated SHA names, 0 when none does
+func mergedPR(merges []MergeRecord, sha string) int {
+	for _, m := range merges {
+		if m.Commit != "" && strings.HasPrefix(m.Commit, sha) {
+			return m.PR
+		}
+	}
+	return 0
+}
+
+// publishRangeDiff comments on the tracking issue the 'git range-diff' between the
+// previously published candidate and the new one, with the commit of every PR mapped
+// across them, so reviewers only look at what evolved. previous are the merges of the
+// previous candidate, fetched with loadPreviousMerges. Errors are logged as warnings
+// since the branch has already been pushed.
+func publishRangeDiff(client GitHubClient, cfg Config, lease pushLease, previous, merged []MergeRecord, head string) {
+	if lease.Target == "" {
+		fmt.Println("Range-diff skipped: no previous candidate.")
+		return
+	}
+	if lease.Target == head {
+		fmt.Println("Range-diff skipped: candidate unchanged.")
+		return
+	}
+	output, err := runGitCommandWithOutput("range-diff", "--no-color",
+		cfg.TrunkBranch+".."+lease.Target, cfg.TrunkBranch+".."+head)
+	if err != nil {
+		slog.Warn("failed to compute the range-diff", "error", err)
+		return
+	}
+	data := rangeDiffData{
+		WebURL:    cfg.WebURL,
+		Owner:     cfg.Owner,
+		Repo:      cfg.Repo,
+		Trunk:     cfg.TrunkBranch,
+		Target:    cfg.TargetBranch,
+		BatchID:   cfg.BatchID,
+		Previous:  lease.Target,
+		Head:      head,
+		Commits:   parseRangeDiff(output, previous, merged),
+		RangeDiff: strings.TrimRight(output, "\n"),
+	}
+	if len(data.RangeDiff) > rangeDiffMaxBytes {
+		data.RangeDiff = data.RangeDiff[:rangeDiffMaxBytes] + fmt.Sprintf("\n[... %d bytes truncated ...]", len(data.RangeDiff)-rangeDiffMaxBytes)
+	}
+	body, err := renderText(cfg, "range_diff_comment", data)
+	if err == nil {
+		err = client.CreateIssueComment(cfg.TrackingIssue, rangeDiffMarker+"\n"+body)
+	}
+	if err != nil {
+		slog.Warn("failed to post the range-diff on tracking issue", "issue_number", cfg.TrackingIssue, "error", err)
+		return
+	}
+	fmt.Printf("Range-diff of %d commit(s) posted on tracking issue #%d.\n", len(data.Commits), cfg.TrackingIssue)
+}
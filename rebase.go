@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// rebaseSquashPR retries a conflicting PR by rebasing its branch onto the
+// current target tip inside a temporary worktree, then squashing the rebased
+// result into the target branch. The PR's local branch is left untouched.
+func rebaseSquashPR(pr GitHubPR, cfg Config) error {
+	targetBranch := cfg.TargetBranch
+	branch := fmt.Sprintf("pr-%d", pr.Number)
+
+	dir, err := os.MkdirTemp("", fmt.Sprintf("rebase-pr-%d-", pr.Number))
+	if err != nil {
+		return fmt.Errorf("create rebase worktree dir failed: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := runGitCommand("worktree", "add", "--detach", dir, branch); err != nil {
+		return fmt.Errorf("create rebase worktree failed: %w", err)
+	}
+	defer runGitCommand("worktree", "remove", "--force", dir)
+
+	if err := runGitCommand("-C", dir, "rebase", targetBranch); err != nil {
+		runGitCommand("-C", dir, "rebase", "--abort")
+		return fmt.Errorf("rebase onto '%s' failed: %w", targetBranch, err)
+	}
+
+	output, err := runGitCommandWithOutput("-C", dir, "rev-parse", "HEAD")
+	if err != nil {
+		return fmt.Errorf("resolve rebased head failed: %w", err)
+	}
+
+	return squashMergePR(pr, strings.TrimSpace(output), cfg)
+}
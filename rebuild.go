@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// runRecord is a published candidate of the results branch
+type runRecord struct {
+	Candidate string     // Candidate SHA the run pushed
+	History   RefHistory // Ref history of the candidate
+	Raw       []byte     // Ref history file as recorded
+	BuiltAt   time.Time  // Build time, from the history stamp
+}
+
+// runRebuild implements the 'rebuild' subcommand: it reconstructs the candidate of a past
+// run from the records of the results branch, merging the recorded PR heads onto the
+// recorded trunk revision, and pushes it under a distinct branch name
+func runRebuild(args []string) {
+	fs := flag.NewFlagSet("rebuild", flag.ExitOnError)
+	asOf := fs.String("as-of", "", "Run to rebuild: a batch ID, or a timestamp (RFC 3339 or YYYY-MM-DD) selecting the last candidate built at or before it")
+	trunk := fs.String("trunk_branch", "main", "Base branch name")
+	target := fs.String("target_branch", "", "Target branch name (defaults to pre-<trunk_branch>)")
+	results := fs.String("results_branch", "", "Results branch the runs were recorded on (see --results_branch of the bot)")
+	branch := fs.String("branch", "", "Branch receiving the rebuilt candidate (defaults to rebuild/<target_branch>-<batch ID>)")
+	push := fs.Bool("push", true, "Push the rebuilt branch to origin; it is only built locally otherwise")
+	fs.Parse(args)
+
+	if *target == "" {
+		*target = fmt.Sprintf("pre-%s", *trunk)
+	}
+	switch {
+	case *asOf == "":
+		log.Fatal("invalid configuration:", fmt.Errorf("missing required parameter: 'as-of'"))
+	case *results == "":
+		log.Fatal("invalid configuration:", fmt.Errorf("missing required parameter: 'results_branch'"))
+	}
+	mustDetectGit(Config{})
+
+	if err := runOriginGit("fetch", "origin", "+refs/heads/"+*results+":"+resultsRef); err != nil {
+		log.Fatal("error fetching results branch:", err)
+	}
+	records, err := loadRunRecords(resultsRef, *target)
+	if err != nil {
+		log.Fatal("error loading run records:", err)
+	}
+	record, err := selectRunRecord(records, *asOf)
+	if err != nil {
+		log.Fatal("error selecting run:", err)
+	}
+	h := record.History
+	fmt.Printf("Rebuilding run %s of '%s': candidate %s built %s on trunk %s with %d PR(s).\n",
+		h.BatchID, *target, shortSHA(record.Candidate), record.BuiltAt.Format(time.RFC3339), shortSHA(h.Stamp.Trunk), len(h.Merges))
+
+	if *branch == "" {
+		*branch = fmt.Sprintf("rebuild/%s-%s", *target, h.BatchID)
+	}
+	if err := validateBranchName(*branch); err != nil {
+		log.Fatal("invalid configuration:", fmt.Errorf("invalid parameter 'branch': %w", err))
+	}
+	if *branch == *target || *branch == *trunk {
+		log.Fatal("invalid configuration:", fmt.Errorf("parameter 'branch' must differ from the trunk and target branches"))
+	}
+
+	if err := rebuildRun(*branch, record); err != nil {
+		runGitCommand("reset", "--hard", "HEAD")
+		log.Fatal("error rebuilding run:", err)
+	}
+	if identical, err := sameTree(record.Candidate, "HEAD"); err == nil {
+		if identical {
+			fmt.Printf("The rebuilt tree is identical to candidate %s.\n", shortSHA(record.Candidate))
+		} else {
+			fmt.Printf("warning: the rebuilt tree differs from candidate %s\n", shortSHA(record.Candidate))
+		}
+	}
+
+	if !*push {
+		fmt.Printf("Rebuilt candidate into local branch '%s'.\n", *branch)
+		return
+	}
+	// The branch is the bot's own, rebuilding a run again replaces it
+	fmt.Printf("Pushing '%s' to remote...", *branch)
+	if err := runOriginGit("push", "origin", "+refs/heads/"+*branch+":refs/heads/"+*branch); err != nil {
+		log.Fatalf("\npush failed: %v", err)
+	}
+	fmt.Println(" done.")
+}
+
+// loadRunRecords reads the recorded candidates of a target branch from the results branch.
+// Runs published before ref histories were recorded there are skipped.
+func loadRunRecords(ref, target string) ([]runRecord, error) {
+	output, err := runGitCommandWithOutput("ls-tree", "--name-only", ref+":"+target)
+	if err != nil {
+		return nil, fmt.Errorf("no runs of '%s' recorded: %w", target, err)
+	}
+	var records []runRecord
+	for _, name := range strings.Fields(output) {
+		candidate, ok := strings.CutSuffix(name, refHistoryFile)
+		if !ok {
+			continue
+		}
+		raw, err := runGitCommandWithOutput("show", ref+":"+target+"/"+name)
+		if err != nil {
+			return nil, fmt.Errorf("run record of %s: %w", shortSHA(candidate), err)
+		}
+		h, err := decodeRefHistory([]byte(raw))
+		if err != nil {
+			return nil, fmt.Errorf("run record of %s: %w", shortSHA(candidate), err)
+		}
+		if h.Stamp == nil {
+			continue
+		}
+		records = append(records, runRecord{Candidate: candidate, History: h, Raw: []byte(raw), BuiltAt: h.Stamp.BuiltAt})
+	}
+	return records, nil
+}
+
+// selectRunRecord picks the run of a batch ID, else the last run built at or before a timestamp
+func selectRunRecord(records []runRecord, asOf string) (runRecord, error) {
+	var best *runRecord
+	for i, r := range records {
+		if r.History.BatchID == asOf && (best == nil || r.BuiltAt.After(best.BuiltAt)) {
+			best = &records[i]
+		}
+	}
+	if best != nil {
+		return *best, nil
+	}
+
+	at, err := time.Parse(time.RFC3339, asOf)
+	if err != nil {
+		day, dayErr := time.Parse(time.DateOnly, asOf)
+		if dayErr != nil {
+			return runRecord{}, fmt.Errorf("'%s' is neither a recorded batch ID nor a timestamp", asOf)
+		}
+		// A day selects the last run of that day
+		at = day.Add(24*time.Hour - time.Nanosecond)
+	}
+	for i, r := range records {
+		// Runs are listed to the second, so a listed time selects the run it lists
+		if !r.BuiltAt.Truncate(time.Second).After(at) && (best == nil || r.BuiltAt.After(best.BuiltAt)) {
+			best = &records[i]
+		}
+	}
+	if best == nil {
+		return runRecord{}, fmt.Errorf("no run recorded at or before %s", at.Format(time.RFC3339))
+	}
+	return *best, nil
+}
+
+// rebuildRun squashes the recorded PR heads, in the recorded order, onto the recorded trunk
+// revision in branch, and commits the ref history of the run as recorded. The commits are
+// new, but the tree matches the candidate when the PRs reproduce its content.
+func rebuildRun(branch string, record runRecord) error {
+	h := record.History
+	if err := ensureCommit(h.Stamp.Trunk); err != nil {
+		return fmt.Errorf("trunk revision: %w", err)
+	}
+	if err := runGitCommand("checkout", "-B", branch, h.Stamp.Trunk); err != nil {
+		return fmt.Errorf("create branch failed: %w", err)
+	}
+
+	cfg := Config{TrunkBranch: h.Stamp.Trunk, TargetBranch: branch, CommitMode: commitModePerPR, BatchID: h.BatchID}
+	for _, m := range h.Merges {
+		if m.Head == "" {
+			return fmt.Errorf("PR #%d has no recorded head revision", m.PR)
+		}
+		pr := GitHubPR{Number: m.PR, Title: fmt.Sprintf("PR #%d", m.PR), SHA: m.Head}
+		fmt.Printf("  #%d @%s ... ", pr.Number, shortSHA(m.Head))
+		if err := processSinglePR(pr, cfg); err != nil && !errors.Is(err, ErrEmptyMerge) {
+			fmt.Println("FAILED")
+			return fmt.Errorf("PR #%d could not be merged: %w", pr.Number, err)
+		}
+		fmt.Println("OK")
+	}
+
+	if err := os.WriteFile(refHistoryFile, record.Raw, 0644); err != nil {
+		return fmt.Errorf("file write failed: %w", err)
+	}
+	if err := runGitCommand("add", refHistoryFile); err != nil {
+		return fmt.Errorf("staging history file failed: %w", err)
+	}
+	message := fmt.Sprintf("chore: rebuild run %s of candidate %s", h.BatchID, shortSHA(record.Candidate))
+	return runGitCommand("commit", "--allow-empty", "-m", prCommitMessage(cfg, message))
+}
+
+// ensureCommit fetches a commit by ID unless it is already present
+func ensureCommit(sha string) error {
+	if _, err := revParse(sha + "^{commit}"); err == nil {
+		return nil
+	}
+	runOriginGit("fetch", "origin", sha)
+	if _, err := revParse(sha + "^{commit}"); err != nil {
+		return fmt.Errorf("'%s' is unreachable", sha)
+	}
+	return nil
+}
+
+// sameTree reports whether two commits have the same tree; the recorded candidate may be
+// gone after later force-pushes, in which case the comparison fails
+func sameTree(a, b string) (bool, error) {
+	if err := ensureCommit(a); err != nil {
+		return false, err
+	}
+	ta, err := revParse(a + "^{tree}")
+	if err != nil {
+		return false, err
+	}
+	tb, err := revParse(b + "^{tree}")
+	if err != nil {
+		return false, err
+	}
+	return ta == tb, nil
+}
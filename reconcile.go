@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// reconcileBatch re-queries the merged PRs right before publishing and rebuilds the
+// target branch without the ones closed or merged to trunk since discovery, so their
+// content is neither duplicated nor reverted on the candidate branch.
+// It returns false when the rebuilt batch is not published (zero merges kept).
+func reconcileBatch(client GitHubClient, cfg Config, prs []GitHubPR, merged []MergeRecord, report *RunReport) ([]GitHubPR, []MergeRecord, bool) {
+	closed := closedPRs(client, merged)
+	if len(closed) == 0 {
+		return prs, merged, true
+	}
+
+	wasMerged := make(map[int]struct{}, len(merged))
+	for _, m := range merged {
+		wasMerged[m.PR] = struct{}{}
+	}
+	var kept, rebuilt []GitHubPR
+	for _, pr := range prs {
+		if state, ok := closed[pr.Number]; ok {
+			fmt.Printf("PR #%d was %s since discovery; dropping it from the batch.\n", pr.Number, state)
+			continue
+		}
+		kept = append(kept, pr)
+		if _, ok := wasMerged[pr.Number]; ok {
+			rebuilt = append(rebuilt, pr)
+		}
+	}
+	report.reclassify(closed, rebuilt)
+
+	// The rebuild only replays PRs already merged once, so the run deadline no longer applies
+	fmt.Printf("\nRebuilding target branch '%s' without %d closed PR(s)...\n", cfg.TargetBranch, len(closed))
+	prepareTargetBranch(cfg)
+	cfg.MaxRunDuration = 0
+	merged, ok := buildBatch(client, cfg, rebuilt, report)
+	return kept, merged, ok
+}
+
+// closedPRs returns the merged PRs that are no longer open, with their current state.
+// Lookup errors keep the PR in the batch since its content was already verified.
+func closedPRs(client GitHubClient, merged []MergeRecord) map[int]string {
+	closed := make(map[int]string)
+	for _, m := range merged {
+		pr, err := client.GetPR(m.PR)
+		if err != nil {
+			slog.Warn("failed to re-query PR", "pr_number", m.PR, "error", err)
+			continue
+		}
+		if pr.State != "open" {
+			closed[m.PR] = pr.State
+		}
+	}
+	return closed
+}
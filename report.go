@@ -0,0 +1,381 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PROutcome is the final status of a candidate PR in a run
+type PROutcome string
+
+// Possible PR outcomes
+const (
+	OutcomeMerged          PROutcome = "merged"           // Squashed into the target branch
+	OutcomeAlreadyIncluded PROutcome = "already_included" // Changes already present in the target branch
+	OutcomeConflict        PROutcome = "conflict"         // Squash merge conflicted
+	OutcomeFailed          PROutcome = "failed"           // Fetch or commit failed
+	OutcomeFiltered        PROutcome = "filtered"         // Excluded by an eligibility filter
+	OutcomeNotAttempted    PROutcome = "not_attempted"    // Batch aborted before reaching the PR
+	OutcomeDeferred        PROutcome = "deferred"         // Left for the next run by the run deadline, the batch size cap or the batch risk cap
+	OutcomeClosed          PROutcome = "closed"           // Closed or merged to trunk before the batch was published
+	OutcomeBinaryConflict  PROutcome = "binary_conflict"  // Skipped by the binary conflict policy
+	OutcomeBlocked         PROutcome = "blocked"          // Cross-repo dependency missing from the run, earlier promotion stage not passed, denied by a policy or too risky
+	OutcomeCulprit         PROutcome = "culprit"          // Excluded for failing the verification, bisected or merged alone onto trunk
+)
+
+// PRResult records the outcome of a single PR
+type PRResult struct {
+	Number   int           `json:"number"`          // PR number
+	Title    string        `json:"title"`           // PR title
+	Outcome  PROutcome     `json:"outcome"`         // Final status
+	Detail   string        `json:"detail"`          // Failure, conflict or filter details
+	Duration time.Duration `json:"duration"`        // Time spent merging the PR
+	Files    []string      `json:"files,omitempty"` // Conflicting files
+}
+
+// RunReport collects the per-PR outcomes of a run for report emitters
+type RunReport struct {
+	TrunkBranch  string           `json:"trunk_branch"`            // Base branch of the batch
+	TargetBranch string           `json:"target_branch"`           // Branch the batch was merged into
+	BatchID      string           `json:"batch_id"`                // Run ID
+	StartedAt    time.Time        `json:"started_at"`              // Run start timestamp
+	Cutoff       *RunCutoff       `json:"cutoff,omitempty"`        // Set when the run deadline deferred PRs
+	Policy       []PolicyDecision `json:"policy,omitempty"`        // Decisions of the batching policies
+	Risk         *RiskReport      `json:"risk,omitempty"`          // Risk scores of the PRs and the batch
+	Token        *TokenGrant      `json:"token,omitempty"`         // GitHub App installation token of the run
+	API          *APIUsage        `json:"api,omitempty"`           // GitHub API usage of the run
+	Chaos        *ChaosReport     `json:"chaos,omitempty"`         // Faults injected by --chaos
+	Diff         *DiffSummary     `json:"diff,omitempty"`          // Candidate diff against trunk, once built
+	Hooks        []HookRun        `json:"hooks,omitempty"`         // Hook commands run, such as the verification
+	Bisection    *VerifyBisection `json:"bisection,omitempty"`     // Bisection of a failing verification
+	ChangedPaths *ChangedPaths    `json:"changed_paths,omitempty"` // Paths changed by the batch and by each PR
+	Deps         *DepsGroup       `json:"deps,omitempty"`          // Dependency update PRs grouped into a single commit
+	Candidate    string           `json:"candidate,omitempty"`     // Pushed target SHA, once published
+	Results      []PRResult       `json:"results"`                 // Outcomes in evaluation order
+
+	events   []RunEvent // Event log the report is derived from
+	eventLog string     // File the events are appended to, empty when not persisted
+}
+
+// reportEmitters maps every --report format to its writer
+var reportEmitters = map[string]func(r *RunReport, w io.Writer) error{
+	"json":  writeJSONReport,
+	"junit": writeJUnitReport,
+	"sarif": writeSARIFReport,
+	"tap":   writeTAPReport,
+}
+
+// newRunReport starts an empty report for the configured branches
+func newRunReport(cfg Config) *RunReport {
+	r := &RunReport{eventLog: eventLogPath(cfg)}
+	r.record(RunEvent{Type: EventRunStarted, Trunk: cfg.TrunkBranch, Target: cfg.TargetBranch, BatchID: cfg.BatchID})
+	return r
+}
+
+// addConflict records a conflicting PR together with its conflicting files
+func (r *RunReport) addConflict(pr GitHubPR, conflict *ConflictError, detail string, duration time.Duration) {
+	r.addResult(PRResult{Number: pr.Number, Title: pr.Title, Outcome: OutcomeConflict, Detail: detail, Duration: duration, Files: conflict.Files})
+}
+
+// add records the outcome of a PR
+func (r *RunReport) add(pr GitHubPR, outcome PROutcome, detail string, duration time.Duration) {
+	r.addResult(PRResult{
+		Number:   pr.Number,
+		Title:    pr.Title,
+		Outcome:  outcome,
+		Detail:   detail,
+		Duration: duration,
+	})
+}
+
+// addResult records a PR outcome as the event of its type
+func (r *RunReport) addResult(res PRResult) {
+	r.record(RunEvent{Type: eventTypeOf(res.Outcome), Result: &res})
+}
+
+// reclassify marks the closed PRs and forgets the results of the PRs merged again by a rebuild
+func (r *RunReport) reclassify(closed map[int]string, rebuilt []GitHubPR) {
+	numbers := make([]int, len(rebuilt))
+	for i, pr := range rebuilt {
+		numbers[i] = pr.Number
+	}
+	r.record(RunEvent{Type: EventPRsReclassified, Closed: closed, Rebuilt: numbers})
+}
+
+// applyReclassify applies a PRsReclassified event to the results
+func (r *RunReport) applyReclassify(closed map[int]string, rebuilt []int) {
+	redo := make(map[int]struct{}, len(rebuilt))
+	for _, n := range rebuilt {
+		redo[n] = struct{}{}
+	}
+
+	results := r.Results[:0]
+	for _, res := range r.Results {
+		if _, ok := redo[res.Number]; ok {
+			continue
+		}
+		if state, ok := closed[res.Number]; ok {
+			res.Outcome, res.Detail = OutcomeClosed, fmt.Sprintf("PR was %s before the batch was published", state)
+		}
+		results = append(results, res)
+	}
+	r.Results = results
+}
+
+// validReportFormats lists the supported --report values
+func validReportFormats() []string {
+	formats := make([]string, 0, len(reportEmitters))
+	for f := range reportEmitters {
+		formats = append(formats, f)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// writeRunReport emits the configured report, if any.
+// Errors are logged as warnings since reports must not change the run outcome.
+func writeRunReport(cfg Config, r *RunReport) {
+	r.finish()
+	if cfg.ReportDir != "" {
+		writeReportDir(cfg, r)
+	}
+	if cfg.Report == "" {
+		return
+	}
+
+	var w io.Writer = os.Stdout
+	if cfg.ReportFile != "" && cfg.ReportFile != "-" {
+		if dir := filepath.Dir(cfg.ReportFile); dir != "." {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				slog.Warn("failed to create report dir", "error", err)
+				return
+			}
+		}
+		f, err := os.Create(cfg.ReportFile)
+		if err != nil {
+			slog.Warn("failed to create report file", "error", err)
+			return
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := reportEmitters[cfg.Report](r, w); err != nil {
+		slog.Warn("failed to write report", "format", cfg.Report, "error", err)
+	}
+}
+
+// junitTestSuites is the root element of a JUnit XML report
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+// junitTestSuite groups the PRs of a run
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	ID        string          `xml:"id,attr,omitempty"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+// junitTestCase represents a single PR
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+// junitMessage carries failure or skip details
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",cdata"`
+}
+
+// writeJUnitReport renders each PR as a test case:
+// merged passes, conflicts and failures fail, everything else is skipped
+func writeJUnitReport(r *RunReport, w io.Writer) error {
+	suite := junitTestSuite{
+		Name:      fmt.Sprintf("feature-branching/%s", r.TargetBranch),
+		ID:        r.BatchID,
+		Timestamp: r.StartedAt.Format(time.RFC3339),
+	}
+
+	var total time.Duration
+	for _, res := range r.Results {
+		total += res.Duration
+		tc := junitTestCase{
+			ClassName: r.TargetBranch,
+			Name:      fmt.Sprintf("#%d %s", res.Number, res.Title),
+			Time:      fmt.Sprintf("%.3f", res.Duration.Seconds()),
+		}
+		switch res.Outcome {
+		case OutcomeMerged:
+		case OutcomeConflict, OutcomeFailed, OutcomeCulprit:
+			tc.Failure = &junitMessage{Message: string(res.Outcome), Body: res.Detail}
+			suite.Failures++
+		default:
+			tc.Skipped = &junitMessage{Message: strings.ReplaceAll(string(res.Outcome), "_", " "), Body: res.Detail}
+			suite.Skipped++
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	suite.Tests = len(suite.Cases)
+	suite.Time = fmt.Sprintf("%.3f", total.Seconds())
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// writeJSONReport renders the run report as indented JSON
+func writeJSONReport(r *RunReport, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// sarifLog is the root of a SARIF 2.1.0 log
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+// sarifRun holds the results of a single run
+type sarifRun struct {
+	Tool struct {
+		Driver struct {
+			Name  string      `json:"name"`
+			Rules []sarifRule `json:"rules"`
+		} `json:"driver"`
+	} `json:"tool"`
+	AutomationDetails struct {
+		ID string `json:"id"`
+	} `json:"automationDetails"`
+	Results []sarifResult `json:"results"`
+}
+
+// sarifRule describes a kind of result
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+// sarifResult is a single finding
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+	} `json:"physicalLocation"`
+}
+
+// writeSARIFReport renders conflicts and failures as SARIF 2.1.0 results,
+// locating conflicts on their files so code scanning can annotate them
+func writeSARIFReport(r *RunReport, w io.Writer) error {
+	var run sarifRun
+	run.Tool.Driver.Name = "feature-branching"
+	run.Tool.Driver.Rules = []sarifRule{
+		{ID: string(OutcomeConflict), ShortDescription: sarifMessage{Text: "PR conflicts with the batch"}},
+		{ID: string(OutcomeFailed), ShortDescription: sarifMessage{Text: "PR could not be merged"}},
+		{ID: string(OutcomeCulprit), ShortDescription: sarifMessage{Text: "PR fails the verification of the batch"}},
+	}
+	run.AutomationDetails.ID = fmt.Sprintf("feature-branching/%s/%s", r.TargetBranch, r.BatchID)
+	run.Results = []sarifResult{}
+	for _, res := range r.Results {
+		if res.Outcome != OutcomeConflict && res.Outcome != OutcomeFailed && res.Outcome != OutcomeCulprit {
+			continue
+		}
+		result := sarifResult{
+			RuleID:  string(res.Outcome),
+			Level:   "error",
+			Message: sarifMessage{Text: fmt.Sprintf("PR #%d %s: %s", res.Number, res.Title, firstLine(res.Detail))},
+		}
+		for _, f := range res.Files {
+			var loc sarifLocation
+			loc.PhysicalLocation.ArtifactLocation.URI = f
+			result.Locations = append(result.Locations, loc)
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
+
+// writeTAPReport renders each PR as a TAP version 13 test point:
+// merged is ok, conflicts and failures are not ok with a YAML diagnostic block,
+// everything else is ok with a SKIP directive
+func writeTAPReport(r *RunReport, w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("TAP version 13\n")
+	fmt.Fprintf(&b, "1..%d\n", len(r.Results))
+	if r.BatchID != "" {
+		fmt.Fprintf(&b, "# batch %s\n", r.BatchID)
+	}
+	for i, res := range r.Results {
+		// '#' starts a directive in TAP, so it is escaped in descriptions
+		desc := strings.ReplaceAll(fmt.Sprintf("PR %d %s", res.Number, res.Title), "#", "\\#")
+		switch res.Outcome {
+		case OutcomeMerged:
+			fmt.Fprintf(&b, "ok %d - %s\n", i+1, desc)
+		case OutcomeConflict, OutcomeFailed, OutcomeCulprit:
+			fmt.Fprintf(&b, "not ok %d - %s\n", i+1, desc)
+			b.WriteString("  ---\n")
+			fmt.Fprintf(&b, "  outcome: %s\n", res.Outcome)
+			fmt.Fprintf(&b, "  duration_ms: %d\n", res.Duration.Milliseconds())
+			b.WriteString("  detail: |\n")
+			for _, line := range strings.Split(strings.TrimRight(res.Detail, "\n"), "\n") {
+				fmt.Fprintf(&b, "    %s\n", line)
+			}
+			b.WriteString("  ...\n")
+		default:
+			reason := strings.ReplaceAll(string(res.Outcome), "_", " ")
+			if detail := firstLine(res.Detail); detail != "" {
+				reason += ": " + detail
+			}
+			fmt.Fprintf(&b, "ok %d - %s # SKIP %s\n", i+1, desc, reason)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// reportIndexFile is the manifest listing the reports of a --report_dir
+const reportIndexFile = "index.json"
+
+// reportDirFiles names the file of every report format inside a --report_dir
+var reportDirFiles = map[string]string{
+	"json":  "result.json",
+	"junit": "junit.xml",
+	"sarif": "results.sarif",
+	"tap":   "results.tap",
+}
+
+// reportConflictFile is the conflict report path inside a --report_dir
+const reportConflictFile = "conflict.json"
+
+// ReportIndex is the index.json manifest of a report directory
+type ReportIndex struct {
+	BatchID      string             `json:"batch_id"`      // Run that produced the reports
+	TrunkBranch  string             `json:"trunk_branch"`  // Base branch of the batch
+	TargetBranch string             `json:"target_branch"` // Branch the batch was merged into
+	GeneratedAt  time.Time          `json:"generated_at"`  // Manifest timestamp
+	Files        []ReportIndexEntry `json:"files"`         // Reports in the directory
+}
+
+// ReportIndexEntry describes a single report file
+type ReportIndexEntry struct {
+	Name   string `json:"name"`   // File name relative to the report directory
+	Format string `json:"format"` // Report format
+	Size   int64  `json:"size"`   // File size in bytes
+}
+
+// writeReportDir writes the run report in every format into the report directory,
+// next to the conflict report of the run, and lists them in index.json.
+// Errors are logged as warnings since reports must not change the run outcome.
+func writeReportDir(cfg Config, r *RunReport) {
+	if err := os.MkdirAll(cfg.ReportDir, 0755); err != nil {
+		slog.Warn("failed to create report dir", "error", err)
+		return
+	}
+
+	index := ReportIndex{
+		BatchID:      r.BatchID,
+		TrunkBranch:  r.TrunkBranch,
+		TargetBranch: r.TargetBranch,
+		GeneratedAt:  time.Now().UTC(),
+		Files:        []ReportIndexEntry{},
+	}
+	for _, format := range validReportFormats() {
+		name := reportDirFiles[format]
+		if err := writeReportFile(filepath.Join(cfg.ReportDir, name), format, r); err != nil {
+			slog.Warn("failed to write report", "format", format, "error", err)
+			continue
+		}
+		index.add(cfg.ReportDir, name, format)
+	}
+	// Only a conflict report of this run belongs to the manifest
+	if info, err := os.Stat(filepath.Join(cfg.ReportDir, reportConflictFile)); err == nil && !info.ModTime().Before(r.StartedAt.Truncate(time.Second)) {
+		index.add(cfg.ReportDir, reportConflictFile, "conflict")
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		slog.Warn("report index serialization failed", "error", err)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(cfg.ReportDir, reportIndexFile), append(data, '\n'), 0644); err != nil {
+		slog.Warn("failed to write report index", "error", err)
+		return
+	}
+	fmt.Printf("Reports written to '%s'.\n", cfg.ReportDir)
+}
+
+// writeReportFile renders the run report in one format into a file
+func writeReportFile(file, format string, r *RunReport) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := reportEmitters[format](r, f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// add lists a written report in the manifest
+func (idx *ReportIndex) add(dir, name, format string) {
+	var size int64
+	if info, err := os.Stat(filepath.Join(dir, name)); err == nil {
+		size = info.Size()
+	}
+	idx.Files = append(idx.Files, ReportIndexEntry{Name: name, Format: format, Size: size})
+}
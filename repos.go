@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// RepoTarget is a repository of --repos, with the branches overriding the run ones
+type RepoTarget struct {
+	Owner        string `json:"owner"`                   // Repository owner
+	Name         string `json:"name"`                    // Repository name
+	TargetBranch string `json:"target_branch,omitempty"` // Target branch of the repository, the run one when empty
+	TrunkBranch  string `json:"trunk_branch,omitempty"`  // Trunk branch of the repository, the run one when empty
+}
+
+// fullName returns the repository as owner/name
+func (t RepoTarget) fullName() string {
+	return t.Owner + "/" + t.Name
+}
+
+// parseRepoTargets parses the --repos entries "owner/name[:target_branch[:trunk_branch]]"
+func parseRepoTargets(entries []string) ([]RepoTarget, error) {
+	var targets []RepoTarget
+	for _, entry := range entries {
+		invalid := fmt.Errorf("invalid parameter 'repos': '%s' (expected owner/name[:target_branch[:trunk_branch]])", entry)
+		fields := strings.Split(entry, ":")
+		owner, name, ok := strings.Cut(strings.TrimSpace(fields[0]), "/")
+		if !ok || owner == "" || name == "" || strings.Contains(name, "/") || len(fields) > 3 {
+			return nil, invalid
+		}
+		t := RepoTarget{Owner: owner, Name: name}
+		if len(fields) > 1 {
+			t.TargetBranch = strings.TrimSpace(fields[1])
+		}
+		if len(fields) > 2 {
+			if t.TrunkBranch = strings.TrimSpace(fields[2]); t.TrunkBranch == "" {
+				return nil, invalid
+			}
+		}
+		for _, other := range targets {
+			if strings.EqualFold(other.fullName(), t.fullName()) {
+				return nil, fmt.Errorf("invalid parameter 'repos': duplicate repository '%s'", t.fullName())
+			}
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// runRepoTargets batches the --repos repositories as org mode batches the discovered ones:
+// each in a fresh clone and its own bot process, with its target and trunk branches. The
+// clone URL of every repository is looked up first, so a missing repository or a token
+// without access fails the run before any repository is batched.
+func runRepoTargets(cfg Config, args []string) {
+	var selected []Repository
+	targets := make(map[string]RepoTarget, len(cfg.Repos))
+	for _, t := range cfg.Repos {
+		repoCfg := cfg
+		repoCfg.Owner, repoCfg.Repo = t.Owner, t.Name
+		client := mustNewGitHubClient(repoCfg)
+		r, err := client.GetRepository()
+		if err != nil {
+			log.Fatalf("error looking up repository '%s': %v", t.fullName(), err)
+		}
+		if r.Archived {
+			log.Fatalf("error looking up repository '%s': repository is archived", t.fullName())
+		}
+		r.FullName = t.fullName()
+		if r.Name == "" {
+			r.Name = t.Name
+		}
+		selected = append(selected, r)
+		targets[r.FullName] = t
+	}
+	fmt.Printf("Batching %d repositories.\n", len(selected))
+
+	batchRepositories(cfg, args, selected, func(r Repository) []string {
+		var repoArgs []string
+		if t := targets[r.FullName]; t.TargetBranch != "" {
+			repoArgs = append(repoArgs, "--target_branch", t.TargetBranch)
+		}
+		if t := targets[r.FullName]; t.TrunkBranch != "" {
+			repoArgs = append(repoArgs, "--trunk_branch", t.TrunkBranch)
+		}
+		return repoArgs
+	})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Constants for the results branch
+const (
+	resultsRef       = "refs/feature-branching/results" // Local ref the results branch is fetched into
+	resultsLatest    = "latest.json"                    // Report of the last candidate of a target
+	botCommitterName = "github-actions[bot]"            // Author of the commits built by the bot outside the target branch
+	botCommitterMail = "41898282+github-actions[bot]@users.noreply.github.com"
+)
+
+// resultsRefspecs builds the results branch commit recording the report of the candidate
+// and returns the push arguments publishing it atomically with the target branch. The
+// report is stored as '<target>/<candidate SHA>.json' and '<target>/latest.json', and the
+// ref history of the candidate as '<target>/<candidate SHA>.ref-history' for rebuilds.
+func resultsRefspecs(cfg Config, report *RunReport) ([]string, error) {
+	candidate, err := revParse(cfg.TargetBranch)
+	if err != nil {
+		return nil, err
+	}
+	// The report is published with the candidate, before its Published event is recorded
+	snapshot := *report
+	snapshot.Candidate = candidate
+	var data bytes.Buffer
+	if err := writeJSONReport(&snapshot, &data); err != nil {
+		return nil, fmt.Errorf("report serialization failed: %w", err)
+	}
+
+	// The lease pins the fetched results tip, so concurrent runs rebuild on top of each other
+	var parent string
+	if runOriginGit("fetch", "origin", "+refs/heads/"+cfg.ResultsBranch+":"+resultsRef) == nil {
+		if parent, err = revParse(resultsRef); err != nil {
+			return nil, err
+		}
+	}
+	files := map[string][]byte{
+		cfg.TargetBranch + "/" + candidate + ".json": data.Bytes(),
+		cfg.TargetBranch + "/" + resultsLatest:       data.Bytes(),
+	}
+	if history, err := runGitCommandWithOutput("show", candidate+":"+refHistoryFile); err == nil {
+		files[cfg.TargetBranch+"/"+candidate+refHistoryFile] = []byte(history)
+	}
+	message := prCommitMessage(cfg, fmt.Sprintf("chore: record results of %s@%s", cfg.TargetBranch, shortSHA(candidate)))
+	commit, err := commitFiles(parent, files, message)
+	if err != nil {
+		return nil, fmt.Errorf("build results commit failed: %w", err)
+	}
+	return []string{
+		"--atomic",
+		fmt.Sprintf("--force-with-lease=refs/heads/%s:%s", cfg.ResultsBranch, parent),
+		commit + ":refs/heads/" + cfg.ResultsBranch,
+	}, nil
+}
+
+// commitFiles commits files on top of the tree of parent (an empty tree when parent is
+// empty) with plumbing commands, leaving the worktree, index and HEAD untouched
+func commitFiles(parent string, files map[string][]byte, message string) (string, error) {
+	tmp, err := os.MkdirTemp("", "feature-branching-commit-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	env := append(os.Environ(), "GIT_INDEX_FILE="+filepath.Join(tmp, "index"),
+		"GIT_AUTHOR_NAME="+botCommitterName, "GIT_AUTHOR_EMAIL="+botCommitterMail,
+		"GIT_COMMITTER_NAME="+botCommitterName, "GIT_COMMITTER_EMAIL="+botCommitterMail)
+	git := func(args ...string) (string, error) {
+		cmd := exec.Command("git", args...)
+		cmd.Env = env
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("'git %s' failed: %s\n%s", args[0], err, truncateOutput(string(output)))
+		}
+		return strings.TrimSpace(string(output)), nil
+	}
+
+	if parent != "" {
+		if _, err := git("read-tree", parent); err != nil {
+			return "", err
+		}
+	}
+	for i, name := range slices.Sorted(maps.Keys(files)) {
+		blobFile := filepath.Join(tmp, fmt.Sprintf("blob-%d", i))
+		if err := os.WriteFile(blobFile, files[name], 0644); err != nil {
+			return "", err
+		}
+		blob, err := git("hash-object", "-w", blobFile)
+		if err != nil {
+			return "", err
+		}
+		if _, err := git("update-index", "--add", "--cacheinfo", "100644,"+blob+","+name); err != nil {
+			return "", err
+		}
+	}
+	tree, err := git("write-tree")
+	if err != nil {
+		return "", err
+	}
+	args := []string{"commit-tree", tree, "-m", message}
+	if parent != "" {
+		args = append(args, "-p", parent)
+	}
+	return git(args...)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+)
+
+// Constants for the conflict stats archive
+const (
+	statsArchiveFile      = "conflict-stats.jsonl.gz"              // Archive file name on the archive branch
+	statsArchiveRef       = "refs/feature-branching/stats-archive" // Local ref the archive branch is fetched into
+	statsArchiveCommitMsg = "chore: archive conflict stats"        // Subject of archive branch commits
+)
+
+// statsRetention is the retention policy of the conflict stats run history
+type statsRetention struct {
+	KeepRuns int    // Runs kept in the stats file, 0 keeps every run
+	Archive  string // Gzip JSON lines file receiving the events of older runs, dropped when empty
+	Branch   string // Branch receiving the archive file, pushed to origin
+}
+
+// compactConflictStats keeps the events of the last KeepRuns runs and archives the older
+// ones. Runs are identified by batch ID, in order of their first event. It returns the
+// number of events moved out of the stats.
+func compactConflictStats(cfg Config, stats *ConflictStats, policy statsRetention) (int, error) {
+	if policy.KeepRuns <= 0 {
+		return 0, nil
+	}
+	var runs []string
+	seen := make(map[string]bool)
+	for _, e := range stats.Events {
+		if !seen[e.BatchID] {
+			seen[e.BatchID] = true
+			runs = append(runs, e.BatchID)
+		}
+	}
+	if len(runs) <= policy.KeepRuns {
+		return 0, nil
+	}
+
+	kept := make(map[string]bool, policy.KeepRuns)
+	for _, id := range runs[len(runs)-policy.KeepRuns:] {
+		kept[id] = true
+	}
+	var keep, old []ConflictEvent
+	for _, e := range stats.Events {
+		if kept[e.BatchID] {
+			keep = append(keep, e)
+		} else {
+			old = append(old, e)
+		}
+	}
+
+	member, err := gzipEvents(old)
+	if err != nil {
+		return 0, err
+	}
+	if policy.Archive != "" {
+		if err := appendFile(policy.Archive, member); err != nil {
+			return 0, fmt.Errorf("write stats archive failed: %w", err)
+		}
+	}
+	if policy.Branch != "" {
+		if err := archiveToBranch(cfg, policy.Branch, member); err != nil {
+			return 0, fmt.Errorf("push stats archive failed: %w", err)
+		}
+	}
+	stats.Events = keep
+	return len(old), nil
+}
+
+// gzipEvents encodes events as JSON lines in a gzip member. Members can be concatenated,
+// so archives grow by appending and still read back as a single stream.
+func gzipEvents(events []ConflictEvent) ([]byte, error) {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	enc := json.NewEncoder(zw)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// appendFile appends data to a file, creating it when needed
+func appendFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// archiveToBranch appends a gzip member to the archive file of a branch on origin
+func archiveToBranch(cfg Config, branch string, member []byte) error {
+	var parent string
+	if runOriginGit("fetch", "origin", "+refs/heads/"+branch+":"+statsArchiveRef) == nil {
+		sha, err := revParse(statsArchiveRef)
+		if err != nil {
+			return err
+		}
+		parent = sha
+	}
+
+	content := member
+	if parent != "" {
+		existing, err := exec.Command("git", "cat-file", "blob", parent+":"+statsArchiveFile).Output()
+		if err == nil {
+			content = append(existing, member...)
+		}
+	}
+
+	commit, err := commitFiles(parent, map[string][]byte{statsArchiveFile: content}, prCommitMessage(cfg, statsArchiveCommitMsg))
+	if err != nil {
+		return err
+	}
+	return runOriginGit("push", "origin", commit+":refs/heads/"+branch)
+}
+
+// runHistoryCompact implements 'history compact', applying the retention policy to the
+// conflict stats run history
+func runHistoryCompact(args []string) {
+	fs := flag.NewFlagSet("history compact", flag.ExitOnError)
+	path := fs.String("conflict_stats", "", "Path of the conflict statistics file")
+	stateDir := fs.String("state_dir", defaultStateDir(), "Directory relative state paths resolve against")
+	storage := fs.String("storage", "file", "Storage of the state, as in the --storage of the runs")
+	keep := fs.Int("stats_keep_runs", 0, "Runs kept in the conflict statistics file")
+	archive := fs.String("stats_archive", "", "Gzip JSON lines file receiving the events of older runs (they are dropped when empty)")
+	branch := fs.String("stats_archive_branch", "", "Branch on origin receiving the archive of older runs")
+	fs.Parse(args)
+
+	if *path == "" {
+		log.Fatal("invalid configuration:", fmt.Errorf("missing required parameter: 'conflict_stats'"))
+	}
+	if *keep <= 0 {
+		log.Fatal("invalid configuration:", fmt.Errorf("invalid parameter 'stats_keep_runs': %d (expected a positive count)", *keep))
+	}
+
+	store, err := openStorage(*storage, *stateDir)
+	if err != nil {
+		log.Fatal("invalid configuration:", fmt.Errorf("invalid parameter 'storage': %w", err))
+	}
+	stats, err := loadConflictStats(store, *path)
+	if err != nil {
+		log.Fatal("error loading conflict stats:", err)
+	}
+	policy := statsRetention{KeepRuns: *keep, Archive: resolveStatePath(*stateDir, *archive), Branch: *branch}
+	moved, err := compactConflictStats(Config{}, &stats, policy)
+	if err != nil {
+		log.Fatal("error compacting conflict stats:", err)
+	}
+	if moved == 0 {
+		fmt.Printf("Nothing to compact in '%s'.\n", *path)
+		return
+	}
+	if err := writeConflictStats(store, *path, stats); err != nil {
+		log.Fatal("error writing conflict stats:", err)
+	}
+	fmt.Printf("Compacted '%s': %d event(s) of older runs moved out, %d kept.\n", *path, moved, len(stats.Events))
+}
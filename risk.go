@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+)
+
+// Weights of the risk factors, summing to the highest score of 100
+const (
+	riskWeightSize      = 30 // Lines changed
+	riskWeightPaths     = 25 // Files and top-level directories touched
+	riskWeightConflicts = 30 // Conflicts recorded for the PR and its files
+	riskWeightFlakiness = 15 // Checks both failing and passing on the PR head
+)
+
+// Saturation points of the risk factors: a PR reaching them scores the full weight
+const (
+	riskSizeLines     = 1000 // Lines changed, on a logarithmic scale
+	riskPathFiles     = 50   // Files touched
+	riskPathDirs      = 5    // Top-level directories touched
+	riskPriorConflict = 3    // Conflicts recorded for the PR itself
+)
+
+// PRRisk is the risk score of a PR with the contribution of every factor
+type PRRisk struct {
+	PR        int     `json:"pr"`        // PR number
+	Score     float64 `json:"score"`     // Risk score from 0 to 100, the sum of the factors
+	Size      float64 `json:"size"`      // Contribution of the lines changed
+	Paths     float64 `json:"paths"`     // Contribution of the files and directories touched
+	Conflicts float64 `json:"conflicts"` // Contribution of the recorded conflicts
+	Flakiness float64 `json:"flakiness"` // Contribution of the flaky checks
+}
+
+// RiskReport records the risk scores of a run
+type RiskReport struct {
+	PRs          []PRRisk `json:"prs"`                      // Scores of the PRs considered, in evaluation order
+	Batch        float64  `json:"batch"`                    // Score of the PRs kept in the batch
+	MaxRisk      float64  `json:"max_risk,omitempty"`       // Highest PR score allowed, 0 when not gated
+	MaxBatchRisk float64  `json:"max_batch_risk,omitempty"` // Highest batch score allowed, 0 when not gated
+	Held         []int    `json:"held,omitempty"`           // PRs held back by the limits
+}
+
+// batchRisk combines PR scores as the chance that any of the PRs goes wrong, reading each
+// score as a percentage: the batch is never less risky than its riskiest PR
+func batchRisk(scores []float64) float64 {
+	safe := 1.0
+	for _, s := range scores {
+		safe *= 1 - s/100
+	}
+	return roundRisk(100 * (1 - safe))
+}
+
+func roundRisk(score float64) float64 {
+	return math.Round(score*10) / 10
+}
+
+// scorePR computes the risk score of a PR from its change against trunk, the conflict
+// stats and the check runs of its head
+func scorePR(stat prDiffStat, pr GitHubPR, stats ConflictStats, runs []CheckRun) PRRisk {
+	risk := PRRisk{PR: pr.Number}
+	lines := float64(stat.insertions + stat.deletions)
+	risk.Size = riskWeightSize * min(1, math.Log2(1+lines)/math.Log2(1+riskSizeLines))
+
+	dirs := make(map[string]bool)
+	for _, f := range stat.files {
+		top, _, _ := strings.Cut(f, "/")
+		dirs[top] = true
+	}
+	risk.Paths = riskWeightPaths * (min(1, float64(len(stat.files))/riskPathFiles) + min(1, float64(len(dirs))/riskPathDirs)) / 2
+
+	// Half for the conflicts of the PR itself, half for its files that conflicted before
+	prior := 0
+	hot := make(map[string]bool)
+	for _, e := range stats.Events {
+		if e.PR == pr.Number {
+			prior++
+		}
+		for _, f := range e.Files {
+			hot[f] = true
+		}
+	}
+	touched := 0
+	for _, f := range stat.files {
+		if hot[f] {
+			touched++
+		}
+	}
+	conflicts := min(1, float64(prior)/riskPriorConflict) / 2
+	if len(stat.files) > 0 {
+		conflicts += float64(touched) / float64(len(stat.files)) / 2
+	}
+	risk.Conflicts = riskWeightConflicts * conflicts
+
+	// Re-runs of a check keep their earlier runs, so a flaky check both fails and passes
+	outcomes := make(map[string][2]bool)
+	for _, run := range runs {
+		if run.Status != "completed" {
+			continue
+		}
+		o := outcomes[run.Name]
+		switch run.Conclusion {
+		case "success":
+			o[0] = true
+		case "failure", "timed_out", "cancelled":
+			o[1] = true
+		}
+		outcomes[run.Name] = o
+	}
+	flaky := 0
+	for _, o := range outcomes {
+		if o[0] && o[1] {
+			flaky++
+		}
+	}
+	if len(outcomes) > 0 {
+		risk.Flakiness = riskWeightFlakiness * float64(flaky) / float64(len(outcomes))
+	}
+
+	risk.Size, risk.Paths = roundRisk(risk.Size), roundRisk(risk.Paths)
+	risk.Conflicts, risk.Flakiness = roundRisk(risk.Conflicts), roundRisk(risk.Flakiness)
+	risk.Score = roundRisk(risk.Size + risk.Paths + risk.Conflicts + risk.Flakiness)
+	return risk
+}
+
+// applyRiskScores scores the PRs and records the scores in the run report. With
+// --risk_order the PRs are merged from the least risky, PRs above --max_risk are held
+// back, and PRs raising the batch above --max_batch_risk are deferred to the next run.
+// PR branches are fetched for their diff stats, which are taken against trunk.
+func applyRiskScores(client GitHubClient, cfg Config, prs []GitHubPR, report *RunReport) []GitHubPR {
+	stats := ConflictStats{}
+	if cfg.ConflictStats != "" {
+		var err error
+		if stats, err = loadConflictStats(stateStorage(cfg), cfg.ConflictStats); err != nil {
+			slog.Warn("failed to load conflict stats, scoring without conflict history", "error", err)
+		}
+	}
+
+	fmt.Printf("Scoring the risk of %d PR(s):\n", len(prs))
+	scores := make(map[int]PRRisk, len(prs))
+	result := &RiskReport{MaxRisk: cfg.MaxRisk, MaxBatchRisk: cfg.MaxBatchRisk}
+	var scored []GitHubPR
+	for _, pr := range prs {
+		stat, err := policyDiffStat(cfg, pr)
+		if err != nil {
+			// The merge reports the fetch failure of the PR
+			scored = append(scored, pr)
+			continue
+		}
+		var runs []CheckRun
+		if head, err := revParse(fmt.Sprintf("pr-%d", pr.Number)); err == nil {
+			if runs, err = client.ListCheckRuns(head); err != nil {
+				slog.Warn("failed to list the checks of PR, scoring without flakiness", "pr_number", pr.Number, "error", err)
+			}
+		}
+		risk := scorePR(stat, pr, stats, runs)
+		scores[pr.Number] = risk
+		result.PRs = append(result.PRs, risk)
+		scored = append(scored, pr)
+	}
+	if cfg.RiskOrder {
+		// PRs that could not be scored keep their place at the end
+		slices.SortStableFunc(scored, func(a, b GitHubPR) int {
+			ra, oka := scores[a.Number]
+			rb, okb := scores[b.Number]
+			switch {
+			case oka != okb:
+				if oka {
+					return -1
+				}
+				return 1
+			case ra.Score < rb.Score:
+				return -1
+			case ra.Score > rb.Score:
+				return 1
+			}
+			return 0
+		})
+	}
+
+	var kept []GitHubPR
+	var batch []float64
+	for _, pr := range scored {
+		risk, ok := scores[pr.Number]
+		if !ok {
+			kept = append(kept, pr)
+			continue
+		}
+		line := fmt.Sprintf("  #%d risk %.1f (size %.1f, paths %.1f, conflicts %.1f, flakiness %.1f)",
+			pr.Number, risk.Score, risk.Size, risk.Paths, risk.Conflicts, risk.Flakiness)
+		if cfg.MaxRisk > 0 && risk.Score > cfg.MaxRisk {
+			detail := fmt.Sprintf("risk score %.1f exceeds max_risk %.1f", risk.Score, cfg.MaxRisk)
+			fmt.Println(line + ": held back, " + detail)
+			report.add(pr, OutcomeBlocked, detail, 0)
+			result.Held = append(result.Held, pr.Number)
+			continue
+		}
+		if next := batchRisk(append(batch, risk.Score)); cfg.MaxBatchRisk > 0 && next > cfg.MaxBatchRisk {
+			detail := fmt.Sprintf("batch risk would reach %.1f, above max_batch_risk %.1f", next, cfg.MaxBatchRisk)
+			fmt.Println(line + ": deferred, " + detail)
+			report.add(pr, OutcomeDeferred, detail, 0)
+			result.Held = append(result.Held, pr.Number)
+			continue
+		}
+		fmt.Println(line)
+		batch = append(batch, risk.Score)
+		kept = append(kept, pr)
+	}
+	result.Batch = batchRisk(batch)
+	fmt.Printf("Batch risk %.1f with %d/%d PR(s).\n\n", result.Batch, len(kept), len(prs))
+	report.riskScored(result)
+	return kept
+}
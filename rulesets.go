@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Ruleset handling policies
+const (
+	rulesetsIgnore = "ignore" // Do not query rulesets
+	rulesetsAdapt  = "adapt"  // Adapt to the rules the bot can satisfy, fail fast on the others
+	rulesetsFail   = "fail"   // Fail fast on every rule the bot would have to adapt to
+)
+
+// rulesetCheck tells how a run copes with a ruleset rule: the adaptation made, or why the
+// rule blocks the bot. Both are empty for rules not affecting the bot.
+type rulesetCheck struct {
+	adapted string
+	blocked string
+}
+
+// checkRule decides how the run copes with a rule of the target branch, adapting cfg in
+// adapt mode. exists tells whether the remote target branch exists.
+func checkRule(cfg *Config, rule BranchRule, exists bool) rulesetCheck {
+	adapt := cfg.Rulesets == rulesetsAdapt
+	switch rule.Type {
+	case "required_signatures":
+		if cfg.SigningKey != "" {
+			return rulesetCheck{adapted: "commits are signed with 'signing_key'"}
+		}
+		return rulesetCheck{blocked: "requires signed commits; set 'signing_key'"}
+
+	case "required_linear_history":
+		if cfg.MergeRefs {
+			return rulesetCheck{blocked: "requires a linear history, but 'merge_refs' pushes GitHub's test-merge commits"}
+		}
+		strategy := slices.Contains(cfg.PRDirectives, "strategy")
+		if cfg.CommitMode != commitModeMerge && !strategy {
+			return rulesetCheck{}
+		}
+		if !adapt {
+			return rulesetCheck{blocked: "requires a linear history, but 'commit_mode' merge or the 'strategy' directive create merge commits"}
+		}
+		if cfg.CommitMode == commitModeMerge {
+			cfg.CommitMode = commitModePerPR
+		}
+		cfg.PRDirectives = slices.DeleteFunc(cfg.PRDirectives, func(d string) bool { return d == "strategy" })
+		return rulesetCheck{adapted: "PRs are squashed instead of merged with merge commits"}
+
+	case "non_fast_forward":
+		if exists {
+			return rulesetCheck{blocked: "blocks force pushes, but every run rebuilds the target branch from trunk"}
+		}
+	case "creation":
+		if !exists {
+			return rulesetCheck{blocked: "restricts creating the target branch, which does not exist yet"}
+		}
+	case "deletion":
+		if cfg.EmptyBatch == emptyBatchDelete {
+			return rulesetCheck{blocked: "restricts deleting the target branch, which 'empty_batch' delete does on empty batches"}
+		}
+	case "update":
+		return rulesetCheck{blocked: "restricts updates of the target branch"}
+	case "pull_request", "merge_queue":
+		return rulesetCheck{blocked: "requires changes to go through pull requests"}
+	case "required_status_checks", "required_deployments":
+		return rulesetCheck{blocked: "requires checks or deployments to succeed before pushing, which the rebuilt target never has"}
+	}
+	return rulesetCheck{}
+}
+
+// mustApplyRulesets enforces checking the rulesets of the target branch before building it
+func mustApplyRulesets(client GitHubClient, cfg Config) Config {
+	cfg, err := applyRulesets(client, cfg)
+	if err != nil {
+		log.Fatal("error checking rulesets:", err)
+	}
+	return cfg
+}
+
+// applyRulesets queries the rulesets applying to the target branch and adapts cfg to the
+// rules the bot can satisfy, so a run fails before building rather than at the push with
+// an opaque rejection. Rules of rulesets the token may always bypass are skipped.
+// Repositories without rulesets support (older GHES) are left as configured.
+func applyRulesets(client GitHubClient, cfg Config) (Config, error) {
+	if cfg.Rulesets == rulesetsIgnore {
+		return cfg, nil
+	}
+	rules, err := client.ListBranchRules(cfg.TargetBranch)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+		fmt.Println("Rulesets are not available for this repository, skipping their checks.")
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if len(rules) == 0 {
+		return cfg, nil
+	}
+
+	rulesets := make(map[int64]Ruleset)
+	exists := remoteBranchExists(cfg.TargetBranch)
+	var blocked []string
+	fmt.Printf("Checking %d ruleset rule(s) of '%s':\n", len(rules), cfg.TargetBranch)
+	for _, rule := range rules {
+		ruleset, ok := rulesets[rule.RulesetID]
+		if !ok {
+			if ruleset, err = client.GetRuleset(rule.RulesetID); err != nil {
+				return cfg, fmt.Errorf("get ruleset %d failed: %w", rule.RulesetID, err)
+			}
+			rulesets[rule.RulesetID] = ruleset
+		}
+		name := fmt.Sprintf("rule '%s' of ruleset '%s' (#%d, %s)", rule.Type, ruleset.Name, ruleset.ID, rule.Source)
+		if ruleset.Bypass == "always" {
+			fmt.Printf("  %s: bypassed by the token\n", name)
+			continue
+		}
+		switch check := checkRule(&cfg, rule, exists); {
+		case check.blocked != "":
+			fmt.Printf("  %s: BLOCKS the bot\n", name)
+			blocked = append(blocked, name+" "+check.blocked)
+		case check.adapted != "":
+			fmt.Printf("  %s: %s\n", name, check.adapted)
+		}
+	}
+	if len(blocked) > 0 {
+		return cfg, fmt.Errorf("'%s' cannot be published as configured (add the bot to the bypass list of the rulesets or point 'target_branch' elsewhere):\n  - %s",
+			cfg.TargetBranch, strings.Join(blocked, "\n  - "))
+	}
+	return cfg, nil
+}
+
+// setupCommitSigning signs every commit of the run with the signing key. The settings are
+// passed to Git through GIT_CONFIG_* variables, so no config file is written and
+// concurrent bot processes do not contend for its lock.
+func setupCommitSigning(cfg Config) {
+	if cfg.SigningKey == "" {
+		return
+	}
+	settings := []struct{ key, value string }{
+		{"gpg.format", cfg.SigningFormat},
+		{"user.signingkey", cfg.SigningKey},
+		{"commit.gpgsign", "true"},
+	}
+	count, _ := strconv.Atoi(os.Getenv("GIT_CONFIG_COUNT"))
+	for _, s := range settings {
+		os.Setenv(fmt.Sprintf("GIT_CONFIG_KEY_%d", count), s.key)
+		os.Setenv(fmt.Sprintf("GIT_CONFIG_VALUE_%d", count), s.value)
+		count++
+	}
+	os.Setenv("GIT_CONFIG_COUNT", strconv.Itoa(count))
+}
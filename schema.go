@@ -0,0 +1,241 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Types of the config schema options
+const (
+	optionBool     = "bool"
+	optionInt      = "int"
+	optionNumber   = "number"
+	optionDuration = "duration"
+	optionString   = "string"
+	optionList     = "list"
+)
+
+// listOptions are the string parameters holding comma separated lists, which tenant
+// configs may also give as JSON arrays
+var listOptions = map[string]struct{}{
+	"labels":                   {},
+	"label":                    {},
+	"exclude_prs":              {},
+	"incident_assignees":       {},
+	"update_branch_labels":     {},
+	"ignore_paths":             {},
+	"tenant_config_sha256":     {},
+	"tenant_config_public_key": {},
+	"lint_forbidden_words":     {},
+	"pr_directives":            {},
+	"promote_checks":           {},
+	"event_sinks":              {},
+	"author_teams":             {},
+	"label_quotas":             {},
+	"concurrency_groups":       {},
+	"project_columns":          {},
+	"label_namespaces":         {},
+}
+
+// configOption describes a parameter of the config schema
+type configOption struct {
+	Name    string `json:"name"`    // Parameter name, as a flag and a tenant config key
+	Type    string `json:"type"`    // bool, int, number, duration, string or list
+	Default string `json:"default"` // Default value, empty when unset
+	Usage   string `json:"usage"`   // Description
+}
+
+// configSchema describes every parameter registered on fs, in name order
+func configSchema(fs *flag.FlagSet) []configOption {
+	var options []configOption
+	fs.VisitAll(func(f *flag.Flag) {
+		options = append(options, configOption{Name: f.Name, Type: optionType(f), Default: f.DefValue, Usage: f.Usage})
+	})
+	return options
+}
+
+// optionType returns the schema type of a flag
+func optionType(f *flag.Flag) string {
+	if _, ok := listOptions[f.Name]; ok {
+		return optionList
+	}
+	if getter, ok := f.Value.(flag.Getter); ok {
+		switch getter.Get().(type) {
+		case bool:
+			return optionBool
+		case int, int64, uint, uint64:
+			return optionInt
+		case float64:
+			return optionNumber
+		case time.Duration:
+			return optionDuration
+		}
+	}
+	return optionString
+}
+
+// checkOptionValue validates a value against the type of an option. Values are command
+// line strings or decoded JSON values from a tenant config.
+func checkOptionValue(typ string, value any) error {
+	if s, ok := value.(string); ok {
+		var err error
+		switch typ {
+		case optionBool:
+			_, err = strconv.ParseBool(s)
+		case optionInt:
+			_, err = strconv.ParseInt(s, 10, 64)
+		case optionNumber:
+			_, err = strconv.ParseFloat(s, 64)
+		case optionDuration:
+			_, err = time.ParseDuration(s)
+		}
+		if err != nil {
+			return fmt.Errorf("expected %s, got %s", describeOptionType(typ), describeValue(value))
+		}
+		return nil
+	}
+	switch v := value.(type) {
+	case bool:
+		if typ == optionBool {
+			return nil
+		}
+	case float64:
+		if typ == optionNumber || typ == optionInt && v == float64(int64(v)) {
+			return nil
+		}
+	case []any:
+		if typ == optionList {
+			for _, item := range v {
+				if _, ok := item.(string); !ok {
+					return fmt.Errorf("expected a list of strings, got an item %s", describeValue(item))
+				}
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("expected %s, got %s", describeOptionType(typ), describeValue(value))
+}
+
+// describeOptionType names the values accepted by an option type
+func describeOptionType(typ string) string {
+	switch typ {
+	case optionBool:
+		return "a boolean"
+	case optionInt:
+		return "an integer"
+	case optionNumber:
+		return "a number"
+	case optionDuration:
+		return `a duration such as "30m"`
+	case optionList:
+		return "a comma separated string or a list of strings"
+	}
+	return "a string"
+}
+
+// describeValue names a value in validation errors
+func describeValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(v)
+	case bool:
+		return "a boolean"
+	case float64:
+		return "the number " + strconv.FormatFloat(v, 'f', -1, 64)
+	case []any:
+		return "a list"
+	case map[string]any:
+		return "an object"
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// unknownOptionError reports a parameter missing from the schema, suggesting the closest one
+func unknownOptionError(fs *flag.FlagSet, name string) error {
+	if suggestion := suggestOption(fs, name); suggestion != "" {
+		return fmt.Errorf("unknown parameter '%s' (did you mean '%s'?)", name, suggestion)
+	}
+	return fmt.Errorf("unknown parameter '%s'", name)
+}
+
+// suggestOption returns the registered parameter closest to name: the same name with
+// dashes or another case, else the nearest within a small edit distance
+func suggestOption(fs *flag.FlagSet, name string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(name, "-", "_"))
+	best, bestDistance := "", len(name)/3+1
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == normalized {
+			best, bestDistance = f.Name, -1
+		}
+		if d := editDistance(normalized, f.Name); d < bestDistance {
+			best, bestDistance = f.Name, d
+		}
+	})
+	return best
+}
+
+// editDistance returns the edit distance between a and b, counting a transposition of
+// adjacent characters as a single edit (optimal string alignment)
+func editDistance(a, b string) int {
+	var prev2 []int
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev = prev, cur
+	}
+	return prev[len(b)]
+}
+
+// checkArgs validates the command line against the schema before it is parsed, so
+// unknown parameters get a suggestion and ill-typed values a typed error instead of
+// the flag package usage dump
+func checkArgs(fs *flag.FlagSet, args []string) error {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || len(arg) < 2 || arg[0] != '-' {
+			return nil
+		}
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-"), "=")
+		if name == "help" || name == "h" {
+			return nil
+		}
+		f := fs.Lookup(name)
+		if f == nil {
+			return unknownOptionError(fs, name)
+		}
+		typ := optionType(f)
+		if !hasValue {
+			if typ == optionBool {
+				continue
+			}
+			if i+1 == len(args) {
+				return fmt.Errorf("invalid parameter '%s': missing value", name)
+			}
+			i++
+			value = args[i]
+		}
+		if err := checkOptionValue(typ, value); err != nil {
+			return fmt.Errorf("invalid parameter '%s': %w", name, err)
+		}
+	}
+	return nil
+}
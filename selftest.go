@@ -0,0 +1,292 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// selftestRefTimeout bounds the wait for GitHub to publish the head ref of a created PR
+const selftestRefTimeout = time.Minute
+
+// selftestPR is a synthetic PR of the selftest
+type selftestPR struct {
+	name      string            // Short name, the last part of its branch
+	title     string            // PR title
+	files     map[string]string // Files the PR writes, relative to the scratch directory
+	unlabeled bool              // Whether the PR lacks the label, so the run must leave it out
+	number    int               // PR number once opened
+	head      string            // Head commit once pushed
+}
+
+// selftestCheck is an assertion of the selftest
+type selftestCheck struct {
+	name string
+	err  error
+}
+
+// runSelftest implements the 'selftest' subcommand: it runs the whole pipeline against a
+// scratch repository on synthetic branches, PRs and a label, asserts the built branch and
+// its ref history, and removes everything it created unless --keep is set. The bot flags
+// apply to the run, so a configuration can be validated before pointing it at production;
+// trunk, target branch and labels are the selftest's own.
+func runSelftest(args []string) {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	keep := fs.Bool("keep", false, "Keep the synthetic branches, PRs and label for inspection instead of removing them")
+	cfg, err := parseConfig(fs, args)
+	if err != nil {
+		log.Fatal("invalid configuration:", err)
+	}
+	if cfg.GithubToken == "" || cfg.ReplayDir != "" || cfg.PRsFile != "" {
+		log.Fatal("invalid configuration:", fmt.Errorf("selftest needs 'github_token' to run against the live repository"))
+	}
+	mustDetectGit(cfg)
+	mustSetupGitConfig()
+
+	client := mustNewGitHubClient(cfg)
+	repo, err := client.GetRepository()
+	if err != nil {
+		log.Fatal("error loading repository:", err)
+	}
+	workdir, err := os.MkdirTemp("", "feature-branching-selftest-")
+	if err != nil {
+		log.Fatal("error creating clone dir:", err)
+	}
+	dir := filepath.Join(workdir, cfg.Repo)
+	if err := cloneRepository(repo.CloneURL, cfg.GithubToken, dir); err != nil {
+		os.RemoveAll(workdir)
+		log.Fatal("error cloning repository:", err)
+	}
+
+	// The bot runs on the configured flags, the selftest's own removed
+	botArgs := slices.DeleteFunc(slices.Clone(args), func(a string) bool {
+		name := strings.TrimLeft(a, "-")
+		return name == "keep" || strings.HasPrefix(name, "keep=")
+	})
+	err = selftest(client, cfg, repo, dir, botArgs, *keep)
+	os.RemoveAll(workdir)
+	if err != nil {
+		log.Fatal("selftest failed: ", err)
+	}
+}
+
+// selftest creates the synthetic PRs in the clone in dir, runs the bot on them and checks
+// the result, cleaning up on the way out unless keep is set
+func selftest(client GitHubClient, cfg Config, repo Repository, dir string, botArgs []string, keep bool) error {
+	id := strings.ToLower(newBatchID())
+	prefix := "selftest/" + id
+	label := "selftest-" + id
+	trunk, target := prefix+"/trunk", prefix+"/pre-trunk"
+	fmt.Printf("Selftest %s on %s/%s from '%s'.\n", id, cfg.Owner, cfg.Repo, repo.DefaultBranch)
+
+	// A and B touch different files, C is left unlabeled so the label filter must skip it
+	scratch := "selftest/" + id + "/"
+	prs := []*selftestPR{
+		{name: "a", title: "selftest: first change", files: map[string]string{"shared.txt": "a\n", "a.txt": "a\n"}},
+		{name: "b", title: "selftest: second change", files: map[string]string{"b.txt": "b\n"}},
+		{name: "c", title: "selftest: unlabeled change", files: map[string]string{"shared.txt": "c\n"}, unlabeled: true},
+	}
+	created := []string{trunk}
+	defer func() {
+		if keep {
+			fmt.Printf("Keeping branches %s/* and label '%s'.\n", prefix, label)
+			return
+		}
+		cleanupSelftest(client, dir, append(created, target), prs, label)
+	}()
+
+	fmt.Print("Pushing synthetic branches...")
+	base, err := selftestCommit(dir, trunk, "origin/"+repo.DefaultBranch, "selftest: scratch trunk", map[string]string{scratch + "shared.txt": "base\n"})
+	if err == nil {
+		err = runGitCommand("-C", dir, "push", "origin", base+":refs/heads/"+trunk)
+	}
+	for _, pr := range prs {
+		if err != nil {
+			break
+		}
+		files := make(map[string]string, len(pr.files))
+		for name, content := range pr.files {
+			files[scratch+name] = content
+		}
+		branch := prefix + "/pr-" + pr.name
+		if pr.head, err = selftestCommit(dir, branch, base, pr.title, files); err == nil {
+			err = runGitCommand("-C", dir, "push", "origin", pr.head+":refs/heads/"+branch)
+			created = append(created, branch)
+		}
+	}
+	if err != nil {
+		fmt.Println()
+		return fmt.Errorf("pushing synthetic branches: %w", err)
+	}
+	fmt.Println(" done.")
+
+	for _, pr := range prs {
+		body := fmt.Sprintf("Synthetic PR of selftest %s, removed when it ends.", id)
+		if pr.number, err = client.CreatePR(pr.title, prefix+"/pr-"+pr.name, trunk, body, false); err != nil {
+			return fmt.Errorf("opening PR '%s': %w", pr.title, err)
+		}
+		if pr.unlabeled {
+			fmt.Printf("Opened PR #%d \"%s\" without label.\n", pr.number, pr.title)
+			continue
+		}
+		if err := client.AddLabel(pr.number, label); err != nil {
+			return fmt.Errorf("labeling PR #%d: %w", pr.number, err)
+		}
+		fmt.Printf("Opened PR #%d \"%s\" labeled '%s'.\n", pr.number, pr.title, label)
+	}
+	for _, pr := range prs {
+		if err := awaitPRHead(dir, pr); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("\n=== Running the pipeline into '%s' ===\n", target)
+	runErr := runBotIn(dir, append(botArgs, "--trunk_branch", trunk, "--target_branch", target, "--labels", label))
+	fmt.Println("=== Pipeline finished ===")
+
+	checks := []selftestCheck{{name: "pipeline run succeeds", err: runErr}}
+	checks = append(checks, checkSelftestBranch(dir, target, base, scratch, prs)...)
+	failed := 0
+	for _, c := range checks {
+		if c.err != nil {
+			fmt.Printf("  FAIL %s: %v\n", c.name, c.err)
+			failed++
+			continue
+		}
+		fmt.Printf("  PASS %s\n", c.name)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d/%d check(s) failed", failed, len(checks))
+	}
+	fmt.Printf("Selftest passed: %d check(s).\n", len(checks))
+	return nil
+}
+
+// selftestCommit commits files on top of parent into branch of the clone in dir
+func selftestCommit(dir, branch, parent, message string, files map[string]string) (string, error) {
+	if err := runGitCommand("-C", dir, "checkout", "-q", "-B", branch, parent); err != nil {
+		return "", err
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return "", err
+		}
+		if err := runGitCommand("-C", dir, "add", name); err != nil {
+			return "", err
+		}
+	}
+	if err := runGitCommand("-C", dir, "commit", "-q", "-m", message); err != nil {
+		return "", err
+	}
+	head, err := runGitCommandWithOutput("-C", dir, "rev-parse", "HEAD")
+	return strings.TrimSpace(head), err
+}
+
+// awaitPRHead waits for GitHub to publish refs/pull/N/head of a PR, which it does
+// asynchronously once the PR is opened
+func awaitPRHead(dir string, pr *selftestPR) error {
+	ref := fmt.Sprintf("refs/pull/%d/head", pr.number)
+	deadline := time.Now().Add(selftestRefTimeout)
+	for {
+		out, _ := runGitCommandWithOutput("-C", dir, "ls-remote", "origin", ref)
+		if strings.HasPrefix(out, pr.head) {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s not published at %s after %s", ref, shortSHA(pr.head), selftestRefTimeout)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// checkSelftestBranch asserts the built target branch: the labeled PRs merged in order
+// onto the scratch trunk, with their content and a matching ref history
+func checkSelftestBranch(dir, target, base, scratch string, prs []*selftestPR) []selftestCheck {
+	local := "refs/feature-branching/selftest"
+	if err := runGitCommand("-C", dir, "fetch", "origin", "+refs/heads/"+target+":"+local); err != nil {
+		return []selftestCheck{{name: "target branch is pushed", err: err}}
+	}
+	checks := []selftestCheck{{name: "target branch is pushed"}}
+
+	var want []int
+	files := make(map[string]string)
+	for _, pr := range prs {
+		if pr.unlabeled {
+			continue
+		}
+		want = append(want, pr.number)
+		for name, content := range pr.files {
+			files[name] = content
+		}
+	}
+	content := selftestCheck{name: "target branch holds the merged changes"}
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		got, err := runGitCommandWithOutput("-C", dir, "show", local+":"+scratch+name)
+		if err != nil {
+			content.err = fmt.Errorf("%s is missing", scratch+name)
+			break
+		}
+		if got != files[name] {
+			content.err = fmt.Errorf("%s is %q, expected %q", scratch+name, got, files[name])
+			break
+		}
+	}
+	checks = append(checks, content)
+
+	history := selftestCheck{name: "ref history records the batch"}
+	raw, err := runGitCommandWithOutput("-C", dir, "show", local+":"+refHistoryFile)
+	if err == nil {
+		var h RefHistory
+		if h, err = decodeRefHistory([]byte(raw)); err == nil {
+			var got []int
+			for _, m := range h.Merges {
+				got = append(got, m.PR)
+			}
+			switch {
+			case !slices.Equal(got, want):
+				err = fmt.Errorf("merged PRs %v, expected %v", got, want)
+			case h.Stamp == nil || h.Stamp.Trunk != base:
+				err = fmt.Errorf("trunk revision is not the scratch trunk %s", shortSHA(base))
+			case h.BatchID == "":
+				err = fmt.Errorf("no batch ID recorded")
+			}
+		}
+	}
+	history.err = err
+	return append(checks, history)
+}
+
+// cleanupSelftest closes the synthetic PRs and deletes their label and branches, the
+// target branch included. Failures are logged as warnings, so one leftover does not keep
+// the others around.
+func cleanupSelftest(client GitHubClient, dir string, branches []string, prs []*selftestPR, label string) {
+	fmt.Println("Cleaning up...")
+	for _, pr := range prs {
+		if pr.number == 0 {
+			continue
+		}
+		if err := client.CloseIssue(pr.number); err != nil {
+			slog.Warn("failed to close PR", "pr_number", pr.number, "error", err)
+		}
+	}
+	if slices.ContainsFunc(prs, func(pr *selftestPR) bool { return pr.number != 0 }) {
+		if err := client.DeleteLabel(label); err != nil {
+			slog.Warn("failed to delete label", "label", label, "error", err)
+		}
+	}
+	// Branches never pushed, such as a target the run did not build, are ignored
+	for _, branch := range branches {
+		runGitCommand("-C", dir, "push", "--quiet", "origin", "--delete", branch)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Semantic version bump levels, ordered by precedence
+const (
+	bumpNone = iota
+	bumpPatch
+	bumpMinor
+	bumpMajor
+)
+
+// bumpNames maps bump levels to their display names
+var bumpNames = []string{"none", "patch", "minor", "major"}
+
+// Labels implying each bump level, matched case-insensitively
+var (
+	majorLabels = []string{"breaking", "breaking-change", "major", "semver:major"}
+	minorLabels = []string{"feature", "feat", "enhancement", "minor", "semver:minor"}
+	patchLabels = []string{"fix", "bug", "bugfix", "patch", "semver:patch"}
+)
+
+// conventionalTitle matches conventional commit titles such as "feat(api)!: ..."
+var conventionalTitle = regexp.MustCompile(`^(\w+)(\([^)]*\))?(!)?:`)
+
+// semverPattern matches versions such as 1.2.3 or v1.2.3
+var semverPattern = regexp.MustCompile(`^v?(\d+)\.(\d+)\.(\d+)`)
+
+// prBump infers the bump level of a PR from its labels, then its conventional commit title
+func prBump(pr GitHubPR) int {
+	switch {
+	case hasAnyLabel(pr.Labels, majorLabels):
+		return bumpMajor
+	case hasAnyLabel(pr.Labels, minorLabels):
+		return bumpMinor
+	case hasAnyLabel(pr.Labels, patchLabels):
+		return bumpPatch
+	}
+
+	m := conventionalTitle.FindStringSubmatch(pr.Title)
+	switch {
+	case strings.Contains(pr.Title, "BREAKING CHANGE"), m != nil && m[3] == "!":
+		return bumpMajor
+	case m != nil && strings.EqualFold(m[1], "feat"):
+		return bumpMinor
+	case m != nil && (strings.EqualFold(m[1], "fix") || strings.EqualFold(m[1], "perf")):
+		return bumpPatch
+	}
+	return bumpNone
+}
+
+// currentVersion reads the version file on the target branch, falling back to the latest
+// version tag reachable from trunk, then to 0.0.0. The "v" prefix is preserved.
+func currentVersion(cfg Config) string {
+	if cfg.VersionFile != "" {
+		if data, err := os.ReadFile(cfg.VersionFile); err == nil {
+			if v := strings.TrimSpace(string(data)); semverPattern.MatchString(v) {
+				return v
+			}
+		}
+	}
+	if tag, err := runGitCommandWithOutput("describe", "--tags", "--abbrev=0", "--match", "v[0-9]*", cfg.TrunkBranch); err == nil {
+		return strings.TrimSpace(tag)
+	}
+	return "0.0.0"
+}
+
+// nextVersion applies a bump level to a version
+func nextVersion(version string, bump int) string {
+	m := semverPattern.FindStringSubmatch(version)
+	if m == nil {
+		return version
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	patch, _ := strconv.Atoi(m[3])
+	switch bump {
+	case bumpMajor:
+		major, minor, patch = major+1, 0, 0
+	case bumpMinor:
+		minor, patch = minor+1, 0
+	case bumpPatch:
+		patch++
+	}
+	prefix := ""
+	if strings.HasPrefix(version, "v") {
+		prefix = "v"
+	}
+	return fmt.Sprintf("%s%d.%d.%d", prefix, major, minor, patch)
+}
+
+// suggestVersion prints and outputs the next semantic version implied by the merged PRs,
+// optionally committing it to the version file on the target branch.
+// Errors are logged as warnings since the suggestion must not fail the batch.
+func suggestVersion(cfg Config, prs []GitHubPR, merged []MergeRecord) {
+	mergedSet := make(map[int]struct{}, len(merged))
+	for _, m := range merged {
+		mergedSet[m.PR] = struct{}{}
+	}
+	bump := bumpNone
+	for _, pr := range prs {
+		if _, ok := mergedSet[pr.Number]; ok {
+			bump = max(bump, prBump(pr))
+		}
+	}
+
+	current := currentVersion(cfg)
+	next := nextVersion(current, bump)
+	fmt.Printf("Suggested version: %s -> %s (%s)\n", current, next, bumpNames[bump])
+	setOutput(cfg, "next_version", next)
+	setOutput(cfg, "version_bump", bumpNames[bump])
+
+	if cfg.VersionFile == "" || next == current {
+		return
+	}
+	if err := os.WriteFile(cfg.VersionFile, []byte(next+"\n"), 0644); err != nil {
+		slog.Warn("failed to write version file", "error", err)
+		return
+	}
+	if err := runGitCommand("add", cfg.VersionFile); err != nil {
+		slog.Warn("failed to stage version file", "error", err)
+		return
+	}
+	if err := runGitCommand("commit", "-m", prCommitMessage(cfg, "chore: bump version to "+next)); err != nil {
+		slog.Warn("failed to commit version bump", "error", err)
+	}
+}
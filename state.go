@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// stateDirName is the directory name used under the per-OS cache directory
+const stateDirName = "feature-branching"
+
+// defaultStateDir returns the per-OS state directory
+// ($XDG_CACHE_HOME or ~/.cache on Linux, ~/Library/Caches on macOS, %LocalAppData% on Windows)
+func defaultStateDir() string {
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, stateDirName)
+	}
+	return filepath.Join(os.TempDir(), stateDirName)
+}
+
+// ensureStateDir creates the state directory if it does not exist
+func ensureStateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create state dir '%s' failed: %w", dir, err)
+	}
+	return nil
+}
+
+// resolveStatePath resolves a relative state file path against the state directory.
+// Absolute paths and empty values are returned unchanged.
+func resolveStatePath(stateDir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(stateDir, path)
+}
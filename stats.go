@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ConflictStats accumulates conflict events across runs
+type ConflictStats struct {
+	Events []ConflictEvent `json:"events"` // Recorded conflicts, oldest first
+}
+
+// ConflictEvent represents a single squash merge conflict of a PR
+type ConflictEvent struct {
+	PR           int       `json:"pr"`            // Conflicting PR number
+	Author       string    `json:"author"`        // PR author login
+	TargetBranch string    `json:"target_branch"` // Branch the PR was merged into
+	Files        []string  `json:"files"`         // Conflicting file paths
+	BatchID      string    `json:"batch_id"`      // Run in which the conflict occurred
+	Timestamp    time.Time `json:"timestamp"`     // Conflict timestamp
+}
+
+// statsEntry is a ranked key with its conflict count
+type statsEntry struct {
+	Key   string
+	Count int
+}
+
+// loadConflictStats reads the statistics from the storage, returning empty stats if there are none yet
+func loadConflictStats(store Storage, key string) (ConflictStats, error) {
+	var stats ConflictStats
+	data, err := store.Load(key)
+	if errors.Is(err, os.ErrNotExist) {
+		return stats, nil
+	}
+	if err != nil {
+		return stats, fmt.Errorf("stats read failed: %w", err)
+	}
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return stats, fmt.Errorf("stats decoding failed: %w", err)
+	}
+	return stats, nil
+}
+
+// recordConflict appends a conflict event to the statistics file, applying the retention policy.
+// Errors are logged as warnings since statistics must not affect the merge outcome.
+func recordConflict(cfg Config, pr GitHubPR, conflict *ConflictError) {
+	store := stateStorage(cfg)
+	stats, err := loadConflictStats(store, cfg.ConflictStats)
+	if err != nil {
+		slog.Warn("failed to load conflict stats", "error", err)
+		return
+	}
+
+	stats.Events = append(stats.Events, ConflictEvent{
+		PR:           pr.Number,
+		Author:       pr.Author,
+		TargetBranch: cfg.TargetBranch,
+		Files:        conflict.Files,
+		BatchID:      cfg.BatchID,
+		Timestamp:    time.Now().UTC(),
+	})
+	policy := statsRetention{KeepRuns: cfg.StatsKeepRuns, Archive: cfg.StatsArchive, Branch: cfg.StatsArchiveBranch}
+	if _, err := compactConflictStats(cfg, &stats, policy); err != nil {
+		// Older events stay in the stats file and are archived by a later run
+		slog.Warn("failed to compact conflict stats", "error", err)
+	}
+
+	if err := writeConflictStats(store, cfg.ConflictStats, stats); err != nil {
+		slog.Warn("failed to write conflict stats", "error", err)
+	}
+}
+
+// writeConflictStats writes the statistics to the storage
+func writeConflictStats(store Storage, key string, stats ConflictStats) error {
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return fmt.Errorf("stats serialization failed: %w", err)
+	}
+	return store.Save(key, data)
+}
+
+// runStats implements the 'stats' subcommand ranking conflict-prone PRs, authors and paths
+func runStats(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	path := fs.String("conflict_stats", "", "Path of the conflict statistics file")
+	stateDir := fs.String("state_dir", defaultStateDir(), "Directory relative state paths resolve against")
+	storage := fs.String("storage", "file", "Storage of the state, as in the --storage of the runs")
+	top := fs.Int("top", 10, "Number of entries shown per ranking")
+	fs.Parse(args)
+
+	if *path == "" {
+		log.Fatal("invalid configuration:", fmt.Errorf("missing required parameter: 'conflict_stats'"))
+	}
+
+	store, err := openStorage(*storage, *stateDir)
+	if err != nil {
+		log.Fatal("invalid configuration:", fmt.Errorf("invalid parameter 'storage': %w", err))
+	}
+	stats, err := loadConflictStats(store, *path)
+	if err != nil {
+		log.Fatal("error loading conflict stats:", err)
+	}
+
+	prs := make(map[string]int)
+	authors := make(map[string]int)
+	paths := make(map[string]int)
+	for _, e := range stats.Events {
+		prs["#"+strconv.Itoa(e.PR)]++
+		if e.Author != "" {
+			authors[e.Author]++
+		}
+		for _, f := range e.Files {
+			paths[f]++
+		}
+	}
+
+	fmt.Printf("%d conflict(s) recorded in '%s'.\n", len(stats.Events), *path)
+	printRanking("Most conflicting PRs", prs, *top)
+	printRanking("Most conflicting authors", authors, *top)
+	printRanking("Most conflicting paths", paths, *top)
+}
+
+// printRanking prints the top entries of a count map, highest first
+func printRanking(title string, counts map[string]int, top int) {
+	entries := make([]statsEntry, 0, len(counts))
+	for k, c := range counts {
+		entries = append(entries, statsEntry{Key: k, Count: c})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	if len(entries) > top {
+		entries = entries[:top]
+	}
+
+	fmt.Printf("\n%s:\n", title)
+	if len(entries) == 0 {
+		fmt.Println("  (none)")
+		return
+	}
+	for i, e := range entries {
+		fmt.Printf("  %2d. %-50s %d\n", i+1, e.Key, e.Count)
+	}
+}
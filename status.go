@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// runStatus implements the 'status' subcommand: it reads the ref history of the published
+// target branch and prints the PRs it is made of, flagging those that were closed or
+// whose head moved since the build, and how far the build lags behind trunk
+func runStatus(args []string) {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	cfg := mustParseConfig(fs, args)
+	mustDetectGit(cfg)
+	cfg, _ = mustMintAppToken(cfg)
+	client := mustNewGitHubClient(cfg)
+
+	f, err := checkFreshness(cfg, freshnessLimits{})
+	if err != nil {
+		log.Fatal("error reading target branch:", err)
+	}
+	targetRef := "origin/" + cfg.TargetBranch
+	head, err := revParse(targetRef)
+	if err != nil {
+		log.Fatal("error reading target branch:", err)
+	}
+	history, err := loadRefHistoryAt(targetRef)
+	if err != nil {
+		log.Fatal("error loading history:", err)
+	}
+
+	batch := history.BatchID
+	if batch == "" {
+		batch = "unknown"
+	}
+	fmt.Printf("'%s' at %s (batch %s), built %s on %s@%s, %d trunk commit(s) behind.\n", cfg.TargetBranch,
+		shortSHA(head), batch, f.BuiltAt.Format(time.RFC3339), cfg.TrunkBranch, shortSHA(f.Trunk), f.Behind)
+	if len(history.Merges) == 0 {
+		fmt.Println("No PR merged.")
+	} else {
+		fmt.Printf("\n%d merged PR(s):\n", len(history.Merges))
+	}
+	outdated := 0
+	for i, m := range history.Merges {
+		state := ""
+		if pr, err := client.GetPR(m.PR); err != nil {
+			state = fmt.Sprintf("state unknown: %v", err)
+		} else if pr.State != "open" {
+			state, outdated = pr.State, outdated+1
+		} else if m.Head != "" && pr.HeadSHA != "" && pr.HeadSHA != m.Head {
+			state, outdated = "head moved to "+shortSHA(pr.HeadSHA), outdated+1
+		}
+		line := fmt.Sprintf("  [%d/%d] #%d", i+1, len(history.Merges), m.PR)
+		if m.Commit != "" {
+			line += "  commit " + shortSHA(m.Commit)
+		}
+		if m.Head != "" {
+			line += "  head " + shortSHA(m.Head)
+		}
+		if state != "" {
+			line += "  (" + state + ")"
+		}
+		fmt.Println(line)
+	}
+	if history.Cutoff != nil && len(history.Cutoff.Deferred) > 0 {
+		deferred := make([]string, len(history.Cutoff.Deferred))
+		for i, n := range history.Cutoff.Deferred {
+			deferred[i] = fmt.Sprintf("#%d", n)
+		}
+		fmt.Printf("\nDeferred by the run deadline: %s\n", strings.Join(deferred, ", "))
+	}
+	if outdated > 0 {
+		fmt.Printf("\n%d PR(s) changed since the build; the next run will update '%s'.\n", outdated, cfg.TargetBranch)
+	}
+}
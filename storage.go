@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Constants for the git branch storage
+const (
+	storageRef       = "refs/feature-branching/storage" // Local ref the storage branch is fetched into
+	storageCommitMsg = "chore: update state"            // Subject of storage branch commits
+	storagePushTries = 3                                // Attempts at pushing a state update racing other runs
+)
+
+// Storage persists the state and history of the runs, such as the conflict stats, the
+// eligibility cache and the notification state, under slash-separated keys
+type Storage interface {
+	// Load returns the data stored under key, an error wrapping os.ErrNotExist when there is none
+	Load(key string) ([]byte, error)
+	// Save stores data under key, replacing what was there
+	Save(key string, data []byte) error
+	// String describes the storage for the run header
+	String() string
+}
+
+// openStorage opens the storage described by --storage: 'file' keeps the state in
+// state_dir, 'git:<branch>' on a branch of origin, 's3://<bucket>/<prefix>' and
+// 'gs://<bucket>/<prefix>' in a bucket, and 'sqlite:<path>' in a SQLite database. Relative
+// database paths resolve against state_dir.
+func openStorage(spec, stateDir string) (Storage, error) {
+	scheme, location, _ := strings.Cut(spec, ":")
+	switch scheme {
+	case "", "file":
+		if location != "" {
+			return nil, fmt.Errorf("'%s' (file storage lives in state_dir)", spec)
+		}
+		return fileStorage{dir: stateDir}, nil
+	case "git":
+		if err := validateBranchName(location); err != nil {
+			return nil, fmt.Errorf("'%s': %w", spec, err)
+		}
+		return gitStorage{branch: location}, nil
+	case "s3", "gs":
+		bucket, prefix, _ := strings.Cut(strings.TrimPrefix(location, "//"), "/")
+		if !strings.HasPrefix(location, "//") || bucket == "" {
+			return nil, fmt.Errorf("'%s' (expected %s://<bucket>/<prefix>)", spec, scheme)
+		}
+		prefix = strings.Trim(prefix, "/")
+		if scheme == "gs" {
+			return gcsStorage{bucket: bucket, prefix: prefix}, nil
+		}
+		return newS3Storage(bucket, prefix)
+	case "sqlite":
+		if location == "" {
+			return nil, fmt.Errorf("'%s' (expected sqlite:<path>)", spec)
+		}
+		if _, err := exec.LookPath("sqlite3"); err != nil {
+			return nil, fmt.Errorf("'%s': SQLite storage needs the sqlite3 command", spec)
+		}
+		return sqliteStorage{path: resolveStatePath(stateDir, location)}, nil
+	}
+	return nil, fmt.Errorf("'%s' (expected file, git:<branch>, s3://<bucket>/<prefix>, gs://<bucket>/<prefix> or sqlite:<path>)", spec)
+}
+
+// stateStorage returns the storage of the run, validated by parseConfig
+func stateStorage(cfg Config) Storage {
+	store, err := openStorage(cfg.Storage, cfg.StateDir)
+	if err != nil {
+		return fileStorage{dir: cfg.StateDir}
+	}
+	if git, ok := store.(gitStorage); ok {
+		git.cfg = cfg
+		return git
+	}
+	return store
+}
+
+// isFileStorage reports whether the state is kept in files, where state paths may be absolute
+func isFileStorage(spec string) bool {
+	return spec == "" || spec == "file"
+}
+
+// validateStorageKey checks a state path configured for a storage other than files: keys
+// are relative to the storage and stay within it
+func validateStorageKey(key string) error {
+	if key == "" {
+		return nil
+	}
+	if filepath.IsAbs(key) || path.IsAbs(key) {
+		return fmt.Errorf("'%s' is absolute, but the storage is not file based", key)
+	}
+	if clean := path.Clean(filepath.ToSlash(key)); clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("'%s' is outside of the storage", key)
+	}
+	return nil
+}
+
+// fileStorage keeps the state in files of the state directory
+type fileStorage struct {
+	dir string // State directory relative keys resolve against
+}
+
+func (s fileStorage) path(key string) string {
+	return resolveStatePath(s.dir, filepath.FromSlash(key))
+}
+
+func (s fileStorage) Load(key string) ([]byte, error) {
+	return os.ReadFile(s.path(key))
+}
+
+func (s fileStorage) Save(key string, data []byte) error {
+	file := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+func (s fileStorage) String() string {
+	return "files in " + s.dir
+}
+
+// gitStorage keeps the state as files of a branch of origin, one commit per update
+type gitStorage struct {
+	branch string // Branch holding the state
+	cfg    Config // Run whose metadata trailers the commits carry, zero outside runs
+}
+
+// fetch fetches the storage branch, returning its head or empty when it does not exist yet
+func (s gitStorage) fetch() string {
+	if runOriginGit("fetch", "--quiet", "origin", "+refs/heads/"+s.branch+":"+storageRef) != nil {
+		return ""
+	}
+	head, err := revParse(storageRef)
+	if err != nil {
+		return ""
+	}
+	return head
+}
+
+func (s gitStorage) Load(key string) ([]byte, error) {
+	head := s.fetch()
+	if head == "" {
+		return nil, fmt.Errorf("branch '%s': %w", s.branch, os.ErrNotExist)
+	}
+	data, err := exec.Command("git", "cat-file", "blob", head+":"+key).Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s on branch '%s': %w", key, s.branch, os.ErrNotExist)
+	}
+	return data, nil
+}
+
+// Save commits the update on the branch head and pushes it, starting over from the new
+// head when another run pushed first
+func (s gitStorage) Save(key string, data []byte) error {
+	var err error
+	for range storagePushTries {
+		var commit string
+		commit, err = commitFiles(s.fetch(), map[string][]byte{key: data}, prCommitMessage(s.cfg, storageCommitMsg+" "+key))
+		if err != nil {
+			return err
+		}
+		if err = runOriginGit("push", "--quiet", "origin", commit+":refs/heads/"+s.branch); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (s gitStorage) String() string {
+	return "branch " + s.branch
+}
+
+// sqliteStorage keeps the state in a table of a SQLite database, through the sqlite3
+// command so the binary stays free of cgo
+type sqliteStorage struct {
+	path string // Database file
+}
+
+// sqliteSchema creates the state table on first use
+const sqliteSchema = "CREATE TABLE IF NOT EXISTS state (key TEXT PRIMARY KEY, data BLOB NOT NULL, updated_at TEXT NOT NULL);\n"
+
+// exec runs a SQL script on the database, waiting for the lock of concurrent runs
+func (s sqliteStorage) exec(script string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return "", err
+	}
+	cmd := exec.Command("sqlite3", "-bail", s.path)
+	cmd.Stdin = strings.NewReader(".timeout 10000\n" + sqliteSchema + script)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("'sqlite3 %s' failed: %s\n%s", s.path, err, truncateOutput(stderr.String()))
+	}
+	return string(output), nil
+}
+
+// sqliteQuote quotes a string literal
+func sqliteQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func (s sqliteStorage) Load(key string) ([]byte, error) {
+	output, err := s.exec("SELECT hex(data) FROM state WHERE key = " + sqliteQuote(key) + ";\n")
+	if err != nil {
+		return nil, err
+	}
+	// Empty data still selects a row, as an empty line
+	if output == "" {
+		return nil, fmt.Errorf("%s in %s: %w", key, s.path, os.ErrNotExist)
+	}
+	return hex.DecodeString(strings.TrimSpace(output))
+}
+
+func (s sqliteStorage) Save(key string, data []byte) error {
+	_, err := s.exec(fmt.Sprintf("INSERT OR REPLACE INTO state (key, data, updated_at) VALUES (%s, X'%s', %s);\n",
+		sqliteQuote(key), hex.EncodeToString(data), sqliteQuote(time.Now().UTC().Format(time.RFC3339))))
+	return err
+}
+
+func (s sqliteStorage) String() string {
+	return "SQLite database " + s.path
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/josedpiambav/feature/mergebottest"
+	"github.com/josedpiambav/feature/trailers"
+)
+
+func TestGitStorageCommitsCarryTrailers(t *testing.T) {
+	repo := mergebottest.NewRepo(t, "main")
+	for _, kv := range repo.GitEnv() {
+		name, value, _ := strings.Cut(kv, "=")
+		t.Setenv(name, value)
+	}
+	t.Chdir(repo.Clone())
+
+	store := stateStorage(Config{Storage: "git:mergebot-state", BatchID: "batch-1"})
+	if err := store.Save("stats.json", []byte("{}\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := repo.Show("mergebot-state:stats.json"); got != "{}\n" {
+		t.Errorf("stats.json = %q", got)
+	}
+	m, err := trailers.Parse(repo.Git(repo.Origin, "log", "-1", "--format=%B", "mergebot-state"))
+	if err != nil || m.BatchID != "batch-1" {
+		t.Errorf("storage commit metadata = %+v, %v, want batch batch-1", m, err)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TenantConfig holds flag defaults shared by every repository of a bot deployment
+// and per-repository overrides, keyed by "owner/repo" or a path.Match pattern such as "acme/*"
+type TenantConfig struct {
+	Defaults map[string]any            `json:"defaults"` // Flag values inherited by every repository
+	Repos    map[string]map[string]any `json:"repos"`    // Flag values overriding the defaults per repository
+}
+
+// tenantReservedFlags cannot be set from a tenant config, since they select the
+// repository and its credentials
+var tenantReservedFlags = map[string]struct{}{
+	"github_token":             {},
+	"app_id":                   {},
+	"app_installation_id":      {},
+	"app_private_key":          {},
+	"owner":                    {},
+	"repo":                     {},
+	"org":                      {},
+	"tenant_config":            {},
+	"tenant_config_sha256":     {},
+	"tenant_config_public_key": {},
+}
+
+// loadTenantConfig reads and verifies the tenant config
+func loadTenantConfig(cfg Config) (TenantConfig, error) {
+	var tc TenantConfig
+	data, err := readTenantConfig(cfg)
+	if err != nil {
+		return tc, err
+	}
+	if err := json.Unmarshal(data, &tc); err != nil {
+		return tc, fmt.Errorf("parse tenant config failed: %w", err)
+	}
+	for pattern := range tc.Repos {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return tc, fmt.Errorf("invalid repository pattern '%s': %w", pattern, err)
+		}
+	}
+	return tc, nil
+}
+
+// settingsFor merges the defaults with the overrides matching owner/repo. Patterns are
+// applied before the exact entry, less specific (shorter) patterns first.
+func (tc TenantConfig) settingsFor(owner, repo string) map[string]any {
+	name := owner + "/" + repo
+	var patterns []string
+	for pattern := range tc.Repos {
+		if ok, _ := path.Match(pattern, name); ok && pattern != name {
+			patterns = append(patterns, pattern)
+		}
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) < len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+	if _, ok := tc.Repos[name]; ok {
+		patterns = append(patterns, name)
+	}
+
+	settings := make(map[string]any, len(tc.Defaults))
+	for key, value := range tc.Defaults {
+		settings[key] = value
+	}
+	for _, pattern := range patterns {
+		for key, value := range tc.Repos[pattern] {
+			settings[key] = value
+		}
+	}
+	return settings
+}
+
+// applyTenantConfig sets the flags configured for owner/repo that were not given on the command line
+func applyTenantConfig(fs *flag.FlagSet, tc TenantConfig, owner, repo string) error {
+	explicit := make(map[string]struct{})
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = struct{}{} })
+
+	settings := tc.settingsFor(owner, repo)
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if _, ok := tenantReservedFlags[key]; ok {
+			return fmt.Errorf("parameter '%s' cannot be set by a tenant config", key)
+		}
+		if fs.Lookup(key) == nil {
+			return unknownOptionError(fs, key)
+		}
+		if _, ok := explicit[key]; ok {
+			continue
+		}
+		if err := setOption(fs, key, settings[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setOption sets a registered flag from a JSON value, validated against its schema type
+func setOption(fs *flag.FlagSet, key string, setting any) error {
+	if err := checkOptionValue(optionType(fs.Lookup(key)), setting); err != nil {
+		return fmt.Errorf("invalid parameter '%s': %w", key, err)
+	}
+	value, err := tenantFlagValue(setting)
+	if err != nil {
+		return fmt.Errorf("parameter '%s': %w", key, err)
+	}
+	if err := fs.Set(key, value); err != nil {
+		return fmt.Errorf("invalid parameter '%s': %w", key, err)
+	}
+	return nil
+}
+
+// tenantFlagValue renders a JSON value as a flag value; lists become comma separated
+func tenantFlagValue(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return "", fmt.Errorf("list items must be strings")
+			}
+			items[i] = s
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", value)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Constants for remote tenant configs
+const (
+	maxTenantConfigBytes = 1 << 20 // Largest tenant config or signature accepted
+	tenantSignatureExt   = ".sig"  // Suffix of the detached signature next to the config
+)
+
+// tenantConfigRepoPattern matches a config repository source 'owner/repo:path[@ref]'
+var tenantConfigRepoPattern = regexp.MustCompile(`^([\w.-]+)/([\w.-]+):([^@]+)(?:@(.+))?$`)
+
+// tenantSource reads a tenant config, or a file next to it when suffix is not empty
+type tenantSource func(suffix string) ([]byte, error)
+
+// readTenantConfig reads the tenant config from a local file, an http(s) URL or a file of a
+// config repository ('owner/repo:path[@ref]', read through the API with the bot token).
+// Remote configs must match an allowed checksum or carry a valid signature.
+func readTenantConfig(cfg Config) ([]byte, error) {
+	source, remote := tenantConfigSource(cfg)
+	verified := len(cfg.TenantConfigSHA256) > 0 || len(cfg.TenantConfigKeys) > 0
+	if remote && !verified {
+		return nil, fmt.Errorf("remote tenant config requires 'tenant_config_sha256' or 'tenant_config_public_key' to verify it")
+	}
+	data, err := source("")
+	if err != nil {
+		return nil, fmt.Errorf("read tenant config failed: %w", err)
+	}
+	if !verified {
+		return data, nil
+	}
+	if err := verifyTenantConfig(cfg, data, source); err != nil {
+		return nil, fmt.Errorf("verify tenant config failed: %w", err)
+	}
+	return data, nil
+}
+
+// tenantConfigSource resolves the tenant config flag into its source, reporting whether it is remote
+func tenantConfigSource(cfg Config) (tenantSource, bool) {
+	location := cfg.TenantConfig
+	switch {
+	case strings.HasPrefix(location, "https://") || strings.HasPrefix(location, "http://"):
+		return func(suffix string) ([]byte, error) {
+			return fetchTenantFile(location+suffix, nil)
+		}, true
+	case tenantConfigRepoPattern.MatchString(location):
+		m := tenantConfigRepoPattern.FindStringSubmatch(location)
+		return func(suffix string) ([]byte, error) {
+			path := cfg.APIURL + "/repos/" + m[1] + "/" + m[2] + "/contents/" + strings.TrimLeft(m[3], "/") + suffix
+			if m[4] != "" {
+				path += "?ref=" + url.QueryEscape(m[4])
+			}
+			header := http.Header{}
+			header.Set("Authorization", "token "+cfg.GithubToken)
+			header.Set("Accept", "application/vnd.github.raw")
+			return fetchTenantFile(path, header)
+		}, true
+	default:
+		return func(suffix string) ([]byte, error) {
+			return os.ReadFile(location + suffix)
+		}, false
+	}
+}
+
+// fetchTenantFile downloads a tenant config file of at most maxTenantConfigBytes
+func fetchTenantFile(location string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequest("GET", location, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned status %d", req.URL.Redacted(), resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxTenantConfigBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxTenantConfigBytes {
+		return nil, fmt.Errorf("GET %s exceeds %d bytes", req.URL.Redacted(), maxTenantConfigBytes)
+	}
+	return data, nil
+}
+
+// verifyTenantConfig accepts a config whose SHA-256 is allowed, or whose detached signature
+// ('<config>.sig', base64) verifies against one of the ed25519 public keys. Checksums pin
+// an exact revision, while signatures let the platform team publish new revisions.
+func verifyTenantConfig(cfg Config, data []byte, source tenantSource) error {
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	if slices.ContainsFunc(cfg.TenantConfigSHA256, func(allowed string) bool { return strings.EqualFold(allowed, digest) }) {
+		return nil
+	}
+	if len(cfg.TenantConfigKeys) == 0 {
+		return fmt.Errorf("checksum %s is not allowed by 'tenant_config_sha256'", digest)
+	}
+
+	encoded, err := source(tenantSignatureExt)
+	if err != nil {
+		return fmt.Errorf("read signature failed: %w", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return fmt.Errorf("decode signature failed: %w", err)
+	}
+	for _, encodedKey := range cfg.TenantConfigKeys {
+		key, err := base64.StdEncoding.DecodeString(encodedKey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return fmt.Errorf("invalid public key '%s' (expected a base64 ed25519 key)", encodedKey)
+		}
+		if ed25519.Verify(ed25519.PublicKey(key), data, signature) {
+			return nil
+		}
+	}
+	return fmt.Errorf("signature does not match any of the 'tenant_config_public_key' keys (checksum %s)", digest)
+}
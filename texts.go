@@ -0,0 +1,217 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// textTemplateExt is the file extension of text templates
+const textTemplateExt = ".tmpl"
+
+// defaultTexts holds the compiled-in templates of every bot-authored text, named after
+// their text, and their translations under texts/<locale>/; a --text_templates directory
+// overrides them with files of the same name
+//
+//go:embed texts/*.tmpl texts/*/*.tmpl
+var defaultTexts embed.FS
+
+// Data available to the text templates, as named by textTemplateData
+type (
+	// compareCommentData renders the compare link comment
+	compareCommentData struct {
+		WebURL          string        // GitHub web URL, such as https://github.com
+		Owner, Repo     string        // Repository
+		Trunk, Target   string        // Base and candidate branches
+		BatchID         string        // Run ID
+		Base, Head      string        // Trunk and candidate commit SHAs
+		CandidateBranch string        // Permanent branch of the batch, empty without --target_template
+		Merged          []MergeRecord // Merged PRs in merge order (.PR, .Commit)
+		Diff            string        // Markdown diff summary against trunk, empty when unavailable
+	}
+	// deltaCommentData renders the tracking issue comment of a batch delta
+	deltaCommentData struct {
+		WebURL        string           // GitHub web URL, such as https://github.com
+		Owner, Repo   string           // Repository
+		Trunk, Target string           // Base and candidate branches
+		BatchID       string           // Run ID
+		Entered       []MergeRecord    // PRs new to the batch (.PR, .Commit, .Head)
+		Left          []MergeRecord    // PRs dropped since the previous candidate
+		Changed       []revisionChange // PRs merged at a new head (.PR, .From, .To)
+		Diff          string           // Markdown diff summary against trunk, empty when unavailable
+	}
+	// rangeDiffData renders the tracking issue comment comparing two candidates
+	rangeDiffData struct {
+		WebURL         string           // GitHub web URL, such as https://github.com
+		Owner, Repo    string           // Repository
+		Trunk, Target  string           // Base and candidate branches
+		BatchID        string           // Run ID
+		Previous, Head string           // Previous and new candidate commit SHAs
+		Commits        []rangeDiffEntry // Commit mapping (.PR, .Status, .Old, .New, .Subject)
+		RangeDiff      string           // 'git range-diff' output, truncated to fit a comment
+	}
+	// titleSuggestionData renders the comment on PRs excluded only by their title
+	titleSuggestionData struct {
+		Target     string // Candidate branch
+		Title      string // Current PR title
+		Suggestion string // Suggested conventional title
+	}
+	// conflictPairData renders the conflict partner comment of both PRs of a pair
+	conflictPairData struct {
+		Target          string // Candidate branch
+		BatchID         string // Run ID
+		ConflictPairing        // .PR, .Author, .Partner, .PartnerAuthor, .Pairwise, .Files
+	}
+	// verifyCulpritData renders the comment on a PR excluded for failing the verification
+	verifyCulpritData struct {
+		Target  string // Candidate branch
+		BatchID string // Run ID
+		PR      int    // Culprit PR
+		Command string // Verification command
+		Output  string // Tail of the output of the failing verification
+		Alone   bool   // Whether the PR failed merged alone onto trunk, before the assembly
+		Trunk   string // Base branch of the batch
+	}
+	// batchPRData renders the title and description of the batch PR
+	batchPRData struct {
+		Owner, Repo   string         // Repository
+		Trunk, Target string         // Base and candidate branches
+		BatchID       string         // Run ID
+		Head          string         // Candidate commit SHA
+		PRs           []batchPREntry // Merged PRs in merge order (.Number, .Title, .Author, .Commit)
+		Diff          string         // Markdown diff summary against trunk, empty when unavailable
+	}
+	// batchPREntry is a merged PR of the batch PR description
+	batchPREntry struct {
+		Number        int    // PR number
+		Title, Author string // PR title and author login
+		Commit        string // Commit of the PR on the candidate
+	}
+	// previewCommentData renders the preview branch comment of a PR
+	previewCommentData struct {
+		WebURL      string // GitHub web URL, such as https://github.com
+		Owner, Repo string // Repository
+		Trunk       string // Base branch
+		Branch      string // Preview branch
+		Number      int    // PR number
+	}
+	// incidentData renders the incident issue title, body and resolution comment
+	incidentData struct {
+		Target  string // Candidate branch
+		BatchID string // Run ID
+		At      string // RFC 3339 time of the failure or resolution
+		Cause   string // Failure, empty for the title and resolution
+		RunURL  string // Workflow run, empty outside GitHub Actions
+	}
+	// approvalRequestData renders the publish plan comment of the approval issue
+	approvalRequestData struct {
+		Trunk, Target string        // Base and candidate branches
+		BatchID       string        // Run ID
+		Merged        []MergeRecord // Merged PRs in merge order (.PR, .Commit)
+		Timeout       time.Duration // Approval wait
+	}
+	// digestData renders the notification digest of the tracking issue
+	digestData struct {
+		Target string   // Candidate branch
+		Since  string   // RFC 3339 time of the previous digest
+		Events []string // Routine events, oldest first
+	}
+)
+
+// textTemplateData maps every text template name to a value of its data type, used to
+// validate the overrides against the fields they may reference
+var textTemplateData = map[string]any{
+	"compare_comment":    compareCommentData{},
+	"delta_comment":      deltaCommentData{},
+	"range_diff_comment": rangeDiffData{},
+	"title_suggestion":   titleSuggestionData{},
+	"conflict_pair":      conflictPairData{},
+	"verify_culprit":     verifyCulpritData{},
+	"batch_pr_title":     batchPRData{},
+	"batch_pr_body":      batchPRData{},
+	"preview_comment":    previewCommentData{},
+	"incident_title":     incidentData{},
+	"incident_body":      incidentData{},
+	"incident_resolved":  incidentData{},
+	"approval_request":   approvalRequestData{},
+	"digest":             digestData{},
+}
+
+// textTemplateFuncs are the functions available to text templates
+var textTemplateFuncs = template.FuncMap{"short": shortSHA}
+
+// parseTextTemplate parses a text template and checks it renders its data type
+func parseTextTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(textTemplateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(io.Discard, textTemplateData[name]); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// loadTextTemplates reads the template overrides of a --text_templates directory,
+// rejecting files that do not name a bot text
+func loadTextTemplates(dir string) (map[string]string, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*"+textTemplateExt))
+	if err != nil {
+		return nil, err
+	}
+	overrides := make(map[string]string, len(files))
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), textTemplateExt)
+		if _, ok := textTemplateData[name]; !ok {
+			names := slices.Sorted(maps.Keys(textTemplateData))
+			return nil, fmt.Errorf("unknown text template '%s' (expected one of %s)", filepath.Base(file), strings.Join(names, ", "))
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := parseTextTemplate(name, string(data)); err != nil {
+			return nil, err
+		}
+		overrides[name] = string(data)
+	}
+	return overrides, nil
+}
+
+// renderText renders a bot-authored text from its configured template, else from the
+// template of the configured locale or the default one. Trailing newlines are dropped,
+// so template files may end with one.
+func renderText(cfg Config, name string, data any) (string, error) {
+	text, ok := cfg.TextTemplates[name]
+	if !ok && cfg.Locale != "" && cfg.Locale != defaultLocale {
+		if content, err := defaultTexts.ReadFile("texts/" + cfg.Locale + "/" + name + textTemplateExt); err == nil {
+			text, ok = string(content), true
+		}
+	}
+	if !ok {
+		content, err := defaultTexts.ReadFile("texts/" + name + textTemplateExt)
+		if err != nil {
+			return "", err
+		}
+		text = string(content)
+	}
+	tmpl, err := parseTextTemplate(name, text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(b.String(), "\n"), nil
+}
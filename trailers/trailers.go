@@ -0,0 +1,102 @@
+// Package trailers reads and writes the run metadata the feature branching bot appends
+// to every commit it creates as Git trailers, so downstream tools can tell which batch,
+// PRs and PR revisions a commit of a candidate branch comes from without its
+// .ref-history file.
+//
+// A PR commit carries, in its last paragraph:
+//
+//	Batch-Id: 01J8Z3V6Q4W2N8T1K5R7M9X0YC
+//	Source-PR: #42
+//	Source-Head-SHA: 4b825dc642cb6eb9a060e54bf8d69288fbee4904
+//	Mergebot-Version: v1.4.0
+//
+// Commits squashing several PRs list a Source-PR and Source-Head-SHA pair per PR, in
+// merge order, and bookkeeping commits list none.
+package trailers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Trailer keys
+const (
+	BatchID       = "Batch-Id"         // Batch the commit was created by
+	SourcePR      = "Source-PR"        // PR the commit merges, as #N
+	SourceHeadSHA = "Source-Head-SHA"  // Revision of the PR merged, following its Source-PR
+	Version       = "Mergebot-Version" // Version of the bot that created the commit
+)
+
+// ErrNoMetadata is returned by Parse for commit messages without a Batch-Id trailer,
+// which the bot did not create
+var ErrNoMetadata = errors.New("commit message carries no " + BatchID + " trailer")
+
+// Source is a PR merged by a commit
+type Source struct {
+	PR      int    // PR number
+	HeadSHA string // PR revision merged, empty when unknown
+}
+
+// Metadata is the run metadata of a commit
+type Metadata struct {
+	BatchID string   // Batch the commit was created by
+	Sources []Source // PRs merged by the commit in merge order, none for bookkeeping commits
+	Version string   // Version of the bot, empty for commits of versions without the trailer
+}
+
+// Lines renders the metadata as trailer lines, in the order Parse reads them
+func (m Metadata) Lines() []string {
+	lines := []string{BatchID + ": " + m.BatchID}
+	for _, s := range m.Sources {
+		lines = append(lines, fmt.Sprintf("%s: #%d", SourcePR, s.PR))
+		if s.HeadSHA != "" {
+			lines = append(lines, SourceHeadSHA+": "+s.HeadSHA)
+		}
+	}
+	if m.Version != "" {
+		lines = append(lines, Version+": "+m.Version)
+	}
+	return lines
+}
+
+// Parse reads the metadata from the trailers of a commit message, its last paragraph.
+// Keys are matched case-insensitively, as Git does, and trailers of other tools are
+// ignored. A Source-Head-SHA belongs to the Source-PR right before it.
+func Parse(message string) (Metadata, error) {
+	var m Metadata
+	message = strings.TrimRight(strings.ReplaceAll(message, "\r\n", "\n"), "\n")
+	paragraph := message
+	if i := strings.LastIndex(message, "\n\n"); i >= 0 {
+		paragraph = message[i+2:]
+	}
+	for _, line := range strings.Split(paragraph, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch {
+		case strings.EqualFold(key, BatchID):
+			m.BatchID = value
+		case strings.EqualFold(key, SourcePR):
+			n, err := strconv.Atoi(strings.TrimPrefix(value, "#"))
+			if err != nil || n <= 0 {
+				return Metadata{}, fmt.Errorf("invalid %s trailer '%s' (expected #N)", SourcePR, value)
+			}
+			m.Sources = append(m.Sources, Source{PR: n})
+		case strings.EqualFold(key, SourceHeadSHA):
+			if len(m.Sources) == 0 || m.Sources[len(m.Sources)-1].HeadSHA != "" {
+				return Metadata{}, fmt.Errorf("%s trailer '%s' does not follow a %s trailer", SourceHeadSHA, value, SourcePR)
+			}
+			m.Sources[len(m.Sources)-1].HeadSHA = value
+		case strings.EqualFold(key, Version):
+			m.Version = value
+		}
+	}
+	if m.BatchID == "" {
+		return Metadata{}, ErrNoMetadata
+	}
+	return m, nil
+}
@@ -0,0 +1,108 @@
+package trailers
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	headA = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+	headB = "9daeafb9864cf43055ae93beb0afd6c7d144bfa4"
+)
+
+func TestLinesRoundTrip(t *testing.T) {
+	for _, m := range []Metadata{
+		{BatchID: "01J8Z3V6Q4W2N8T1K5R7M9X0YC", Version: "v1.4.0"},
+		{BatchID: "b1", Sources: []Source{{PR: 42, HeadSHA: headA}}, Version: "v1.4.0"},
+		{BatchID: "b1", Sources: []Source{{PR: 1, HeadSHA: headA}, {PR: 2}, {PR: 3, HeadSHA: headB}}},
+	} {
+		message := "feat: subject\n\nBody line.\n\n" + strings.Join(m.Lines(), "\n") + "\n"
+		got, err := Parse(message)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", message, err)
+		}
+		if !reflect.DeepEqual(got, m) {
+			t.Errorf("Parse(Lines(%+v)) = %+v", m, got)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		message string
+		want    Metadata
+		wantErr string
+	}{
+		{
+			name:    "keys match case-insensitively",
+			message: "fix: subject\n\nbatch-id: b1\nsource-pr: #7\nSOURCE-HEAD-SHA: " + headA + "\nmergebot-version: v2.0.0",
+			want:    Metadata{BatchID: "b1", Sources: []Source{{PR: 7, HeadSHA: headA}}, Version: "v2.0.0"},
+		},
+		{
+			name: "trailers of other tools are ignored",
+			message: "Merge 2 PR(s) into pre-main\n\n- #1 one\n- #2 two\n\nBatch-Id: b1\nSource-PR: #1\nSource-PR: #2\n" +
+				"Signed-off-by: Jane Doe <jane@example.com>\nChanged-Path: src/api\nChanged-Path: docs",
+			want: Metadata{BatchID: "b1", Sources: []Source{{PR: 1}, {PR: 2}}},
+		},
+		{
+			name:    "only the last paragraph holds trailers",
+			message: "chore: subject\n\nBatch-Id: in-the-body\n\nSigned-off-by: Jane Doe <jane@example.com>",
+			wantErr: ErrNoMetadata.Error(),
+		},
+		{
+			name:    "CRLF line endings",
+			message: "feat: subject\r\n\r\nBatch-Id: b1\r\nSource-PR: #3\r\nSource-Head-SHA: " + headB + "\r\n",
+			want:    Metadata{BatchID: "b1", Sources: []Source{{PR: 3, HeadSHA: headB}}},
+		},
+		{
+			name:    "no metadata",
+			message: "feat: written by a human\n\nSigned-off-by: Jane Doe <jane@example.com>",
+			wantErr: ErrNoMetadata.Error(),
+		},
+		{
+			name:    "head without a PR",
+			message: "feat: subject\n\nBatch-Id: b1\nSource-Head-SHA: " + headA,
+			wantErr: "does not follow a Source-PR trailer",
+		},
+		{
+			name:    "second head of a PR",
+			message: "feat: subject\n\nBatch-Id: b1\nSource-PR: #1\nSource-Head-SHA: " + headA + "\nSource-Head-SHA: " + headB,
+			wantErr: "does not follow a Source-PR trailer",
+		},
+		{
+			name:    "invalid PR",
+			message: "feat: subject\n\nBatch-Id: b1\nSource-PR: abc",
+			wantErr: "invalid Source-PR trailer 'abc'",
+		},
+		{
+			name:    "non-positive PR",
+			message: "feat: subject\n\nBatch-Id: b1\nSource-PR: #0",
+			wantErr: "invalid Source-PR trailer '#0'",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Parse(tc.message)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("Parse error = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Parse = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseNoMetadataIsSentinel(t *testing.T) {
+	if _, err := Parse("feat: subject"); !errors.Is(err, ErrNoMetadata) {
+		t.Errorf("Parse error = %v, want ErrNoMetadata", err)
+	}
+}
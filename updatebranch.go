@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// Branch update modes for PRs behind trunk
+const (
+	updateBranchAPI   = "api"   // Ask GitHub to merge trunk into the PR branch
+	updateBranchLocal = "local" // Merge trunk into the fetched PR branch locally, without pushing
+)
+
+// Polling of the PR head after an API branch update
+const (
+	updateBranchPollInterval = 2 * time.Second
+	updateBranchTimeout      = time.Minute
+)
+
+// wantsBranchUpdate reports whether a PR is selected for branch updates by its labels
+func wantsBranchUpdate(cfg Config, pr GitHubPR) bool {
+	return cfg.UpdateBranches != "" && hasAnyLabel(pr.Labels, cfg.UpdateBranchLabels)
+}
+
+// updatePRBranches asks GitHub to update every selected PR that is behind trunk
+// and waits for the new head, so the batch fetches PRs that are current with trunk.
+// Failures are logged as warnings and the PR is batched at its previous head.
+func updatePRBranches(client GitHubClient, cfg Config, prs []GitHubPR) {
+	if cfg.UpdateBranches != updateBranchAPI {
+		return
+	}
+
+	fmt.Printf("Updating PR branches behind '%s':\n", cfg.TrunkBranch)
+	for _, pr := range prs {
+		if !wantsBranchUpdate(cfg, pr) {
+			continue
+		}
+		head, err := fetchPRHead(pr)
+		if err != nil {
+			slog.Warn("failed to fetch PR", "pr_number", pr.Number, "error", err)
+			continue
+		}
+		if isAncestor(cfg.TrunkBranch, head) {
+			continue
+		}
+
+		fmt.Printf("  #%d behind '%s' ... ", pr.Number, cfg.TrunkBranch)
+		if err := client.UpdatePRBranch(pr.Number, head); err != nil {
+			fmt.Printf("FAILED\n         Reason: %s\n", firstLine(err.Error()))
+			continue
+		}
+		if updated, ok := waitForPRHead(pr, head); ok {
+			fmt.Printf("UPDATED (%s -> %s)\n", shortSHA(head), shortSHA(updated))
+		} else {
+			fmt.Printf("PENDING (still at %s after %s)\n", shortSHA(head), updateBranchTimeout)
+		}
+	}
+}
+
+// fetchPRHead fetches the current PR head without touching local branches
+func fetchPRHead(pr GitHubPR) (string, error) {
+	if err := runOriginGit("fetch", "origin", fmt.Sprintf("pull/%d/head", pr.Number)); err != nil {
+		return "", fmt.Errorf("fetch PR head failed: %w", err)
+	}
+	return revParse("FETCH_HEAD")
+}
+
+// waitForPRHead polls the PR head until it moves away from previous or the timeout expires
+func waitForPRHead(pr GitHubPR, previous string) (string, bool) {
+	deadline := time.Now().Add(updateBranchTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(updateBranchPollInterval)
+		if head, err := fetchPRHead(pr); err == nil && head != previous {
+			return head, true
+		}
+	}
+	return previous, false
+}
+
+// mergeTrunkLocally merges trunk into a fetched PR branch inside a temporary worktree
+// and returns the resulting commit. The PR's local branch is left untouched.
+func mergeTrunkLocally(pr GitHubPR, branch, trunkBranch string) (string, error) {
+	if isAncestor(trunkBranch, branch) {
+		return branch, nil
+	}
+
+	dir, err := os.MkdirTemp("", fmt.Sprintf("update-pr-%d-", pr.Number))
+	if err != nil {
+		return "", fmt.Errorf("create update worktree dir failed: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := runGitCommand("worktree", "add", "--detach", dir, branch); err != nil {
+		return "", fmt.Errorf("create update worktree failed: %w", err)
+	}
+	defer runGitCommand("worktree", "remove", "--force", dir)
+
+	if err := runGitCommand("-C", dir, "merge", "--no-edit", trunkBranch); err != nil {
+		runGitCommand("-C", dir, "merge", "--abort")
+		return "", fmt.Errorf("merge '%s' into PR branch failed: %w", trunkBranch, err)
+	}
+
+	output, err := runGitCommandWithOutput("-C", dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("resolve updated head failed: %w", err)
+	}
+	return strings.TrimSpace(output), nil
+}
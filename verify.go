@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// verifyBatch runs the verification command on the assembled target branch before it is
+// pushed. The command runs in a sandbox worktree, so it cannot alter the branch, with
+// only the directories touched by the batch checked out unless a full checkout is forced,
+// and under the hook limits.
+func verifyBatch(cfg Config, report *RunReport) error {
+	return verifyRevision(cfg, cfg.TargetBranch, "verify", report)
+}
+
+// sandboxMu serializes the setup and removal of the sandbox worktrees, which update the
+// shared repository config and worktree list, when revisions are verified concurrently
+var sandboxMu sync.Mutex
+
+// verifyRevision runs the verification command on a revision of the batch as the hook
+// named hook
+func verifyRevision(cfg Config, rev, hook string, report *RunReport) error {
+	run, err := verifyRevisionTo(cfg, rev, hook, os.Stdout, os.Stderr)
+	if run != nil {
+		report.hookRan(*run)
+		fmt.Println(run.describe() + ".")
+	}
+	return err
+}
+
+// verifyRevisionTo runs the verification command on a revision as verifyRevision does,
+// writing its progress and the command output to stdout and stderr. The hook run is nil
+// when the sandbox could not be set up.
+func verifyRevisionTo(cfg Config, rev, hook string, stdout, stderr io.Writer) (*HookRun, error) {
+	features, _ := detectGitFeatures()
+	sparse := !cfg.VerifyFullCheckout
+	if sparse && !features.SparseCheckout {
+		slog.Warn("git does not support per-worktree sparse checkouts, verifying a full checkout", "git_version", features.Version)
+		sparse = false
+	}
+
+	dir, err := os.MkdirTemp("", "feature-branching-verify-")
+	if err != nil {
+		return nil, fmt.Errorf("create sandbox failed: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	dirs, err := createSandbox(cfg, rev, dir, sparse)
+	defer func() {
+		sandboxMu.Lock()
+		defer sandboxMu.Unlock()
+		runGitCommand("worktree", "remove", "--force", dir)
+	}()
+	if err != nil {
+		return nil, err
+	}
+	if sparse {
+		fmt.Fprintf(stdout, "Verifying '%s' in a sparse checkout (%d changed directories and top-level files)...\n", revisionName(cfg, rev), len(dirs))
+	} else {
+		fmt.Fprintf(stdout, "Verifying '%s' in a full checkout...\n", revisionName(cfg, rev))
+	}
+
+	run, err := runHookTo(hook, cfg.VerifyCmd, dir, cfg.HookLimits, stdout, stderr)
+	if err != nil {
+		return &run, fmt.Errorf("'%s' failed: %w", cfg.VerifyCmd, err)
+	}
+	return &run, nil
+}
+
+// createSandbox checks rev out into the worktree dir, only the directories changed from
+// trunk when sparse, which it returns
+func createSandbox(cfg Config, rev, dir string, sparse bool) ([]string, error) {
+	sandboxMu.Lock()
+	defer sandboxMu.Unlock()
+	add := []string{"worktree", "add", "--detach", dir, rev}
+	if sparse {
+		add = []string{"worktree", "add", "--no-checkout", "--detach", dir, rev}
+	}
+	if err := runGitCommand(add...); err != nil {
+		return nil, fmt.Errorf("create sandbox failed: %w", err)
+	}
+	if !sparse {
+		return nil, nil
+	}
+	dirs, err := batchDirectories(cfg.TrunkBranch, rev)
+	if err != nil {
+		return nil, err
+	}
+	// In partial clones only the blobs of the sparse paths are downloaded
+	set := append([]string{"-C", dir, "sparse-checkout", "set", "--cone", "--"}, dirs...)
+	if err := runGitCommand(set...); err != nil {
+		return nil, fmt.Errorf("sparse checkout failed: %w", err)
+	}
+	if err := runGitCommand("-C", dir, "read-tree", "-mu", "HEAD"); err != nil {
+		return nil, fmt.Errorf("sparse checkout failed: %w", err)
+	}
+	return dirs, nil
+}
+
+// revisionName returns the branch name of a revision, its short SHA for the commits of
+// a bisection
+func revisionName(cfg Config, rev string) string {
+	if rev == cfg.TargetBranch || rev == cfg.TrunkBranch {
+		return rev
+	}
+	return shortSHA(rev)
+}
+
+// batchDirectories returns the directories containing the files changed from trunk to
+// rev, without the ones already covered by a parent entry
+func batchDirectories(trunk, rev string) ([]string, error) {
+	output, err := runGitCommandWithOutput("diff", "--name-only", "-z", "--no-renames", trunk, rev)
+	if err != nil {
+		return nil, fmt.Errorf("list changed files failed: %w", err)
+	}
+	var dirs []string
+	for _, file := range strings.Split(output, "\x00") {
+		if dir := path.Dir(file); file != "" && dir != "." {
+			dirs = append(dirs, dir)
+		}
+	}
+	slices.Sort(dirs)
+	all := slices.Compact(dirs)
+	return slices.DeleteFunc(slices.Clone(all), func(d string) bool {
+		return slices.ContainsFunc(all, func(parent string) bool { return strings.HasPrefix(d, parent+"/") })
+	}), nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+)
+
+// verifyCulpritMarker marks the culprit comments of PRs
+const verifyCulpritMarker = "<!-- feature-branching:verify-culprit -->"
+
+// VerifyBisection records the bisection of a failing verification
+type VerifyBisection struct {
+	Steps    []BisectStep `json:"steps"`              // Verifications of the bisection, in order
+	Culprits []int        `json:"culprits,omitempty"` // PRs excluded for failing the verification
+}
+
+// BisectStep is a verification of the batch merged up to a PR
+type BisectStep struct {
+	Revision string `json:"revision"`          // Commit verified
+	Through  int    `json:"through,omitempty"` // Last PR merged into the revision, 0 for trunk alone
+	PRs      int    `json:"prs"`               // PRs merged into the revision
+	Passed   bool   `json:"passed"`            // Whether the verification passed
+}
+
+// bisectBatch excludes the PRs failing the verification of the batch and republishes the rest.
+// It returns false when the rebuilt batch is not published (zero merges kept).
+func bisectBatch(client GitHubClient, cfg Config, prs []GitHubPR, merged []MergeRecord, failure error, report *RunReport) ([]GitHubPR, []MergeRecord, bool, error) {
+	fmt.Printf("\nVerification failed: %v\nBisecting %d merged PR(s) for the culprit(s)...\n", failure, len(merged))
+	bisection := &VerifyBisection{}
+	defer report.verifyBisected(bisection)
+	// The rebuilds only replay PRs already merged once, so the run deadline no longer applies
+	cfg.MaxRunDuration = 0
+
+	trunkPasses := false
+	good := 0
+	failing := lastHookOutput(report)
+	for len(merged) > 0 {
+		states, err := probeStates(cfg, merged)
+		if err != nil {
+			return prs, merged, true, fmt.Errorf("bisection failed: %w", err)
+		}
+		// Output of the failing verifications, by PRs merged
+		outputs := map[int]string{len(merged): failing}
+		verify := func(n int) bool {
+			step := BisectStep{Revision: cfg.TrunkBranch, PRs: n}
+			if n > 0 {
+				step.Revision, step.Through = states[n-1], merged[n-1].PR
+			}
+			if rev, err := revParse(step.Revision); err == nil {
+				step.Revision = rev
+			}
+			step.Passed = verifyRevision(cfg, step.Revision, "verify-bisect", report) == nil
+			if !step.Passed {
+				outputs[n] = lastHookOutput(report)
+			}
+			bisection.Steps = append(bisection.Steps, step)
+			return step.Passed
+		}
+
+		// Merged up to lo PRs the batch passes, up to hi it fails
+		lo, hi := good, len(merged)
+		for hi-lo > 1 {
+			mid := (lo + hi) / 2
+			if verify(mid) {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		if lo == 0 && !trunkPasses {
+			if !verify(0) {
+				return prs, merged, true, fmt.Errorf("the verification fails on '%s' alone, no PR of the batch is to blame", cfg.TrunkBranch)
+			}
+			trunkPasses = true
+		}
+
+		culprit := merged[hi-1].PR
+		bisection.Culprits = append(bisection.Culprits, culprit)
+		fmt.Printf("PR #%d takes the batch from passing to failing the verification; excluding it.\n", culprit)
+		var kept, rebuilt []GitHubPR
+		var culpritPR GitHubPR
+		for _, pr := range prs {
+			switch {
+			case pr.Number == culprit:
+				culpritPR = pr
+			case slices.ContainsFunc(merged, func(m MergeRecord) bool { return m.PR == pr.Number }):
+				rebuilt = append(rebuilt, pr)
+				fallthrough
+			default:
+				kept = append(kept, pr)
+			}
+		}
+		// The culprit result replaces its merge, the rebuild records the others again
+		report.reclassify(nil, append(slices.Clone(rebuilt), culpritPR))
+		report.add(culpritPR, OutcomeCulprit, fmt.Sprintf("verification '%s' fails once the PR is merged onto the PRs before it", cfg.VerifyCmd), 0)
+		notifyVerifyCulprit(client, cfg, culpritPR, outputs[hi], false)
+		prs = kept
+
+		fmt.Printf("\nRebuilding target branch '%s' without %d culprit(s)...\n", cfg.TargetBranch, len(bisection.Culprits))
+		prepareTargetBranch(cfg)
+		var ok bool
+		if merged, ok = buildBatch(client, cfg, rebuilt, report); !ok {
+			return prs, merged, false, nil
+		}
+		// The PRs before the culprit are merged again the same way
+		good = min(hi-1, len(merged))
+		if len(merged) == 0 {
+			break
+		}
+		full := BisectStep{Revision: cfg.TargetBranch, Through: merged[len(merged)-1].PR, PRs: len(merged)}
+		if rev, err := revParse(cfg.TargetBranch); err == nil {
+			full.Revision = rev
+		}
+		err = verifyBatch(cfg, report)
+		full.Passed = err == nil
+		bisection.Steps = append(bisection.Steps, full)
+		if full.Passed {
+			break
+		}
+		fmt.Printf("Verification still fails: %v\n", err)
+		failing = lastHookOutput(report)
+	}
+	fmt.Printf("Bisection done after %d verification(s), %d culprit(s) excluded.\n", len(bisection.Steps), len(bisection.Culprits))
+	report.candidateBuilt(summarizeBatchDiff(cfg))
+	return prs, merged, true, nil
+}
+
+// lastHookOutput returns the output tail of the last hook run of the report
+func lastHookOutput(report *RunReport) string {
+	if len(report.Hooks) == 0 {
+		return ""
+	}
+	return report.Hooks[len(report.Hooks)-1].Output
+}
+
+// notifyVerifyCulprit comments on a culprit PR with the output of the verification it
+// failed, merged alone onto trunk or onto the PRs before it. Errors are logged as warnings
+// since the run goes on without the PR.
+func notifyVerifyCulprit(client GitHubClient, cfg Config, pr GitHubPR, output string, alone bool) {
+	body, err := renderText(cfg, "verify_culprit", verifyCulpritData{
+		Target:  cfg.TargetBranch,
+		BatchID: cfg.BatchID,
+		PR:      pr.Number,
+		Command: cfg.VerifyCmd,
+		Output:  output,
+		Alone:   alone,
+		Trunk:   cfg.TrunkBranch,
+	})
+	if err != nil {
+		slog.Warn("failed to build culprit comment", "error", err)
+		return
+	}
+	if err := upsertComment(client, pr.Number, verifyCulpritMarker, body); err != nil {
+		slog.Warn("failed to comment on PR", "pr_number", pr.Number, "error", err)
+	}
+}